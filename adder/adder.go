@@ -167,22 +167,27 @@ func (a *Adder) FromFiles(ctx context.Context, f files.Directory) (api.Cid, erro
 				return api.CidUndef, err
 			}
 		}
-		// TODO (hector): We can only add a single CAR file for the
-		// moment.
-		if a.params.Format == "car" {
-			break
-		}
 	}
 	if it.Err() != nil {
 		return api.CidUndef, it.Err()
 	}
 
-	clusterRoot, err := a.dgs.Finalize(a.ctx, adderRoot)
-	if err != nil {
-		logger.Error("error finalizing adder:", err)
-		return api.CidUndef, err
+	// CAR imports may have resulted in several roots. Each of them is
+	// pinned separately with the same options.
+	roots := []api.Cid{adderRoot}
+	if ca, ok := dagFmtr.(*carAdder); ok && len(ca.roots) > 0 {
+		roots = ca.roots
+	}
+
+	var clusterRoot api.Cid
+	for _, root := range roots {
+		clusterRoot, err = a.dgs.Finalize(a.ctx, root)
+		if err != nil {
+			logger.Error("error finalizing adder:", err)
+			return api.CidUndef, err
+		}
+		logger.Infof("%s successfully added to cluster", clusterRoot)
 	}
-	logger.Infof("%s successfully added to cluster", clusterRoot)
 	return clusterRoot, nil
 }
 
@@ -247,16 +252,24 @@ func (ia *ipfsAdder) Add(name string, f files.Node) (api.Cid, error) {
 	return api.NewCid(nd.Cid()), nil
 }
 
-// An adder to add CAR files. It is at the moment very basic, and can
-// add a single CAR file with a single root. Ideally, it should be able to
-// add more complex, or several CARs by wrapping them with a single root.
-// But for that we would need to keep state and track an MFS root similarly to
-// what the ipfsadder does.
+// An adder to add CAR files. It can add several CAR files, each of them with
+// one or several roots. It does not wrap them in a single root: instead, it
+// keeps track of all the roots so that they can be pinned individually.
+//
+// Sharded imports result in a single cluster DAG, so they are limited to one
+// CAR file with one root. Files are streamed, which means that a second file
+// can only be rejected after the blocks of the first one have been added.
+// Clients should therefore refuse to send several files when sharding.
 type carAdder struct {
 	ctx    context.Context
 	dgs    ClusterDAGService
 	params api.AddParams
 	output chan api.AddedOutput
+
+	// number of CAR files seen so far.
+	files int
+	// roots added so far, in order and without duplicates.
+	roots []api.Cid
 }
 
 func newCarAdder(ctx context.Context, dgs ClusterDAGService, params api.AddParams, out chan api.AddedOutput) (*carAdder, error) {
@@ -269,12 +282,19 @@ func newCarAdder(ctx context.Context, dgs ClusterDAGService, params api.AddParam
 }
 
 // Add takes a node which should be a CAR file and nothing else and
-// adds its blocks using the ClusterDAGService.
+// adds its blocks using the ClusterDAGService. It emits an AddedOutput for
+// every root in the CAR and returns the last one. Bytes in the output refer
+// to the whole CAR file.
 func (ca *carAdder) Add(name string, fn files.Node) (api.Cid, error) {
 	if ca.params.Wrap {
 		return api.CidUndef, errors.New("cannot wrap a CAR file upload")
 	}
 
+	if ca.params.Shard && ca.files > 0 {
+		return api.CidUndef, errors.New("sharding is not supported when adding several CAR files")
+	}
+	ca.files++
+
 	f, ok := fn.(files.File)
 	if !ok {
 		return api.CidUndef, errors.New("expected CAR file is not of type file")
@@ -284,13 +304,18 @@ func (ca *carAdder) Add(name string, fn files.Node) (api.Cid, error) {
 		return api.CidUndef, err
 	}
 
-	if len(carReader.Header.Roots) != 1 {
-		return api.CidUndef, errors.New("only CAR files with a single root are supported")
+	roots := carReader.Header.Roots
+	if len(roots) == 0 {
+		return api.CidUndef, errors.New("CAR file has no roots")
+	}
+
+	// Fail before adding any blocks if the upload cannot be sharded.
+	if ca.params.Shard && ca.countRoots(roots) > 1 {
+		return api.CidUndef, errors.New("sharding is not supported when adding several CAR roots")
 	}
 
-	root := carReader.Header.Roots[0]
 	bytes := uint64(0)
-	size := uint64(0)
+	sizes := make(map[cid.Cid]uint64, len(roots))
 
 	for {
 		block, err := carReader.Next()
@@ -307,12 +332,15 @@ func (ca *carAdder) Add(name string, fn files.Node) (api.Cid, error) {
 			return api.CidUndef, err
 		}
 
-		// If the root is in the CAR and the root is a UnixFS
+		// If a root is in the CAR and it is a UnixFS
 		// node, then set the size in the output object.
-		if nd.Cid().Equals(root) {
+		for _, root := range roots {
+			if !nd.Cid().Equals(root) {
+				continue
+			}
 			ufs, err := unixfs.ExtractFSNode(nd)
 			if err == nil {
-				size = ufs.FileSize()
+				sizes[root] = ufs.FileSize()
 			}
 		}
 
@@ -322,13 +350,39 @@ func (ca *carAdder) Add(name string, fn files.Node) (api.Cid, error) {
 		}
 	}
 
-	ca.output <- api.AddedOutput{
-		Name:        name,
-		Cid:         api.NewCid(root),
-		Bytes:       bytes,
-		Size:        size,
-		Allocations: ca.dgs.Allocations(),
+	for _, root := range roots {
+		rootCid := api.NewCid(root)
+		ca.addRoot(rootCid)
+		ca.output <- api.AddedOutput{
+			Name:        name,
+			Cid:         rootCid,
+			Bytes:       bytes,
+			Size:        sizes[root],
+			Allocations: ca.dgs.Allocations(),
+		}
+	}
+
+	return api.NewCid(roots[len(roots)-1]), nil
+}
+
+// countRoots returns the number of different roots that there would be after
+// adding the given ones.
+func (ca *carAdder) countRoots(roots []cid.Cid) int {
+	seen := make(map[cid.Cid]struct{}, len(ca.roots)+len(roots))
+	for _, r := range ca.roots {
+		seen[r.Cid] = struct{}{}
+	}
+	for _, r := range roots {
+		seen[r] = struct{}{}
 	}
+	return len(seen)
+}
 
-	return api.NewCid(root), nil
+func (ca *carAdder) addRoot(root api.Cid) {
+	for _, r := range ca.roots {
+		if r.Equals(root) {
+			return
+		}
+	}
+	ca.roots = append(ca.roots, root)
 }
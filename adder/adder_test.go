@@ -20,6 +20,8 @@ import (
 
 type mockCDAGServ struct {
 	*test.MockDAGService
+
+	finalized []api.Cid
 }
 
 func newMockCDAGServ() *mockCDAGServ {
@@ -35,8 +37,9 @@ func newReadableMockCDAGServ() *mockCDAGServ {
 	}
 }
 
-// noop
+// noop, but keeps track of the finalized roots.
 func (dag *mockCDAGServ) Finalize(ctx context.Context, root api.Cid) (api.Cid, error) {
+	dag.finalized = append(dag.finalized, root)
 	return root, nil
 }
 
@@ -203,6 +206,128 @@ func TestAdder_CAR(t *testing.T) {
 
 }
 
+func TestAdder_CARMultiple(t *testing.T) {
+	ctx := context.Background()
+	sth := test.NewShardingTestHelper()
+	defer sth.Clean(t)
+
+	// Prepare two DAGs in the same DAGService.
+	dags := newReadableMockCDAGServ()
+	mr, closer := sth.GetTreeMultiReader(t)
+	defer closer.Close()
+	r := multipart.NewReader(mr, mr.Boundary())
+	root1, err := New(dags, api.DefaultAddParams(), nil).FromMultipart(ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := files.NewMapDirectory(map[string]files.Node{
+		"": files.NewBytesFile([]byte("second CAR contents")),
+	})
+	root2, err := New(dags, api.DefaultAddParams(), nil).FromFiles(ctx, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeCar := func(roots ...api.Cid) files.File {
+		var buf bytes.Buffer
+		var cids []cid.Cid
+		for _, r := range roots {
+			cids = append(cids, r.Cid)
+		}
+		err := car.WriteCar(ctx, dags, cids, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files.NewReaderFile(&buf)
+	}
+
+	testAdd := func(t *testing.T, carDir files.Directory) {
+		carMf := files.NewMultiFileReader(carDir, true)
+		carMr := multipart.NewReader(carMf, carMf.Boundary())
+
+		p := api.DefaultAddParams()
+		p.Format = "car"
+		out := make(chan api.AddedOutput, 10)
+		importDags := newMockCDAGServ()
+		defer importDags.Close()
+		_, err := New(importDags, p, out).FromMultipart(ctx, carMr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var outputs []api.AddedOutput
+		for o := range out {
+			outputs = append(outputs, o)
+		}
+		if len(outputs) != 2 {
+			t.Fatalf("expected one output per root. Got %d", len(outputs))
+		}
+
+		if len(importDags.finalized) != 2 ||
+			!importDags.finalized[0].Equals(root1) ||
+			!importDags.finalized[1].Equals(root2) {
+			t.Errorf("expected both roots to be finalized: %v", importDags.finalized)
+		}
+	}
+
+	t.Run("several CARs", func(t *testing.T) {
+		testAdd(t, files.NewSliceDirectory([]files.DirEntry{
+			files.FileEntry("a", writeCar(root1)),
+			files.FileEntry("b", writeCar(root2)),
+		}))
+	})
+
+	t.Run("several roots", func(t *testing.T) {
+		testAdd(t, files.NewSliceDirectory([]files.DirEntry{
+			files.FileEntry("", writeCar(root1, root2)),
+		}))
+	})
+
+	t.Run("sharded", func(t *testing.T) {
+		carDir := files.NewSliceDirectory([]files.DirEntry{
+			files.FileEntry("", writeCar(root1, root2)),
+		})
+		carMf := files.NewMultiFileReader(carDir, true)
+		carMr := multipart.NewReader(carMf, carMf.Boundary())
+
+		p := api.DefaultAddParams()
+		p.Format = "car"
+		p.Shard = true
+		importDags := newMockCDAGServ()
+		defer importDags.Close()
+		_, err := New(importDags, p, nil).FromMultipart(ctx, carMr)
+		if err == nil {
+			t.Fatal("expected an error sharding several roots")
+		}
+		if len(importDags.Nodes) > 0 {
+			t.Error("no blocks should have been added")
+		}
+	})
+
+	t.Run("sharded several CARs", func(t *testing.T) {
+		carDir := files.NewSliceDirectory([]files.DirEntry{
+			files.FileEntry("a", writeCar(root1)),
+			files.FileEntry("b", writeCar(root1)),
+		})
+		carMf := files.NewMultiFileReader(carDir, true)
+		carMr := multipart.NewReader(carMf, carMf.Boundary())
+
+		p := api.DefaultAddParams()
+		p.Format = "car"
+		p.Shard = true
+		importDags := newMockCDAGServ()
+		defer importDags.Close()
+		_, err := New(importDags, p, nil).FromMultipart(ctx, carMr)
+		if err == nil {
+			t.Fatal("expected an error sharding several CAR files")
+		}
+		if len(importDags.finalized) > 0 {
+			t.Error("nothing should have been finalized")
+		}
+	})
+}
+
 func TestAdder_LargeFolder(t *testing.T) {
 	items := 10000 // add 10000 items
 
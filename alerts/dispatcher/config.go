@@ -0,0 +1,254 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/config"
+	"github.com/kelseyhightower/envconfig"
+)
+
+const configKey = "dispatcher"
+const envConfigKey = "cluster_dispatcher"
+
+// These are the default values for a Config.
+const (
+	DefaultDedupWindow         = 5 * time.Minute
+	DefaultRateLimit           = 30
+	DefaultRateLimitInterval   = time.Minute
+	DefaultWebhookTimeout      = 10 * time.Second
+	DefaultWebhookMaxRetries   = 3
+	DefaultWebhookRetryBackoff = 2 * time.Second
+	DefaultExecTimeout         = 30 * time.Second
+)
+
+// DefaultMetrics are the metrics whose alerts are dispatched by default:
+// peers going down ("ping") and pins which fail verification ("scrub").
+// Other metrics expire all the time, i.e. when a maintenance ends.
+var DefaultMetrics = []string{"ping", "scrub"}
+
+// Config allows to initialize a Dispatcher. Every sink is enabled by
+// setting its destination: WebhookURL, FilePath or ExecCommand.
+type Config struct {
+	config.Saver
+
+	// Metrics lists the names of the metrics whose alerts are
+	// dispatched. Other alerts are dropped.
+	Metrics []string
+
+	// DedupWindow is the time during which alerts for the same metric
+	// and peer are only dispatched once. Set to 0 to dispatch all
+	// alerts.
+	DedupWindow time.Duration
+
+	// RateLimit is the maximum number of alerts dispatched every
+	// RateLimitInterval. Alerts over the limit are dropped. Set to 0 to
+	// disable rate-limiting.
+	RateLimit         int
+	RateLimitInterval time.Duration
+
+	// WebhookURL is the address to which alerts are POSTed as JSON.
+	WebhookURL string
+	// WebhookHeaders are added to every webhook request (i.e.
+	// Authorization).
+	WebhookHeaders map[string]string
+	// WebhookTimeout is the timeout for every webhook request.
+	WebhookTimeout time.Duration
+	// WebhookMaxRetries is the number of times that a failed webhook
+	// request is retried.
+	WebhookMaxRetries int
+	// WebhookRetryBackoff is the time to wait before the first retry. It
+	// doubles with every retry.
+	WebhookRetryBackoff time.Duration
+
+	// FilePath is the file to which alerts are appended, one JSON object
+	// per line.
+	FilePath string
+
+	// ExecCommand is run for every alert with ExecArgs. The alert is
+	// written to its standard input as JSON.
+	ExecCommand string
+	ExecArgs    []string
+	// ExecTimeout is the time after which the command is killed.
+	ExecTimeout time.Duration
+}
+
+type jsonConfig struct {
+	Metrics             []string          `json:"metrics"`
+	DedupWindow         string            `json:"dedup_window"`
+	RateLimit           int               `json:"rate_limit"`
+	RateLimitInterval   string            `json:"rate_limit_interval"`
+	WebhookURL          string            `json:"webhook_url"`
+	WebhookHeaders      map[string]string `json:"webhook_headers" hidden:"true"`
+	WebhookTimeout      string            `json:"webhook_timeout"`
+	WebhookMaxRetries   int               `json:"webhook_max_retries"`
+	WebhookRetryBackoff string            `json:"webhook_retry_backoff"`
+	FilePath            string            `json:"file_path"`
+	ExecCommand         string            `json:"exec_command"`
+	ExecArgs            []string          `json:"exec_args"`
+	ExecTimeout         string            `json:"exec_timeout"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values. No sinks are
+// enabled by default.
+func (cfg *Config) Default() error {
+	cfg.Metrics = append([]string{}, DefaultMetrics...)
+	cfg.DedupWindow = DefaultDedupWindow
+	cfg.RateLimit = DefaultRateLimit
+	cfg.RateLimitInterval = DefaultRateLimitInterval
+	cfg.WebhookURL = ""
+	cfg.WebhookHeaders = map[string]string{}
+	cfg.WebhookTimeout = DefaultWebhookTimeout
+	cfg.WebhookMaxRetries = DefaultWebhookMaxRetries
+	cfg.WebhookRetryBackoff = DefaultWebhookRetryBackoff
+	cfg.FilePath = ""
+	cfg.ExecCommand = ""
+	cfg.ExecArgs = []string{}
+	cfg.ExecTimeout = DefaultExecTimeout
+	return nil
+}
+
+// ApplyEnvVars fills in any Config fields found
+// as environment variables.
+func (cfg *Config) ApplyEnvVars() error {
+	jcfg := cfg.toJSONConfig()
+
+	err := envconfig.Process(envConfigKey, jcfg)
+	if err != nil {
+		return err
+	}
+
+	return cfg.applyJSONConfig(jcfg)
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if len(cfg.Metrics) == 0 {
+		return errors.New("dispatcher.metrics is empty")
+	}
+	for _, m := range cfg.Metrics {
+		if m == "" {
+			return errors.New("dispatcher.metrics contains an empty metric name")
+		}
+	}
+
+	if cfg.DedupWindow < 0 {
+		return errors.New("dispatcher.dedup_window is invalid")
+	}
+
+	if cfg.RateLimit < 0 {
+		return errors.New("dispatcher.rate_limit is invalid")
+	}
+
+	if cfg.RateLimit > 0 && cfg.RateLimitInterval <= 0 {
+		return errors.New("dispatcher.rate_limit_interval is invalid")
+	}
+
+	if cfg.WebhookURL != "" {
+		u, err := url.Parse(cfg.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("dispatcher.webhook_url is invalid")
+		}
+	}
+
+	if cfg.WebhookTimeout <= 0 {
+		return errors.New("dispatcher.webhook_timeout is invalid")
+	}
+
+	if cfg.WebhookMaxRetries < 0 {
+		return errors.New("dispatcher.webhook_max_retries is invalid")
+	}
+
+	if cfg.WebhookRetryBackoff < 0 {
+		return errors.New("dispatcher.webhook_retry_backoff is invalid")
+	}
+
+	if cfg.ExecTimeout <= 0 {
+		return errors.New("dispatcher.exec_timeout is invalid")
+	}
+
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Default()
+
+	return cfg.applyJSONConfig(jcfg)
+}
+
+func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
+	err := config.ParseDurations(
+		configKey,
+		&config.DurationOpt{Duration: jcfg.DedupWindow, Dst: &cfg.DedupWindow, Name: "dedup_window"},
+		&config.DurationOpt{Duration: jcfg.RateLimitInterval, Dst: &cfg.RateLimitInterval, Name: "rate_limit_interval"},
+		&config.DurationOpt{Duration: jcfg.WebhookTimeout, Dst: &cfg.WebhookTimeout, Name: "webhook_timeout"},
+		&config.DurationOpt{Duration: jcfg.WebhookRetryBackoff, Dst: &cfg.WebhookRetryBackoff, Name: "webhook_retry_backoff"},
+		&config.DurationOpt{Duration: jcfg.ExecTimeout, Dst: &cfg.ExecTimeout, Name: "exec_timeout"},
+	)
+	if err != nil {
+		return err
+	}
+
+	if jcfg.Metrics != nil {
+		cfg.Metrics = jcfg.Metrics
+	}
+	cfg.RateLimit = jcfg.RateLimit
+	cfg.WebhookURL = jcfg.WebhookURL
+	if jcfg.WebhookHeaders != nil {
+		cfg.WebhookHeaders = jcfg.WebhookHeaders
+	}
+	cfg.WebhookMaxRetries = jcfg.WebhookMaxRetries
+	cfg.FilePath = jcfg.FilePath
+	cfg.ExecCommand = jcfg.ExecCommand
+	if jcfg.ExecArgs != nil {
+		cfg.ExecArgs = jcfg.ExecArgs
+	}
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := cfg.toJSONConfig()
+
+	return config.DefaultJSONMarshal(jcfg)
+}
+
+func (cfg *Config) toJSONConfig() *jsonConfig {
+	return &jsonConfig{
+		Metrics:             cfg.Metrics,
+		DedupWindow:         cfg.DedupWindow.String(),
+		RateLimit:           cfg.RateLimit,
+		RateLimitInterval:   cfg.RateLimitInterval.String(),
+		WebhookURL:          cfg.WebhookURL,
+		WebhookHeaders:      cfg.WebhookHeaders,
+		WebhookTimeout:      cfg.WebhookTimeout.String(),
+		WebhookMaxRetries:   cfg.WebhookMaxRetries,
+		WebhookRetryBackoff: cfg.WebhookRetryBackoff.String(),
+		FilePath:            cfg.FilePath,
+		ExecCommand:         cfg.ExecCommand,
+		ExecArgs:            cfg.ExecArgs,
+		ExecTimeout:         cfg.ExecTimeout.String(),
+	}
+}
+
+// ToDisplayJSON returns JSON config as a string.
+func (cfg *Config) ToDisplayJSON() ([]byte, error) {
+	return config.DisplayJSON(cfg.toJSONConfig())
+}
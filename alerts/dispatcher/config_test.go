@@ -0,0 +1,156 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var cfgJSON = []byte(`
+{
+      "metrics": ["ping"],
+      "dedup_window": "1m",
+      "rate_limit": 5,
+      "rate_limit_interval": "10s",
+      "webhook_url": "http://127.0.0.1:9000/alerts",
+      "webhook_headers": {
+          "Authorization": "Bearer abc"
+      },
+      "webhook_timeout": "5s",
+      "webhook_max_retries": 2,
+      "webhook_retry_backoff": "1s",
+      "file_path": "/tmp/alerts.jsonl",
+      "exec_command": "notify-oncall",
+      "exec_args": ["--severity", "high"],
+      "exec_timeout": "20s"
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.Metrics) != 1 ||
+		cfg.DedupWindow != time.Minute ||
+		cfg.RateLimit != 5 ||
+		cfg.RateLimitInterval != 10*time.Second ||
+		cfg.WebhookHeaders["Authorization"] != "Bearer abc" ||
+		cfg.WebhookMaxRetries != 2 ||
+		cfg.FilePath != "/tmp/alerts.jsonl" ||
+		len(cfg.ExecArgs) != 2 ||
+		cfg.ExecTimeout != 20*time.Second {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.DedupWindow = "-10"
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding dedup_window")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.WebhookURL = "ftp://127.0.0.1/alerts"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding webhook_url")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.WebhookHeaders["Authorization"] != "Bearer abc" {
+		t.Error("webhook_headers should have been preserved")
+	}
+}
+
+func TestToDisplayJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	display, err := cfg.ToDisplayJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(display), "Bearer abc") {
+		t.Error("webhook_headers should be hidden")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.DedupWindow = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.RateLimitInterval = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.WebhookMaxRetries = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.ExecTimeout = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.Metrics = nil
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.Metrics = []string{""}
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
+
+func TestApplyEnvVars(t *testing.T) {
+	os.Setenv("CLUSTER_DISPATCHER_RATELIMIT", "7")
+	os.Setenv("CLUSTER_DISPATCHER_FILEPATH", "/tmp/env.jsonl")
+	defer os.Unsetenv("CLUSTER_DISPATCHER_RATELIMIT")
+	defer os.Unsetenv("CLUSTER_DISPATCHER_FILEPATH")
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ApplyEnvVars()
+
+	if cfg.RateLimit != 7 {
+		t.Fatal("failed to override rate_limit with env var")
+	}
+	if cfg.FilePath != "/tmp/env.jsonl" {
+		t.Fatal("failed to override file_path with env var")
+	}
+}
@@ -0,0 +1,213 @@
+// Package dispatcher implements an AlertDispatcher component for IPFS
+// Cluster which forwards alerts to webhooks, files and local commands so
+// that they can be consumed by external tooling.
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+
+	logging "github.com/ipfs/go-log/v2"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+
+	"go.opencensus.io/trace"
+)
+
+var logger = logging.Logger("dispatcher")
+
+// QueueSize is the number of alerts that can wait to be delivered by every
+// sink. Alerts are dropped when the queue of a sink is full.
+var QueueSize = 256
+
+// ErrShutdown is returned when dispatching alerts after Shutdown.
+var ErrShutdown = errors.New("the dispatcher has been shutdown")
+
+type alertKey struct {
+	name string
+	peer peer.ID
+}
+
+// sinkQueue holds the alerts waiting to be delivered by a sink.
+type sinkQueue struct {
+	sink  Sink
+	queue chan api.Alert
+}
+
+// Dispatcher forwards the alerts for the configured metrics to the
+// configured sinks. Every sink delivers its alerts in order, independently
+// from the others. Repeated alerts are dropped as well as those over the
+// rate limit.
+type Dispatcher struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	config  *Config
+	metrics map[string]struct{}
+	sinks   []*sinkQueue
+
+	mu          sync.Mutex
+	lastSent    map[alertKey]time.Time
+	windowStart time.Time
+	windowCount int
+
+	shutdownLock sync.Mutex
+	shutdown     bool
+	wg           sync.WaitGroup
+}
+
+// New creates a Dispatcher with the sinks enabled in the given Config.
+func New(cfg *Config) (*Dispatcher, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var sinks []Sink
+	if cfg.WebhookURL != "" {
+		sinks = append(sinks, newWebhookSink(cfg))
+	}
+	if cfg.FilePath != "" {
+		sinks = append(sinks, newFileSink(cfg))
+	}
+	if cfg.ExecCommand != "" {
+		sinks = append(sinks, newExecSink(cfg))
+	}
+	return newDispatcher(cfg, sinks), nil
+}
+
+func newDispatcher(cfg *Config, sinks []Sink) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		ctx:      ctx,
+		cancel:   cancel,
+		config:   cfg,
+		metrics:  make(map[string]struct{}, len(cfg.Metrics)),
+		lastSent: make(map[alertKey]time.Time),
+	}
+	for _, m := range cfg.Metrics {
+		d.metrics[m] = struct{}{}
+	}
+
+	for _, s := range sinks {
+		sq := &sinkQueue{
+			sink:  s,
+			queue: make(chan api.Alert, QueueSize),
+		}
+		d.sinks = append(d.sinks, sq)
+		d.wg.Add(1)
+		go d.deliver(sq)
+	}
+	return d
+}
+
+// SetClient does nothing. The Dispatcher does not use RPC.
+func (d *Dispatcher) SetClient(c *rpc.Client) {}
+
+// Shutdown stops the Dispatcher. Alerts waiting to be delivered are
+// dropped.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	_, span := trace.StartSpan(ctx, "dispatcher/Shutdown")
+	defer span.End()
+
+	d.shutdownLock.Lock()
+	defer d.shutdownLock.Unlock()
+
+	if d.shutdown {
+		logger.Debug("already shutdown")
+		return nil
+	}
+
+	logger.Info("stopping alert dispatcher")
+	d.cancel()
+	d.wg.Wait()
+	d.shutdown = true
+	return nil
+}
+
+// Dispatch queues an alert for delivery on every sink. It does not block.
+// Alerts for metrics not in Metrics, alerts for the same metric and peer
+// as an alert dispatched less than DedupWindow ago, and alerts over the
+// rate limit, are dropped.
+func (d *Dispatcher) Dispatch(ctx context.Context, alrt api.Alert) error {
+	_, span := trace.StartSpan(ctx, "dispatcher/Dispatch")
+	defer span.End()
+
+	if d.ctx.Err() != nil {
+		return ErrShutdown
+	}
+
+	if _, ok := d.metrics[alrt.Name]; !ok {
+		return nil
+	}
+
+	if len(d.sinks) == 0 || !d.admit(alrt, time.Now()) {
+		return nil
+	}
+
+	for _, sq := range d.sinks {
+		select {
+		case sq.queue <- alrt:
+		default:
+			logger.Errorf("%s: alert queue is full. Dropping %s alert for %s", sq.sink.Name(), alrt.Name, alrt.Peer)
+		}
+	}
+	return nil
+}
+
+// admit applies deduplication and rate-limiting and returns whether the
+// alert should be dispatched.
+func (d *Dispatcher) admit(alrt api.Alert, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := alertKey{name: alrt.Name, peer: alrt.Peer}
+	if window := d.config.DedupWindow; window > 0 {
+		for k, t := range d.lastSent {
+			if now.Sub(t) >= window {
+				delete(d.lastSent, k)
+			}
+		}
+		if _, ok := d.lastSent[key]; ok {
+			logger.Debugf("dropping duplicate %s alert for %s", alrt.Name, alrt.Peer)
+			return false
+		}
+	}
+
+	if limit := d.config.RateLimit; limit > 0 {
+		if now.Sub(d.windowStart) >= d.config.RateLimitInterval {
+			d.windowStart = now
+			d.windowCount = 0
+		}
+		if d.windowCount >= limit {
+			logger.Warnf("alert rate limit reached. Dropping %s alert for %s", alrt.Name, alrt.Peer)
+			return false
+		}
+		d.windowCount++
+	}
+
+	if d.config.DedupWindow > 0 {
+		d.lastSent[key] = now
+	}
+	return true
+}
+
+// deliver sends the alerts queued for a sink until shutdown.
+func (d *Dispatcher) deliver(sq *sinkQueue) {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case alrt := <-sq.queue:
+			err := sq.sink.Send(d.ctx, alrt)
+			if err != nil && d.ctx.Err() == nil {
+				logger.Errorf("%s: error delivering %s alert for %s: %s", sq.sink.Name(), alrt.Name, alrt.Peer, err)
+			}
+		}
+	}
+}
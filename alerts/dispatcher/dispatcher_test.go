@@ -0,0 +1,213 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/test"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+type mockSink struct {
+	mu     sync.Mutex
+	alerts []api.Alert
+	fail   bool
+}
+
+func (s *mockSink) Name() string {
+	return "mock"
+}
+
+func (s *mockSink) Send(ctx context.Context, alrt api.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = append(s.alerts, alrt)
+	if s.fail {
+		return errors.New("mock sink failed")
+	}
+	return nil
+}
+
+func (s *mockSink) received() []api.Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]api.Alert{}, s.alerts...)
+}
+
+func makeAlert(name string, pid peer.ID) api.Alert {
+	return api.Alert{
+		Metric: api.Metric{
+			Name:  name,
+			Peer:  pid,
+			Value: "1",
+			Valid: true,
+		},
+		TriggeredAt: time.Now(),
+	}
+}
+
+func testingDispatcher(t *testing.T, cfg *Config, sinks ...Sink) *Dispatcher {
+	t.Helper()
+	d := newDispatcher(cfg, sinks)
+	t.Cleanup(func() {
+		d.Shutdown(context.Background())
+	})
+	return d
+}
+
+func TestDispatch(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.DedupWindow = 0
+	cfg.RateLimit = 0
+
+	s1 := &mockSink{}
+	s2 := &mockSink{fail: true}
+	d := testingDispatcher(t, cfg, s1, s2)
+
+	for _, pid := range []peer.ID{test.PeerID1, test.PeerID2, test.PeerID1} {
+		err := d.Dispatch(ctx, makeAlert("ping", pid))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for _, s := range []*mockSink{s1, s2} {
+		alerts := s.received()
+		if len(alerts) != 3 {
+			t.Fatalf("expected 3 alerts, got %d", len(alerts))
+		}
+		if alerts[1].Peer != test.PeerID2 {
+			t.Error("alerts should be delivered in order")
+		}
+	}
+}
+
+func TestDispatchMetrics(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.DedupWindow = 0
+	cfg.RateLimit = 0
+	cfg.Metrics = []string{"scrub"}
+
+	s := &mockSink{}
+	d := testingDispatcher(t, cfg, s)
+
+	d.Dispatch(ctx, makeAlert("ping", test.PeerID1))
+	d.Dispatch(ctx, makeAlert("freespace", test.PeerID1))
+	d.Dispatch(ctx, makeAlert("scrub", test.PeerID1))
+	time.Sleep(100 * time.Millisecond)
+
+	alerts := s.received()
+	if len(alerts) != 1 || alerts[0].Name != "scrub" {
+		t.Fatalf("expected only the scrub alert: %v", alerts)
+	}
+}
+
+func TestDispatchDedup(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.DedupWindow = 200 * time.Millisecond
+	cfg.RateLimit = 0
+
+	s := &mockSink{}
+	d := testingDispatcher(t, cfg, s)
+
+	d.Dispatch(ctx, makeAlert("ping", test.PeerID1))
+	d.Dispatch(ctx, makeAlert("ping", test.PeerID1))
+	d.Dispatch(ctx, makeAlert("ping", test.PeerID2))
+	d.Dispatch(ctx, makeAlert("scrub", test.PeerID1))
+	time.Sleep(300 * time.Millisecond)
+	d.Dispatch(ctx, makeAlert("ping", test.PeerID1))
+	time.Sleep(100 * time.Millisecond)
+
+	alerts := s.received()
+	if len(alerts) != 4 {
+		t.Fatalf("expected 4 alerts, got %d: %v", len(alerts), alerts)
+	}
+}
+
+func TestDispatchRateLimit(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.DedupWindow = 0
+	cfg.RateLimit = 2
+	cfg.RateLimitInterval = 200 * time.Millisecond
+
+	s := &mockSink{}
+	d := testingDispatcher(t, cfg, s)
+
+	for i := 0; i < 5; i++ {
+		d.Dispatch(ctx, makeAlert("ping", test.PeerID1))
+	}
+	time.Sleep(300 * time.Millisecond)
+	d.Dispatch(ctx, makeAlert("ping", test.PeerID1))
+	time.Sleep(100 * time.Millisecond)
+
+	alerts := s.received()
+	if len(alerts) != 3 {
+		t.Fatalf("expected 3 alerts, got %d", len(alerts))
+	}
+}
+
+func TestDispatchShutdown(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+
+	d := newDispatcher(cfg, []Sink{&mockSink{}})
+	err := d.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Dispatch(ctx, makeAlert("ping", test.PeerID1))
+	if err != ErrShutdown {
+		t.Error("expected ErrShutdown")
+	}
+}
+
+func TestNew(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Shutdown(context.Background())
+	if len(d.sinks) != 0 {
+		t.Error("no sinks should be enabled by default")
+	}
+
+	cfg.WebhookURL = "http://127.0.0.1:9000"
+	cfg.FilePath = "alerts.jsonl"
+	cfg.ExecCommand = "true"
+	d2, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d2.Shutdown(context.Background())
+	if len(d2.sinks) != 3 {
+		t.Errorf("expected 3 sinks, got %d", len(d2.sinks))
+	}
+
+	cfg.ExecTimeout = 0
+	_, err = New(cfg)
+	if err == nil {
+		t.Error("expected an error with an invalid config")
+	}
+}
@@ -0,0 +1,191 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+)
+
+// Sink delivers alerts to a destination outside of the cluster peer.
+type Sink interface {
+	// Name identifies the sink in logs.
+	Name() string
+	// Send delivers a single alert. It should return once the alert
+	// has been delivered or it has failed to do so.
+	Send(context.Context, api.Alert) error
+}
+
+// webhookSink POSTs alerts as JSON to an HTTP endpoint, retrying with an
+// exponential backoff.
+type webhookSink struct {
+	url        string
+	headers    map[string]string
+	maxRetries int
+	backoff    time.Duration
+	client     *http.Client
+}
+
+func newWebhookSink(cfg *Config) *webhookSink {
+	return &webhookSink{
+		url:        cfg.WebhookURL,
+		headers:    cfg.WebhookHeaders,
+		maxRetries: cfg.WebhookMaxRetries,
+		backoff:    cfg.WebhookRetryBackoff,
+		client:     &http.Client{Timeout: cfg.WebhookTimeout},
+	}
+}
+
+func (ws *webhookSink) Name() string {
+	return "webhook"
+}
+
+func (ws *webhookSink) Send(ctx context.Context, alrt api.Alert) error {
+	body, err := json.Marshal(alrt)
+	if err != nil {
+		return err
+	}
+
+	backoff := ws.backoff
+	for i := 0; ; i++ {
+		retry, err := ws.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || i >= ws.maxRetries {
+			return err
+		}
+		logger.Debugf("webhook: %s. Retrying in %s", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes a single webhook request and returns whether it can be
+// retried when it fails.
+func (ws *webhookSink) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", ws.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range ws.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+}
+
+// fileSink appends alerts to a file, one JSON object per line. The file is
+// opened for every alert so that it can be rotated.
+type fileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newFileSink(cfg *Config) *fileSink {
+	return &fileSink{
+		path: cfg.FilePath,
+	}
+}
+
+func (fs *fileSink) Name() string {
+	return "file"
+}
+
+func (fs *fileSink) Send(ctx context.Context, alrt api.Alert) error {
+	line, err := json.Marshal(alrt)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	f, err := os.OpenFile(fs.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(line)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// execSink runs a local command for every alert. The alert is written to
+// its standard input as JSON and its main fields are set as
+// CLUSTER_ALERT_* environment variables.
+type execSink struct {
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+func newExecSink(cfg *Config) *execSink {
+	return &execSink{
+		command: cfg.ExecCommand,
+		args:    cfg.ExecArgs,
+		timeout: cfg.ExecTimeout,
+	}
+}
+
+func (es *execSink) Name() string {
+	return "exec"
+}
+
+func (es *execSink) Send(ctx context.Context, alrt api.Alert) error {
+	input, err := json.Marshal(alrt)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, es.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, es.command, es.args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(
+		os.Environ(),
+		"CLUSTER_ALERT_NAME="+alrt.Name,
+		"CLUSTER_ALERT_PEER="+alrt.Peer.String(),
+		"CLUSTER_ALERT_VALUE="+alrt.Value,
+		"CLUSTER_ALERT_TRIGGERED_AT="+strconv.FormatInt(alrt.TriggeredAt.Unix(), 10),
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", es.command, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
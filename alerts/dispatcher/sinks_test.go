@@ -0,0 +1,157 @@
+package dispatcher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/test"
+)
+
+func TestWebhookSink(t *testing.T) {
+	ctx := context.Background()
+
+	var requests int32
+	var status int32 = http.StatusServiceUnavailable
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			t.Error("expected a JSON POST")
+		}
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			t.Error("expected the configured headers")
+		}
+		var alrt api.Alert
+		err := json.NewDecoder(r.Body).Decode(&alrt)
+		if err != nil || alrt.Peer != test.PeerID1 {
+			t.Errorf("unexpected payload: %s", err)
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ts.Close()
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.WebhookURL = ts.URL
+	cfg.WebhookHeaders = map[string]string{"Authorization": "Bearer abc"}
+	cfg.WebhookMaxRetries = 2
+	cfg.WebhookRetryBackoff = 10 * time.Millisecond
+	ws := newWebhookSink(cfg)
+
+	err := ws.Send(ctx, makeAlert("ping", test.PeerID1))
+	if err == nil {
+		t.Error("expected an error when the webhook fails")
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	atomic.StoreInt32(&status, http.StatusBadRequest)
+	err = ws.Send(ctx, makeAlert("ping", test.PeerID1))
+	if err == nil {
+		t.Error("expected an error when the webhook fails")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("client errors should not be retried: %d requests", n)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	atomic.StoreInt32(&status, http.StatusAccepted)
+	err = ws.Send(ctx, makeAlert("ping", test.PeerID1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.FilePath = filepath.Join(t.TempDir(), "alerts.jsonl")
+	fs := newFileSink(cfg)
+
+	for _, name := range []string{"ping", "freespace"} {
+		err := fs.Send(ctx, makeAlert(name, test.PeerID1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(cfg.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var alrt api.Alert
+		err := json.Unmarshal(scanner.Bytes(), &alrt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, alrt.Name)
+	}
+	if strings.Join(names, ",") != "ping,freespace" {
+		t.Errorf("unexpected alerts in file: %v", names)
+	}
+}
+
+func TestExecSink(t *testing.T) {
+	ctx := context.Background()
+	out := filepath.Join(t.TempDir(), "out")
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ExecCommand = "sh"
+	cfg.ExecArgs = []string{"-c", `echo "$CLUSTER_ALERT_NAME $CLUSTER_ALERT_PEER" > ` + out + `; cat >> ` + out}
+	es := newExecSink(cfg)
+
+	err := es.Send(ctx, makeAlert("ping", test.PeerID1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(data), "\n", 2)
+	if lines[0] != "ping "+test.PeerID1.String() {
+		t.Errorf("unexpected environment: %s", lines[0])
+	}
+	var alrt api.Alert
+	err = json.Unmarshal([]byte(lines[1]), &alrt)
+	if err != nil || alrt.Name != "ping" {
+		t.Errorf("unexpected input: %s", lines[1])
+	}
+
+	cfg.ExecArgs = []string{"-c", "exit 3"}
+	err = newExecSink(cfg).Send(ctx, makeAlert("ping", test.PeerID1))
+	if err == nil {
+		t.Error("expected an error when the command fails")
+	}
+
+	cfg.ExecArgs = []string{"-c", "exec sleep 5"}
+	cfg.ExecTimeout = 100 * time.Millisecond
+	start := time.Now()
+	err = newExecSink(cfg).Send(ctx, makeAlert("ping", test.PeerID1))
+	if err == nil || time.Since(start) > 2*time.Second {
+		t.Error("expected the command to be killed after the timeout")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	peer "github.com/libp2p/go-libp2p-core/peer"
 
@@ -46,6 +48,20 @@ type classifiedMetrics struct {
 	candidatePeers []peer.ID
 	priority       api.MetricsSet
 	priorityPeers  []peer.ID
+	// peers left out and the reason why.
+	excluded map[peer.ID]string
+}
+
+// allocationDetails records the intermediate steps of an allocation so
+// that they can be explained in allocation previews.
+type allocationDetails struct {
+	metrics       api.MetricsSet
+	currentAllocs []peer.ID
+	classified    classifiedMetrics
+	// peers in the order given by the allocator, when it was called.
+	ranked []peer.ID
+	// why the allocator was not called, if it was not.
+	skipped string
 }
 
 // allocate finds peers to allocate a hash using the informer and the monitor
@@ -56,16 +72,29 @@ type classifiedMetrics struct {
 // into account if the given CID was previously in a "pin everywhere" mode,
 // and will consider such Pins as currently unallocated ones, providing
 // new allocations as available.
-func (c *Cluster) allocate(ctx context.Context, hash api.Cid, currentPin api.Pin, rplMin, rplMax int, blacklist []peer.ID, priorityList []peer.ID) ([]peer.ID, error) {
+func (c *Cluster) allocate(ctx context.Context, pin api.Pin, currentPin api.Pin, blacklist []peer.ID, priorityList []peer.ID) ([]peer.ID, error) {
+	allocs, _, err := c.allocateWithDetails(ctx, pin, currentPin, blacklist, priorityList)
+	return allocs, err
+}
+
+// allocateWithDetails works like allocate and additionally returns the
+// details of the allocation process.
+func (c *Cluster) allocateWithDetails(ctx context.Context, pin api.Pin, currentPin api.Pin, blacklist []peer.ID, priorityList []peer.ID) ([]peer.ID, *allocationDetails, error) {
 	ctx, span := trace.StartSpan(ctx, "cluster/allocate")
 	defer span.End()
 
+	details := &allocationDetails{}
+
+	rplMin := pin.ReplicationFactorMin
+	rplMax := pin.ReplicationFactorMax
+
 	if (rplMin + rplMax) == 0 {
-		return nil, fmt.Errorf("bad replication factors: %d/%d", rplMin, rplMax)
+		return nil, details, fmt.Errorf("bad replication factors: %d/%d", rplMin, rplMax)
 	}
 
 	if rplMin < 0 && rplMax < 0 { // allocate everywhere
-		return []peer.ID{}, nil
+		details.skipped = "the pin is allocated everywhere"
+		return []peer.ID{}, details, nil
 	}
 
 	// Figure out who is holding the CID
@@ -74,33 +103,19 @@ func (c *Cluster) allocate(ctx context.Context, hash api.Cid, currentPin api.Pin
 		currentAllocs = currentPin.Allocations
 	}
 
-	// Get Metrics that the allocator is interested on
-	mSet := make(api.MetricsSet)
-	metrics := c.allocator.Metrics()
-	for _, metricName := range metrics {
-		mSet[metricName] = c.monitor.LatestMetrics(ctx, metricName)
-	}
+	mSet, classified := c.classifyMetrics(ctx, pin, currentAllocs, blacklist, priorityList)
 
-	// Filter and divide metrics.  The resulting sets only have peers that
-	// have all the metrics needed and are not blacklisted.
-	classified := c.filterMetrics(
-		ctx,
-		mSet,
-		len(metrics),
-		currentAllocs,
-		priorityList,
-		blacklist,
-	)
+	details.metrics = mSet
+	details.currentAllocs = currentAllocs
+	details.classified = classified
 
 	newAllocs, err := c.obtainAllocations(
 		ctx,
-		hash,
-		rplMin,
-		rplMax,
-		classified,
+		pin,
+		details,
 	)
 	if err != nil {
-		return newAllocs, err
+		return newAllocs, details, err
 	}
 
 	// if current allocations are above the minimal threshold,
@@ -110,7 +125,45 @@ func (c *Cluster) allocate(ctx context.Context, hash api.Cid, currentPin api.Pin
 	if newAllocs == nil {
 		newAllocs = currentAllocs
 	}
-	return newAllocs, nil
+	return newAllocs, details, nil
+}
+
+// classifyMetrics obtains the metrics that the allocator is interested
+// on, along with those needed by the placement constraints of the pin,
+// and divides them with filterMetrics.
+func (c *Cluster) classifyMetrics(ctx context.Context, pin api.Pin, currentAllocs, blacklist, priorityList []peer.ID) (api.MetricsSet, classifiedMetrics) {
+	mSet := make(api.MetricsSet)
+	metrics := append([]string{}, c.allocator.Metrics()...)
+	for _, metricName := range pin.PlacementMetrics() {
+		if !containsString(metrics, metricName) {
+			metrics = append(metrics, metricName)
+		}
+	}
+	for _, metricName := range metrics {
+		mSet[metricName] = c.monitor.LatestMetrics(ctx, metricName)
+	}
+
+	// Peers which failed to pin this item before are not tried again.
+	unallocatable := c.unallocatablePeers(ctx)
+	for _, pid := range pin.FailedAllocations {
+		if _, ok := unallocatable[pid]; !ok {
+			unallocatable[pid] = "failed to pin it before"
+		}
+	}
+
+	// Filter and divide metrics.  The resulting sets only have peers that
+	// have all the metrics needed, are not blacklisted and can take new
+	// allocations.
+	classified := c.filterMetrics(
+		ctx,
+		mSet,
+		len(metrics),
+		currentAllocs,
+		priorityList,
+		blacklist,
+		unallocatable,
+	)
+	return mSet, classified
 }
 
 // Given metrics from all informers, split them into 3 MetricsSet:
@@ -119,14 +172,16 @@ func (c *Cluster) allocate(ctx context.Context, hash api.Cid, currentPin api.Pin
 // - Those corresponding to "candidate" allocations
 // And return also an slice of the peers in those groups.
 //
-// Peers from untrusted peers are left out if configured.
+// Peers from untrusted peers are left out if configured, as well as the
+// unallocatable ones, which map to the reason why.
 //
 // For a metric/peer to be included in a group, it is necessary that it has
 // metrics for all informers.
-func (c *Cluster) filterMetrics(ctx context.Context, mSet api.MetricsSet, numMetrics int, currentAllocs, priorityList, blacklist []peer.ID) classifiedMetrics {
+func (c *Cluster) filterMetrics(ctx context.Context, mSet api.MetricsSet, numMetrics int, currentAllocs, priorityList, blacklist []peer.ID, unallocatable map[peer.ID]string) classifiedMetrics {
 	curPeersMap := make(map[peer.ID][]api.Metric)
 	candPeersMap := make(map[peer.ID][]api.Metric)
 	prioPeersMap := make(map[peer.ID][]api.Metric)
+	excluded := make(map[peer.ID]string)
 
 	// Divide the metric by current/candidate/prio and by peer
 	for _, metrics := range mSet {
@@ -134,10 +189,17 @@ func (c *Cluster) filterMetrics(ctx context.Context, mSet api.MetricsSet, numMet
 			switch {
 			case containsPeer(blacklist, m.Peer):
 				// discard blacklisted peers
+				excluded[m.Peer] = "blacklisted"
+				continue
+			case unallocatable[m.Peer] != "":
+				// discard peers which should not get
+				// allocations, i.e. those being drained.
+				excluded[m.Peer] = unallocatable[m.Peer]
 				continue
 			case c.config.PinOnlyOnTrustedPeers && !c.consensus.IsTrustedPeer(ctx, m.Peer):
 				// discard peer that are not trusted when
 				// configured.
+				excluded[m.Peer] = "not a trusted peer"
 				continue
 			case containsPeer(currentAllocs, m.Peer):
 				curPeersMap[m.Peer] = append(curPeersMap[m.Peer], m)
@@ -149,6 +211,12 @@ func (c *Cluster) filterMetrics(ctx context.Context, mSet api.MetricsSet, numMet
 		}
 	}
 
+	names := make([]string, 0, len(mSet))
+	for name := range mSet {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	fillMetricsSet := func(peersMap map[peer.ID][]api.Metric) (api.MetricsSet, []peer.ID) {
 		mSet := make(api.MetricsSet)
 		peers := make([]peer.ID, 0, len(peersMap))
@@ -164,7 +232,9 @@ func (c *Cluster) filterMetrics(ctx context.Context, mSet api.MetricsSet, numMet
 					mSet[m.Name] = append(mSet[m.Name], m)
 				}
 				peers = append(peers, p)
-			} // otherwise this peer will be ignored.
+			} else { // otherwise this peer will be ignored.
+				excluded[p] = "missing metrics: " + strings.Join(missingMetrics(names, metrics), ",")
+			}
 		}
 		return mSet, peers
 	}
@@ -180,9 +250,28 @@ func (c *Cluster) filterMetrics(ctx context.Context, mSet api.MetricsSet, numMet
 		candidatePeers: candPeers,
 		priority:       prioSet,
 		priorityPeers:  prioPeers,
+		excluded:       excluded,
 	}
 }
 
+// missingMetrics returns the names that are not among the given metrics.
+func missingMetrics(names []string, metrics []api.Metric) []string {
+	var missing []string
+	for _, name := range names {
+		found := false
+		for _, m := range metrics {
+			if m.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
 // allocationError logs an allocation error
 func allocationError(hash api.Cid, needed, wanted int, candidatesValid []peer.ID) error {
 	logger.Errorf("Not enough candidates to allocate %s:", hash)
@@ -202,13 +291,17 @@ func allocationError(hash api.Cid, needed, wanted int, candidatesValid []peer.ID
 
 func (c *Cluster) obtainAllocations(
 	ctx context.Context,
-	hash api.Cid,
-	rplMin, rplMax int,
-	metrics classifiedMetrics,
+	pin api.Pin,
+	details *allocationDetails,
 ) ([]peer.ID, error) {
 	ctx, span := trace.StartSpan(ctx, "cluster/obtainAllocations")
 	defer span.End()
 
+	metrics := details.classified
+	hash := pin.Cid
+	rplMin := pin.ReplicationFactorMin
+	rplMax := pin.ReplicationFactorMax
+
 	nCurrentValid := len(metrics.currentPeers)
 	nAvailableValid := len(metrics.candidatePeers) + len(metrics.priorityPeers)
 	needed := rplMin - nCurrentValid // The minimum we need
@@ -227,15 +320,18 @@ func (c *Cluster) obtainAllocations(
 		// This could be done more intelligently by dropping them
 		// according to the allocator order (i.e. free-ing peers
 		// with most used space first).
+		details.skipped = "current allocations exceed the maximum replication factor"
 		return metrics.currentPeers[0 : len(metrics.currentPeers)+wanted], nil
 	}
 
 	if needed <= 0 { // allocations are above minimal threshold
 		// We don't provide any new allocations
+		details.skipped = "current allocations reach the minimum replication factor"
 		return nil, nil
 	}
 
 	if nAvailableValid < needed { // not enough candidates
+		details.skipped = "not enough candidates"
 		return nil, allocationError(hash, needed, wanted, append(metrics.priorityPeers, metrics.candidatePeers...))
 	}
 
@@ -245,7 +341,7 @@ func (c *Cluster) obtainAllocations(
 	// the allocator returns a list of peers ordered by priority
 	finalAllocs, err := c.allocator.Allocate(
 		ctx,
-		hash,
+		pin,
 		metrics.current,
 		metrics.candidate,
 		metrics.priority,
@@ -253,6 +349,7 @@ func (c *Cluster) obtainAllocations(
 	if err != nil {
 		return nil, logError(err.Error())
 	}
+	details.ranked = finalAllocs
 
 	logger.Debugf("obtainAllocations: allocate(): %s", finalAllocs)
 
@@ -268,3 +365,111 @@ func (c *Cluster) obtainAllocations(
 	// along with the ones provided by the allocator
 	return append(metrics.currentPeers, finalAllocs[0:allocationsToUse]...), nil
 }
+
+// report explains how every peer was considered during the allocation,
+// given the resulting allocations and the metrics used by the allocator.
+// Chosen peers come first, in allocation order.
+func (d *allocationDetails) report(allocs []peer.ID, allocatorMetrics []string) []api.AllocationPeerReport {
+	byPeer := make(map[peer.ID][]api.Metric)
+	for _, metrics := range d.metrics {
+		for _, m := range metrics {
+			byPeer[m.Peer] = append(byPeer[m.Peer], m)
+		}
+	}
+	// current allocations may not have valid metrics at all.
+	for _, p := range d.currentAllocs {
+		if _, ok := byPeer[p]; !ok {
+			byPeer[p] = nil
+		}
+	}
+
+	rank := make(map[peer.ID]int, len(d.ranked))
+	for i, p := range d.ranked {
+		rank[p] = i + 1
+	}
+
+	reports := make([]api.AllocationPeerReport, 0, len(byPeer))
+	for p, metrics := range byPeer {
+		sort.Slice(metrics, func(i, j int) bool {
+			return metrics[i].Name < metrics[j].Name
+		})
+
+		var partition []string
+		for _, name := range allocatorMetrics {
+			for _, m := range metrics {
+				if m.Name == name && m.Partitionable {
+					partition = append(partition, name+"="+m.Value)
+				}
+			}
+		}
+
+		r := api.AllocationPeerReport{
+			Peer:      p,
+			Partition: strings.Join(partition, "/"),
+			Rank:      rank[p],
+			Chosen:    containsPeer(allocs, p),
+			Metrics:   metrics,
+		}
+
+		switch {
+		case containsPeer(d.classified.currentPeers, p):
+			r.Group = api.AllocationGroupCurrent
+			if r.Chosen {
+				r.Reason = "already allocated"
+			} else {
+				r.Reason = "dropped: " + d.skipped
+			}
+		case containsPeer(d.classified.priorityPeers, p):
+			r.Group = api.AllocationGroupPriority
+		case containsPeer(d.classified.candidatePeers, p):
+			r.Group = api.AllocationGroupCandidate
+		default:
+			r.Group = api.AllocationGroupExcluded
+			r.Reason = d.classified.excluded[p]
+			if r.Reason == "" {
+				r.Reason = "no valid metrics"
+			}
+			if r.Chosen {
+				r.Reason += " (kept as a current allocation)"
+			}
+		}
+
+		if r.Reason == "" {
+			switch {
+			case r.Chosen:
+				r.Reason = fmt.Sprintf("chosen by the allocator with rank %d", r.Rank)
+			case r.Rank > 0:
+				r.Reason = "enough peers with a better rank were chosen"
+			case d.skipped != "":
+				r.Reason = "not allocated: " + d.skipped
+			default:
+				r.Reason = "left out by the allocator"
+			}
+		}
+		reports = append(reports, r)
+	}
+
+	pos := make(map[peer.ID]int, len(allocs))
+	for i, p := range allocs {
+		pos[p] = i
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		ri, rj := reports[i], reports[j]
+		pi, iok := pos[ri.Peer]
+		pj, jok := pos[rj.Peer]
+		if iok != jok {
+			return iok
+		}
+		if iok {
+			return pi < pj
+		}
+		if (ri.Rank > 0) != (rj.Rank > 0) {
+			return ri.Rank > 0
+		}
+		if ri.Rank != rj.Rank {
+			return ri.Rank < rj.Rank
+		}
+		return ri.Peer < rj.Peer
+	})
+	return reports
+}
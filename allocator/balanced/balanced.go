@@ -271,9 +271,12 @@ func (pnedm *partitionedMetric) chooseNext() peer.ID {
 //   - It repeats the process until there is no more buckets to sort.
 //   - Finally, it returns the first peer of the first
 //   - Third, based on the AllocateBy order, it select the first metric
+//
+// The resulting list is adjusted to the placement constraints of the pin
+// (see api.PinOptions.ApplyPlacement).
 func (a *Allocator) Allocate(
 	ctx context.Context,
-	c api.Cid,
+	pin api.Pin,
 	current, candidates, priority api.MetricsSet,
 ) ([]peer.ID, error) {
 
@@ -295,7 +298,7 @@ func (a *Allocator) Allocate(
 	first := priorityPartition.sortedPeers()
 	last := candidatePartition.sortedPeers()
 
-	return append(first, last...), nil
+	return pin.ApplyPlacement(append(first, last...), current, candidates, priority)
 }
 
 // Metrics returns the names of the metrics that have been registered
@@ -104,7 +104,7 @@ func TestAllocate(t *testing.T) {
 	// - b-eu->eu1->pid3 (only peer left)
 
 	peers, err := alloc.Allocate(context.Background(),
-		test.Cid1,
+		api.PinCid(test.Cid1),
 		nil,
 		candidates,
 		nil,
@@ -153,3 +153,45 @@ func TestAllocate(t *testing.T) {
 		}
 	}
 }
+
+func TestAllocatePlacement(t *testing.T) {
+	alloc, err := New(&Config{
+		AllocateBy: []string{"freespace"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	candidates := api.MetricsSet{
+		"tag:rack": []api.Metric{
+			makeMetric("tag:rack", "r1", 0, test.PeerID1, true),
+			makeMetric("tag:rack", "r1", 0, test.PeerID2, true),
+			makeMetric("tag:rack", "r2", 0, test.PeerID3, true),
+		},
+		"freespace": []api.Metric{
+			makeMetric("freespace", "100", 100, test.PeerID1, false),
+			makeMetric("freespace", "500", 500, test.PeerID2, false),
+			makeMetric("freespace", "200", 200, test.PeerID3, false),
+		},
+	}
+
+	pin := api.PinCid(test.Cid1)
+	pin.ReplicationFactorMin = 2
+	pin.ReplicationFactorMax = 2
+	pin.AntiAffinity = []string{"tag:rack"}
+
+	peers, err := alloc.Allocate(context.Background(), pin, nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 || peers[0] != test.PeerID2 || peers[1] != test.PeerID3 {
+		t.Errorf("unexpected allocations: %s", peers)
+	}
+
+	pin.ReplicationFactorMin = 3
+	pin.ReplicationFactorMax = 3
+	_, err = alloc.Allocate(context.Background(), pin, nil, candidates, nil)
+	if err == nil {
+		t.Error("expected an error when anti-affinity cannot be satisfied")
+	}
+}
@@ -0,0 +1,120 @@
+package fillfirst
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/lubanproj/ipfs-cluster/config"
+	"github.com/kelseyhightower/envconfig"
+)
+
+const configKey = "fillfirst"
+const envConfigKey = "cluster_fillfirst"
+
+// freeSpaceMetric is the name of the metric produced by the disk informer
+// with the "freespace" metric type, whose weight is the free space in
+// bytes.
+const freeSpaceMetric = "freespace"
+
+// These are the default values for a Config.
+var (
+	DefaultMetric       = freeSpaceMetric
+	DefaultMinFreeSpace = uint64(10 << 30) // 10 GiB
+)
+
+// Config allows to initialize the Allocator.
+type Config struct {
+	config.Saver
+
+	// Metric is the name of the metric used to sort peers. Peers with
+	// the lowest weight (the least free space) are chosen first.
+	Metric string
+	// MinFreeSpace is the amount of bytes that peers keep free: peers
+	// with less free space are not chosen anymore. It can only be set
+	// when the metric is "freespace".
+	MinFreeSpace uint64
+}
+
+type jsonConfig struct {
+	Metric       string `json:"metric"`
+	MinFreeSpace uint64 `json:"min_free_space"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.Metric = DefaultMetric
+	cfg.MinFreeSpace = DefaultMinFreeSpace
+	return nil
+}
+
+// ApplyEnvVars fills in any Config fields found
+// as environment variables.
+func (cfg *Config) ApplyEnvVars() error {
+	jcfg := cfg.toJSONConfig()
+
+	err := envconfig.Process(envConfigKey, jcfg)
+	if err != nil {
+		return err
+	}
+
+	return cfg.applyJSONConfig(jcfg)
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if cfg.Metric == "" {
+		return errors.New("fillfirst.metric is invalid")
+	}
+
+	if cfg.MinFreeSpace > 0 && cfg.Metric != freeSpaceMetric {
+		return errors.New("fillfirst.min_free_space can only be set with the freespace metric")
+	}
+
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Default()
+
+	return cfg.applyJSONConfig(jcfg)
+}
+
+func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
+	config.SetIfNotDefault(jcfg.Metric, &cfg.Metric)
+	cfg.MinFreeSpace = jcfg.MinFreeSpace
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := cfg.toJSONConfig()
+
+	return config.DefaultJSONMarshal(jcfg)
+}
+
+func (cfg *Config) toJSONConfig() *jsonConfig {
+	return &jsonConfig{
+		Metric:       cfg.Metric,
+		MinFreeSpace: cfg.MinFreeSpace,
+	}
+}
+
+// ToDisplayJSON returns JSON config as a string.
+func (cfg *Config) ToDisplayJSON() ([]byte, error) {
+	return config.DisplayJSON(cfg.toJSONConfig())
+}
@@ -0,0 +1,78 @@
+package fillfirst
+
+import (
+	"os"
+	"testing"
+)
+
+var cfgJSON = []byte(`
+{
+      "metric": "freespace",
+      "min_free_space": 1024
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Metric != "freespace" || cfg.MinFreeSpace != 1024 {
+		t.Error("configuration not loaded")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Metric != "freespace" || cfg.MinFreeSpace != 1024 {
+		t.Error("configuration was lost in serialization/deserialization")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.Metric = ""
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Metric = "numpin"
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating min_free_space with another metric")
+	}
+	cfg.MinFreeSpace = 0
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+}
+
+func TestApplyEnvVars(t *testing.T) {
+	os.Setenv("CLUSTER_FILLFIRST_METRIC", "tag:group")
+	os.Setenv("CLUSTER_FILLFIRST_MINFREESPACE", "0")
+	cfg := &Config{}
+	cfg.Default()
+	err := cfg.ApplyEnvVars()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Metric != "tag:group" {
+		t.Fatal("failed to override metric with env var")
+	}
+}
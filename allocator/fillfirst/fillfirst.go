@@ -0,0 +1,104 @@
+// Package fillfirst implements a bin-packing allocator which concentrates
+// data in as few peers as possible.
+//
+// Peers are sorted by the weight of a metric in ascending order, so that
+// with the "freespace" metric, the fullest peers that still have more than
+// a minimum amount of free space are chosen first. This keeps the rest of
+// the peers idle, so that they can be powered down until they are needed.
+//
+// The peers which already hold a pin (current) are taken into account by
+// the placement constraints only: they keep their replicas regardless of
+// how full they are.
+package fillfirst
+
+import (
+	"context"
+	"sort"
+
+	api "github.com/lubanproj/ipfs-cluster/api"
+	logging "github.com/ipfs/go-log/v2"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+)
+
+var logger = logging.Logger("allocator")
+
+// Allocator is an allocator that fills peers one after another.
+type Allocator struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// New returns an initialized Allocator.
+func New(cfg *Config) (*Allocator, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Allocator{
+		config: cfg,
+	}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (a *Allocator) SetClient(c *rpc.Client) {
+	a.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (a *Allocator) Shutdown(ctx context.Context) error {
+	a.rpcClient = nil
+	return nil
+}
+
+// Allocate returns the priority peers followed by the candidate peers,
+// each group sorted by ascending weight. With the "freespace" metric, peers
+// with less than MinFreeSpace are left out, as well as those that would
+// break the pin placement constraints.
+func (a *Allocator) Allocate(
+	ctx context.Context,
+	pin api.Pin,
+	current, candidates, priority api.MetricsSet,
+) ([]peer.ID, error) {
+	first := a.sort(priority[a.config.Metric])
+	last := a.sort(candidates[a.config.Metric])
+	return pin.ApplyPlacement(append(first, last...), current, candidates, priority)
+}
+
+func (a *Allocator) sort(metrics []api.Metric) []peer.ID {
+	var eligible []api.Metric
+	for _, m := range metrics {
+		w := m.GetWeight()
+		if a.config.Metric == freeSpaceMetric && (w < 0 || uint64(w) < a.config.MinFreeSpace) {
+			logger.Debugf("fillfirst: %s is below the minimum free space", m.Peer)
+			continue
+		}
+		eligible = append(eligible, m)
+	}
+
+	// Ties are broken by peer ID so that the same peers keep being
+	// filled.
+	sort.Slice(eligible, func(i, j int) bool {
+		wi := eligible[i].GetWeight()
+		wj := eligible[j].GetWeight()
+		if wi == wj {
+			return eligible[i].Peer < eligible[j].Peer
+		}
+		return wi < wj
+	})
+
+	peers := make([]peer.ID, len(eligible))
+	for i, m := range eligible {
+		peers[i] = m.Peer
+	}
+	return peers
+}
+
+// Metrics returns the names of the metrics that have been registered
+// with this allocator.
+func (a *Allocator) Metrics() []string {
+	return []string{a.config.Metric}
+}
@@ -0,0 +1,91 @@
+package fillfirst
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/test"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func makeMetric(name string, weight int64, peer peer.ID) api.Metric {
+	return api.Metric{
+		Name:   name,
+		Weight: weight,
+		Peer:   peer,
+		Valid:  true,
+		Expire: time.Now().Add(time.Minute).UnixNano(),
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	alloc, err := New(&Config{
+		Metric:       "freespace",
+		MinFreeSpace: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	candidates := api.MetricsSet{
+		"freespace": []api.Metric{
+			makeMetric("freespace", 5000, test.PeerID1),
+			makeMetric("freespace", 200, test.PeerID2),
+			makeMetric("freespace", 99, test.PeerID3), // too full
+			makeMetric("freespace", 1000, test.PeerID4),
+			makeMetric("freespace", 200, test.PeerID5),
+		},
+	}
+	priority := api.MetricsSet{
+		"freespace": []api.Metric{
+			makeMetric("freespace", 10000, test.PeerID6),
+			makeMetric("freespace", 10, test.PeerID7), // too full
+		},
+	}
+
+	peers, err := alloc.Allocate(context.Background(), api.PinCid(test.Cid1), nil, candidates, priority)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// PeerID2 and PeerID5 have the same weight and are sorted by ID.
+	second, third := test.PeerID2, test.PeerID5
+	if third < second {
+		second, third = third, second
+	}
+	expected := []peer.ID{test.PeerID6, second, third, test.PeerID4, test.PeerID1}
+	if len(peers) != len(expected) {
+		t.Fatalf("expected %d peers, got %d: %s", len(expected), len(peers), peers)
+	}
+	for i := range expected {
+		if peers[i] != expected[i] {
+			t.Errorf("wrong id in pos %d: %s", i, peers[i])
+		}
+	}
+}
+
+func TestAllocateOtherMetric(t *testing.T) {
+	alloc, err := New(&Config{
+		Metric: "reposize",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Smaller repositories have more weight (less negative).
+	candidates := api.MetricsSet{
+		"reposize": []api.Metric{
+			makeMetric("reposize", -100, test.PeerID1),
+			makeMetric("reposize", -5000, test.PeerID2),
+		},
+	}
+	peers, err := alloc.Allocate(context.Background(), api.PinCid(test.Cid1), nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 || peers[0] != test.PeerID2 {
+		t.Errorf("expected the biggest repository first, got %s", peers)
+	}
+}
@@ -0,0 +1,146 @@
+package latency
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/config"
+	"github.com/kelseyhightower/envconfig"
+)
+
+const configKey = "latency"
+const envConfigKey = "cluster_latency"
+
+// These are the default values for a Config.
+var (
+	DefaultMetric           = "freespace"
+	DefaultPingTimeout      = 5 * time.Second
+	DefaultLatencyTTL       = time.Minute
+	DefaultLatencyTolerance = 10 * time.Millisecond
+)
+
+// Config allows to initialize the Allocator.
+type Config struct {
+	config.Saver
+
+	// Metric is the name of the metric used to order peers with
+	// similar latencies. Peers with more weight are chosen first.
+	Metric string
+	// PingTimeout is the maximum time to wait for a peer to answer
+	// when measuring latencies. Peers which do not answer in time are
+	// chosen last.
+	PingTimeout time.Duration
+	// LatencyTTL specifies how often latencies are measured in the
+	// background.
+	LatencyTTL time.Duration
+	// LatencyTolerance is the difference in latency under which peers
+	// are considered equally close.
+	LatencyTolerance time.Duration
+}
+
+type jsonConfig struct {
+	Metric           string `json:"metric"`
+	PingTimeout      string `json:"ping_timeout"`
+	LatencyTTL       string `json:"latency_ttl"`
+	LatencyTolerance string `json:"latency_tolerance"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.Metric = DefaultMetric
+	cfg.PingTimeout = DefaultPingTimeout
+	cfg.LatencyTTL = DefaultLatencyTTL
+	cfg.LatencyTolerance = DefaultLatencyTolerance
+	return nil
+}
+
+// ApplyEnvVars fills in any Config fields found
+// as environment variables.
+func (cfg *Config) ApplyEnvVars() error {
+	jcfg := cfg.toJSONConfig()
+
+	err := envconfig.Process(envConfigKey, jcfg)
+	if err != nil {
+		return err
+	}
+
+	return cfg.applyJSONConfig(jcfg)
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if cfg.Metric == "" {
+		return errors.New("latency.metric is invalid")
+	}
+
+	if cfg.PingTimeout <= 0 {
+		return errors.New("latency.ping_timeout is invalid")
+	}
+
+	if cfg.LatencyTTL <= 0 {
+		return errors.New("latency.latency_ttl is invalid")
+	}
+
+	if cfg.LatencyTolerance < 0 {
+		return errors.New("latency.latency_tolerance is invalid")
+	}
+
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Default()
+
+	return cfg.applyJSONConfig(jcfg)
+}
+
+func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
+	config.SetIfNotDefault(jcfg.Metric, &cfg.Metric)
+
+	err := config.ParseDurations(cfg.ConfigKey(),
+		&config.DurationOpt{Duration: jcfg.PingTimeout, Dst: &cfg.PingTimeout, Name: "ping_timeout"},
+		&config.DurationOpt{Duration: jcfg.LatencyTTL, Dst: &cfg.LatencyTTL, Name: "latency_ttl"},
+		&config.DurationOpt{Duration: jcfg.LatencyTolerance, Dst: &cfg.LatencyTolerance, Name: "latency_tolerance"},
+	)
+	if err != nil {
+		return err
+	}
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := cfg.toJSONConfig()
+
+	return config.DefaultJSONMarshal(jcfg)
+}
+
+func (cfg *Config) toJSONConfig() *jsonConfig {
+	return &jsonConfig{
+		Metric:           cfg.Metric,
+		PingTimeout:      cfg.PingTimeout.String(),
+		LatencyTTL:       cfg.LatencyTTL.String(),
+		LatencyTolerance: cfg.LatencyTolerance.String(),
+	}
+}
+
+// ToDisplayJSON returns JSON config as a string.
+func (cfg *Config) ToDisplayJSON() ([]byte, error) {
+	return config.DisplayJSON(cfg.toJSONConfig())
+}
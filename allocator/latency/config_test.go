@@ -0,0 +1,76 @@
+package latency
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+var cfgJSON = []byte(`
+{
+      "metric": "numpin",
+      "ping_timeout": "2s",
+      "latency_ttl": "30s",
+      "latency_tolerance": "5ms"
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Metric != "numpin" ||
+		cfg.PingTimeout != 2*time.Second ||
+		cfg.LatencyTTL != 30*time.Second ||
+		cfg.LatencyTolerance != 5*time.Millisecond {
+		t.Error("configuration not loaded")
+	}
+
+	err = cfg.LoadJSON([]byte(`{"ping_timeout": "abc"}`))
+	if err == nil {
+		t.Error("expected an error parsing ping_timeout")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Metric != "numpin" || cfg.LatencyTolerance != 5*time.Millisecond {
+		t.Error("configuration was lost in serialization/deserialization")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.PingTimeout = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
+
+func TestApplyEnvVars(t *testing.T) {
+	os.Setenv("CLUSTER_LATENCY_LATENCYTTL", "1h")
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ApplyEnvVars()
+
+	if cfg.LatencyTTL != time.Hour {
+		t.Fatal("failed to override latency_ttl with env var")
+	}
+}
@@ -0,0 +1,297 @@
+// Package latency implements an allocator which prefers the peers that are
+// closest, in terms of network latency, to the peer making the allocation.
+//
+// Latencies are measured in the background with a lightweight RPC call to
+// the peers seen during allocations, and refreshed every LatencyTTL.
+// Allocations only read the measured values: peers which have not been
+// measured yet are chosen after the measured ones and before those which
+// cannot be reached. Peers with similar latencies (within a tolerance) are
+// ordered by the weight of a metric, like free space.
+//
+// Latencies are relative to the peer making the allocation, which is where
+// new content is fetched from. When a pin already has allocations (current)
+// and this peer is not one of them, the content will be fetched from them
+// instead and candidates are ordered by weight only.
+package latency
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	api "github.com/lubanproj/ipfs-cluster/api"
+	logging "github.com/ipfs/go-log/v2"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+)
+
+var logger = logging.Logger("allocator")
+
+var errNoRPCClient = errors.New("the allocator has no rpc client")
+
+// forgetAfter is the number of LatencyTTLs after which peers that have not
+// been seen in allocations are not measured anymore.
+const forgetAfter = 10
+
+type measurement struct {
+	latency   time.Duration
+	reachable bool
+	taken     time.Time
+}
+
+// Allocator is an allocator that sorts peers by latency.
+type Allocator struct {
+	config    *Config
+	rpcClient *rpc.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	latenciesMux sync.Mutex
+	latencies    map[peer.ID]measurement
+	// peers seen in allocations and when, so that only those are
+	// measured.
+	seen map[peer.ID]time.Time
+	// notifies the measuring loop of peers without measurements.
+	measureCh chan struct{}
+
+	// measures the latency to a peer. Replaced in tests.
+	ping func(ctx context.Context, pid peer.ID) (time.Duration, error)
+}
+
+// New returns an initialized Allocator.
+func New(cfg *Config) (*Allocator, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &Allocator{
+		config:    cfg,
+		ctx:       ctx,
+		cancel:    cancel,
+		latencies: make(map[peer.ID]measurement),
+		seen:      make(map[peer.ID]time.Time),
+		measureCh: make(chan struct{}, 1),
+	}
+	a.ping = a.rpcPing
+	return a, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster. Latencies are measured from
+// then on.
+func (a *Allocator) SetClient(c *rpc.Client) {
+	a.rpcClient = c
+	go a.measureLoop()
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (a *Allocator) Shutdown(ctx context.Context) error {
+	a.cancel()
+	a.rpcClient = nil
+	return nil
+}
+
+// rpcPing measures the round-trip time of a Cluster.Version call.
+func (a *Allocator) rpcPing(ctx context.Context, pid peer.ID) (time.Duration, error) {
+	if a.rpcClient == nil {
+		return 0, errNoRPCClient
+	}
+
+	start := time.Now()
+	var v api.Version
+	err := a.rpcClient.CallContext(
+		ctx,
+		pid,
+		"Cluster",
+		"Version",
+		struct{}{},
+		&v,
+	)
+	return time.Since(start), err
+}
+
+// measureLoop refreshes the latencies every LatencyTTL, and when
+// allocations find peers that have not been measured.
+func (a *Allocator) measureLoop() {
+	ticker := time.NewTicker(a.config.LatencyTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-a.measureCh:
+		}
+		a.refresh(a.ctx)
+	}
+}
+
+// refresh measures, in parallel, the latencies of the peers seen in
+// allocations that have no measurement or one older than LatencyTTL.
+// Peers that have not been seen in a while are forgotten.
+func (a *Allocator) refresh(ctx context.Context) {
+	now := time.Now()
+
+	a.latenciesMux.Lock()
+	var stale []peer.ID
+	for p, seen := range a.seen {
+		if now.Sub(seen) > forgetAfter*a.config.LatencyTTL {
+			delete(a.seen, p)
+			delete(a.latencies, p)
+			continue
+		}
+		m, ok := a.latencies[p]
+		if !ok || now.Sub(m.taken) >= a.config.LatencyTTL {
+			stale = append(stale, p)
+		}
+	}
+	a.latenciesMux.Unlock()
+
+	var wg sync.WaitGroup
+	results := make([]measurement, len(stale))
+	for i, p := range stale {
+		wg.Add(1)
+		go func(i int, p peer.ID) {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, a.config.PingTimeout)
+			defer cancel()
+			lat, err := a.ping(pingCtx, p)
+			if err != nil {
+				logger.Debugf("latency: cannot reach %s: %s", p, err)
+			}
+			results[i] = measurement{
+				latency:   lat,
+				reachable: err == nil,
+				taken:     time.Now(),
+			}
+		}(i, p)
+	}
+	wg.Wait()
+
+	a.latenciesMux.Lock()
+	defer a.latenciesMux.Unlock()
+	for i, p := range stale {
+		if _, ok := a.seen[p]; ok {
+			a.latencies[p] = results[i]
+		}
+	}
+}
+
+// cached returns the measured latencies of the given peers. Peers without
+// measurements are left out and the measuring loop is notified about them.
+func (a *Allocator) cached(peers []peer.ID) map[peer.ID]measurement {
+	now := time.Now()
+
+	a.latenciesMux.Lock()
+	latencies := make(map[peer.ID]measurement, len(peers))
+	missing := false
+	for _, p := range peers {
+		a.seen[p] = now
+		m, ok := a.latencies[p]
+		if !ok {
+			missing = true
+			continue
+		}
+		latencies[p] = m
+	}
+	a.latenciesMux.Unlock()
+
+	if missing {
+		select {
+		case a.measureCh <- struct{}{}:
+		default:
+		}
+	}
+	return latencies
+}
+
+// Allocate returns the priority peers followed by the candidate peers,
+// each group sorted by latency. Peers whose latencies differ less than
+// LatencyTolerance are sorted by the weight of the configured metric.
+// When current allocations exist and this peer is not among them, peers
+// are sorted by weight only. The order is then adjusted to honour the pin
+// placement constraints.
+func (a *Allocator) Allocate(
+	ctx context.Context,
+	pin api.Pin,
+	current, candidates, priority api.MetricsSet,
+) ([]peer.ID, error) {
+	byLatency := true
+	if cur := current[a.config.Metric]; len(cur) > 0 {
+		byLatency = false
+		for _, m := range cur {
+			if a.rpcClient != nil && m.Peer == a.rpcClient.ID() {
+				byLatency = true
+			}
+		}
+	}
+
+	first := a.sort(priority[a.config.Metric], byLatency)
+	last := a.sort(candidates[a.config.Metric], byLatency)
+	return pin.ApplyPlacement(append(first, last...), current, candidates, priority)
+}
+
+// Peers are classified by what is known about their latency.
+const (
+	measuredPeer = iota
+	unmeasuredPeer
+	unreachablePeer
+)
+
+func (a *Allocator) sort(metrics []api.Metric, byLatency bool) []peer.ID {
+	peers := make([]peer.ID, len(metrics))
+	weights := make(map[peer.ID]int64, len(metrics))
+	for i, m := range metrics {
+		peers[i] = m.Peer
+		weights[m.Peer] = m.GetWeight()
+	}
+
+	latencies := a.cached(peers)
+	class := func(p peer.ID) int {
+		m, ok := latencies[p]
+		switch {
+		case !byLatency || !ok:
+			return unmeasuredPeer
+		case !m.reachable:
+			return unreachablePeer
+		default:
+			return measuredPeer
+		}
+	}
+	bucket := func(p peer.ID) time.Duration {
+		if a.config.LatencyTolerance == 0 {
+			return latencies[p].latency
+		}
+		return latencies[p].latency / a.config.LatencyTolerance
+	}
+
+	sort.SliceStable(peers, func(i, j int) bool {
+		pi, pj := peers[i], peers[j]
+		ci, cj := class(pi), class(pj)
+		if ci != cj {
+			return ci < cj
+		}
+		if ci == measuredPeer {
+			if bi, bj := bucket(pi), bucket(pj); bi != bj {
+				return bi < bj
+			}
+		}
+		if wi, wj := weights[pi], weights[pj]; wi != wj {
+			return wi > wj
+		}
+		return pi < pj
+	})
+	return peers
+}
+
+// Metrics returns the names of the metrics that have been registered
+// with this allocator.
+func (a *Allocator) Metrics() []string {
+	return []string{a.config.Metric}
+}
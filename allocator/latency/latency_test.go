@@ -0,0 +1,136 @@
+package latency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/test"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func makeMetric(name string, weight int64, peer peer.ID) api.Metric {
+	return api.Metric{
+		Name:   name,
+		Weight: weight,
+		Peer:   peer,
+		Valid:  true,
+		Expire: time.Now().Add(time.Minute).UnixNano(),
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	alloc, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latencies := map[peer.ID]time.Duration{
+		test.PeerID1: 50 * time.Millisecond,
+		test.PeerID2: 2 * time.Millisecond,
+		test.PeerID3: 5 * time.Millisecond,
+		test.PeerID5: 20 * time.Millisecond,
+	}
+	var pingsMux sync.Mutex
+	pings := 0
+	alloc.ping = func(ctx context.Context, pid peer.ID) (time.Duration, error) {
+		pingsMux.Lock()
+		pings++
+		pingsMux.Unlock()
+		lat, ok := latencies[pid]
+		if !ok {
+			return 0, errors.New("unreachable")
+		}
+		return lat, nil
+	}
+
+	candidates := api.MetricsSet{
+		"freespace": []api.Metric{
+			makeMetric("freespace", 200, test.PeerID1),
+			makeMetric("freespace", 100, test.PeerID2),
+			makeMetric("freespace", 500, test.PeerID3),
+			makeMetric("freespace", 1000, test.PeerID4), // unreachable
+		},
+	}
+	priority := api.MetricsSet{
+		"freespace": []api.Metric{
+			makeMetric("freespace", 100, test.PeerID5),
+		},
+	}
+
+	check := func(current api.MetricsSet, expected ...peer.ID) {
+		t.Helper()
+		peers, err := alloc.Allocate(context.Background(), api.PinCid(test.Cid1), current, candidates, priority)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(peers) != len(expected) {
+			t.Fatalf("expected %d peers, got %d", len(expected), len(peers))
+		}
+		for i := range expected {
+			if peers[i] != expected[i] {
+				t.Errorf("wrong id in pos %d: %s", i, peers[i])
+			}
+		}
+	}
+
+	// Nothing has been measured yet: peers are sorted by weight and
+	// no allocation waits for a ping.
+	check(nil, test.PeerID5, test.PeerID4, test.PeerID3, test.PeerID1, test.PeerID2)
+	if pings != 0 {
+		t.Errorf("expected no pings while allocating, got %d", pings)
+	}
+
+	alloc.refresh(context.Background())
+
+	// PeerID2 and PeerID3 are within the tolerance, so PeerID3 comes
+	// first as it has more free space.
+	for i := 0; i < 2; i++ {
+		check(nil, test.PeerID5, test.PeerID3, test.PeerID2, test.PeerID1, test.PeerID4)
+	}
+
+	// Latencies are cached.
+	alloc.refresh(context.Background())
+	if pings != 5 {
+		t.Errorf("expected 5 pings, got %d", pings)
+	}
+
+	// The content of pins with allocations elsewhere does not come
+	// from this peer.
+	current := api.MetricsSet{
+		"freespace": []api.Metric{
+			makeMetric("freespace", 100, test.PeerID6),
+		},
+	}
+	check(current, test.PeerID5, test.PeerID4, test.PeerID3, test.PeerID1, test.PeerID2)
+}
+
+func TestAllocateNoClient(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	alloc, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without an rpc client no peer can be reached and they are sorted
+	// by weight.
+	candidates := api.MetricsSet{
+		"freespace": []api.Metric{
+			makeMetric("freespace", 100, test.PeerID1),
+			makeMetric("freespace", 200, test.PeerID2),
+		},
+	}
+	peers, err := alloc.Allocate(context.Background(), api.PinCid(test.Cid1), nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 || peers[0] != test.PeerID2 {
+		t.Error("expected peers sorted by weight")
+	}
+}
@@ -0,0 +1,64 @@
+package weighted
+
+import (
+	"os"
+	"testing"
+)
+
+var cfgJSON = []byte(`
+{
+      "metric": "numpin"
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Metric != "numpin" {
+		t.Error("metric not loaded")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Metric != "numpin" {
+		t.Error("configuration was lost in serialization/deserialization")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.Metric = ""
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
+
+func TestApplyEnvVars(t *testing.T) {
+	os.Setenv("CLUSTER_WEIGHTED_METRIC", "tag:group")
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ApplyEnvVars()
+
+	if cfg.Metric != "tag:group" {
+		t.Fatal("failed to override metric with env var")
+	}
+}
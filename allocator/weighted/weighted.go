@@ -0,0 +1,140 @@
+// Package weighted implements an allocator that chooses peers randomly,
+// with a probability proportional to the weight of a metric.
+//
+// For example, allocating by "freespace", a peer with twice as much free
+// space as another is twice as likely to be chosen first. Unlike the
+// balanced allocator, peers with similar metrics get similar amounts of
+// data even when their metrics change slowly.
+//
+// The random order is derived from the CID of the pin, so allocating the
+// same pin again with similar metrics gives the same result. This way,
+// re-allocating a pin which keeps some of its current allocations, or
+// checking whether a pin is well placed, does not move it around.
+package weighted
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+
+	api "github.com/lubanproj/ipfs-cluster/api"
+	logging "github.com/ipfs/go-log/v2"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+)
+
+var logger = logging.Logger("allocator")
+
+// Allocator is an allocator that orders peers by weighted random
+// sampling.
+type Allocator struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// New returns an initialized Allocator.
+func New(cfg *Config) (*Allocator, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Allocator{
+		config: cfg,
+	}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (a *Allocator) SetClient(c *rpc.Client) {
+	a.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (a *Allocator) Shutdown(ctx context.Context) error {
+	a.rpcClient = nil
+	return nil
+}
+
+// Allocate returns the priority peers followed by the candidate peers,
+// each group in a random order where peers with more weight are more
+// likely to come first. Peers with a weight of 0 or less are never chosen
+// before any other and are sorted by weight. The pin placement constraints
+// are applied to the result.
+func (a *Allocator) Allocate(
+	ctx context.Context,
+	pin api.Pin,
+	current, candidates, priority api.MetricsSet,
+) ([]peer.ID, error) {
+	rnd := pinRand(pin.Cid)
+	first := a.shuffle(rnd, priority[a.config.Metric])
+	last := a.shuffle(rnd, candidates[a.config.Metric])
+	return pin.ApplyPlacement(append(first, last...), current, candidates, priority)
+}
+
+type sampledPeer struct {
+	peer   peer.ID
+	weight int64
+	key    float64
+}
+
+// shuffle implements weighted random sampling without replacement
+// (Efraimidis and Spirakis): each peer gets a key u^(1/weight), with u
+// uniformly random in (0, 1), and peers are sorted by key. Logarithms are
+// used for numerical stability.
+func (a *Allocator) shuffle(rnd *rand.Rand, metrics []api.Metric) []peer.ID {
+	// Peers are sampled in a fixed order so that the same random
+	// numbers are given to the same peers.
+	metrics = append([]api.Metric{}, metrics...)
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Peer < metrics[j].Peer
+	})
+
+	sampled := make([]sampledPeer, 0, len(metrics))
+	for _, m := range metrics {
+		u := rnd.Float64()
+		for u == 0 {
+			u = rnd.Float64()
+		}
+		w := m.GetWeight()
+		key := math.Inf(-1)
+		if w > 0 {
+			key = math.Log(u) / float64(w)
+		}
+		sampled = append(sampled, sampledPeer{
+			peer:   m.Peer,
+			weight: w,
+			key:    key,
+		})
+	}
+
+	sort.SliceStable(sampled, func(i, j int) bool {
+		if sampled[i].key == sampled[j].key {
+			return sampled[i].weight > sampled[j].weight
+		}
+		return sampled[i].key > sampled[j].key
+	})
+
+	peers := make([]peer.ID, len(sampled))
+	for i, s := range sampled {
+		peers[i] = s.peer
+	}
+	logger.Debugf("weighted allocator order: %s", peers)
+	return peers
+}
+
+// pinRand returns a random number generator seeded with the given CID.
+func pinRand(ci api.Cid) *rand.Rand {
+	h := fnv.New64a()
+	h.Write(ci.Bytes())
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// Metrics returns the names of the metrics that have been registered
+// with this allocator.
+func (a *Allocator) Metrics() []string {
+	return []string{a.config.Metric}
+}
@@ -0,0 +1,99 @@
+package weighted
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	api "github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	multihash "github.com/multiformats/go-multihash"
+)
+
+func makeMetric(name string, weight int64, peer peer.ID) api.Metric {
+	return api.Metric{
+		Name:   name,
+		Weight: weight,
+		Peer:   peer,
+		Valid:  true,
+		Expire: time.Now().Add(time.Minute).UnixNano(),
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	alloc, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidates := api.MetricsSet{
+		"freespace": []api.Metric{
+			makeMetric("freespace", 100, test.PeerID1),
+			makeMetric("freespace", 300, test.PeerID2),
+			makeMetric("freespace", 0, test.PeerID3),
+			makeMetric("freespace", -10, test.PeerID4),
+		},
+	}
+	priority := api.MetricsSet{
+		"freespace": []api.Metric{
+			makeMetric("freespace", 1, test.PeerID5),
+		},
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	firsts := make(map[peer.ID]int)
+	n := 4000
+	for i := 0; i < n; i++ {
+		buf := make([]byte, 32)
+		rnd.Read(buf)
+		mh, _ := multihash.Sum(buf, multihash.SHA2_256, -1)
+		ci := api.NewCid(cid.NewCidV1(cid.Raw, mh))
+
+		peers, err := alloc.Allocate(context.Background(), api.PinCid(ci), nil, candidates, priority)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(peers) != 5 {
+			t.Fatalf("expected 5 peers, got %d", len(peers))
+		}
+		if peers[0] != test.PeerID5 {
+			t.Fatal("priority peers should come first")
+		}
+		if peers[3] != test.PeerID3 || peers[4] != test.PeerID4 {
+			t.Fatal("peers without weight should come last, sorted by weight")
+		}
+		firsts[peers[1]]++
+	}
+
+	// PeerID2 has 3/4 of the weight.
+	ratio := float64(firsts[test.PeerID2]) / float64(n)
+	if ratio < 0.7 || ratio > 0.8 {
+		t.Errorf("PeerID2 was first %.2f of the times, expected around 0.75", ratio)
+	}
+
+	// The same pin always gets the same order.
+	pin := api.PinCid(test.Cid1)
+	peers, _ := alloc.Allocate(context.Background(), pin, nil, candidates, priority)
+	for i := 0; i < 10; i++ {
+		again, _ := alloc.Allocate(context.Background(), pin, nil, candidates, priority)
+		for j := range peers {
+			if again[j] != peers[j] {
+				t.Fatal("allocating the same pin again gave a different order")
+			}
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	alloc, _ := New(cfg)
+	if m := alloc.Metrics(); len(m) != 1 || m[0] != DefaultMetric {
+		t.Error("unexpected metrics")
+	}
+}
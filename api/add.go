@@ -210,6 +210,10 @@ func AddParamsFromQuery(query url.Values) (AddParams, error) {
 		return params, err
 	}
 
+	if params.Shard && (params.Local || params.NoPin) {
+		return params, errors.New("shard cannot be combined with local or no-pin")
+	}
+
 	return params, nil
 }
 
@@ -28,6 +28,20 @@ func TestAddParams_FromQuery(t *testing.T) {
 	}
 }
 
+func TestAddParams_FromQueryShardLocal(t *testing.T) {
+	for _, qStr := range []string{"shard=true&local=true", "shard=true&no-pin=true"} {
+		q, err := url.ParseQuery(qStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = AddParamsFromQuery(q)
+		if err == nil {
+			t.Errorf("%s: expected an error", qStr)
+		}
+	}
+}
+
 func TestAddParams_FromQueryRawLeaves(t *testing.T) {
 	qStr := "cid-version=1"
 
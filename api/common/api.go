@@ -103,6 +103,9 @@ type Route struct {
 	Method      string
 	Pattern     string
 	HandlerFunc http.HandlerFunc
+	// Role is the minimum role needed to use this route when roles
+	// are configured. Routes without a role require RoleAdmin.
+	Role Role
 }
 
 type jwtToken struct {
@@ -278,7 +281,7 @@ func (api *API) addRoutes() {
 			Name(route.Name).
 			Handler(
 				ochttp.WithRouteTag(
-					http.HandlerFunc(route.HandlerFunc),
+					api.roleHandler(route),
 					"/"+route.Name,
 				),
 			)
@@ -310,6 +313,8 @@ func (api *API) authHandler(h http.Handler, lggr *logging.ZapEventLogger) http.H
 		username, password, okBasic := r.BasicAuth()
 		tokenString, okToken := parseBearerToken(r.Header.Get("Authorization"))
 
+		ctx := r.Context()
+
 		switch {
 		case okBasic:
 			ok := verifyBasicAuth(credentials, username, password)
@@ -318,8 +323,19 @@ func (api *API) authHandler(h http.Handler, lggr *logging.ZapEventLogger) http.H
 				api.SendResponse(w, http.StatusUnauthorized, errors.New("unauthorized: access denied"), nil)
 				return
 			}
+		case okToken && isAPIKeyToken(tokenString):
+			key, err := api.verifyAPIKey(ctx, credentials, tokenString)
+			if err != nil {
+				lggr.Debug(err)
+
+				w.Header().Set("WWW-Authenticate", wwwAuthenticate("Bearer", "Restricted IPFS Cluster API", "invalid_token", ""))
+				api.SendResponse(w, http.StatusUnauthorized, errors.New("unauthorized: invalid api key"), nil)
+				return
+			}
+			username = key.User
+			ctx = context.WithValue(ctx, apiKeyContextKey{}, key)
 		case okToken:
-			_, err := verifyToken(credentials, tokenString)
+			token, err := verifyToken(credentials, tokenString)
 			if err != nil {
 				lggr.Debug(err)
 
@@ -327,6 +343,8 @@ func (api *API) authHandler(h http.Handler, lggr *logging.ZapEventLogger) http.H
 				api.SendResponse(w, http.StatusUnauthorized, errors.New("unauthorized: invalid token"), nil)
 				return
 			}
+			// The issuer has been checked by verifyToken.
+			username = token.Claims.(*jwt.RegisteredClaims).Issuer
 		default:
 			// No authentication provided, but needed
 			w.Header().Add("WWW-Authenticate", wwwAuthenticate("Bearer", "Restricted IPFS Cluster API", "", ""))
@@ -336,11 +354,35 @@ func (api *API) authHandler(h http.Handler, lggr *logging.ZapEventLogger) http.H
 		}
 
 		// If we are here, authentication worked.
-		h.ServeHTTP(w, r)
+		ctx = context.WithValue(ctx, userContextKey{}, username)
+		h.ServeHTTP(w, r.WithContext(ctx))
 	}
 	return http.HandlerFunc(wrap)
 }
 
+type userContextKey struct{}
+
+// User returns the API user which authenticated the request with the given
+// context, or an empty string when authentication is disabled.
+func User(ctx context.Context) string {
+	user, _ := ctx.Value(userContextKey{}).(string)
+	return user
+}
+
+// IsAdmin returns true when the user which authenticated the request with
+// the given context can manage the pins of other users: when it has the
+// admin role and did not use an API key without the admin scope. Everyone
+// is an admin when authentication is disabled.
+func (api *API) IsAdmin(ctx context.Context) bool {
+	if api.config.BasicAuthCredentials == nil {
+		return true
+	}
+	if key, ok := RequestAPIKey(ctx); ok && !key.HasScope(types.APIKeyScopeAdmin) {
+		return false
+	}
+	return api.config.Roles[User(ctx)] == RoleAdmin
+}
+
 func parseBearerToken(authHeader string) (string, bool) {
 	const prefix = "Bearer "
 	if len(authHeader) < len(prefix) || !strings.EqualFold(authHeader[:len(prefix)], prefix) {
@@ -604,6 +646,13 @@ func (api *API) GenerateTokenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Tokens are not limited by scopes, so API keys cannot be exchanged
+	// for them.
+	if _, ok := RequestAPIKey(r.Context()); ok {
+		api.SendResponse(w, http.StatusForbidden, errors.New("forbidden: api keys cannot be used to generate tokens"), nil)
+		return
+	}
+
 	var issuer string
 
 	// We do not verify as we assume it is already done!
@@ -676,6 +725,8 @@ func (api *API) SendResponse(
 		if status == SetStatusAutomatically || status < 400 {
 			if err.Error() == state.ErrNotFound.Error() {
 				status = http.StatusNotFound
+			} else if strings.HasPrefix(err.Error(), types.ErrQuotaExceeded.Error()) {
+				status = http.StatusForbidden
 			} else {
 				status = http.StatusInternalServerError
 			}
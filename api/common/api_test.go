@@ -47,6 +47,26 @@ func routes(c *rpc.Client) []Route {
 				w.Header().Add("Content-Type", "application/json")
 				w.Write([]byte(`{ "thisis": "atest" }`))
 			},
+			RoleReader,
+		},
+		{
+			"User",
+			"GET",
+			"/user",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Test-User", User(r.Context()))
+				w.WriteHeader(http.StatusNoContent)
+			},
+			RoleReader,
+		},
+		{
+			"Admin",
+			"POST",
+			"/admin",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			RoleAdmin,
 		},
 	}
 
@@ -305,6 +325,10 @@ func assertHTTPStatusIsUnauthoriazed(resp *http.Response) error {
 	return httpStatusCodeChecker(resp, http.StatusUnauthorized)
 }
 
+func assertHTTPStatusIsForbidden(resp *http.Response) error {
+	return httpStatusCodeChecker(resp, http.StatusForbidden)
+}
+
 func assertHTTPStatusIsTooLarge(resp *http.Response) error {
 	return httpStatusCodeChecker(resp, http.StatusRequestHeaderFieldsTooLarge)
 }
@@ -503,6 +527,186 @@ func TestBasicAuth(t *testing.T) {
 	}
 }
 
+func userContext(user string) context.Context {
+	return context.WithValue(context.Background(), userContextKey{}, user)
+}
+
+func makeUserChecker(user string) responseChecker {
+	return func(resp *http.Response) error {
+		if got := resp.Header.Get("X-Test-User"); got != user {
+			return fmt.Errorf("expected user %q, got %q", user, got)
+		}
+		return nil
+	}
+}
+
+func TestAuthUser(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPIwithBasicAuth(t)
+	defer rest.Shutdown(ctx)
+
+	for _, tc := range []httpTestcase{
+		{
+			method:  "GET",
+			path:    "/user",
+			shaper:  makeBasicAuthRequestShaper(adminUserName, adminUserPassword),
+			checker: makeUserChecker(adminUserName),
+		},
+		{
+			method:  "GET",
+			path:    "/user",
+			shaper:  makeTokenAuthRequestShaper(validToken),
+			checker: makeUserChecker(validUserName),
+		},
+	} {
+		test.BothEndpoints(t, tc.getTestFunction(rest))
+	}
+
+	rest.config.Roles = map[string]Role{adminUserName: RoleAdmin, validUserName: RolePinner}
+	if !rest.IsAdmin(userContext(adminUserName)) || rest.IsAdmin(userContext(validUserName)) {
+		t.Error("only users with the admin role should be admins")
+	}
+
+	noauth := testAPI(t)
+	defer noauth.Shutdown(ctx)
+	if !noauth.IsAdmin(ctx) {
+		t.Error("everyone is an admin without authentication")
+	}
+	tc := httpTestcase{
+		method:  "GET",
+		path:    "/user",
+		checker: makeUserChecker(""),
+	}
+	test.BothEndpoints(t, tc.getTestFunction(noauth))
+}
+
+func TestRoles(t *testing.T) {
+	ctx := context.Background()
+	cfg := newDefaultTestConfig(t)
+	cfg.BasicAuthCredentials = map[string]string{
+		validUserName:   validUserPassword,
+		adminUserName:   adminUserPassword,
+		invalidUserName: invalidUserPassword,
+	}
+	cfg.Roles = map[string]Role{
+		validUserName: RoleReader,
+		adminUserName: RoleAdmin,
+	}
+	rest := testAPIwithConfig(t, cfg, "roles")
+	defer rest.Shutdown(ctx)
+
+	for _, tc := range []httpTestcase{
+		{
+			method:  "GET",
+			path:    "/test",
+			shaper:  makeBasicAuthRequestShaper(validUserName, validUserPassword),
+			checker: makeHTTPStatusNegatedAssert(assertHTTPStatusIsForbidden),
+		},
+		{
+			method:  "POST",
+			path:    "/admin",
+			shaper:  makeBasicAuthRequestShaper(validUserName, validUserPassword),
+			checker: assertHTTPStatusIsForbidden,
+		},
+		{
+			method:  "POST",
+			path:    "/admin",
+			shaper:  makeTokenAuthRequestShaper(validToken),
+			checker: assertHTTPStatusIsForbidden,
+		},
+		{
+			method:  "POST",
+			path:    "/admin",
+			shaper:  makeBasicAuthRequestShaper(adminUserName, adminUserPassword),
+			checker: makeHTTPStatusNegatedAssert(assertHTTPStatusIsForbidden),
+		},
+		{
+			// users without a role cannot use the API.
+			method:  "GET",
+			path:    "/test",
+			shaper:  makeBasicAuthRequestShaper(invalidUserName, invalidUserPassword),
+			checker: assertHTTPStatusIsForbidden,
+		},
+	} {
+		test.BothEndpoints(t, tc.getTestFunction(rest))
+	}
+
+	if !rest.IsAdmin(userContext(adminUserName)) || rest.IsAdmin(userContext(validUserName)) {
+		t.Error("only users with the admin role should be admins")
+	}
+
+	// Without roles, every user can use every route.
+	norole := testAPIwithBasicAuth(t)
+	defer norole.Shutdown(ctx)
+	tc := httpTestcase{
+		method:  "POST",
+		path:    "/admin",
+		shaper:  makeBasicAuthRequestShaper(validUserName, validUserPassword),
+		checker: makeHTTPStatusNegatedAssert(assertHTTPStatusIsForbidden),
+	}
+	test.BothEndpoints(t, tc.getTestFunction(norole))
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	ctx := context.Background()
+	cfg := newDefaultTestConfig(t)
+	cfg.BasicAuthCredentials = map[string]string{
+		validUserName:    validUserPassword,
+		rpctest.PinOwner: validUserPassword,
+	}
+	rest := testAPIwithConfig(t, cfg, "api keys")
+	defer rest.Shutdown(ctx)
+
+	for _, tc := range []httpTestcase{
+		{
+			method:  "GET",
+			path:    "/user",
+			shaper:  makeTokenAuthRequestShaper(rpctest.APIKeyToken),
+			checker: makeUserChecker(rpctest.PinOwner),
+		},
+		{
+			method:  "GET",
+			path:    "/test",
+			shaper:  makeTokenAuthRequestShaper(rpctest.APIKeyToken + "0"),
+			checker: assertHTTPStatusIsUnauthoriazed,
+		},
+		{
+			// the mock key only has the read scope.
+			method:  "POST",
+			path:    "/admin",
+			shaper:  makeTokenAuthRequestShaper(rpctest.APIKeyToken),
+			checker: assertHTTPStatusIsForbidden,
+		},
+	} {
+		test.BothEndpoints(t, tc.getTestFunction(rest))
+	}
+
+	// Keys stop working when their user has no credentials.
+	delete(rest.config.BasicAuthCredentials, rpctest.PinOwner)
+	tc := httpTestcase{
+		method:  "GET",
+		path:    "/test",
+		shaper:  makeTokenAuthRequestShaper(rpctest.APIKeyToken),
+		checker: assertHTTPStatusIsUnauthoriazed,
+	}
+	test.BothEndpoints(t, tc.getTestFunction(rest))
+}
+
+func TestRoleAllows(t *testing.T) {
+	if !RoleAdmin.Allows(RoleOperator) || !RolePinner.Allows(RolePinner) {
+		t.Error("roles should allow routes requiring the same or lower roles")
+	}
+	if RoleOperator.Allows(RoleAdmin) || RoleReader.Allows(RolePinner) {
+		t.Error("roles should not allow routes requiring higher roles")
+	}
+	if RoleOperator.Allows(0) || !RoleAdmin.Allows(0) {
+		t.Error("routes without a role should require the admin role")
+	}
+	if Role(0).Allows(RoleReader) {
+		t.Error("users without a role should not be allowed")
+	}
+}
+
 func TestTokenAuth(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPIwithBasicAuth(t)
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"context"
+	"errors"
+
+	types "github.com/lubanproj/ipfs-cluster/api"
+)
+
+type apiKeyContextKey struct{}
+
+// RequestAPIKey returns the API key used to authenticate the request with
+// the given context, if any.
+func RequestAPIKey(ctx context.Context) (types.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(types.APIKey)
+	return key, ok
+}
+
+func isAPIKeyToken(token string) bool {
+	_, _, ok := types.ParseAPIKeyToken(token)
+	return ok
+}
+
+// verifyAPIKey asks the cluster peer for the API key matching the given
+// token. Keys stop working when their user is removed from the
+// credentials.
+func (api *API) verifyAPIKey(ctx context.Context, credentials map[string]string, token string) (types.APIKey, error) {
+	var key types.APIKey
+	err := api.rpcClient.CallContext(
+		ctx,
+		"",
+		"Cluster",
+		"APIKeyVerify",
+		token,
+		&key,
+	)
+	if err != nil {
+		return key, err
+	}
+	if _, ok := credentials[key.User]; !ok {
+		return key, errors.New("the user of the api key has no credentials")
+	}
+	return key, nil
+}
+
+// scopesRole returns the most powerful role allowed by the given API key
+// scopes.
+func scopesRole(scopes []string) Role {
+	var role Role
+	for _, s := range scopes {
+		r := Role(0)
+		switch s {
+		case types.APIKeyScopeRead:
+			r = RoleReader
+		case types.APIKeyScopePin:
+			r = RolePinner
+		case types.APIKeyScopeAdmin:
+			r = RoleAdmin
+		}
+		if r > role {
+			role = r
+		}
+	}
+	return role
+}
@@ -87,6 +87,13 @@ type Config struct {
 	// which are authorized to use Basic Authentication
 	BasicAuthCredentials map[string]string
 
+	// Roles assign a role to users, which decides the routes that they
+	// can use. When empty, every authenticated user can use every route.
+	// Otherwise, users without a role cannot use the API. Only users with
+	// the admin role can unpin and modify the pins owned by other users
+	// and read their usage.
+	Roles map[string]Role
+
 	// HTTPLogFile is path of the file that would save HTTP API logs. If this
 	// path is empty, HTTP logs would be sent to standard output. This path
 	// should either be absolute or relative to cluster base directory. Its
@@ -124,6 +131,7 @@ type jsonConfig struct {
 	PrivateKey               string             `json:"private_key,omitempty" hidden:"true"`
 
 	BasicAuthCredentials map[string]string   `json:"basic_auth_credentials"  hidden:"true"`
+	Roles                map[string]string   `json:"roles,omitempty"`
 	HTTPLogFile          string              `json:"http_log_file"`
 	Headers              map[string][]string `json:"headers"`
 
@@ -189,6 +197,12 @@ func (cfg *Config) Validate() error {
 		return errors.New(cfg.ConfigKey + ".cors_max_age is invalid")
 	}
 
+	for user, role := range cfg.Roles {
+		if _, ok := roleNames[role]; user == "" || !ok {
+			return errors.New(cfg.ConfigKey + ".roles is invalid")
+		}
+	}
+
 	return cfg.validateLibp2p()
 }
 
@@ -240,6 +254,17 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 	cfg.HTTPLogFile = jcfg.HTTPLogFile
 	cfg.Headers = jcfg.Headers
 
+	if len(jcfg.Roles) > 0 {
+		cfg.Roles = make(map[string]Role, len(jcfg.Roles))
+		for user, name := range jcfg.Roles {
+			role, err := RoleFromString(name)
+			if err != nil {
+				return fmt.Errorf("%s.roles: %w", cfg.ConfigKey, err)
+			}
+			cfg.Roles[user] = role
+		}
+	}
+
 	return cfg.Validate()
 }
 
@@ -403,6 +428,13 @@ func (cfg *Config) toJSONConfig() (jcfg *jsonConfig, err error) {
 		CORSMaxAge:             cfg.CORSMaxAge.String(),
 	}
 
+	if len(cfg.Roles) > 0 {
+		jcfg.Roles = make(map[string]string, len(cfg.Roles))
+		for user, role := range cfg.Roles {
+			jcfg.Roles[user] = role.String()
+		}
+	}
+
 	if cfg.ID != "" {
 		jcfg.ID = peer.Encode(cfg.ID)
 	}
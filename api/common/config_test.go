@@ -63,6 +63,7 @@ func defaultFunc(cfg *Config) error {
 
 	// Auth
 	cfg.BasicAuthCredentials = nil
+	cfg.Roles = nil
 
 	// Logs
 	cfg.HTTPLogFile = ""
@@ -217,6 +218,15 @@ func TestLoadJSON(t *testing.T) {
 	if err == nil {
 		t.Error("expected error with MaxHeaderBytes")
 	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Roles = map[string]string{"user": "superuser"}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with roles")
+	}
 }
 
 func TestApplyEnvVars(t *testing.T) {
@@ -333,3 +343,28 @@ func TestDefault(t *testing.T) {
 		t.Fatal("expected error validating")
 	}
 }
+
+func TestLoadJSONRoles(t *testing.T) {
+	cfg := newTestConfig()
+	err := cfg.LoadJSON([]byte(`
+{
+	"basic_auth_credentials": {"admin": "pass1", "user": "pass2"},
+	"roles": {"admin": "admin", "user": "pinner"}
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Roles["admin"] != RoleAdmin || cfg.Roles["user"] != RolePinner {
+		t.Error("error parsing roles")
+	}
+
+	j, err := cfg.toJSONConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Roles["user"] != "pinner" {
+		t.Error("roles should be kept in the JSON config")
+	}
+}
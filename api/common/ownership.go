@@ -0,0 +1,126 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	types "github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/state"
+)
+
+// This file contains the pin ownership checks. When authentication is
+// enabled, pins made through the APIs are owned by the authenticated user.
+// Only their owner or an admin can unpin or modify them. Quotas are
+// enforced by Cluster when the pins are committed.
+
+var errNotOwner = errors.New("forbidden: the item is owned by another user")
+
+// pinGet returns the pin for the given CID and whether it exists.
+func (api *API) pinGet(ctx context.Context, c types.Cid) (types.Pin, bool, error) {
+	var pin types.Pin
+	err := api.rpcClient.CallContext(
+		ctx,
+		"",
+		"Cluster",
+		"PinGet",
+		c,
+		&pin,
+	)
+	if err != nil && err.Error() == state.ErrNotFound.Error() {
+		return pin, false, nil
+	}
+	return pin, err == nil, err
+}
+
+// canModify returns true when the user which authenticated the request
+// with the given context can modify or unpin the given pin.
+func (api *API) canModify(ctx context.Context, pin types.Pin) bool {
+	return pin.Owner == "" || pin.Owner == User(ctx) || api.IsAdmin(ctx)
+}
+
+// AuthorizePin sets the Owner of the given pin to the authenticated user,
+// or to the owner of the existing pin. It makes the request fail and
+// returns false when the user cannot modify the existing pin, or the pin
+// it updates. When the CID is not known in advance, as when adding, it
+// also fails when the quota of the user is already used up.
+func (api *API) AuthorizePin(w http.ResponseWriter, r *http.Request, pin *types.Pin) bool {
+	user := User(r.Context())
+	if user == "" {
+		return true
+	}
+
+	if pin.PinUpdate.Defined() && !api.AuthorizeModify(w, r, pin.PinUpdate) {
+		return false
+	}
+
+	if !pin.Cid.Defined() {
+		pin.Owner = user
+		return api.checkQuotaLeft(w, r, user)
+	}
+
+	existing, found, err := api.pinGet(r.Context(), pin.Cid)
+	if err != nil {
+		api.SendResponse(w, SetStatusAutomatically, err, nil)
+		return false
+	}
+	if found && !api.canModify(r.Context(), existing) {
+		api.SendResponse(w, http.StatusForbidden, errNotOwner, nil)
+		return false
+	}
+	if found && existing.Owner != "" {
+		pin.Owner = existing.Owner
+		return true
+	}
+	pin.Owner = user
+	return true
+}
+
+// AuthorizeModify makes the request fail with 403 and returns false when
+// the authenticated user cannot modify or unpin the given CID.
+func (api *API) AuthorizeModify(w http.ResponseWriter, r *http.Request, c types.Cid) bool {
+	if User(r.Context()) == "" {
+		return true
+	}
+
+	existing, found, err := api.pinGet(r.Context(), c)
+	if err != nil {
+		api.SendResponse(w, SetStatusAutomatically, err, nil)
+		return false
+	}
+	if found && !api.canModify(r.Context(), existing) {
+		api.SendResponse(w, http.StatusForbidden, errNotOwner, nil)
+		return false
+	}
+	return true
+}
+
+// checkQuotaLeft makes the request fail with 403 and returns false when the
+// given user cannot own any more pins or content.
+func (api *API) checkQuotaLeft(w http.ResponseWriter, r *http.Request, user string) bool {
+	var usage types.Usage
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"Usage",
+		user,
+		&usage,
+	)
+	if err != nil {
+		api.SendResponse(w, SetStatusAutomatically, err, nil)
+		return false
+	}
+
+	switch {
+	case usage.MaxPins > 0 && usage.Pins >= usage.MaxPins:
+		err = fmt.Errorf("%w: %s cannot own more than %d pins", types.ErrQuotaExceeded, user, usage.MaxPins)
+	case usage.MaxSize > 0 && usage.Size >= usage.MaxSize:
+		err = fmt.Errorf("%w: %s cannot own more than %d bytes", types.ErrQuotaExceeded, user, usage.MaxSize)
+	default:
+		return true
+	}
+	api.SendResponse(w, http.StatusForbidden, err, nil)
+	return false
+}
@@ -0,0 +1,103 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Role is assigned to API users in the configuration and decides which
+// routes they can use. Every role can use the routes allowed to the roles
+// below it.
+type Role int
+
+// Roles from least to most powerful. Routes without a role are restricted to
+// RoleAdmin.
+const (
+	// RoleReader can read the state of the cluster.
+	RoleReader Role = iota + 1
+	// RolePinner can additionally add, pin and unpin content.
+	RolePinner
+	// RoleOperator can additionally run maintenance tasks like draining
+	// peers or recovering the pinset.
+	RoleOperator
+	// RoleAdmin can use every route.
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleReader:   "reader",
+	RolePinner:   "pinner",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+// String returns the name of the role.
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// RoleFromString parses a role name.
+func RoleFromString(s string) (Role, error) {
+	for r, name := range roleNames {
+		if name == s {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role: %s", s)
+}
+
+// Allows returns true when the role can use routes requiring the given
+// role.
+func (r Role) Allows(required Role) bool {
+	if required == 0 {
+		required = RoleAdmin
+	}
+	return r >= required
+}
+
+// UserRole returns the role of the given user and whether roles are
+// enforced. Roles are not enforced when authentication is disabled or no
+// roles are configured. Users without a role cannot use any route.
+func (api *API) UserRole(user string) (Role, bool) {
+	if api.config.BasicAuthCredentials == nil || len(api.config.Roles) == 0 {
+		return RoleAdmin, false
+	}
+	return api.config.Roles[user], true
+}
+
+// requestRole returns the role of the user which authenticated the
+// request with the given context, limited by the scopes of the API key
+// used, and whether it is enforced.
+func (api *API) requestRole(ctx context.Context) (Role, bool) {
+	role, enforced := api.UserRole(User(ctx))
+	if key, ok := RequestAPIKey(ctx); ok {
+		if sr := scopesRole(key.Scopes); sr < role {
+			role = sr
+		}
+		enforced = true
+	}
+	return role, enforced
+}
+
+// roleHandler makes requests to the given route fail with 403 when the
+// role of the authenticated user, or the scopes of their API key, do not
+// allow using it.
+func (api *API) roleHandler(route Route) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role, enforced := api.requestRole(r.Context())
+		if enforced && !role.Allows(route.Role) {
+			required := route.Role
+			if required == 0 {
+				required = RoleAdmin
+			}
+			err := fmt.Errorf("forbidden: %s requires the %s role", route.Name, required)
+			api.SendResponse(w, http.StatusForbidden, err, nil)
+			return
+		}
+		route.HandlerFunc(w, r)
+	}
+}
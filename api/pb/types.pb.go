@@ -28,6 +28,8 @@ const (
 	Pin_MetaType       Pin_PinType = 2
 	Pin_ClusterDAGType Pin_PinType = 3
 	Pin_ShardType      Pin_PinType = 4
+	Pin_CollectionType Pin_PinType = 5
+	Pin_RecordType     Pin_PinType = 6
 )
 
 // Enum value maps for Pin_PinType.
@@ -38,6 +40,8 @@ var (
 		2: "MetaType",
 		3: "ClusterDAGType",
 		4: "ShardType",
+		5: "CollectionType",
+		6: "RecordType",
 	}
 	Pin_PinType_value = map[string]int32{
 		"BadType":        0,
@@ -45,6 +49,8 @@ var (
 		"MetaType":       2,
 		"ClusterDAGType": 3,
 		"ShardType":      4,
+		"CollectionType": 5,
+		"RecordType":     6,
 	}
 )
 
@@ -80,13 +86,16 @@ type Pin struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Cid         []byte      `protobuf:"bytes,1,opt,name=Cid,proto3" json:"Cid,omitempty"`
-	Type        Pin_PinType `protobuf:"varint,2,opt,name=Type,proto3,enum=api.pb.Pin_PinType" json:"Type,omitempty"`
-	Allocations [][]byte    `protobuf:"bytes,3,rep,name=Allocations,proto3" json:"Allocations,omitempty"`
-	MaxDepth    int32       `protobuf:"zigzag32,4,opt,name=MaxDepth,proto3" json:"MaxDepth,omitempty"`
-	Reference   []byte      `protobuf:"bytes,5,opt,name=Reference,proto3" json:"Reference,omitempty"`
-	Options     *PinOptions `protobuf:"bytes,6,opt,name=Options,proto3" json:"Options,omitempty"`
-	Timestamp   uint64      `protobuf:"varint,7,opt,name=Timestamp,proto3" json:"Timestamp,omitempty"`
+	Cid               []byte      `protobuf:"bytes,1,opt,name=Cid,proto3" json:"Cid,omitempty"`
+	Type              Pin_PinType `protobuf:"varint,2,opt,name=Type,proto3,enum=api.pb.Pin_PinType" json:"Type,omitempty"`
+	Allocations       [][]byte    `protobuf:"bytes,3,rep,name=Allocations,proto3" json:"Allocations,omitempty"`
+	MaxDepth          int32       `protobuf:"zigzag32,4,opt,name=MaxDepth,proto3" json:"MaxDepth,omitempty"`
+	Reference         []byte      `protobuf:"bytes,5,opt,name=Reference,proto3" json:"Reference,omitempty"`
+	Options           *PinOptions `protobuf:"bytes,6,opt,name=Options,proto3" json:"Options,omitempty"`
+	Timestamp         uint64      `protobuf:"varint,7,opt,name=Timestamp,proto3" json:"Timestamp,omitempty"`
+	Parents           [][]byte    `protobuf:"bytes,8,rep,name=Parents,proto3" json:"Parents,omitempty"`
+	FailedAllocations [][]byte    `protobuf:"bytes,9,rep,name=FailedAllocations,proto3" json:"FailedAllocations,omitempty"`
+	Size              uint64      `protobuf:"varint,10,opt,name=Size,proto3" json:"Size,omitempty"`
 }
 
 func (x *Pin) Reset() {
@@ -170,6 +179,27 @@ func (x *Pin) GetTimestamp() uint64 {
 	return 0
 }
 
+func (x *Pin) GetParents() [][]byte {
+	if x != nil {
+		return x.Parents
+	}
+	return nil
+}
+
+func (x *Pin) GetFailedAllocations() [][]byte {
+	if x != nil {
+		return x.FailedAllocations
+	}
+	return nil
+}
+
+func (x *Pin) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
 type PinOptions struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -185,6 +215,11 @@ type PinOptions struct {
 	ExpireAt       uint64            `protobuf:"varint,8,opt,name=ExpireAt,proto3" json:"ExpireAt,omitempty"`
 	Origins        [][]byte          `protobuf:"bytes,9,rep,name=Origins,proto3" json:"Origins,omitempty"`
 	SortedMetadata []*Metadata       `protobuf:"bytes,10,rep,name=SortedMetadata,proto3" json:"SortedMetadata,omitempty"`
+	Priority       int32             `protobuf:"zigzag32,11,opt,name=Priority,proto3" json:"Priority,omitempty"`
+	AntiAffinity   []string          `protobuf:"bytes,12,rep,name=AntiAffinity,proto3" json:"AntiAffinity,omitempty"`
+	Spread         []string          `protobuf:"bytes,13,rep,name=Spread,proto3" json:"Spread,omitempty"`
+	CallbackURL    string            `protobuf:"bytes,14,opt,name=CallbackURL,proto3" json:"CallbackURL,omitempty"`
+	Owner          string            `protobuf:"bytes,15,opt,name=Owner,proto3" json:"Owner,omitempty"`
 }
 
 func (x *PinOptions) Reset() {
@@ -283,6 +318,41 @@ func (x *PinOptions) GetSortedMetadata() []*Metadata {
 	return nil
 }
 
+func (x *PinOptions) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *PinOptions) GetAntiAffinity() []string {
+	if x != nil {
+		return x.AntiAffinity
+	}
+	return nil
+}
+
+func (x *PinOptions) GetSpread() []string {
+	if x != nil {
+		return x.Spread
+	}
+	return nil
+}
+
+func (x *PinOptions) GetCallbackURL() string {
+	if x != nil {
+		return x.CallbackURL
+	}
+	return ""
+}
+
+func (x *PinOptions) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
 type Metadata struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -342,7 +412,7 @@ var File_types_proto protoreflect.FileDescriptor
 
 var file_types_proto_rawDesc = []byte{
 	0x0a, 0x0b, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x06, 0x61,
-	0x70, 0x69, 0x2e, 0x70, 0x62, 0x22, 0xbf, 0x02, 0x0a, 0x03, 0x50, 0x69, 0x6e, 0x12, 0x10, 0x0a,
+	0x70, 0x69, 0x2e, 0x70, 0x62, 0x22, 0xbf, 0x03, 0x0a, 0x03, 0x50, 0x69, 0x6e, 0x12, 0x10, 0x0a,
 	0x03, 0x43, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x43, 0x69, 0x64, 0x12,
 	0x27, 0x0a, 0x04, 0x54, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x13, 0x2e,
 	0x61, 0x70, 0x69, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x69, 0x6e, 0x2e, 0x50, 0x69, 0x6e, 0x54, 0x79,
@@ -357,12 +427,20 @@ var file_types_proto_rawDesc = []byte{
 	0x69, 0x6e, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x07, 0x4f, 0x70, 0x74, 0x69, 0x6f,
 	0x6e, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18,
 	0x07, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70,
-	0x22, 0x55, 0x0a, 0x07, 0x50, 0x69, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x42,
-	0x61, 0x64, 0x54, 0x79, 0x70, 0x65, 0x10, 0x00, 0x12, 0x0c, 0x0a, 0x08, 0x44, 0x61, 0x74, 0x61,
-	0x54, 0x79, 0x70, 0x65, 0x10, 0x01, 0x12, 0x0c, 0x0a, 0x08, 0x4d, 0x65, 0x74, 0x61, 0x54, 0x79,
-	0x70, 0x65, 0x10, 0x02, 0x12, 0x12, 0x0a, 0x0e, 0x43, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x44,
-	0x41, 0x47, 0x54, 0x79, 0x70, 0x65, 0x10, 0x03, 0x12, 0x0d, 0x0a, 0x09, 0x53, 0x68, 0x61, 0x72,
-	0x64, 0x54, 0x79, 0x70, 0x65, 0x10, 0x04, 0x22, 0xb9, 0x03, 0x0a, 0x0a, 0x50, 0x69, 0x6e, 0x4f,
+	0x12, 0x18, 0x0a, 0x07, 0x50, 0x61, 0x72, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28,
+	0x0c, 0x52, 0x07, 0x50, 0x61, 0x72, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x2c, 0x0a, 0x11, 0x46, 0x61,
+	0x69, 0x6c, 0x65, 0x64, 0x41, 0x6c, 0x6c, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18,
+	0x09, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x11, 0x46, 0x61, 0x69, 0x6c, 0x65, 0x64, 0x41, 0x6c, 0x6c,
+	0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x53, 0x69, 0x7a, 0x65,
+	0x18, 0x0a, 0x20, 0x01, 0x28, 0x04, 0x52, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x22, 0x79, 0x0a, 0x07,
+	0x50, 0x69, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x42, 0x61, 0x64, 0x54, 0x79,
+	0x70, 0x65, 0x10, 0x00, 0x12, 0x0c, 0x0a, 0x08, 0x44, 0x61, 0x74, 0x61, 0x54, 0x79, 0x70, 0x65,
+	0x10, 0x01, 0x12, 0x0c, 0x0a, 0x08, 0x4d, 0x65, 0x74, 0x61, 0x54, 0x79, 0x70, 0x65, 0x10, 0x02,
+	0x12, 0x12, 0x0a, 0x0e, 0x43, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x44, 0x41, 0x47, 0x54, 0x79,
+	0x70, 0x65, 0x10, 0x03, 0x12, 0x0d, 0x0a, 0x09, 0x53, 0x68, 0x61, 0x72, 0x64, 0x54, 0x79, 0x70,
+	0x65, 0x10, 0x04, 0x12, 0x12, 0x0a, 0x0e, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x69, 0x6f,
+	0x6e, 0x54, 0x79, 0x70, 0x65, 0x10, 0x05, 0x12, 0x0e, 0x0a, 0x0a, 0x52, 0x65, 0x63, 0x6f, 0x72,
+	0x64, 0x54, 0x79, 0x70, 0x65, 0x10, 0x06, 0x22, 0xc9, 0x04, 0x0a, 0x0a, 0x50, 0x69, 0x6e, 0x4f,
 	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x32, 0x0a, 0x14, 0x52, 0x65, 0x70, 0x6c, 0x69, 0x63,
 	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x46, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x4d, 0x69, 0x6e, 0x18, 0x01,
 	0x20, 0x01, 0x28, 0x11, 0x52, 0x14, 0x52, 0x65, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f,
@@ -386,6 +464,15 @@ var file_types_proto_rawDesc = []byte{
 	0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x0a, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10,
 	0x2e, 0x61, 0x70, 0x69, 0x2e, 0x70, 0x62, 0x2e, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61,
 	0x52, 0x0e, 0x53, 0x6f, 0x72, 0x74, 0x65, 0x64, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61,
+	0x12, 0x1a, 0x0a, 0x08, 0x50, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x18, 0x0b, 0x20, 0x01,
+	0x28, 0x11, 0x52, 0x08, 0x50, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x12, 0x22, 0x0a, 0x0c,
+	0x41, 0x6e, 0x74, 0x69, 0x41, 0x66, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x79, 0x18, 0x0c, 0x20, 0x03,
+	0x28, 0x09, 0x52, 0x0c, 0x41, 0x6e, 0x74, 0x69, 0x41, 0x66, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x79,
+	0x12, 0x16, 0x0a, 0x06, 0x53, 0x70, 0x72, 0x65, 0x61, 0x64, 0x18, 0x0d, 0x20, 0x03, 0x28, 0x09,
+	0x52, 0x06, 0x53, 0x70, 0x72, 0x65, 0x61, 0x64, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x61, 0x6c, 0x6c,
+	0x62, 0x61, 0x63, 0x6b, 0x55, 0x52, 0x4c, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x43,
+	0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x55, 0x52, 0x4c, 0x12, 0x14, 0x0a, 0x05, 0x4f, 0x77,
+	0x6e, 0x65, 0x72, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x4f, 0x77, 0x6e, 0x65, 0x72,
 	0x1a, 0x3b, 0x0a, 0x0d, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x45, 0x6e, 0x74, 0x72,
 	0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03,
 	0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01,
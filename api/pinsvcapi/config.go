@@ -113,6 +113,7 @@ func defaultFunc(cfg *common.Config) error {
 
 	// Auth
 	cfg.BasicAuthCredentials = nil
+	cfg.Roles = nil
 
 	// Logs
 	cfg.HTTPLogFile = ""
@@ -62,6 +62,9 @@ type Pin struct {
 	Name    PinName           `json:"name,omitempty"`
 	Origins []types.Multiaddr `json:"origins,omitempty"`
 	Meta    map[string]string `json:"meta,omitempty"`
+	// Priority is a cluster extension to the pinning services API.
+	// See api.PinOptions.
+	Priority int `json:"priority,omitempty"`
 }
 
 // Defined returns if the pinis empty (Cid not set).
@@ -40,7 +40,7 @@ var apiInfo map[string]string = map[string]string{
 
 func trackerStatusToSvcStatus(st types.TrackerStatus) pinsvc.Status {
 	switch {
-	case st.Match(types.TrackerStatusError):
+	case st.Match(types.TrackerStatusError | types.TrackerStatusCorrupted):
 		return pinsvc.StatusFailed
 	case st.Match(types.TrackerStatusPinQueued):
 		return pinsvc.StatusQueued
@@ -57,7 +57,7 @@ func svcStatusToTrackerStatus(st pinsvc.Status) types.TrackerStatus {
 	var tst types.TrackerStatus
 
 	if st.Match(pinsvc.StatusFailed) {
-		tst |= types.TrackerStatusError
+		tst |= types.TrackerStatusError | types.TrackerStatusCorrupted
 	}
 	if st.Match(pinsvc.StatusQueued) {
 		tst |= types.TrackerStatusPinQueued
@@ -77,6 +77,7 @@ func svcPinToClusterPin(p pinsvc.Pin) (types.Pin, error) {
 		Origins:  p.Origins,
 		Metadata: p.Meta,
 		Mode:     types.PinModeRecursive,
+		Priority: p.Priority,
 	}
 	return types.PinWithOpts(p.Cid, opts), nil
 }
@@ -98,10 +99,11 @@ func globalPinInfoToSvcPinStatus(
 	status.Status = trackerStatusToSvcStatus(statusMask)
 	status.Created = gpi.Created
 	status.Pin = pinsvc.Pin{
-		Cid:     gpi.Cid,
-		Name:    pinsvc.PinName(gpi.Name),
-		Origins: gpi.Origins,
-		Meta:    gpi.Metadata,
+		Cid:      gpi.Cid,
+		Name:     pinsvc.PinName(gpi.Name),
+		Origins:  gpi.Origins,
+		Meta:     gpi.Metadata,
+		Priority: gpi.Priority,
 	}
 
 	status.Info = apiInfo
@@ -147,36 +149,42 @@ func (api *API) routes(c *rpc.Client) []common.Route {
 			Method:      "GET",
 			Pattern:     "/pins",
 			HandlerFunc: api.listPins,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "AddPin",
 			Method:      "POST",
 			Pattern:     "/pins",
 			HandlerFunc: api.addPin,
+			Role:        common.RolePinner,
 		},
 		{
 			Name:        "GetPin",
 			Method:      "GET",
 			Pattern:     "/pins/{requestID}",
 			HandlerFunc: api.getPin,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "ReplacePin",
 			Method:      "POST",
 			Pattern:     "/pins/{requestID}",
 			HandlerFunc: api.addPin,
+			Role:        common.RolePinner,
 		},
 		{
 			Name:        "RemovePin",
 			Method:      "DELETE",
 			Pattern:     "/pins/{requestID}",
 			HandlerFunc: api.removePin,
+			Role:        common.RolePinner,
 		},
 		{
 			Name:        "GetToken",
 			Method:      "POST",
 			Pattern:     "/token",
 			HandlerFunc: api.GenerateTokenHandler,
+			Role:        common.RoleReader,
 		},
 	}
 }
@@ -221,6 +229,10 @@ func (api *API) addPin(w http.ResponseWriter, r *http.Request) {
 			clusterPin.PinUpdate = updateCid
 		}
 
+		if !api.AuthorizePin(w, r, &clusterPin) {
+			return
+		}
+
 		// Pin item
 		var pinObj types.Pin
 		err = api.rpcClient.CallContext(
@@ -296,6 +308,9 @@ func (api *API) removePin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	api.config.Logger.Debugf("removePin: %s", c)
+	if !api.AuthorizeModify(w, r, c) {
+		return
+	}
 	var pinObj types.Pin
 	err := api.rpcClient.CallContext(
 		r.Context(),
@@ -430,10 +445,11 @@ func (api *API) pinToSvcPinStatus(ctx context.Context, rID string, pin types.Pin
 		Status:    pinsvc.StatusQueued,
 		Created:   pin.Timestamp,
 		Pin: pinsvc.Pin{
-			Cid:     pin.Cid,
-			Name:    pinsvc.PinName(pin.Name),
-			Origins: pin.Origins,
-			Meta:    pin.Metadata,
+			Cid:      pin.Cid,
+			Name:     pinsvc.PinName(pin.Name),
+			Origins:  pin.Origins,
+			Meta:     pin.Metadata,
+			Priority: pin.Priority,
 		},
 		Info: apiInfo,
 	}
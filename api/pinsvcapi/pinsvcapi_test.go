@@ -3,6 +3,7 @@ package pinsvcapi
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 	"strings"
 	"testing"
 	"time"
@@ -169,6 +170,7 @@ func TestAPIPinEndpoint(t *testing.T) {
 			Meta: map[string]string{
 				"meta": "data",
 			},
+			Priority: 5,
 		}
 		var status pinsvc.PinStatus
 		pinJSON, err := json.Marshal(pin)
@@ -186,6 +188,9 @@ func TestAPIPinEndpoint(t *testing.T) {
 		if len(status.Pin.Origins) != 1 {
 			t.Errorf("expected origins: %+v", status.Pin)
 		}
+		if status.Pin.Priority != 5 {
+			t.Errorf("priority should match: %+v", status.Pin)
+		}
 		if len(status.Delegates) != 3 {
 			t.Errorf("expected 3 delegates: %+v", status)
 		}
@@ -251,3 +256,50 @@ func TestAPIRemovePinEndpoint(t *testing.T) {
 
 	test.BothEndpoints(t, tf)
 }
+
+func TestAPIRoutesHaveRoles(t *testing.T) {
+	svcapi := &API{}
+	for _, route := range svcapi.routes(nil) {
+		if route.Role == 0 {
+			t.Errorf("route %s does not have a role", route.Name)
+		}
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	ctx := context.Background()
+	cfg := NewConfig()
+	cfg.Default()
+	cfg.BasicAuthCredentials = map[string]string{
+		clustertest.PinOwner: "password",
+	}
+	svcapi := testAPIwithConfig(t, cfg, "api keys")
+	defer svcapi.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		h := test.MakeHost(t, svcapi)
+		defer h.Close()
+		c := test.HTTPClient(t, h, test.IsHTTPS(url(svcapi)))
+
+		do := func(method string) int {
+			req, _ := http.NewRequest(method, url(svcapi)+"/pins", strings.NewReader("{}"))
+			req.Header.Set("Authorization", "Bearer "+clustertest.APIKeyToken)
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		if status := do("GET"); status != http.StatusOK {
+			t.Errorf("api keys should be accepted: %d", status)
+		}
+		// the mock key only has the read scope.
+		if status := do("POST"); status != http.StatusForbidden {
+			t.Errorf("read keys should not be able to pin: %d", status)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
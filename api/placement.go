@@ -0,0 +1,194 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Placement constraints restrict the peers that can be allocated to a pin
+// based on the values of their metrics, usually the "tag:<name>" metrics
+// produced by the tags informer:
+//
+//   - AntiAffinity metrics: no two allocations may share the same value,
+//     i.e. "at most one replica per rack". Peers without the metric are
+//     never allocated.
+//   - Spread metrics: every value among the peers available for
+//     allocation must be held by at least one allocation, i.e. "at least
+//     one replica in each region".
+
+// HasPlacementConstraints returns true when the options set any placement
+// constraint.
+func (po PinOptions) HasPlacementConstraints() bool {
+	return len(po.AntiAffinity) > 0 || len(po.Spread) > 0
+}
+
+// PlacementMetrics returns the names of the metrics needed to enforce the
+// placement constraints, without duplicates.
+func (po PinOptions) PlacementMetrics() []string {
+	var names []string
+	seen := make(map[string]struct{})
+	for _, list := range [][]string{po.AntiAffinity, po.Spread} {
+		for _, name := range list {
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ApplyPlacement takes the peers sorted by an allocator and returns them
+// in an order that satisfies the placement constraints: peers needed to
+// spread the allocations come first, followed by the rest, and peers that
+// would break an anti-affinity constraint are left out. Taking up to
+// ReplicationFactorMax - len(current) peers from the result honours every
+// constraint.
+//
+// The metrics sets are those given to the allocator. An error is returned
+// when the constraints cannot be satisfied with the given peers and
+// replication factors.
+func (po PinOptions) ApplyPlacement(sorted []peer.ID, current, candidates, priority MetricsSet) ([]peer.ID, error) {
+	if !po.HasPlacementConstraints() {
+		return sorted, nil
+	}
+
+	values := make(map[string]map[peer.ID]string)
+	for _, name := range po.PlacementMetrics() {
+		values[name] = make(map[peer.ID]string)
+		for _, set := range []MetricsSet{current, candidates, priority} {
+			for _, m := range set[name] {
+				values[name][m.Peer] = m.Value
+			}
+		}
+	}
+
+	currentPeers := make(map[peer.ID]struct{})
+	for _, metrics := range current {
+		for _, m := range metrics {
+			currentPeers[m.Peer] = struct{}{}
+		}
+	}
+
+	// values taken by the allocations, per anti-affinity metric.
+	used := make(map[string]map[string]bool)
+	for _, name := range po.AntiAffinity {
+		used[name] = make(map[string]bool)
+		for p := range currentPeers {
+			if v, ok := values[name][p]; ok {
+				used[name][v] = true
+			}
+		}
+	}
+
+	// values without allocations, per spread metric.
+	missing := make(map[string]map[string]bool)
+	for _, name := range po.Spread {
+		missing[name] = make(map[string]bool)
+		for _, v := range values[name] {
+			missing[name][v] = true
+		}
+		for p := range currentPeers {
+			if v, ok := values[name][p]; ok {
+				delete(missing[name], v)
+			}
+		}
+	}
+
+	conflicts := func(p peer.ID) bool {
+		for _, name := range po.AntiAffinity {
+			v, ok := values[name][p]
+			if !ok || used[name][v] {
+				return true
+			}
+		}
+		return false
+	}
+
+	spreads := func(p peer.ID) bool {
+		for _, name := range po.Spread {
+			v, ok := values[name][p]
+			if ok && missing[name][v] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var allocs []peer.ID
+	chosen := make(map[peer.ID]bool)
+	take := func(p peer.ID) {
+		for _, name := range po.AntiAffinity {
+			used[name][values[name][p]] = true
+		}
+		for _, name := range po.Spread {
+			if v, ok := values[name][p]; ok {
+				delete(missing[name], v)
+			}
+		}
+		chosen[p] = true
+		allocs = append(allocs, p)
+	}
+
+	// First the peers that place replicas in values that have none,
+	// in the order given by the allocator.
+	for _, p := range sorted {
+		if !conflicts(p) && spreads(p) {
+			take(p)
+		}
+	}
+
+	for _, name := range po.Spread {
+		if len(missing[name]) == 0 {
+			continue
+		}
+		var vs []string
+		for v := range missing[name] {
+			vs = append(vs, v)
+		}
+		sort.Strings(vs)
+		return nil, fmt.Errorf(
+			"placement constraints cannot be satisfied: no eligible peers to spread allocations to %s=%s",
+			name,
+			strings.Join(vs, ","),
+		)
+	}
+
+	if po.ReplicationFactorMax > 0 {
+		wanted := po.ReplicationFactorMax - len(currentPeers)
+		if len(allocs) > wanted {
+			return nil, fmt.Errorf(
+				"placement constraints cannot be satisfied: spreading allocations over %s needs %d new allocations but the maximum replication factor allows %d",
+				strings.Join(po.Spread, ","),
+				len(allocs),
+				wanted,
+			)
+		}
+	}
+
+	for _, p := range sorted {
+		if !chosen[p] && !conflicts(p) {
+			take(p)
+		}
+	}
+
+	// When there were not enough peers to begin with, let the caller
+	// complain about it.
+	if po.ReplicationFactorMin > 0 {
+		needed := po.ReplicationFactorMin - len(currentPeers)
+		if len(allocs) < needed && len(sorted) >= needed {
+			return nil, fmt.Errorf(
+				"placement constraints cannot be satisfied: anti-affinity on %s leaves %d eligible peers but %d new allocations are needed",
+				strings.Join(po.AntiAffinity, ","),
+				len(allocs),
+				needed,
+			)
+		}
+	}
+
+	return allocs, nil
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+var placementTags = map[peer.ID][2]string{
+	"p1": {"r1", "eu"},
+	"p2": {"r1", "eu"},
+	"p3": {"r2", "eu"},
+	"p4": {"r3", "us"},
+	"p5": {"r4", "us"},
+	"p6": {"r5", "asia"},
+}
+
+func placementMetrics(peers ...peer.ID) MetricsSet {
+	set := make(MetricsSet)
+	for _, p := range peers {
+		tags := placementTags[p]
+		set["tag:rack"] = append(set["tag:rack"], Metric{Name: "tag:rack", Peer: p, Value: tags[0]})
+		set["tag:region"] = append(set["tag:region"], Metric{Name: "tag:region", Peer: p, Value: tags[1]})
+	}
+	return set
+}
+
+func TestApplyPlacement(t *testing.T) {
+	all := []peer.ID{"p1", "p2", "p3", "p4", "p5", "p6"}
+
+	type testcase struct {
+		name       string
+		opts       PinOptions
+		current    []peer.ID
+		candidates []peer.ID
+		sorted     []peer.ID
+		expected   []peer.ID
+		err        string
+	}
+
+	testcases := []testcase{
+		{
+			name:       "no constraints",
+			opts:       PinOptions{ReplicationFactorMin: 1, ReplicationFactorMax: 2},
+			candidates: all,
+			sorted:     []peer.ID{"p2", "p1"},
+			expected:   []peer.ID{"p2", "p1"},
+		},
+		{
+			name:       "anti-affinity",
+			opts:       PinOptions{ReplicationFactorMin: 1, ReplicationFactorMax: 3, AntiAffinity: []string{"tag:rack"}},
+			candidates: all,
+			sorted:     []peer.ID{"p1", "p2", "p3", "p4"},
+			expected:   []peer.ID{"p1", "p3", "p4"},
+		},
+		{
+			name:       "anti-affinity with current allocations",
+			opts:       PinOptions{ReplicationFactorMin: 2, ReplicationFactorMax: 3, AntiAffinity: []string{"tag:rack"}},
+			current:    []peer.ID{"p1"},
+			candidates: []peer.ID{"p2", "p3", "p4"},
+			sorted:     []peer.ID{"p2", "p3", "p4"},
+			expected:   []peer.ID{"p3", "p4"},
+		},
+		{
+			name:       "anti-affinity leaves too few peers",
+			opts:       PinOptions{ReplicationFactorMin: 2, ReplicationFactorMax: 2, AntiAffinity: []string{"tag:rack"}},
+			candidates: []peer.ID{"p1", "p2"},
+			sorted:     []peer.ID{"p1", "p2"},
+			err:        "anti-affinity on tag:rack",
+		},
+		{
+			name:       "spread",
+			opts:       PinOptions{ReplicationFactorMin: 1, ReplicationFactorMax: 3, Spread: []string{"tag:region"}},
+			candidates: all,
+			sorted:     all,
+			expected:   []peer.ID{"p1", "p4", "p6", "p2", "p3", "p5"},
+		},
+		{
+			name:       "spread with current allocations",
+			opts:       PinOptions{ReplicationFactorMin: 1, ReplicationFactorMax: 3, Spread: []string{"tag:region"}},
+			current:    []peer.ID{"p2"},
+			candidates: []peer.ID{"p1", "p3", "p4", "p5", "p6"},
+			sorted:     []peer.ID{"p1", "p3", "p5", "p4", "p6"},
+			expected:   []peer.ID{"p5", "p6", "p1", "p3", "p4"},
+		},
+		{
+			name:       "spread over more values than allowed",
+			opts:       PinOptions{ReplicationFactorMin: 1, ReplicationFactorMax: 2, Spread: []string{"tag:region"}},
+			candidates: all,
+			sorted:     all,
+			err:        "maximum replication factor allows 2",
+		},
+		{
+			name:       "spread to value without eligible peers",
+			opts:       PinOptions{ReplicationFactorMin: 1, ReplicationFactorMax: 3, Spread: []string{"tag:region"}},
+			candidates: all,
+			sorted:     []peer.ID{"p1", "p4"},
+			err:        "tag:region=asia",
+		},
+		{
+			name: "spread and anti-affinity",
+			opts: PinOptions{
+				ReplicationFactorMin: 1,
+				ReplicationFactorMax: 4,
+				AntiAffinity:         []string{"tag:rack"},
+				Spread:               []string{"tag:region"},
+			},
+			candidates: all,
+			sorted:     all,
+			expected:   []peer.ID{"p1", "p4", "p6", "p3", "p5"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var current MetricsSet
+			if len(tc.current) > 0 {
+				current = placementMetrics(tc.current...)
+			}
+			candidates := placementMetrics(tc.candidates...)
+
+			peers, err := tc.opts.ApplyPlacement(tc.sorted, current, candidates, nil)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(peers) != len(tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, peers)
+			}
+			for i := range peers {
+				if peers[i] != tc.expected[i] {
+					t.Fatalf("expected %v, got %v", tc.expected, peers)
+				}
+			}
+		})
+	}
+}
+
+func TestPlacementMetrics(t *testing.T) {
+	po := PinOptions{
+		AntiAffinity: []string{"tag:rack", "tag:region"},
+		Spread:       []string{"tag:region", "tag:zone"},
+	}
+	names := po.PlacementMetrics()
+	if strings.Join(names, ",") != "tag:rack,tag:region,tag:zone" {
+		t.Errorf("unexpected metrics: %v", names)
+	}
+}
@@ -0,0 +1,351 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// PinQuery selects which pins are returned when listing the pinset. Zero
+// values mean that the corresponding field is not used for filtering.
+//
+// Pins are listed in a stable order: that of the keys in the state, or the
+// one given by Sort. When Limit is set, the next page is obtained by
+// setting the Cursor to the CID of the last pin in the previous page.
+type PinQuery struct {
+	// Type is a bitmask of the pin types to list. When unset, all
+	// types but records are listed (see AllType).
+	Type PinType `json:"type,omitempty" codec:"t,omitempty"`
+	// Name matches pins whose name contains this string.
+	Name string `json:"name,omitempty" codec:"n,omitempty"`
+	// NameRegexp matches pins whose name matches this regular
+	// expression.
+	NameRegexp string `json:"name_regexp,omitempty" codec:"r,omitempty"`
+	// Metadata matches pins which have all these metadata keys set to
+	// the given values.
+	Metadata map[string]string `json:"metadata,omitempty" codec:"m,omitempty"`
+	// CreatedAfter and CreatedBefore match pins added in that time
+	// window.
+	CreatedAfter  time.Time `json:"created_after,omitempty" codec:"ca,omitempty"`
+	CreatedBefore time.Time `json:"created_before,omitempty" codec:"cb,omitempty"`
+	// ExpireBefore matches pins which expire before the given time.
+	ExpireBefore time.Time `json:"expire_before,omitempty" codec:"eb,omitempty"`
+	// Allocation matches pins which should be pinned by the given peer,
+	// including pins which are pinned everywhere.
+	Allocation peer.ID `json:"allocation,omitempty" codec:"a,omitempty"`
+	// ReplicationFactorMin and ReplicationFactorMax match pins with
+	// exactly those replication factors.
+	ReplicationFactorMin int `json:"replication_factor_min,omitempty" codec:"rn,omitempty"`
+	ReplicationFactorMax int `json:"replication_factor_max,omitempty" codec:"rx,omitempty"`
+	// Owner matches pins made by the given API user.
+	Owner string `json:"owner,omitempty" codec:"o,omitempty"`
+	// Parent matches pins which have the given CID among their Parents,
+	// like the members of a collection.
+	Parent Cid `json:"parent,omitempty" codec:"p,omitempty"`
+	// Sort is one of SortByName, SortByCreated and SortByExpire,
+	// optionally prefixed with "-" to sort in descending order. Pins
+	// with the same value are listed in key order.
+	Sort string `json:"sort,omitempty" codec:"so,omitempty"`
+	// Limit is the maximum number of pins to list.
+	Limit int `json:"limit,omitempty" codec:"l,omitempty"`
+	// Cursor is the CID of the last pin of the previous page. Only pins
+	// after it are listed.
+	Cursor Cid `json:"cursor,omitempty" codec:"c,omitempty"`
+}
+
+// Sort orders for PinQuery.
+const (
+	SortByName    = "name"
+	SortByCreated = "created"
+	SortByExpire  = "expire"
+)
+
+// SortCompare returns a function which compares two pins by the query Sort,
+// returning a negative number when a goes before b and a positive one when
+// it goes after. It returns nil when the query is not sorted.
+func (pq PinQuery) SortCompare() (func(a, b Pin) int, error) {
+	if pq.Sort == "" {
+		return nil, nil
+	}
+
+	field := strings.TrimPrefix(pq.Sort, "-")
+	desc := field != pq.Sort
+
+	var cmp func(a, b Pin) int
+	switch field {
+	case SortByName:
+		cmp = func(a, b Pin) int {
+			return strings.Compare(a.Name, b.Name)
+		}
+	case SortByCreated:
+		cmp = func(a, b Pin) int {
+			return compareTimes(a.Timestamp, b.Timestamp)
+		}
+	case SortByExpire:
+		// Pins which do not expire go last.
+		cmp = func(a, b Pin) int {
+			aNever := a.ExpireAt.IsZero() || a.ExpireAt.Equal(unixZero)
+			bNever := b.ExpireAt.IsZero() || b.ExpireAt.Equal(unixZero)
+			switch {
+			case aNever && bNever:
+				return 0
+			case aNever:
+				return 1
+			case bNever:
+				return -1
+			}
+			return compareTimes(a.ExpireAt, b.ExpireAt)
+		}
+	default:
+		return nil, fmt.Errorf("invalid sort value: %s", pq.Sort)
+	}
+
+	if desc {
+		return func(a, b Pin) int {
+			return cmp(b, a)
+		}, nil
+	}
+	return cmp, nil
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ToQuery returns the PinQuery as query arguments for the REST API.
+func (pq PinQuery) ToQuery() (string, error) {
+	q := url.Values{}
+
+	if pq.Type != 0 && pq.Type != AllType {
+		var types []string
+		for _, t := range []PinType{DataType, MetaType, ClusterDAGType, ShardType, CollectionType} {
+			if pq.Type&t > 0 {
+				types = append(types, t.String())
+			}
+		}
+		q.Set("filter", strings.Join(types, ","))
+	}
+	if pq.Name != "" {
+		q.Set("name", pq.Name)
+	}
+	if pq.NameRegexp != "" {
+		q.Set("name-regexp", pq.NameRegexp)
+	}
+	for k, v := range pq.Metadata {
+		if k == "" {
+			continue
+		}
+		q.Set(pinOptionsMetaPrefix+k, v)
+	}
+	for name, tm := range map[string]time.Time{
+		"created-after":  pq.CreatedAfter,
+		"created-before": pq.CreatedBefore,
+		"expire-before":  pq.ExpireBefore,
+	} {
+		if tm.IsZero() {
+			continue
+		}
+		v, err := tm.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		q.Set(name, string(v))
+	}
+	if pq.Allocation != "" {
+		q.Set("allocation", pq.Allocation.String())
+	}
+	if pq.ReplicationFactorMin != 0 {
+		q.Set("replication-min", fmt.Sprintf("%d", pq.ReplicationFactorMin))
+	}
+	if pq.ReplicationFactorMax != 0 {
+		q.Set("replication-max", fmt.Sprintf("%d", pq.ReplicationFactorMax))
+	}
+	if pq.Owner != "" {
+		q.Set("owner", pq.Owner)
+	}
+	if pq.Parent.Defined() {
+		q.Set("parent", pq.Parent.String())
+	}
+	if pq.Sort != "" {
+		q.Set("sort", pq.Sort)
+	}
+	if pq.Limit != 0 {
+		q.Set("limit", fmt.Sprintf("%d", pq.Limit))
+	}
+	if pq.Cursor.Defined() {
+		q.Set("cursor", pq.Cursor.String())
+	}
+	return q.Encode(), nil
+}
+
+// FromQuery is the inverse of ToQuery().
+func (pq *PinQuery) FromQuery(q url.Values) error {
+	for _, f := range strings.Split(q.Get("filter"), ",") {
+		pq.Type |= PinTypeFromString(f)
+	}
+	if pq.Type == BadType || pq.Type&RecordType != 0 {
+		return fmt.Errorf("invalid filter value")
+	}
+
+	pq.Name = q.Get("name")
+	pq.NameRegexp = q.Get("name-regexp")
+	if pq.NameRegexp != "" {
+		if _, err := regexp.Compile(pq.NameRegexp); err != nil {
+			return fmt.Errorf("name-regexp cannot be parsed: %w", err)
+		}
+	}
+
+	for k := range q {
+		if !strings.HasPrefix(k, pinOptionsMetaPrefix) {
+			continue
+		}
+		metaKey := strings.TrimPrefix(k, pinOptionsMetaPrefix)
+		if metaKey == "" {
+			continue
+		}
+		if pq.Metadata == nil {
+			pq.Metadata = make(map[string]string)
+		}
+		pq.Metadata[metaKey] = q.Get(k)
+	}
+
+	for name, tm := range map[string]*time.Time{
+		"created-after":  &pq.CreatedAfter,
+		"created-before": &pq.CreatedBefore,
+		"expire-before":  &pq.ExpireBefore,
+	} {
+		if v := q.Get(name); v != "" {
+			err := tm.UnmarshalText([]byte(v))
+			if err != nil {
+				return fmt.Errorf("%s cannot be parsed: %w", name, err)
+			}
+		}
+	}
+
+	if v := q.Get("allocation"); v != "" {
+		pid, err := peer.Decode(v)
+		if err != nil {
+			return fmt.Errorf("error decoding allocation: %w", err)
+		}
+		pq.Allocation = pid
+	}
+
+	if v := q.Get("replication"); v != "" {
+		q.Set("replication-min", v)
+		q.Set("replication-max", v)
+	}
+	err := parseIntParam(q, "replication-min", &pq.ReplicationFactorMin)
+	if err != nil {
+		return err
+	}
+	err = parseIntParam(q, "replication-max", &pq.ReplicationFactorMax)
+	if err != nil {
+		return err
+	}
+
+	pq.Owner = q.Get("owner")
+
+	if v := q.Get("parent"); v != "" {
+		ci, err := DecodeCid(v)
+		if err != nil {
+			return fmt.Errorf("error decoding parent: %w", err)
+		}
+		pq.Parent = ci
+	}
+
+	pq.Sort = q.Get("sort")
+	if _, err := pq.SortCompare(); err != nil {
+		return err
+	}
+
+	err = parseIntParam(q, "limit", &pq.Limit)
+	if err != nil {
+		return err
+	}
+	if pq.Limit < 0 {
+		return fmt.Errorf("parameter limit invalid")
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		ci, err := DecodeCid(v)
+		if err != nil {
+			return fmt.Errorf("error decoding cursor: %w", err)
+		}
+		pq.Cursor = ci
+	}
+	return nil
+}
+
+// Matcher returns a function which returns true for the pins selected by
+// this query. Sort, Limit and Cursor are not taken into account.
+func (pq PinQuery) Matcher() (func(Pin) bool, error) {
+	var nameRe *regexp.Regexp
+	if pq.NameRegexp != "" {
+		re, err := regexp.Compile(pq.NameRegexp)
+		if err != nil {
+			return nil, err
+		}
+		nameRe = re
+	}
+
+	types := pq.Type
+	if types == 0 {
+		types = AllType
+	}
+
+	match := func(p Pin) bool {
+		if types&p.Type == 0 {
+			return false
+		}
+		if pq.Name != "" && !strings.Contains(p.Name, pq.Name) {
+			return false
+		}
+		if nameRe != nil && !nameRe.MatchString(p.Name) {
+			return false
+		}
+		for k, v := range pq.Metadata {
+			if pv, ok := p.Metadata[k]; !ok || pv != v {
+				return false
+			}
+		}
+		if !pq.CreatedAfter.IsZero() && !p.Timestamp.After(pq.CreatedAfter) {
+			return false
+		}
+		if !pq.CreatedBefore.IsZero() && !p.Timestamp.Before(pq.CreatedBefore) {
+			return false
+		}
+		if !pq.ExpireBefore.IsZero() {
+			if p.ExpireAt.IsZero() || p.ExpireAt.Equal(unixZero) || !p.ExpireAt.Before(pq.ExpireBefore) {
+				return false
+			}
+		}
+		if pq.Allocation != "" && p.IsRemotePin(pq.Allocation) {
+			return false
+		}
+		if pq.ReplicationFactorMin != 0 && p.ReplicationFactorMin != pq.ReplicationFactorMin {
+			return false
+		}
+		if pq.ReplicationFactorMax != 0 && p.ReplicationFactorMax != pq.ReplicationFactorMax {
+			return false
+		}
+		if pq.Owner != "" && p.Owner != pq.Owner {
+			return false
+		}
+		if pq.Parent.Defined() && !p.HasParent(pq.Parent) {
+			return false
+		}
+		return true
+	}
+	return match, nil
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestPinQueryQuery(t *testing.T) {
+	pid, _ := peer.Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	ci, _ := DecodeCid("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	pq := PinQuery{
+		Type:                 DataType | MetaType,
+		Name:                 "abc",
+		NameRegexp:           "^a.c$",
+		Metadata:             map[string]string{"key": "value"},
+		CreatedAfter:         now.Add(-time.Hour),
+		CreatedBefore:        now,
+		ExpireBefore:         now.Add(time.Hour),
+		Allocation:           pid,
+		ReplicationFactorMin: 2,
+		ReplicationFactorMax: 3,
+		Owner:                "alice",
+		Parent:               ci,
+		Sort:                 "-" + SortByCreated,
+		Limit:                10,
+		Cursor:               ci,
+	}
+
+	q, err := pq.ToQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := url.ParseQuery(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pq2 PinQuery
+	err = pq2.FromQuery(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pq2.Type != pq.Type ||
+		pq2.Name != pq.Name ||
+		pq2.NameRegexp != pq.NameRegexp ||
+		pq2.Metadata["key"] != "value" ||
+		!pq2.CreatedAfter.Equal(pq.CreatedAfter) ||
+		!pq2.CreatedBefore.Equal(pq.CreatedBefore) ||
+		!pq2.ExpireBefore.Equal(pq.ExpireBefore) ||
+		pq2.Allocation != pq.Allocation ||
+		pq2.ReplicationFactorMin != 2 ||
+		pq2.ReplicationFactorMax != 3 ||
+		pq2.Owner != "alice" ||
+		!pq2.Parent.Equals(ci) ||
+		pq2.Sort != "-created" ||
+		pq2.Limit != 10 ||
+		!pq2.Cursor.Equals(ci) {
+		t.Errorf("PinQuery did not survive a query round trip: %+v %+v", pq, pq2)
+	}
+
+	var empty PinQuery
+	err = empty.FromQuery(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Type != AllType {
+		t.Error("an empty query should list all types")
+	}
+
+	for _, bad := range []string{
+		"filter=invalid",
+		"filter=pin,record",
+		"name-regexp=(",
+		"created-after=yesterday",
+		"allocation=abc",
+		"limit=-1",
+		"cursor=abc",
+		"parent=abc",
+		"sort=size",
+	} {
+		values, _ := url.ParseQuery(bad)
+		var pq PinQuery
+		if err := pq.FromQuery(values); err == nil {
+			t.Errorf("expected an error parsing %s", bad)
+		}
+	}
+}
+
+func TestPinQueryMatcher(t *testing.T) {
+	pid1, _ := peer.Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	pid2, _ := peer.Decode("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+	ci, _ := DecodeCid("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+	now := time.Now()
+
+	pin := PinWithOpts(ci, PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 2,
+		Name:                 "holiday-photos",
+		Metadata:             map[string]string{"team": "a", "kind": "img"},
+		ExpireAt:             now.Add(time.Hour),
+		Owner:                "alice",
+	})
+	pin.Timestamp = now
+	pin.Allocations = []peer.ID{pid1}
+	pin.Parents = []Cid{ci}
+
+	testcases := []struct {
+		pq    PinQuery
+		match bool
+	}{
+		{PinQuery{}, true},
+		{PinQuery{Type: AllType}, true},
+		{PinQuery{Type: MetaType}, false},
+		{PinQuery{Type: RecordType}, false},
+		{PinQuery{Name: "photos"}, true},
+		{PinQuery{Name: "videos"}, false},
+		{PinQuery{NameRegexp: "^holiday-"}, true},
+		{PinQuery{NameRegexp: "^photos"}, false},
+		{PinQuery{Metadata: map[string]string{"team": "a"}}, true},
+		{PinQuery{Metadata: map[string]string{"team": "a", "kind": "doc"}}, false},
+		{PinQuery{Metadata: map[string]string{"owner": "a"}}, false},
+		{PinQuery{CreatedAfter: now.Add(-time.Minute)}, true},
+		{PinQuery{CreatedAfter: now.Add(time.Minute)}, false},
+		{PinQuery{CreatedBefore: now.Add(time.Minute)}, true},
+		{PinQuery{CreatedBefore: now.Add(-time.Minute)}, false},
+		{PinQuery{ExpireBefore: now.Add(2 * time.Hour)}, true},
+		{PinQuery{ExpireBefore: now.Add(time.Minute)}, false},
+		{PinQuery{Allocation: pid1}, true},
+		{PinQuery{Allocation: pid2}, false},
+		{PinQuery{ReplicationFactorMin: 1, ReplicationFactorMax: 2}, true},
+		{PinQuery{ReplicationFactorMax: 3}, false},
+		{PinQuery{Owner: "alice"}, true},
+		{PinQuery{Owner: "bob"}, false},
+		{PinQuery{Parent: ci}, true},
+		{PinQuery{Parent: CidUndef}, true},
+	}
+
+	for i, tc := range testcases {
+		match, err := tc.pq.Matcher()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match(pin) != tc.match {
+			t.Errorf("testcase %d: expected match to be %t", i, tc.match)
+		}
+	}
+
+	// Pins without expiration never match ExpireBefore and pins
+	// everywhere match any allocation.
+	pin.ExpireAt = time.Time{}
+	pin.ReplicationFactorMin = -1
+	pin.ReplicationFactorMax = -1
+	match, _ := PinQuery{ExpireBefore: now.Add(2 * time.Hour)}.Matcher()
+	if match(pin) {
+		t.Error("pins without expiration should not match")
+	}
+	match, _ = PinQuery{Allocation: pid2}.Matcher()
+	if !match(pin) {
+		t.Error("pins everywhere are allocated to every peer")
+	}
+}
@@ -0,0 +1,129 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	types "github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/api/common"
+
+	mux "github.com/gorilla/mux"
+)
+
+// This file contains the handlers to manage API keys. Users manage their
+// own keys, while admins can manage the keys of everyone. Requests
+// authenticated with an API key cannot create keys with scopes that the
+// key does not have.
+
+// apiKeys returns the API keys visible to the user which authenticated the
+// request with the given context.
+func (api *API) apiKeys(ctx context.Context) ([]types.APIKey, error) {
+	var keys []types.APIKey
+	err := api.rpcClient.CallContext(
+		ctx,
+		"",
+		"Cluster",
+		"APIKeys",
+		struct{}{},
+		&keys,
+	)
+	if err != nil || api.IsAdmin(ctx) {
+		return keys, err
+	}
+
+	user := common.User(ctx)
+	owned := make([]types.APIKey, 0, len(keys))
+	for _, k := range keys {
+		if k.User == user {
+			owned = append(owned, k)
+		}
+	}
+	return owned, nil
+}
+
+func (api *API) apiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := api.apiKeys(r.Context())
+	api.SendResponse(w, common.SetStatusAutomatically, err, keys)
+}
+
+func (api *API) apiKeyCreateHandler(w http.ResponseWriter, r *http.Request) {
+	var key types.APIKey
+	err := key.FromQuery(r.URL.Query())
+	if err != nil {
+		api.SendResponse(w, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	user := common.User(r.Context())
+	if key.User == "" {
+		key.User = user
+	}
+	if key.User != user && !api.IsAdmin(r.Context()) {
+		api.SendResponse(w, http.StatusForbidden, errors.New("forbidden: only admins can create api keys for other users"), nil)
+		return
+	}
+	if creds := api.config.BasicAuthCredentials; creds != nil {
+		if _, ok := creds[key.User]; !ok {
+			api.SendResponse(w, http.StatusBadRequest, fmt.Errorf("unknown user: %s", key.User), nil)
+			return
+		}
+	}
+	if parent, ok := common.RequestAPIKey(r.Context()); ok {
+		for _, s := range key.Scopes {
+			if !parent.HasScope(s) {
+				api.SendResponse(w, http.StatusForbidden, fmt.Errorf("forbidden: the api key used does not have the %s scope", s), nil)
+				return
+			}
+		}
+	}
+	if err := key.Validate(); err != nil {
+		api.SendResponse(w, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	var created types.APIKey
+	err = api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"APIKeyCreate",
+		key,
+		&created,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, created)
+}
+
+func (api *API) apiKeyRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["keyID"]
+
+	// Users can only see, and therefore revoke, their own keys
+	// unless they are admins.
+	keys, err := api.apiKeys(r.Context())
+	if err != nil {
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+		return
+	}
+	found := false
+	for _, k := range keys {
+		if k.ID == id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		api.SendResponse(w, http.StatusNotFound, errors.New("api key not found"), nil)
+		return
+	}
+
+	err = api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"APIKeyRevoke",
+		id,
+		&struct{}{},
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+}
@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	types "github.com/lubanproj/ipfs-cluster/api"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+	"go.uber.org/multierr"
+)
+
+// rpcNodeGetter is an ipld.NodeGetter which retrieves blocks by calling
+// IPFSConnector.BlockGet on a set of cluster peers. Peers are tried in
+// order, starting with the last one that could provide a block, so that
+// exporting a DAG mostly talks to a single peer but falls back to other
+// allocations when that peer does not have some of the data. The IPFS
+// daemon of the local peer is tried last, as it may need to fetch the
+// blocks from the network and store them.
+type rpcNodeGetter struct {
+	rpcClient *rpc.Client
+	peers     []peer.ID
+
+	mu   sync.Mutex
+	last int
+}
+
+func newRPCNodeGetter(rpcClient *rpc.Client, peers []peer.ID) *rpcNodeGetter {
+	return &rpcNodeGetter{
+		rpcClient: rpcClient,
+		peers:     peers,
+	}
+}
+
+// Get fetches and decodes the block with the given cid.
+func (ng *rpcNodeGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	ng.mu.Lock()
+	start := ng.last
+	ng.mu.Unlock()
+
+	var errs error
+	for i := range ng.peers {
+		idx := (start + i) % len(ng.peers)
+		p := ng.peers[idx]
+		data, err := ng.blockGet(ctx, p, c)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			logger.Debugf("block %s not available in %s: %s", c, p, err)
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", p, err))
+			continue
+		}
+
+		ng.mu.Lock()
+		ng.last = idx
+		ng.mu.Unlock()
+		return decodeBlock(data, c)
+	}
+
+	// The empty peer ID calls the local peer.
+	data, err := ng.blockGet(ctx, "", c)
+	if err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("local peer: %w", err))
+		return nil, fmt.Errorf("could not retrieve block %s from any peer: %w", c, errs)
+	}
+	return decodeBlock(data, c)
+}
+
+func decodeBlock(data []byte, c cid.Cid) (ipld.Node, error) {
+	blk, err := blocks.NewBlockWithCid(data, c)
+	if err != nil {
+		return nil, err
+	}
+	return ipld.Decode(blk)
+}
+
+// GetMany fetches the given cids sequentially.
+func (ng *rpcNodeGetter) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption, len(cids))
+	go func() {
+		defer close(out)
+		for _, c := range cids {
+			nd, err := ng.Get(ctx, c)
+			select {
+			case <-ctx.Done():
+				return
+			case out <- &ipld.NodeOption{Node: nd, Err: err}:
+			}
+		}
+	}()
+	return out
+}
+
+// blockGet retrieves a block from a peer and verifies that the data
+// matches the cid.
+func (ng *rpcNodeGetter) blockGet(ctx context.Context, p peer.ID, c cid.Cid) ([]byte, error) {
+	var data []byte
+	err := ng.rpcClient.CallContext(
+		ctx,
+		p,
+		"IPFSConnector",
+		"BlockGet",
+		types.NewCid(c),
+		&data,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	hashed, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	if !hashed.Equals(c) {
+		return nil, fmt.Errorf("block data does not match cid (got %s)", hashed)
+	}
+	return data, nil
+}
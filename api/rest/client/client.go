@@ -6,6 +6,7 @@ package client
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"time"
@@ -55,6 +56,21 @@ type Client interface {
 	PeerAdd(ctx context.Context, pid peer.ID) (api.ID, error)
 	// PeerRm removes a current peer from the cluster
 	PeerRm(ctx context.Context, pid peer.ID) error
+	// PeerDrain starts moving all the pins of a peer to other peers,
+	// removing it from the cluster afterwards if remove is true.
+	PeerDrain(ctx context.Context, pid peer.ID, remove bool) (api.DrainStatus, error)
+	// PeerDrainStatus returns the progress of draining a peer.
+	PeerDrainStatus(ctx context.Context, pid peer.ID) (api.DrainStatus, error)
+	// PeerDrainCancel stops draining a peer.
+	PeerDrainCancel(ctx context.Context, pid peer.ID) (api.DrainStatus, error)
+	// PeerMaintenanceStart puts a peer in maintenance mode for the given
+	// duration, or for the maximum allowed by the peer when it is 0.
+	PeerMaintenanceStart(ctx context.Context, pid peer.ID, d time.Duration) (api.MaintenanceStatus, error)
+	// PeerMaintenanceStatus returns whether a peer is in maintenance
+	// mode.
+	PeerMaintenanceStatus(ctx context.Context, pid peer.ID) (api.MaintenanceStatus, error)
+	// PeerMaintenanceStop ends the maintenance mode of a peer.
+	PeerMaintenanceStop(ctx context.Context, pid peer.ID) (api.MaintenanceStatus, error)
 
 	// Add imports files to the cluster from the given paths.
 	Add(ctx context.Context, paths []string, params api.AddParams, out chan<- api.AddedOutput) error
@@ -73,11 +89,42 @@ type Client interface {
 	// It returns api.Pin of the given cid before it is unpinned.
 	UnpinPath(ctx context.Context, path string) (api.Pin, error)
 
-	// Allocations returns the consensus state listing all tracked items
-	// and the peers that should be pinning them.
-	Allocations(ctx context.Context, filter api.PinType, out chan<- api.Pin) error
+	// Allocations returns the consensus state listing the tracked items
+	// selected by the query and the peers that should be pinning them.
+	// Results can be paginated by setting the query Limit and using the
+	// last Cid received as the Cursor for the next call.
+	Allocations(ctx context.Context, query api.PinQuery, out chan<- api.Pin) error
 	// Allocation returns the current allocations for a given Cid.
 	Allocation(ctx context.Context, ci api.Cid) (api.Pin, error)
+	// AllocationPreview returns the allocations that pinning a Cid with
+	// the given options would produce, and how every peer was
+	// considered, without pinning anything. The Cid may be undefined.
+	AllocationPreview(ctx context.Context, ci api.Cid, opts api.PinOptions) (api.AllocationPreview, error)
+	// AllocationParents returns the meta-pins referencing the given
+	// shard or ClusterDAG Cid.
+	AllocationParents(ctx context.Context, ci api.Cid) ([]api.Pin, error)
+	// ExportCAR writes the DAG of a pinned Cid to w as a CARv1 file.
+	ExportCAR(ctx context.Context, ci api.Cid, w io.Writer) error
+
+	// CollectionCreate creates a new collection with the given name.
+	// The options are used to pin every member of the collection.
+	CollectionCreate(ctx context.Context, name string, opts api.PinOptions) (api.Pin, error)
+	// Collections lists all the collections.
+	Collections(ctx context.Context, out chan<- api.Pin) error
+	// Collection returns the collection with the given name.
+	Collection(ctx context.Context, name string) (api.Pin, error)
+	// CollectionMembers lists the pins which belong to a collection.
+	CollectionMembers(ctx context.Context, name string, out chan<- api.Pin) error
+	// CollectionAdd pins the given Cids as members of a collection.
+	CollectionAdd(ctx context.Context, name string, cids []api.Cid) ([]api.Pin, error)
+	// CollectionRemove removes the given Cids from a collection. They
+	// are unpinned unless they belong to other collections.
+	CollectionRemove(ctx context.Context, name string, cids []api.Cid) error
+	// CollectionDelete removes a collection along with its members.
+	CollectionDelete(ctx context.Context, name string) (api.Pin, error)
+	// CollectionStatus returns the status of a collection, aggregated
+	// across its members.
+	CollectionStatus(ctx context.Context, name string) (api.GlobalPinInfo, error)
 
 	// Status returns the current ipfs state for a given Cid. If local is true,
 	// the information affects only the current peer, otherwise the information
@@ -96,11 +143,47 @@ type Client interface {
 	// local is true, the operation is limited to the current peer.
 	// Otherwise, it happens everywhere.
 	RecoverAll(ctx context.Context, local bool, out chan<- api.GlobalPinInfo) error
+	// Verify checks the integrity of a pinned Cid by walking its DAG
+	// and rehashing every block in the IPFS daemons. Items with
+	// problems get the "corrupted" status and can be fixed with
+	// Recover. If local is true, only the current peer verifies.
+	Verify(ctx context.Context, ci api.Cid, local bool) (api.GlobalPinInfo, error)
 
 	// Alerts returns information health events in the cluster (expired
 	// metrics etc.).
 	Alerts(ctx context.Context) ([]api.Alert, error)
 
+	// RebalanceStatus returns the progress of the rebalancer of the
+	// peer.
+	RebalanceStatus(ctx context.Context) (api.RebalanceStatus, error)
+
+	// Usage returns the number and size of the pins owned by an API user
+	// and their quota. An empty user means the authenticated user. Only
+	// admins can read the usage of other users.
+	Usage(ctx context.Context, user string) (api.Usage, error)
+
+	// APIKeys returns the API keys of the authenticated user, or those of
+	// every user for admins.
+	APIKeys(ctx context.Context) ([]api.APIKey, error)
+	// APIKeyCreate creates an API key with the user, scopes and expiry of
+	// the given key. The returned key carries the secret and its Token().
+	// An empty user means the authenticated user.
+	APIKeyCreate(ctx context.Context, key api.APIKey) (api.APIKey, error)
+	// APIKeyRevoke revokes the API key with the given ID.
+	APIKeyRevoke(ctx context.Context, id string) error
+
+	// ReplicationReport streams the pins which have fewer healthy
+	// copies than their minimum replication factor, more than their
+	// maximum, or none at all.
+	ReplicationReport(ctx context.Context, out chan<- api.ReplicationReport) error
+
+	// Events subscribes to the events of the peer: changes to the pinset
+	// and status transitions of the items it tracks, as selected by the
+	// filter. Events are not aggregated from other peers: the status
+	// transitions of pins allocated elsewhere are not received. It blocks
+	// until the context is cancelled or the peer closes the connection.
+	Events(ctx context.Context, filter api.EventFilter, out chan<- api.Event) error
+
 	// Version returns the ipfs-cluster peer's version.
 	Version(context.Context) (api.Version, error)
 
@@ -136,6 +219,10 @@ type Config struct {
 	Username string
 	Password string
 
+	// APIKey is a token sent as Bearer authentication. It is used
+	// instead of the basic authentication credentials when set.
+	APIKey string
+
 	// The ipfs-cluster REST API endpoint in multiaddress form
 	// (takes precedence over host:port). It this address contains
 	// an /ipfs/, /p2p/ or /dnsaddr, the API will be contacted
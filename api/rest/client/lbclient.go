@@ -2,7 +2,9 @@ package client
 
 import (
 	"context"
+	"io"
 	"sync/atomic"
+	"time"
 
 	shell "github.com/ipfs/go-ipfs-api"
 	files "github.com/ipfs/go-ipfs-files"
@@ -171,6 +173,84 @@ func (lc *loadBalancingClient) PeerRm(ctx context.Context, id peer.ID) error {
 	return lc.retry(0, call)
 }
 
+// PeerDrain starts moving all the pins of a peer to other peers.
+func (lc *loadBalancingClient) PeerDrain(ctx context.Context, pid peer.ID, remove bool) (api.DrainStatus, error) {
+	var status api.DrainStatus
+	call := func(c Client) error {
+		var err error
+		status, err = c.PeerDrain(ctx, pid, remove)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return status, err
+}
+
+// PeerDrainStatus returns the progress of draining a peer.
+func (lc *loadBalancingClient) PeerDrainStatus(ctx context.Context, pid peer.ID) (api.DrainStatus, error) {
+	var status api.DrainStatus
+	call := func(c Client) error {
+		var err error
+		status, err = c.PeerDrainStatus(ctx, pid)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return status, err
+}
+
+// PeerDrainCancel stops draining a peer.
+func (lc *loadBalancingClient) PeerDrainCancel(ctx context.Context, pid peer.ID) (api.DrainStatus, error) {
+	var status api.DrainStatus
+	call := func(c Client) error {
+		var err error
+		status, err = c.PeerDrainCancel(ctx, pid)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return status, err
+}
+
+// PeerMaintenanceStart puts a peer in maintenance mode.
+func (lc *loadBalancingClient) PeerMaintenanceStart(ctx context.Context, pid peer.ID, d time.Duration) (api.MaintenanceStatus, error) {
+	var status api.MaintenanceStatus
+	call := func(c Client) error {
+		var err error
+		status, err = c.PeerMaintenanceStart(ctx, pid, d)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return status, err
+}
+
+// PeerMaintenanceStatus returns whether a peer is in maintenance mode.
+func (lc *loadBalancingClient) PeerMaintenanceStatus(ctx context.Context, pid peer.ID) (api.MaintenanceStatus, error) {
+	var status api.MaintenanceStatus
+	call := func(c Client) error {
+		var err error
+		status, err = c.PeerMaintenanceStatus(ctx, pid)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return status, err
+}
+
+// PeerMaintenanceStop ends the maintenance mode of a peer.
+func (lc *loadBalancingClient) PeerMaintenanceStop(ctx context.Context, pid peer.ID) (api.MaintenanceStatus, error) {
+	var status api.MaintenanceStatus
+	call := func(c Client) error {
+		var err error
+		status, err = c.PeerMaintenanceStop(ctx, pid)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return status, err
+}
+
 // Pin tracks a Cid with the given replication factor and a name for
 // human-friendliness.
 func (lc *loadBalancingClient) Pin(ctx context.Context, ci api.Cid, opts api.PinOptions) (api.Pin, error) {
@@ -225,9 +305,78 @@ func (lc *loadBalancingClient) UnpinPath(ctx context.Context, p string) (api.Pin
 	return pin, err
 }
 
-// Allocations returns the consensus state listing all tracked items and
-// the peers that should be pinning them.
-func (lc *loadBalancingClient) Allocations(ctx context.Context, filter api.PinType, out chan<- api.Pin) error {
+// Allocations returns the consensus state listing the tracked items
+// selected by the given query and the peers that should be pinning them.
+func (lc *loadBalancingClient) Allocations(ctx context.Context, query api.PinQuery, out chan<- api.Pin) error {
+	call := func(c Client) error {
+		done := make(chan struct{})
+		cout := make(chan api.Pin, cap(out))
+		go func() {
+			for o := range cout {
+				out <- o
+			}
+			done <- struct{}{}
+		}()
+
+		// this blocks until done
+		err := c.Allocations(ctx, query, cout)
+		// wait for cout to be closed
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		return err
+	}
+
+	err := lc.retry(0, call)
+	close(out)
+	return err
+}
+
+// CollectionCreate creates a new collection with the given name. The
+// options are used to pin every member of the collection.
+func (lc *loadBalancingClient) CollectionCreate(ctx context.Context, name string, opts api.PinOptions) (api.Pin, error) {
+	var pin api.Pin
+	call := func(c Client) error {
+		var err error
+		pin, err = c.CollectionCreate(ctx, name, opts)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return pin, err
+}
+
+// Collections lists all the collections.
+func (lc *loadBalancingClient) Collections(ctx context.Context, out chan<- api.Pin) error {
+	return lc.streamPins(ctx, out, func(c Client, cout chan<- api.Pin) error {
+		return c.Collections(ctx, cout)
+	})
+}
+
+// Collection returns the collection with the given name.
+func (lc *loadBalancingClient) Collection(ctx context.Context, name string) (api.Pin, error) {
+	var pin api.Pin
+	call := func(c Client) error {
+		var err error
+		pin, err = c.Collection(ctx, name)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return pin, err
+}
+
+// CollectionMembers lists the pins which belong to a collection.
+func (lc *loadBalancingClient) CollectionMembers(ctx context.Context, name string, out chan<- api.Pin) error {
+	return lc.streamPins(ctx, out, func(c Client, cout chan<- api.Pin) error {
+		return c.CollectionMembers(ctx, name, cout)
+	})
+}
+
+// streamPins retries a streaming call which returns pins, forwarding them
+// to out.
+func (lc *loadBalancingClient) streamPins(ctx context.Context, out chan<- api.Pin, f func(Client, chan<- api.Pin) error) error {
 	call := func(c Client) error {
 		done := make(chan struct{})
 		cout := make(chan api.Pin, cap(out))
@@ -239,7 +388,7 @@ func (lc *loadBalancingClient) Allocations(ctx context.Context, filter api.PinTy
 		}()
 
 		// this blocks until done
-		err := c.Allocations(ctx, filter, cout)
+		err := f(c, cout)
 		// wait for cout to be closed
 		select {
 		case <-ctx.Done():
@@ -253,6 +402,55 @@ func (lc *loadBalancingClient) Allocations(ctx context.Context, filter api.PinTy
 	return err
 }
 
+// CollectionAdd pins the given Cids as members of a collection.
+func (lc *loadBalancingClient) CollectionAdd(ctx context.Context, name string, cids []api.Cid) ([]api.Pin, error) {
+	var pins []api.Pin
+	call := func(c Client) error {
+		var err error
+		pins, err = c.CollectionAdd(ctx, name, cids)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return pins, err
+}
+
+// CollectionRemove removes the given Cids from a collection. They are
+// unpinned unless they belong to other collections.
+func (lc *loadBalancingClient) CollectionRemove(ctx context.Context, name string, cids []api.Cid) error {
+	call := func(c Client) error {
+		return c.CollectionRemove(ctx, name, cids)
+	}
+	return lc.retry(0, call)
+}
+
+// CollectionDelete removes a collection along with its members.
+func (lc *loadBalancingClient) CollectionDelete(ctx context.Context, name string) (api.Pin, error) {
+	var pin api.Pin
+	call := func(c Client) error {
+		var err error
+		pin, err = c.CollectionDelete(ctx, name)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return pin, err
+}
+
+// CollectionStatus returns the status of a collection, aggregated across
+// its members.
+func (lc *loadBalancingClient) CollectionStatus(ctx context.Context, name string) (api.GlobalPinInfo, error) {
+	var gpi api.GlobalPinInfo
+	call := func(c Client) error {
+		var err error
+		gpi, err = c.CollectionStatus(ctx, name)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return gpi, err
+}
+
 // Allocation returns the current allocations for a given Cid.
 func (lc *loadBalancingClient) Allocation(ctx context.Context, ci api.Cid) (api.Pin, error) {
 	var pin api.Pin
@@ -266,6 +464,43 @@ func (lc *loadBalancingClient) Allocation(ctx context.Context, ci api.Cid) (api.
 	return pin, err
 }
 
+// AllocationPreview returns the allocations that pinning a Cid with the
+// given options would produce, without pinning anything.
+func (lc *loadBalancingClient) AllocationPreview(ctx context.Context, ci api.Cid, opts api.PinOptions) (api.AllocationPreview, error) {
+	var preview api.AllocationPreview
+	call := func(c Client) error {
+		var err error
+		preview, err = c.AllocationPreview(ctx, ci, opts)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return preview, err
+}
+
+// AllocationParents returns the meta-pins referencing the given shard or
+// ClusterDAG Cid.
+func (lc *loadBalancingClient) AllocationParents(ctx context.Context, ci api.Cid) ([]api.Pin, error) {
+	var parents []api.Pin
+	call := func(c Client) error {
+		var err error
+		parents, err = c.AllocationParents(ctx, ci)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return parents, err
+}
+
+// ExportCAR writes the DAG of a pinned Cid to w as a CARv1 file.
+func (lc *loadBalancingClient) ExportCAR(ctx context.Context, ci api.Cid, w io.Writer) error {
+	call := func(c Client) error {
+		return c.ExportCAR(ctx, ci, w)
+	}
+
+	return lc.retry(0, call)
+}
+
 // Status returns the current ipfs state for a given Cid. If local is true,
 // the information affects only the current peer, otherwise the information
 // is fetched from all cluster peers.
@@ -356,6 +591,21 @@ func (lc *loadBalancingClient) Recover(ctx context.Context, ci api.Cid, local bo
 	return pinInfo, err
 }
 
+// Verify checks the integrity of a pinned Cid by walking its DAG and
+// rehashing every block in the IPFS daemons. If local is true, only the
+// current peer verifies, otherwise every peer where it is allocated does.
+func (lc *loadBalancingClient) Verify(ctx context.Context, ci api.Cid, local bool) (api.GlobalPinInfo, error) {
+	var pinInfo api.GlobalPinInfo
+	call := func(c Client) error {
+		var err error
+		pinInfo, err = c.Verify(ctx, ci, local)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return pinInfo, err
+}
+
 // RecoverAll triggers Recover() operations on all tracked items. If local is
 // true, the operation is limited to the current peer. Otherwise, it happens
 // everywhere.
@@ -398,6 +648,127 @@ func (lc *loadBalancingClient) Alerts(ctx context.Context) ([]api.Alert, error)
 	return alerts, err
 }
 
+// RebalanceStatus returns the progress of the rebalancer of the peer.
+func (lc *loadBalancingClient) RebalanceStatus(ctx context.Context) (api.RebalanceStatus, error) {
+	var status api.RebalanceStatus
+	call := func(c Client) error {
+		var err error
+		status, err = c.RebalanceStatus(ctx)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return status, err
+}
+
+// Usage returns the number and size of the pins owned by an API user and
+// their quota.
+func (lc *loadBalancingClient) Usage(ctx context.Context, user string) (api.Usage, error) {
+	var usage api.Usage
+	call := func(c Client) error {
+		var err error
+		usage, err = c.Usage(ctx, user)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return usage, err
+}
+
+// APIKeys returns the API keys of the authenticated user, or those of
+// every user for admins.
+func (lc *loadBalancingClient) APIKeys(ctx context.Context) ([]api.APIKey, error) {
+	var keys []api.APIKey
+	call := func(c Client) error {
+		var err error
+		keys, err = c.APIKeys(ctx)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return keys, err
+}
+
+// APIKeyCreate creates an API key with the user, scopes and expiry of the
+// given key.
+func (lc *loadBalancingClient) APIKeyCreate(ctx context.Context, key api.APIKey) (api.APIKey, error) {
+	var created api.APIKey
+	call := func(c Client) error {
+		var err error
+		created, err = c.APIKeyCreate(ctx, key)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return created, err
+}
+
+// APIKeyRevoke revokes the API key with the given ID.
+func (lc *loadBalancingClient) APIKeyRevoke(ctx context.Context, id string) error {
+	call := func(c Client) error {
+		return c.APIKeyRevoke(ctx, id)
+	}
+
+	return lc.retry(0, call)
+}
+
+// ReplicationReport streams the pins which have fewer healthy copies than
+// their minimum replication factor, more than their maximum, or none at all.
+func (lc *loadBalancingClient) ReplicationReport(ctx context.Context, out chan<- api.ReplicationReport) error {
+	call := func(c Client) error {
+		done := make(chan struct{})
+		cout := make(chan api.ReplicationReport, cap(out))
+		go func() {
+			for o := range cout {
+				out <- o
+			}
+			done <- struct{}{}
+		}()
+
+		// this blocks until done
+		err := c.ReplicationReport(ctx, cout)
+		// wait for cout to be closed
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		return err
+	}
+
+	err := lc.retry(0, call)
+	close(out)
+	return err
+}
+
+// Events subscribes to the events of one of the peers: changes to the
+// pinset and status transitions of the items it tracks, as selected by the
+// filter.
+func (lc *loadBalancingClient) Events(ctx context.Context, filter api.EventFilter, out chan<- api.Event) error {
+	call := func(c Client) error {
+		done := make(chan struct{})
+		cout := make(chan api.Event, cap(out))
+		go func() {
+			for o := range cout {
+				out <- o
+			}
+			done <- struct{}{}
+		}()
+
+		// this blocks until done
+		err := c.Events(ctx, filter, cout)
+		// wait for cout to be closed
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		return err
+	}
+
+	err := lc.retry(0, call)
+	close(out)
+	return err
+}
+
 // Version returns the ipfs-cluster peer's version.
 func (lc *loadBalancingClient) Version(ctx context.Context) (api.Version, error) {
 	var v api.Version
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
@@ -82,6 +83,72 @@ func (c *defaultClient) PeerRm(ctx context.Context, id peer.ID) error {
 	return c.do(ctx, "DELETE", fmt.Sprintf("/peers/%s", id.Pretty()), nil, nil, nil)
 }
 
+// PeerDrain starts moving all the pins of a peer to other peers, removing
+// it from the cluster afterwards if remove is true.
+func (c *defaultClient) PeerDrain(ctx context.Context, pid peer.ID, remove bool) (api.DrainStatus, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PeerDrain")
+	defer span.End()
+
+	var status api.DrainStatus
+	err := c.do(ctx, "POST", fmt.Sprintf("/peers/%s/drain?remove=%t", pid.Pretty(), remove), nil, nil, &status)
+	return status, err
+}
+
+// PeerDrainStatus returns the progress of draining a peer.
+func (c *defaultClient) PeerDrainStatus(ctx context.Context, pid peer.ID) (api.DrainStatus, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PeerDrainStatus")
+	defer span.End()
+
+	var status api.DrainStatus
+	err := c.do(ctx, "GET", fmt.Sprintf("/peers/%s/drain", pid.Pretty()), nil, nil, &status)
+	return status, err
+}
+
+// PeerDrainCancel stops draining a peer.
+func (c *defaultClient) PeerDrainCancel(ctx context.Context, pid peer.ID) (api.DrainStatus, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PeerDrainCancel")
+	defer span.End()
+
+	var status api.DrainStatus
+	err := c.do(ctx, "DELETE", fmt.Sprintf("/peers/%s/drain", pid.Pretty()), nil, nil, &status)
+	return status, err
+}
+
+// PeerMaintenanceStart puts a peer in maintenance mode for the given
+// duration, or for the maximum allowed by the peer when it is 0.
+func (c *defaultClient) PeerMaintenanceStart(ctx context.Context, pid peer.ID, d time.Duration) (api.MaintenanceStatus, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PeerMaintenanceStart")
+	defer span.End()
+
+	path := fmt.Sprintf("/peers/%s/maintenance", pid.Pretty())
+	if d > 0 {
+		path += "?duration=" + url.QueryEscape(d.String())
+	}
+	var status api.MaintenanceStatus
+	err := c.do(ctx, "POST", path, nil, nil, &status)
+	return status, err
+}
+
+// PeerMaintenanceStatus returns whether a peer is in maintenance mode.
+func (c *defaultClient) PeerMaintenanceStatus(ctx context.Context, pid peer.ID) (api.MaintenanceStatus, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PeerMaintenanceStatus")
+	defer span.End()
+
+	var status api.MaintenanceStatus
+	err := c.do(ctx, "GET", fmt.Sprintf("/peers/%s/maintenance", pid.Pretty()), nil, nil, &status)
+	return status, err
+}
+
+// PeerMaintenanceStop ends the maintenance mode of a peer.
+func (c *defaultClient) PeerMaintenanceStop(ctx context.Context, pid peer.ID) (api.MaintenanceStatus, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PeerMaintenanceStop")
+	defer span.End()
+
+	var status api.MaintenanceStatus
+	err := c.do(ctx, "DELETE", fmt.Sprintf("/peers/%s/maintenance", pid.Pretty()), nil, nil, &status)
+	return status, err
+}
+
 // Pin tracks a Cid with the given replication factor and a name for
 // human-friendliness.
 func (c *defaultClient) Pin(ctx context.Context, ci api.Cid, opts api.PinOptions) (api.Pin, error) {
@@ -163,31 +230,17 @@ func (c *defaultClient) UnpinPath(ctx context.Context, p string) (api.Pin, error
 	return pin, err
 }
 
-// Allocations returns the consensus state listing all tracked items and
-// the peers that should be pinning them.
-func (c *defaultClient) Allocations(ctx context.Context, filter api.PinType, out chan<- api.Pin) error {
+// Allocations returns the consensus state listing the tracked items
+// selected by the given query and the peers that should be pinning them.
+func (c *defaultClient) Allocations(ctx context.Context, query api.PinQuery, out chan<- api.Pin) error {
 	defer close(out)
 
 	ctx, span := trace.StartSpan(ctx, "client/Allocations")
 	defer span.End()
 
-	types := []api.PinType{
-		api.DataType,
-		api.MetaType,
-		api.ClusterDAGType,
-		api.ShardType,
-	}
-
-	var strFilter []string
-
-	if filter == api.AllType {
-		strFilter = []string{"all"}
-	} else {
-		for _, t := range types {
-			if t&filter > 0 { // the filter includes this type
-				strFilter = append(strFilter, t.String())
-			}
-		}
+	q, err := query.ToQuery()
+	if err != nil {
+		return err
 	}
 
 	handler := func(dec *json.Decoder) error {
@@ -200,16 +253,131 @@ func (c *defaultClient) Allocations(ctx context.Context, filter api.PinType, out
 		return nil
 	}
 
-	f := url.QueryEscape(strings.Join(strFilter, ","))
 	return c.doStream(
 		ctx,
 		"GET",
-		fmt.Sprintf("/allocations?filter=%s", f),
+		fmt.Sprintf("/allocations?%s", q),
 		nil,
 		nil,
 		handler)
 }
 
+// CollectionCreate creates a new collection with the given name. The
+// options are used to pin every member of the collection.
+func (c *defaultClient) CollectionCreate(ctx context.Context, name string, opts api.PinOptions) (api.Pin, error) {
+	ctx, span := trace.StartSpan(ctx, "client/CollectionCreate")
+	defer span.End()
+
+	query, err := opts.ToQuery()
+	if err != nil {
+		return api.Pin{}, err
+	}
+	var pin api.Pin
+	err = c.do(
+		ctx,
+		"POST",
+		fmt.Sprintf(
+			"/collections/%s?%s",
+			url.PathEscape(name),
+			query,
+		),
+		nil,
+		nil,
+		&pin,
+	)
+	return pin, err
+}
+
+// Collections lists all the collections.
+func (c *defaultClient) Collections(ctx context.Context, out chan<- api.Pin) error {
+	ctx, span := trace.StartSpan(ctx, "client/Collections")
+	defer span.End()
+	return c.streamCollectionPins(ctx, "/collections", out)
+}
+
+// Collection returns the collection with the given name.
+func (c *defaultClient) Collection(ctx context.Context, name string) (api.Pin, error) {
+	ctx, span := trace.StartSpan(ctx, "client/Collection")
+	defer span.End()
+
+	var pin api.Pin
+	err := c.do(ctx, "GET", fmt.Sprintf("/collections/%s", url.PathEscape(name)), nil, nil, &pin)
+	return pin, err
+}
+
+// CollectionMembers lists the pins which belong to a collection.
+func (c *defaultClient) CollectionMembers(ctx context.Context, name string, out chan<- api.Pin) error {
+	ctx, span := trace.StartSpan(ctx, "client/CollectionMembers")
+	defer span.End()
+	return c.streamCollectionPins(ctx, fmt.Sprintf("/collections/%s/members", url.PathEscape(name)), out)
+}
+
+func (c *defaultClient) streamCollectionPins(ctx context.Context, path string, out chan<- api.Pin) error {
+	defer close(out)
+
+	handler := func(dec *json.Decoder) error {
+		var obj api.Pin
+		err := dec.Decode(&obj)
+		if err != nil {
+			return err
+		}
+		out <- obj
+		return nil
+	}
+	return c.doStream(ctx, "GET", path, nil, nil, handler)
+}
+
+// CollectionAdd pins the given Cids as members of a collection.
+func (c *defaultClient) CollectionAdd(ctx context.Context, name string, cids []api.Cid) ([]api.Pin, error) {
+	ctx, span := trace.StartSpan(ctx, "client/CollectionAdd")
+	defer span.End()
+
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(cids)
+	if err != nil {
+		return nil, err
+	}
+
+	var pins []api.Pin
+	err = c.do(ctx, "POST", fmt.Sprintf("/collections/%s/members", url.PathEscape(name)), nil, &buf, &pins)
+	return pins, err
+}
+
+// CollectionRemove removes the given Cids from a collection. They are
+// unpinned unless they belong to other collections.
+func (c *defaultClient) CollectionRemove(ctx context.Context, name string, cids []api.Cid) error {
+	ctx, span := trace.StartSpan(ctx, "client/CollectionRemove")
+	defer span.End()
+
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(cids)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "DELETE", fmt.Sprintf("/collections/%s/members", url.PathEscape(name)), nil, &buf, nil)
+}
+
+// CollectionDelete removes a collection along with its members.
+func (c *defaultClient) CollectionDelete(ctx context.Context, name string) (api.Pin, error) {
+	ctx, span := trace.StartSpan(ctx, "client/CollectionDelete")
+	defer span.End()
+
+	var pin api.Pin
+	err := c.do(ctx, "DELETE", fmt.Sprintf("/collections/%s", url.PathEscape(name)), nil, nil, &pin)
+	return pin, err
+}
+
+// CollectionStatus returns the status of a collection, aggregated across
+// its members.
+func (c *defaultClient) CollectionStatus(ctx context.Context, name string) (api.GlobalPinInfo, error) {
+	ctx, span := trace.StartSpan(ctx, "client/CollectionStatus")
+	defer span.End()
+
+	var gpi api.GlobalPinInfo
+	err := c.do(ctx, "GET", fmt.Sprintf("/collections/%s/status", url.PathEscape(name)), nil, nil, &gpi)
+	return gpi, err
+}
+
 // Allocation returns the current allocations for a given Cid.
 func (c *defaultClient) Allocation(ctx context.Context, ci api.Cid) (api.Pin, error) {
 	ctx, span := trace.StartSpan(ctx, "client/Allocation")
@@ -220,6 +388,49 @@ func (c *defaultClient) Allocation(ctx context.Context, ci api.Cid) (api.Pin, er
 	return pin, err
 }
 
+// AllocationPreview returns the allocations that pinning a Cid with the
+// given options would produce, without pinning anything.
+func (c *defaultClient) AllocationPreview(ctx context.Context, ci api.Cid, opts api.PinOptions) (api.AllocationPreview, error) {
+	ctx, span := trace.StartSpan(ctx, "client/AllocationPreview")
+	defer span.End()
+
+	query, err := opts.ToQuery()
+	if err != nil {
+		return api.AllocationPreview{}, err
+	}
+	if ci.Defined() {
+		query += "&cid=" + ci.String()
+	}
+
+	var preview api.AllocationPreview
+	err = c.do(ctx, "POST", "/allocations/preview?"+query, nil, nil, &preview)
+	return preview, err
+}
+
+// AllocationParents returns the meta-pins referencing the given shard or
+// ClusterDAG Cid.
+func (c *defaultClient) AllocationParents(ctx context.Context, ci api.Cid) ([]api.Pin, error) {
+	ctx, span := trace.StartSpan(ctx, "client/AllocationParents")
+	defer span.End()
+
+	var parents []api.Pin
+	err := c.do(ctx, "GET", fmt.Sprintf("/allocations/%s/parents", ci.String()), nil, nil, &parents)
+	return parents, err
+}
+
+// ExportCAR writes the DAG of a pinned Cid to w as a CARv1 file. Blocks are
+// retrieved by the cluster peer from the peers allocated to the pin.
+func (c *defaultClient) ExportCAR(ctx context.Context, ci api.Cid, w io.Writer) error {
+	ctx, span := trace.StartSpan(ctx, "client/ExportCAR")
+	defer span.End()
+
+	resp, err := c.doRequest(ctx, "GET", fmt.Sprintf("/pins/%s/car", ci.String()), nil, nil)
+	if err != nil {
+		return api.Error{Code: 0, Message: err.Error()}
+	}
+	return c.handleRawStreamResponse(resp, w)
+}
+
 // Status returns the current ipfs state for a given Cid. If local is true,
 // the information affects only the current peer, otherwise the information
 // is fetched from all cluster peers.
@@ -306,6 +517,18 @@ func (c *defaultClient) Recover(ctx context.Context, ci api.Cid, local bool) (ap
 	return gpi, err
 }
 
+// Verify checks the integrity of a pinned Cid by walking its DAG and
+// rehashing every block in the IPFS daemons. If local is true, only the
+// current peer verifies, otherwise every peer where it is allocated does.
+func (c *defaultClient) Verify(ctx context.Context, ci api.Cid, local bool) (api.GlobalPinInfo, error) {
+	ctx, span := trace.StartSpan(ctx, "client/Verify")
+	defer span.End()
+
+	var gpi api.GlobalPinInfo
+	err := c.do(ctx, "POST", fmt.Sprintf("/pins/%s/verify?local=%t", ci.String(), local), nil, nil, &gpi)
+	return gpi, err
+}
+
 // RecoverAll triggers Recover() operations on all tracked items. If local is
 // true, the operation is limited to the current peer. Otherwise, it happens
 // everywhere.
@@ -345,6 +568,124 @@ func (c *defaultClient) Alerts(ctx context.Context) ([]api.Alert, error) {
 	return alerts, err
 }
 
+// RebalanceStatus returns the progress of the rebalancer of the peer.
+func (c *defaultClient) RebalanceStatus(ctx context.Context) (api.RebalanceStatus, error) {
+	ctx, span := trace.StartSpan(ctx, "client/RebalanceStatus")
+	defer span.End()
+
+	var status api.RebalanceStatus
+	err := c.do(ctx, "GET", "/health/rebalance", nil, nil, &status)
+	return status, err
+}
+
+// Usage returns the number and size of the pins owned by an API user and
+// their quota.
+func (c *defaultClient) Usage(ctx context.Context, user string) (api.Usage, error) {
+	ctx, span := trace.StartSpan(ctx, "client/Usage")
+	defer span.End()
+
+	path := "/usage"
+	if user != "" {
+		path += "?user=" + url.QueryEscape(user)
+	}
+
+	var usage api.Usage
+	err := c.do(ctx, "GET", path, nil, nil, &usage)
+	return usage, err
+}
+
+// APIKeys returns the API keys of the authenticated user, or those of
+// every user for admins.
+func (c *defaultClient) APIKeys(ctx context.Context) ([]api.APIKey, error) {
+	ctx, span := trace.StartSpan(ctx, "client/APIKeys")
+	defer span.End()
+
+	var keys []api.APIKey
+	err := c.do(ctx, "GET", "/keys", nil, nil, &keys)
+	return keys, err
+}
+
+// APIKeyCreate creates an API key with the user, scopes and expiry of the
+// given key.
+func (c *defaultClient) APIKeyCreate(ctx context.Context, key api.APIKey) (api.APIKey, error) {
+	ctx, span := trace.StartSpan(ctx, "client/APIKeyCreate")
+	defer span.End()
+
+	query, err := key.ToQuery()
+	if err != nil {
+		return api.APIKey{}, err
+	}
+	var created api.APIKey
+	err = c.do(ctx, "POST", "/keys?"+query, nil, nil, &created)
+	return created, err
+}
+
+// APIKeyRevoke revokes the API key with the given ID.
+func (c *defaultClient) APIKeyRevoke(ctx context.Context, id string) error {
+	ctx, span := trace.StartSpan(ctx, "client/APIKeyRevoke")
+	defer span.End()
+
+	return c.do(ctx, "DELETE", "/keys/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// ReplicationReport streams the pins which have fewer healthy copies than
+// their minimum replication factor, more than their maximum, or none at all.
+func (c *defaultClient) ReplicationReport(ctx context.Context, out chan<- api.ReplicationReport) error {
+	defer close(out)
+
+	ctx, span := trace.StartSpan(ctx, "client/ReplicationReport")
+	defer span.End()
+
+	handler := func(dec *json.Decoder) error {
+		var obj api.ReplicationReport
+		err := dec.Decode(&obj)
+		if err != nil {
+			return err
+		}
+		out <- obj
+		return nil
+	}
+
+	return c.doStream(ctx, "GET", "/health/replication", nil, nil, handler)
+}
+
+// Events subscribes to the events of the peer: changes to the pinset and
+// status transitions of the items it tracks, as selected by the filter.
+func (c *defaultClient) Events(ctx context.Context, filter api.EventFilter, out chan<- api.Event) error {
+	defer close(out)
+
+	ctx, span := trace.StartSpan(ctx, "client/Events")
+	defer span.End()
+
+	query := url.Values{}
+	for _, ci := range filter.Cids {
+		query.Add("cid", ci.String())
+	}
+	for _, name := range filter.Names {
+		query.Add("name", name)
+	}
+	for _, typ := range filter.Types {
+		query.Add("type", string(typ))
+	}
+
+	path := "/events"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	handler := func(dec *json.Decoder) error {
+		var obj api.Event
+		err := dec.Decode(&obj)
+		if err != nil {
+			return err
+		}
+		out <- obj
+		return nil
+	}
+
+	return c.doStream(ctx, "GET", path, nil, nil, handler)
+}
+
 // Version returns the ipfs-cluster peer's version.
 func (c *defaultClient) Version(ctx context.Context) (api.Version, error) {
 	ctx, span := trace.StartSpan(ctx, "client/Version")
@@ -619,6 +960,13 @@ func (c *defaultClient) Add(
 	ctx, span := trace.StartSpan(ctx, "client/Add")
 	defer span.End()
 
+	// The server can only notice extra files once the first one has been
+	// added, so fail early.
+	if params.Shard && params.Format == "car" && len(paths) > 1 {
+		close(out)
+		return errors.New("sharding is not supported when adding several CAR files")
+	}
+
 	addFiles := make([]files.DirEntry, len(paths))
 	for i, p := range paths {
 		u, err := url.Parse(p)
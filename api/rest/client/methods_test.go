@@ -1,6 +1,7 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"sync"
@@ -11,6 +12,7 @@ import (
 	rest "github.com/lubanproj/ipfs-cluster/api/rest"
 	test "github.com/lubanproj/ipfs-cluster/test"
 
+	car "github.com/ipld/go-car"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
 	ma "github.com/multiformats/go-multiaddr"
@@ -138,6 +140,74 @@ func TestPeerRm(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestPeerDrain(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		status, err := c.PeerDrain(ctx, test.PeerID2, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Peer != test.PeerID2 || !status.Remove {
+			t.Errorf("unexpected drain status: %+v", status)
+		}
+
+		status, err = c.PeerDrainStatus(ctx, test.PeerID2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Moved != 1 || status.Phase != types.DrainPhaseDraining {
+			t.Errorf("unexpected drain progress: %+v", status)
+		}
+
+		status, err = c.PeerDrainCancel(ctx, test.PeerID2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Phase != types.DrainPhaseCancelled {
+			t.Errorf("expected a cancelled drain: %+v", status)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestPeerMaintenance(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		status, err := c.PeerMaintenanceStart(ctx, test.PeerID1, 10*time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.Enabled || status.Until.Sub(status.Started) > 11*time.Minute {
+			t.Errorf("unexpected maintenance status: %+v", status)
+		}
+
+		status, err = c.PeerMaintenanceStatus(ctx, test.PeerID1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Peer != test.PeerID1 || !status.Enabled {
+			t.Errorf("unexpected maintenance status: %+v", status)
+		}
+
+		status, err = c.PeerMaintenanceStop(ctx, test.PeerID1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Enabled {
+			t.Errorf("expected maintenance to be disabled: %+v", status)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestPin(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -291,7 +361,7 @@ func TestAllocations(t *testing.T) {
 			}
 		}()
 
-		err := c.Allocations(ctx, types.DataType|types.MetaType, pins)
+		err := c.Allocations(ctx, types.PinQuery{Type: types.DataType | types.MetaType}, pins)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -300,6 +370,23 @@ func TestAllocations(t *testing.T) {
 		if n == 0 {
 			t.Error("should be some pins")
 		}
+
+		page := make(chan types.Pin, 10)
+		query := types.PinQuery{
+			ReplicationFactorMax: -1,
+			Limit:                1,
+			Cursor:               test.Cid1,
+		}
+		err = c.Allocations(ctx, query, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) != 1 {
+			t.Fatal("expected a single pin")
+		}
+		if p := <-page; !p.Cid.Equals(test.Cid3) {
+			t.Error("expected cid3 after cid1")
+		}
 	}
 
 	testClients(t, api, testF)
@@ -323,6 +410,77 @@ func TestAllocation(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestAllocationPreview(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		opts := types.PinOptions{
+			ReplicationFactorMin: 1,
+			ReplicationFactorMax: 1,
+		}
+		preview, err := c.AllocationPreview(ctx, test.Cid1, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !preview.Cid.Equals(test.Cid1) {
+			t.Error("should be same cid")
+		}
+		if len(preview.Allocations) != 1 || len(preview.Peers) != 2 {
+			t.Errorf("unexpected preview: %+v", preview)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestAllocationParents(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		parents, err := c.AllocationParents(ctx, test.Cid1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(parents) != 1 {
+			t.Fatal("expected one parent")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestExportCAR(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		var buf bytes.Buffer
+		err := c.ExportCAR(ctx, test.Cid6, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cr, err := car.NewCarReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cr.Header.Roots[0].Equals(test.Cid6.Cid) {
+			t.Error("unexpected root")
+		}
+
+		err = c.ExportCAR(ctx, test.Cid4, &buf)
+		if err == nil {
+			t.Error("expected an error exporting a non-pinned cid")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestStatus(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -475,6 +633,84 @@ func TestRecover(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		pin, err := c.Verify(ctx, test.Cid1, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pin.Cid.Equals(test.Cid1) {
+			t.Error("should be same pin")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestCollections(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		opts := types.PinOptions{ReplicationFactorMin: 1, ReplicationFactorMax: 2}
+		coll, err := c.CollectionCreate(ctx, "photos", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if coll.Type != types.CollectionType || coll.Name != "photos" || coll.ReplicationFactorMax != 2 {
+			t.Error("unexpected collection: ", coll)
+		}
+
+		pins, err := c.CollectionAdd(ctx, "photos", []types.Cid{test.Cid1, test.Cid2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pins) != 2 || !pins[1].HasParent(coll.Cid) {
+			t.Error("unexpected members: ", pins)
+		}
+
+		_, err = c.CollectionAdd(ctx, "photos", []types.Cid{test.ErrorCid})
+		if err == nil {
+			t.Error("expected an error")
+		}
+
+		err = c.CollectionRemove(ctx, "photos", []types.Cid{test.Cid1})
+		if err != nil {
+			t.Error(err)
+		}
+
+		gpi, err := c.CollectionStatus(ctx, "photos")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gpi.Name != "photos" || !gpi.Cid.Equals(coll.Cid) {
+			t.Error("unexpected status: ", gpi)
+		}
+
+		out := make(chan types.Pin, 10)
+		err = c.Collections(ctx, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != 0 {
+			t.Error("the mock pinset has no collections")
+		}
+
+		out = make(chan types.Pin, 10)
+		err = c.CollectionMembers(ctx, "photos", out)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestRecoverAll(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -519,6 +755,145 @@ func TestAlerts(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestRebalanceStatus(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		status, err := c.RebalanceStatus(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.Enabled || status.Migrated != 1 {
+			t.Errorf("unexpected rebalance status: %+v", status)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestUsage(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		usage, err := c.Usage(ctx, test.PinOwner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if usage.User != test.PinOwner || usage.Pins != 1 || usage.Size != test.DAGSize {
+			t.Errorf("unexpected usage: %+v", usage)
+		}
+
+		// Without authentication there is no user.
+		_, err = c.Usage(ctx, "")
+		if err == nil {
+			t.Error("expected an error without a user")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		keys, err := c.APIKeys(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 1 || keys[0].ID != test.APIKeyID {
+			t.Errorf("unexpected keys: %+v", keys)
+		}
+
+		key, err := c.APIKeyCreate(ctx, types.APIKey{
+			User:   test.PinOwner,
+			Scopes: []string{types.APIKeyScopeRead},
+			Expiry: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key.Token() != test.APIKeyToken || key.User != test.PinOwner {
+			t.Errorf("unexpected key: %+v", key)
+		}
+
+		err = c.APIKeyRevoke(ctx, test.APIKeyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.APIKeyRevoke(ctx, "missing")
+		if err == nil {
+			t.Error("expected an error revoking a missing key")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestReplicationReport(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		out := make(chan types.ReplicationReport, 10)
+		err := c.ReplicationReport(ctx, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var reports []types.ReplicationReport
+		for r := range out {
+			reports = append(reports, r)
+		}
+		if len(reports) != 2 {
+			t.Fatalf("expected 2 reports, got %d", len(reports))
+		}
+		if reports[0].State != types.ReplicationUnder || reports[1].State != types.ReplicationUnavailable {
+			t.Errorf("unexpected reports: %+v", reports)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		filter := types.EventFilter{
+			Cids:  []types.Cid{test.Cid1},
+			Types: []types.EventType{types.EventPinned, types.EventError},
+		}
+		out := make(chan types.Event, 10)
+		err := c.Events(ctx, filter, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var events []types.Event
+		for ev := range out {
+			events = append(events, ev)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected 1 event, got %d", len(events))
+		}
+		if events[0].Type != types.EventPinned || !events[0].Cid.Equals(test.Cid1) {
+			t.Errorf("unexpected event: %+v", events[0])
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestGetConnectGraph(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -869,6 +1244,29 @@ func TestAddMultiFile(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestAddShardedCARs(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer api.Shutdown(ctx)
+
+	testF := func(t *testing.T, c Client) {
+		p := types.DefaultAddParams()
+		p.Format = "car"
+		p.Shard = true
+
+		out := make(chan types.AddedOutput, 1)
+		err := c.Add(ctx, []string{"a.car", "b.car"}, p, out)
+		if err == nil {
+			t.Fatal("expected an error sharding several CAR files")
+		}
+		if _, ok := <-out; ok {
+			t.Error("output channel should have been closed")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestRepoGC(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -71,7 +71,9 @@ func (c *defaultClient) doRequest(
 		r.Close = true
 	}
 
-	if c.config.Username != "" {
+	if c.config.APIKey != "" {
+		r.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	} else if c.config.Username != "" {
 		r.SetBasicAuth(c.config.Username, c.config.Password)
 	}
 
@@ -153,6 +155,38 @@ func (c *defaultClient) handleStreamResponse(resp *http.Response, handler respon
 		}
 	}
 
+	return trailerError(resp)
+}
+
+// handleRawStreamResponse copies a non-JSON streaming response body to w.
+func (c *defaultClient) handleRawStreamResponse(resp *http.Response, w io.Writer) error {
+	if resp.StatusCode > 399 && resp.StatusCode < 600 {
+		return c.handleResponse(resp, nil)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return api.Error{
+			Code:    resp.StatusCode,
+			Message: "expected streaming response with code 200",
+		}
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		logger.Error(err)
+		return api.Error{
+			Code:    resp.StatusCode,
+			Message: err.Error(),
+		}
+	}
+
+	return trailerError(resp)
+}
+
+// trailerError returns the errors reported in the X-Stream-Error trailer
+// once a streaming response body has been fully read.
+func trailerError(resp *http.Response) error {
 	trailerErrs := resp.Trailer.Values("X-Stream-Error")
 	var err error
 	for _, trailerErr := range trailerErrs {
@@ -112,6 +112,7 @@ func defaultFunc(cfg *common.Config) error {
 
 	// Auth
 	cfg.BasicAuthCredentials = nil
+	cfg.Roles = nil
 
 	// Logs
 	cfg.HTTPLogFile = ""
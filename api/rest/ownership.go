@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	types "github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/api/common"
+)
+
+// This file contains the handlers related to pin ownership. The ownership
+// checks are shared with other APIs (see common.API.AuthorizePin) and
+// quotas are enforced by Cluster.
+
+// resolvePath resolves an IPFS path to a CID.
+func (api *API) resolvePath(ctx context.Context, path string) (types.Cid, error) {
+	var c types.Cid
+	err := api.rpcClient.CallContext(
+		ctx,
+		"",
+		"IPFSConnector",
+		"Resolve",
+		path,
+		&c,
+	)
+	return c, err
+}
+
+// usageHandler returns the usage of the authenticated user. Admins can
+// read the usage of other users with the "user" query parameter, which is
+// needed when authentication is disabled.
+func (api *API) usageHandler(w http.ResponseWriter, r *http.Request) {
+	user := common.User(r.Context())
+	if u := r.URL.Query().Get("user"); u != "" && u != user {
+		if !api.IsAdmin(r.Context()) {
+			api.SendResponse(w, http.StatusForbidden, errors.New("forbidden: only admins can read the usage of other users"), nil)
+			return
+		}
+		user = u
+	}
+	if user == "" {
+		api.SendResponse(w, http.StatusBadRequest, errors.New("user parameter is required when authentication is disabled"), nil)
+		return
+	}
+
+	var usage types.Usage
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"Usage",
+		user,
+		&usage,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, usage)
+}
@@ -21,7 +21,9 @@ import (
 	types "github.com/lubanproj/ipfs-cluster/api"
 	"github.com/lubanproj/ipfs-cluster/api/common"
 
+	cid "github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
+	car "github.com/ipld/go-car"
 	"github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
@@ -75,6 +77,7 @@ func (api *API) routes(c *rpc.Client) []common.Route {
 			Method:      "GET",
 			Pattern:     "/id",
 			HandlerFunc: api.idHandler,
+			Role:        common.RoleReader,
 		},
 
 		{
@@ -82,6 +85,7 @@ func (api *API) routes(c *rpc.Client) []common.Route {
 			Method:      "GET",
 			Pattern:     "/version",
 			HandlerFunc: api.versionHandler,
+			Role:        common.RoleReader,
 		},
 
 		{
@@ -89,120 +93,315 @@ func (api *API) routes(c *rpc.Client) []common.Route {
 			Method:      "GET",
 			Pattern:     "/peers",
 			HandlerFunc: api.peerListHandler,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "PeerAdd",
 			Method:      "POST",
 			Pattern:     "/peers",
 			HandlerFunc: api.peerAddHandler,
+			Role:        common.RoleAdmin,
 		},
 		{
 			Name:        "PeerRemove",
 			Method:      "DELETE",
 			Pattern:     "/peers/{peer}",
 			HandlerFunc: api.peerRemoveHandler,
+			Role:        common.RoleAdmin,
+		},
+		{
+			Name:        "PeerDrain",
+			Method:      "POST",
+			Pattern:     "/peers/{peer}/drain",
+			HandlerFunc: api.peerDrainHandler,
+			Role:        common.RoleOperator,
+		},
+		{
+			Name:        "PeerDrainStatus",
+			Method:      "GET",
+			Pattern:     "/peers/{peer}/drain",
+			HandlerFunc: api.peerDrainStatusHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "PeerDrainCancel",
+			Method:      "DELETE",
+			Pattern:     "/peers/{peer}/drain",
+			HandlerFunc: api.peerDrainCancelHandler,
+			Role:        common.RoleOperator,
+		},
+		{
+			Name:        "PeerMaintenanceStart",
+			Method:      "POST",
+			Pattern:     "/peers/{peer}/maintenance",
+			HandlerFunc: api.peerMaintenanceStartHandler,
+			Role:        common.RoleOperator,
+		},
+		{
+			Name:        "PeerMaintenanceStatus",
+			Method:      "GET",
+			Pattern:     "/peers/{peer}/maintenance",
+			HandlerFunc: api.peerMaintenanceStatusHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "PeerMaintenanceStop",
+			Method:      "DELETE",
+			Pattern:     "/peers/{peer}/maintenance",
+			HandlerFunc: api.peerMaintenanceStopHandler,
+			Role:        common.RoleOperator,
 		},
 		{
 			Name:        "Add",
 			Method:      "POST",
 			Pattern:     "/add",
 			HandlerFunc: api.addHandler,
+			Role:        common.RolePinner,
 		},
 		{
 			Name:        "Allocations",
 			Method:      "GET",
 			Pattern:     "/allocations",
 			HandlerFunc: api.allocationsHandler,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "Allocation",
 			Method:      "GET",
 			Pattern:     "/allocations/{hash}",
 			HandlerFunc: api.allocationHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "AllocationPreview",
+			Method:      "POST",
+			Pattern:     "/allocations/preview",
+			HandlerFunc: api.allocationPreviewHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "AllocationParents",
+			Method:      "GET",
+			Pattern:     "/allocations/{hash}/parents",
+			HandlerFunc: api.allocationParentsHandler,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "StatusAll",
 			Method:      "GET",
 			Pattern:     "/pins",
 			HandlerFunc: api.statusAllHandler,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "Recover",
 			Method:      "POST",
 			Pattern:     "/pins/{hash}/recover",
 			HandlerFunc: api.recoverHandler,
+			Role:        common.RolePinner,
 		},
 		{
 			Name:        "RecoverAll",
 			Method:      "POST",
 			Pattern:     "/pins/recover",
 			HandlerFunc: api.recoverAllHandler,
+			Role:        common.RoleAdmin,
+		},
+		{
+			Name:        "Verify",
+			Method:      "POST",
+			Pattern:     "/pins/{hash}/verify",
+			HandlerFunc: api.verifyHandler,
+			Role:        common.RolePinner,
+		},
+		{
+			Name:        "ExportCAR",
+			Method:      "GET",
+			Pattern:     "/pins/{hash}/car",
+			HandlerFunc: api.exportCARHandler,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "Status",
 			Method:      "GET",
 			Pattern:     "/pins/{hash}",
 			HandlerFunc: api.statusHandler,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "Pin",
 			Method:      "POST",
 			Pattern:     "/pins/{hash}",
 			HandlerFunc: api.pinHandler,
+			Role:        common.RolePinner,
 		},
 		{
 			Name:        "PinPath",
 			Method:      "POST",
 			Pattern:     "/pins/{keyType:ipfs|ipns|ipld}/{path:.*}",
 			HandlerFunc: api.pinPathHandler,
+			Role:        common.RolePinner,
 		},
 		{
 			Name:        "Unpin",
 			Method:      "DELETE",
 			Pattern:     "/pins/{hash}",
 			HandlerFunc: api.unpinHandler,
+			Role:        common.RolePinner,
 		},
 		{
 			Name:        "UnpinPath",
 			Method:      "DELETE",
 			Pattern:     "/pins/{keyType:ipfs|ipns|ipld}/{path:.*}",
 			HandlerFunc: api.unpinPathHandler,
+			Role:        common.RolePinner,
+		},
+		{
+			Name:        "Collections",
+			Method:      "GET",
+			Pattern:     "/collections",
+			HandlerFunc: api.collectionsHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "Collection",
+			Method:      "GET",
+			Pattern:     "/collections/{name}",
+			HandlerFunc: api.collectionHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "CollectionCreate",
+			Method:      "POST",
+			Pattern:     "/collections/{name}",
+			HandlerFunc: api.collectionCreateHandler,
+			Role:        common.RolePinner,
+		},
+		{
+			Name:        "CollectionDelete",
+			Method:      "DELETE",
+			Pattern:     "/collections/{name}",
+			HandlerFunc: api.collectionDeleteHandler,
+			Role:        common.RolePinner,
+		},
+		{
+			Name:        "CollectionMembers",
+			Method:      "GET",
+			Pattern:     "/collections/{name}/members",
+			HandlerFunc: api.collectionMembersHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "CollectionAdd",
+			Method:      "POST",
+			Pattern:     "/collections/{name}/members",
+			HandlerFunc: api.collectionAddHandler,
+			Role:        common.RolePinner,
+		},
+		{
+			Name:        "CollectionRemove",
+			Method:      "DELETE",
+			Pattern:     "/collections/{name}/members",
+			HandlerFunc: api.collectionRemoveHandler,
+			Role:        common.RolePinner,
+		},
+		{
+			Name:        "CollectionStatus",
+			Method:      "GET",
+			Pattern:     "/collections/{name}/status",
+			HandlerFunc: api.collectionStatusHandler,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "RepoGC",
 			Method:      "POST",
 			Pattern:     "/ipfs/gc",
 			HandlerFunc: api.repoGCHandler,
+			Role:        common.RoleAdmin,
 		},
 		{
 			Name:        "ConnectionGraph",
 			Method:      "GET",
 			Pattern:     "/health/graph",
 			HandlerFunc: api.graphHandler,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "Alerts",
 			Method:      "GET",
 			Pattern:     "/health/alerts",
 			HandlerFunc: api.alertsHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "RebalanceStatus",
+			Method:      "GET",
+			Pattern:     "/health/rebalance",
+			HandlerFunc: api.rebalanceStatusHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "ReplicationReport",
+			Method:      "GET",
+			Pattern:     "/health/replication",
+			HandlerFunc: api.replicationReportHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "Events",
+			Method:      "GET",
+			Pattern:     "/events",
+			HandlerFunc: api.eventsHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "Usage",
+			Method:      "GET",
+			Pattern:     "/usage",
+			HandlerFunc: api.usageHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "APIKeys",
+			Method:      "GET",
+			Pattern:     "/keys",
+			HandlerFunc: api.apiKeysHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "APIKeyCreate",
+			Method:      "POST",
+			Pattern:     "/keys",
+			HandlerFunc: api.apiKeyCreateHandler,
+			Role:        common.RoleReader,
+		},
+		{
+			Name:        "APIKeyRevoke",
+			Method:      "DELETE",
+			Pattern:     "/keys/{keyID}",
+			HandlerFunc: api.apiKeyRevokeHandler,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "Metrics",
 			Method:      "GET",
 			Pattern:     "/monitor/metrics/{name}",
 			HandlerFunc: api.metricsHandler,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "MetricNames",
 			Method:      "GET",
 			Pattern:     "/monitor/metrics",
 			HandlerFunc: api.metricNamesHandler,
+			Role:        common.RoleReader,
 		},
 		{
 			Name:        "GetToken",
 			Method:      "POST",
 			Pattern:     "/token",
 			HandlerFunc: api.GenerateTokenHandler,
+			Role:        common.RoleReader,
 		},
 	}
 }
@@ -290,6 +489,172 @@ func (api *API) alertsHandler(w http.ResponseWriter, r *http.Request) {
 	api.SendResponse(w, common.SetStatusAutomatically, err, alerts)
 }
 
+func (api *API) rebalanceStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var status types.RebalanceStatus
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"RebalanceStatus",
+		struct{}{},
+		&status,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, status)
+}
+
+func (api *API) replicationReportHandler(w http.ResponseWriter, r *http.Request) {
+	in := make(chan struct{})
+	close(in)
+
+	out := make(chan types.ReplicationReport, common.StreamChannelSize)
+	errCh := make(chan error, 1)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	go func() {
+		defer close(errCh)
+
+		errCh <- api.rpcClient.Stream(
+			r.Context(),
+			"",
+			"Cluster",
+			"ReplicationReport",
+			in,
+			out,
+		)
+	}()
+
+	iter := func() (interface{}, bool, error) {
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case p, ok := <-out:
+			return p, ok, nil
+		}
+	}
+
+	api.StreamResponse(w, iter, errCh)
+}
+
+// eventsHandler streams pin events until the client disconnects. Events are
+// sent as newline-delimited JSON or, when the client accepts
+// "text/event-stream" or sets format=sse, as server-sent events. They can
+// be filtered with the "cid", "name" and "type" query parameters. "cid"
+// and "type" take comma-separated lists. Only the events of this peer are
+// sent (see Cluster.Events).
+func (api *API) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+
+	var sse bool
+	switch queryValues.Get("format") {
+	case "":
+		sse = strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	case "sse":
+		sse = true
+	case "json":
+	default:
+		api.SendResponse(w, http.StatusBadRequest, errors.New("invalid format value"), nil)
+		return
+	}
+
+	var filter types.EventFilter
+	for _, cidStr := range splitQueryValues(queryValues["cid"]) {
+		c, err := types.DecodeCid(cidStr)
+		if err != nil {
+			api.SendResponse(w, http.StatusBadRequest, fmt.Errorf("error decoding Cid: %w", err), nil)
+			return
+		}
+		filter.Cids = append(filter.Cids, c)
+	}
+	filter.Names = queryValues["name"]
+	for _, typStr := range splitQueryValues(queryValues["type"]) {
+		typ := types.EventType(typStr)
+		if !typ.IsValid() {
+			api.SendResponse(w, http.StatusBadRequest, fmt.Errorf("invalid event type: %s", typStr), nil)
+			return
+		}
+		filter.Types = append(filter.Types, typ)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	in := make(chan types.EventFilter, 1)
+	in <- filter
+	close(in)
+	out := make(chan types.Event, common.StreamChannelSize)
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- api.rpcClient.Stream(
+			ctx,
+			"",
+			"Cluster",
+			"Events",
+			in,
+			out,
+		)
+	}()
+
+	api.SetHeaders(w)
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Trailer", "X-Stream-Error")
+	w.WriteHeader(http.StatusOK)
+	flusher, flush := w.(http.Flusher)
+	if flush {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	var err error
+	for ev := range out {
+		if sse {
+			var data []byte
+			data, err = json.Marshal(ev)
+			if err == nil {
+				_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			}
+		} else {
+			err = enc.Encode(ev)
+		}
+		if err != nil {
+			// most likely the client went away.
+			logger.Debug(err)
+			cancel()
+			break
+		}
+		if flush {
+			flusher.Flush()
+		}
+	}
+	// let the stream finish.
+	for range out {
+	}
+
+	w.Header().Set("X-Stream-Error", "")
+	if err := <-errCh; err != nil && ctx.Err() == nil {
+		w.Header().Set("X-Stream-Error", err.Error())
+	}
+}
+
+// splitQueryValues splits comma-separated query values, ignoring empty
+// ones.
+func splitQueryValues(values []string) []string {
+	var res []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				res = append(res, s)
+			}
+		}
+	}
+	return res
+}
+
 func (api *API) addHandler(w http.ResponseWriter, r *http.Request) {
 	reader, err := r.MultipartReader()
 	if err != nil {
@@ -303,6 +668,12 @@ func (api *API) addHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pin := types.PinWithOpts(types.CidUndef, params.PinOptions)
+	if !api.AuthorizePin(w, r, &pin) {
+		return
+	}
+	params.PinOptions = pin.PinOptions
+
 	api.SetHeaders(w)
 
 	// any errors sent as trailer
@@ -384,9 +755,111 @@ func (api *API) peerRemoveHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (api *API) peerDrainHandler(w http.ResponseWriter, r *http.Request) {
+	if p := api.ParsePidOrFail(w, r); p != "" {
+		remove := r.URL.Query().Get("remove") == "true"
+		var status types.DrainStatus
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			"PeerDrain",
+			types.DrainStatus{Peer: p, Remove: remove},
+			&status,
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, status)
+	}
+}
+
+func (api *API) peerDrainStatusHandler(w http.ResponseWriter, r *http.Request) {
+	api.peerDrainCall(w, r, "PeerDrainStatus")
+}
+
+func (api *API) peerDrainCancelHandler(w http.ResponseWriter, r *http.Request) {
+	api.peerDrainCall(w, r, "PeerDrainCancel")
+}
+
+func (api *API) peerDrainCall(w http.ResponseWriter, r *http.Request, method string) {
+	if p := api.ParsePidOrFail(w, r); p != "" {
+		var status types.DrainStatus
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			method,
+			p,
+			&status,
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, status)
+	}
+}
+
+// peerMaintenanceStartHandler puts a peer in maintenance mode. The
+// "duration" query parameter optionally sets how long it lasts.
+func (api *API) peerMaintenanceStartHandler(w http.ResponseWriter, r *http.Request) {
+	p := api.ParsePidOrFail(w, r)
+	if p == "" {
+		return
+	}
+
+	var d time.Duration
+	if durStr := r.URL.Query().Get("duration"); durStr != "" {
+		var err error
+		d, err = time.ParseDuration(durStr)
+		if err != nil {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error parsing duration: "+err.Error()), nil)
+			return
+		}
+	}
+
+	var status types.MaintenanceStatus
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		p,
+		"Cluster",
+		"MaintenanceStart",
+		d,
+		&status,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, status)
+}
+
+func (api *API) peerMaintenanceStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if p := api.ParsePidOrFail(w, r); p != "" {
+		var status types.MaintenanceStatus
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			"PeerMaintenanceStatus",
+			p,
+			&status,
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, status)
+	}
+}
+
+func (api *API) peerMaintenanceStopHandler(w http.ResponseWriter, r *http.Request) {
+	if p := api.ParsePidOrFail(w, r); p != "" {
+		var status types.MaintenanceStatus
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			p,
+			"Cluster",
+			"MaintenanceStop",
+			struct{}{},
+			&status,
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, status)
+	}
+}
+
 func (api *API) pinHandler(w http.ResponseWriter, r *http.Request) {
 	if pin := api.ParseCidOrFail(w, r); pin.Defined() {
 		api.config.Logger.Debugf("rest api pinHandler: %s", pin.Cid)
+		if !api.AuthorizePin(w, r, &pin) {
+			return
+		}
 		// span.AddAttributes(trace.StringAttribute("cid", pin.Cid))
 		var pinObj types.Pin
 		err := api.rpcClient.CallContext(
@@ -405,6 +878,9 @@ func (api *API) pinHandler(w http.ResponseWriter, r *http.Request) {
 func (api *API) unpinHandler(w http.ResponseWriter, r *http.Request) {
 	if pin := api.ParseCidOrFail(w, r); pin.Defined() {
 		api.config.Logger.Debugf("rest api unpinHandler: %s", pin.Cid)
+		if !api.AuthorizeModify(w, r, pin.Cid) {
+			return
+		}
 		// span.AddAttributes(trace.StringAttribute("cid", pin.Cid))
 		var pinObj types.Pin
 		err := api.rpcClient.CallContext(
@@ -424,6 +900,11 @@ func (api *API) pinPathHandler(w http.ResponseWriter, r *http.Request) {
 	var pin types.Pin
 	if pinpath := api.ParsePinPathOrFail(w, r); pinpath.Defined() {
 		api.config.Logger.Debugf("rest api pinPathHandler: %s", pinpath.Path)
+		if common.User(r.Context()) != "" {
+			// Ownership is checked on the resolved CID.
+			api.pinResolvedPath(w, r, pinpath)
+			return
+		}
 		err := api.rpcClient.CallContext(
 			r.Context(),
 			"",
@@ -442,6 +923,11 @@ func (api *API) unpinPathHandler(w http.ResponseWriter, r *http.Request) {
 	var pin types.Pin
 	if pinpath := api.ParsePinPathOrFail(w, r); pinpath.Defined() {
 		api.config.Logger.Debugf("rest api unpinPathHandler: %s", pinpath.Path)
+		if common.User(r.Context()) != "" {
+			// Ownership is checked on the resolved CID.
+			api.unpinResolvedPath(w, r, pinpath)
+			return
+		}
 		err := api.rpcClient.CallContext(
 			r.Context(),
 			"",
@@ -455,19 +941,105 @@ func (api *API) unpinPathHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (api *API) allocationsHandler(w http.ResponseWriter, r *http.Request) {
-	queryValues := r.URL.Query()
-	filterStr := queryValues.Get("filter")
-	var filter types.PinType
-	for _, f := range strings.Split(filterStr, ",") {
-		filter |= types.PinTypeFromString(f)
+// pinResolvedPath resolves the path and pins the resulting CID, like
+// Cluster.PinPath does, after checking ownership.
+func (api *API) pinResolvedPath(w http.ResponseWriter, r *http.Request, pinpath types.PinPath) {
+	c, err := api.resolvePath(r.Context(), pinpath.Path)
+	if err != nil {
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+		return
 	}
 
-	if filter == types.BadType {
-		api.SendResponse(w, http.StatusBadRequest, errors.New("invalid filter value"), nil)
+	pin := types.PinWithOpts(c, pinpath.PinOptions)
+	if !api.AuthorizePin(w, r, &pin) {
 		return
 	}
 
+	var pinObj types.Pin
+	err = api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"Pin",
+		pin,
+		&pinObj,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, pinObj)
+}
+
+// unpinResolvedPath resolves the path and unpins the resulting CID, like
+// Cluster.UnpinPath does, after checking ownership.
+func (api *API) unpinResolvedPath(w http.ResponseWriter, r *http.Request, pinpath types.PinPath) {
+	c, err := api.resolvePath(r.Context(), pinpath.Path)
+	if err != nil {
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+		return
+	}
+
+	if !api.AuthorizeModify(w, r, c) {
+		return
+	}
+
+	var pinObj types.Pin
+	err = api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"Unpin",
+		types.PinCid(c),
+		&pinObj,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, pinObj)
+}
+
+// allocationsHandler lists the pinset. The query arguments are parsed as
+// an api.PinQuery, allowing to filter and paginate the results.
+func (api *API) allocationsHandler(w http.ResponseWriter, r *http.Request) {
+	var query types.PinQuery
+	err := query.FromQuery(r.URL.Query())
+	if err != nil {
+		api.SendResponse(w, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	in := make(chan types.PinQuery, 1)
+	in <- query
+	close(in)
+
+	out := make(chan types.Pin, common.StreamChannelSize)
+	errCh := make(chan error, 1)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	go func() {
+		defer close(errCh)
+
+		errCh <- api.rpcClient.Stream(
+			ctx,
+			"",
+			"Cluster",
+			"PinsQuery",
+			in,
+			out,
+		)
+	}()
+
+	iter := func() (interface{}, bool, error) {
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case p, ok := <-out:
+			return p, ok, nil
+		}
+	}
+
+	api.StreamResponse(w, iter, errCh)
+}
+
+// streamPins sends the pins in the shared state for which match returns
+// true.
+func (api *API) streamPins(w http.ResponseWriter, r *http.Request, match func(types.Pin) bool) {
 	in := make(chan struct{})
 	close(in)
 
@@ -505,7 +1077,7 @@ func (api *API) allocationsHandler(w http.ResponseWriter, r *http.Request) {
 				}
 				// this means we keep iterating if no filter
 				// matched
-				if filter == types.AllType || filter&p.Type > 0 {
+				if match(p) {
 					break iterloop
 				}
 			}
@@ -531,6 +1103,306 @@ func (api *API) allocationHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// allocationPreviewHandler takes the same pin options as pinHandler and an
+// optional "cid" parameter, and returns the allocations that pinning would
+// produce without pinning anything.
+func (api *API) allocationPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	opts := types.PinOptions{}
+	err := opts.FromQuery(q)
+	if err != nil {
+		api.SendResponse(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	pin := types.PinWithOpts(types.CidUndef, opts)
+
+	if v := q.Get("cid"); v != "" {
+		c, err := types.DecodeCid(v)
+		if err != nil {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding Cid: "+err.Error()), nil)
+			return
+		}
+		pin.Cid = c
+	}
+
+	var preview types.AllocationPreview
+	err = api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"AllocationPreview",
+		pin,
+		&preview,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, preview)
+}
+
+func (api *API) allocationParentsHandler(w http.ResponseWriter, r *http.Request) {
+	if pin := api.ParseCidOrFail(w, r); pin.Defined() {
+		var parents []types.Pin
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			"PinParents",
+			pin.Cid,
+			&parents,
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, parents)
+	}
+}
+
+// parseCollectionOrFail returns the collection name from the request path
+// and its CID, or makes the request fail.
+func (api *API) parseCollectionOrFail(w http.ResponseWriter, r *http.Request) (string, types.Cid) {
+	name := mux.Vars(r)["name"]
+	ci, err := types.CollectionCid(name)
+	if err != nil {
+		api.SendResponse(w, http.StatusBadRequest, err, nil)
+		return "", types.CidUndef
+	}
+	return name, ci
+}
+
+// parseCollectionMembersOrFail decodes a JSON array of CIDs from the
+// request body.
+func (api *API) parseCollectionMembersOrFail(w http.ResponseWriter, r *http.Request) (types.CollectionMembers, bool) {
+	name, ci := api.parseCollectionOrFail(w, r)
+	if !ci.Defined() {
+		return types.CollectionMembers{}, false
+	}
+
+	dec := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	var cids []types.Cid
+	err := dec.Decode(&cids)
+	if err != nil {
+		api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding request body: "+err.Error()), nil)
+		return types.CollectionMembers{}, false
+	}
+	return types.CollectionMembers{Name: name, Cids: cids}, true
+}
+
+// authorizeCollectionModify makes the request fail and returns false when
+// the authenticated user cannot modify the collection or any of the given
+// pins.
+func (api *API) authorizeCollectionModify(w http.ResponseWriter, r *http.Request, members types.CollectionMembers, cids []types.Cid) bool {
+	ci, err := types.CollectionCid(members.Name)
+	if err != nil {
+		api.SendResponse(w, http.StatusBadRequest, err, nil)
+		return false
+	}
+	if !api.AuthorizeModify(w, r, ci) {
+		return false
+	}
+	for _, c := range cids {
+		if !api.AuthorizeModify(w, r, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (api *API) collectionsHandler(w http.ResponseWriter, r *http.Request) {
+	api.streamPins(w, r, func(p types.Pin) bool {
+		return p.Type == types.CollectionType
+	})
+}
+
+func (api *API) collectionHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ci := api.parseCollectionOrFail(w, r); ci.Defined() {
+		var pin types.Pin
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			"PinGet",
+			ci,
+			&pin,
+		)
+		if err == nil && pin.Type != types.CollectionType {
+			api.SendResponse(w, http.StatusNotFound, errors.New("not a collection"), nil)
+			return
+		}
+		api.SendResponse(w, common.SetStatusAutomatically, err, pin)
+	}
+}
+
+func (api *API) collectionCreateHandler(w http.ResponseWriter, r *http.Request) {
+	name, ci := api.parseCollectionOrFail(w, r)
+	if !ci.Defined() {
+		return
+	}
+
+	opts := types.PinOptions{}
+	err := opts.FromQuery(r.URL.Query())
+	if err != nil {
+		api.SendResponse(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	opts.Name = name
+
+	// Members are owned by the owner of the collection.
+	pin := types.PinWithOpts(ci, opts)
+	if !api.AuthorizePin(w, r, &pin) {
+		return
+	}
+
+	err = api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"CollectionCreate",
+		pin,
+		&pin,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, pin)
+}
+
+func (api *API) collectionDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ci := api.parseCollectionOrFail(w, r); ci.Defined() {
+		if !api.AuthorizeModify(w, r, ci) {
+			return
+		}
+		var pin types.Pin
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			"Unpin",
+			types.PinCid(ci),
+			&pin,
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, pin)
+	}
+}
+
+func (api *API) collectionMembersHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ci := api.parseCollectionOrFail(w, r); ci.Defined() {
+		api.streamPins(w, r, func(p types.Pin) bool {
+			return p.HasParent(ci)
+		})
+	}
+}
+
+func (api *API) collectionAddHandler(w http.ResponseWriter, r *http.Request) {
+	if members, ok := api.parseCollectionMembersOrFail(w, r); ok {
+		// Adding pins to a collection modifies their options.
+		if !api.authorizeCollectionModify(w, r, members, members.Cids) {
+			return
+		}
+		var pins []types.Pin
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			"CollectionAdd",
+			members,
+			&pins,
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, pins)
+	}
+}
+
+func (api *API) collectionRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	if members, ok := api.parseCollectionMembersOrFail(w, r); ok {
+		if !api.authorizeCollectionModify(w, r, members, nil) {
+			return
+		}
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			"CollectionRemove",
+			members,
+			&struct{}{},
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+	}
+}
+
+func (api *API) collectionStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if name, ci := api.parseCollectionOrFail(w, r); ci.Defined() {
+		var gpi types.GlobalPinInfo
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			"CollectionStatus",
+			name,
+			&gpi,
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, gpi)
+	}
+}
+
+// exportCARHandler streams the DAG of a pinned item as a CARv1 file. Blocks
+// are requested from the peers allocated to the pin (or from every peer when
+// the pin has no specific allocations or is sharded), and from the IPFS
+// daemon of this peer as a last resort.
+func (api *API) exportCARHandler(w http.ResponseWriter, r *http.Request) {
+	pin := api.ParseCidOrFail(w, r)
+	if !pin.Defined() {
+		return
+	}
+
+	ctx := r.Context()
+	var pinResp types.Pin
+	err := api.rpcClient.CallContext(
+		ctx,
+		"",
+		"Cluster",
+		"PinGet",
+		pin.Cid,
+		&pinResp,
+	)
+	if err != nil {
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+		return
+	}
+
+	peers := pinResp.Allocations
+	if len(peers) == 0 || pinResp.Type == types.MetaType {
+		err = api.rpcClient.CallContext(
+			ctx,
+			"",
+			"Consensus",
+			"Peers",
+			struct{}{},
+			&peers,
+		)
+		if err != nil {
+			api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+			return
+		}
+	}
+
+	ng := newRPCNodeGetter(api.rpcClient, peers)
+
+	// Make sure the root is retrievable before we commit to
+	// a 200 response.
+	if _, err := ng.Get(ctx, pinResp.Cid.Cid); err != nil {
+		api.SendResponse(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	api.SetHeaders(w)
+	w.Header().Set("Content-Type", "application/vnd.ipld.car")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", pinResp.Cid.String()+".car"))
+	w.Header().Set("Trailer", "X-Stream-Error")
+	w.WriteHeader(http.StatusOK)
+
+	err = car.WriteCar(ctx, ng, []cid.Cid{pinResp.Cid.Cid}, w)
+	if err != nil {
+		logger.Errorf("error exporting %s as CAR: %s", pinResp.Cid, err)
+		w.Header().Set("X-Stream-Error", err.Error())
+		return
+	}
+	w.Header().Set("X-Stream-Error", "")
+}
+
 func (api *API) statusAllHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
@@ -816,6 +1688,37 @@ func (api *API) recoverHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (api *API) verifyHandler(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+	local := queryValues.Get("local")
+
+	if pin := api.ParseCidOrFail(w, r); pin.Defined() {
+		if local == "true" {
+			var pinInfo types.PinInfo
+			err := api.rpcClient.CallContext(
+				r.Context(),
+				"",
+				"Cluster",
+				"VerifyLocal",
+				pin.Cid,
+				&pinInfo,
+			)
+			api.SendResponse(w, common.SetStatusAutomatically, err, pinInfo.ToGlobal())
+		} else {
+			var pinInfo types.GlobalPinInfo
+			err := api.rpcClient.CallContext(
+				r.Context(),
+				"",
+				"Cluster",
+				"Verify",
+				pin.Cid,
+				&pinInfo,
+			)
+			api.SendResponse(w, common.SetStatusAutomatically, err, pinInfo)
+		}
+	}
+}
+
 func (api *API) repoGCHandler(w http.ResponseWriter, r *http.Request) {
 	queryValues := r.URL.Query()
 	local := queryValues.Get("local")
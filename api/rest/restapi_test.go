@@ -2,7 +2,9 @@ package rest
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -10,9 +12,11 @@ import (
 	"time"
 
 	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/api/common"
 	test "github.com/lubanproj/ipfs-cluster/api/common/test"
 	clustertest "github.com/lubanproj/ipfs-cluster/test"
 
+	car "github.com/ipld/go-car"
 	libp2p "github.com/libp2p/go-libp2p"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	ma "github.com/multiformats/go-multiaddr"
@@ -278,6 +282,72 @@ func TestAPIPeerRemoveEndpoint(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIPeerDrainEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		drainURL := url(rest) + "/peers/" + clustertest.PeerID2.Pretty() + "/drain"
+
+		var status api.DrainStatus
+		test.MakePost(t, rest, drainURL+"?remove=true", []byte{}, &status)
+		if status.Peer != clustertest.PeerID2 || !status.Remove || status.Phase != api.DrainPhaseDraining {
+			t.Errorf("unexpected drain status: %+v", status)
+		}
+
+		status = api.DrainStatus{}
+		test.MakeGet(t, rest, drainURL, &status)
+		if status.Pins != 3 || status.Moved != 1 || !status.Moving.Equals(clustertest.Cid1) {
+			t.Errorf("unexpected drain progress: %+v", status)
+		}
+
+		status = api.DrainStatus{}
+		test.MakeDelete(t, rest, drainURL, &status)
+		if status.Phase != api.DrainPhaseCancelled {
+			t.Errorf("expected a cancelled drain: %+v", status)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIPeerMaintenanceEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		maintURL := url(rest) + "/peers/" + clustertest.PeerID1.Pretty() + "/maintenance"
+
+		var status api.MaintenanceStatus
+		test.MakePost(t, rest, maintURL+"?duration=10m", []byte{}, &status)
+		if !status.Enabled || status.Until.Sub(status.Started) > 11*time.Minute {
+			t.Errorf("unexpected maintenance status: %+v", status)
+		}
+
+		var errResp api.Error
+		test.MakePost(t, rest, maintURL+"?duration=abc", []byte{}, &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("expected an error parsing the duration")
+		}
+
+		status = api.MaintenanceStatus{}
+		test.MakeGet(t, rest, maintURL, &status)
+		if status.Peer != clustertest.PeerID1 || !status.Enabled {
+			t.Errorf("unexpected maintenance status: %+v", status)
+		}
+
+		status = api.MaintenanceStatus{}
+		test.MakeDelete(t, rest, maintURL, &status)
+		if status.Enabled {
+			t.Errorf("expected maintenance to be disabled: %+v", status)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestConnectGraphEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -499,6 +569,286 @@ func TestAPIUnpinEndpointWithPath(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func testAPIwithOwnership(t *testing.T) *API {
+	cfg := NewConfig()
+	cfg.Default()
+	cfg.BasicAuthCredentials = map[string]string{
+		validUserName:        validUserPassword,
+		adminUserName:        adminUserPassword,
+		clustertest.PinOwner: validUserPassword,
+	}
+	cfg.Roles = map[string]common.Role{
+		validUserName:        common.RolePinner,
+		adminUserName:        common.RoleAdmin,
+		clustertest.PinOwner: common.RolePinner,
+	}
+
+	return testAPIwithConfig(t, cfg, "ownership")
+}
+
+// makeRequestAs performs a request authenticated as the given user and
+// returns the response status.
+func makeRequestAs(t *testing.T, rest *API, method, url, user, pass string, resp interface{}) int {
+	h := test.MakeHost(t, rest)
+	defer h.Close()
+	c := test.HTTPClient(t, h, test.IsHTTPS(url))
+	req, _ := http.NewRequest(method, url, nil)
+	req.SetBasicAuth(user, pass)
+	httpResp, err := c.Do(req)
+	test.ProcessResp(t, httpResp, err, resp)
+	return httpResp.StatusCode
+}
+
+func TestAPIPinOwnership(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPIwithOwnership(t)
+	defer rest.Shutdown(ctx)
+
+	owner := clustertest.PinOwner
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		cid1 := url(rest) + "/pins/" + clustertest.Cid1.String()
+		cid3 := url(rest) + "/pins/" + clustertest.Cid3.String()
+
+		// Unowned items are owned by whoever pins them.
+		var pin api.Pin
+		status := makeRequestAs(t, rest, "POST", cid1, validUserName, validUserPassword, &pin)
+		if status != http.StatusOK || pin.Owner != validUserName {
+			t.Errorf("expected %s to own the pin: %d %s", validUserName, status, pin.Owner)
+		}
+
+		// Items owned by others can only be modified by admins.
+		var errResp api.Error
+		status = makeRequestAs(t, rest, "POST", cid3, validUserName, validUserPassword, &errResp)
+		if status != http.StatusForbidden {
+			t.Errorf("expected 403 pinning an item owned by another user: %d", status)
+		}
+		pin = api.Pin{}
+		status = makeRequestAs(t, rest, "POST", cid3, adminUserName, adminUserPassword, &pin)
+		if status != http.StatusOK || pin.Owner != owner {
+			t.Errorf("admins should keep the owner: %d %s", status, pin.Owner)
+		}
+		pin = api.Pin{}
+		status = makeRequestAs(t, rest, "POST", cid3, owner, validUserPassword, &pin)
+		if status != http.StatusOK || pin.Owner != owner {
+			t.Errorf("owners can repin beyond their quota: %d %s", status, pin.Owner)
+		}
+
+		status = makeRequestAs(t, rest, "DELETE", cid3, validUserName, validUserPassword, &errResp)
+		if status != http.StatusForbidden {
+			t.Errorf("expected 403 unpinning an item owned by another user: %d", status)
+		}
+		for _, user := range []string{adminUserName, owner} {
+			pass := validUserPassword
+			if user == adminUserName {
+				pass = adminUserPassword
+			}
+			status = makeRequestAs(t, rest, "DELETE", cid3, user, pass, &pin)
+			if status != http.StatusOK {
+				t.Errorf("%s should be able to unpin: %d", user, status)
+			}
+		}
+		status = makeRequestAs(t, rest, "DELETE", cid1, validUserName, validUserPassword, &pin)
+		if status != http.StatusOK {
+			t.Errorf("unowned items can be unpinned: %d", status)
+		}
+
+		// Paths are checked on the resolved CID.
+		pin = api.Pin{}
+		status = makeRequestAs(t, rest, "POST", url(rest)+"/pins"+clustertest.PathIPFS2, validUserName, validUserPassword, &pin)
+		if status != http.StatusOK || pin.Owner != validUserName || !pin.Cid.Equals(clustertest.Cid2) {
+			t.Errorf("unexpected pin for path: %d %s %s", status, pin.Cid, pin.Owner)
+		}
+		status = makeRequestAs(t, rest, "DELETE", url(rest)+"/pins"+clustertest.PathIPFS2, validUserName, validUserPassword, &pin)
+		if status != http.StatusOK {
+			t.Errorf("unowned paths can be unpinned: %d", status)
+		}
+
+		// Quotas are enforced by Cluster.
+		errResp = api.Error{}
+		status = makeRequestAs(t, rest, "POST", cid1, owner, validUserPassword, &errResp)
+		if status != http.StatusForbidden || !strings.Contains(errResp.Message, "quota") {
+			t.Errorf("expected the pin quota to be exceeded: %d %s", status, errResp.Message)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIUsageEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPIwithOwnership(t)
+	defer rest.Shutdown(ctx)
+
+	owner := clustertest.PinOwner
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var usage api.Usage
+		status := makeRequestAs(t, rest, "GET", url(rest)+"/usage", owner, validUserPassword, &usage)
+		if status != http.StatusOK ||
+			usage.User != owner ||
+			usage.Pins != 1 ||
+			usage.Size != clustertest.DAGSize ||
+			usage.MaxPins != 1 {
+			t.Errorf("unexpected usage: %d %+v", status, usage)
+		}
+
+		var errResp api.Error
+		status = makeRequestAs(t, rest, "GET", url(rest)+"/usage?user="+owner, validUserName, validUserPassword, &errResp)
+		if status != http.StatusForbidden {
+			t.Errorf("only admins can read the usage of others: %d", status)
+		}
+
+		usage = api.Usage{}
+		status = makeRequestAs(t, rest, "GET", url(rest)+"/usage?user="+owner, adminUserName, adminUserPassword, &usage)
+		if status != http.StatusOK || usage.User != owner || usage.Pins != 1 {
+			t.Errorf("unexpected usage: %d %+v", status, usage)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIRoutesHaveRoles(t *testing.T) {
+	rest := &API{}
+	for _, route := range rest.routes(nil) {
+		if route.Role == 0 {
+			t.Errorf("route %s does not have a role", route.Name)
+		}
+	}
+}
+
+func TestAPIRoles(t *testing.T) {
+	ctx := context.Background()
+	cfg := NewConfig()
+	cfg.Default()
+	cfg.BasicAuthCredentials = map[string]string{
+		validUserName: validUserPassword,
+		adminUserName: adminUserPassword,
+	}
+	cfg.Roles = map[string]common.Role{
+		validUserName: common.RoleReader,
+		adminUserName: common.RolePinner,
+	}
+	rest := testAPIwithConfig(t, cfg, "roles")
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		pinURL := url(rest) + "/pins/" + clustertest.Cid1.String()
+		peerURL := url(rest) + "/peers/" + clustertest.PeerID1.String()
+
+		var id api.ID
+		status := makeRequestAs(t, rest, "GET", url(rest)+"/id", validUserName, validUserPassword, &id)
+		if status != http.StatusOK {
+			t.Errorf("readers should be able to read the peer ID: %d", status)
+		}
+
+		var errResp api.Error
+		status = makeRequestAs(t, rest, "POST", pinURL, validUserName, validUserPassword, &errResp)
+		if status != http.StatusForbidden {
+			t.Errorf("readers should not be able to pin: %d", status)
+		}
+
+		var pin api.Pin
+		status = makeRequestAs(t, rest, "POST", pinURL, adminUserName, adminUserPassword, &pin)
+		if status != http.StatusOK {
+			t.Errorf("pinners should be able to pin: %d", status)
+		}
+
+		errResp = api.Error{}
+		status = makeRequestAs(t, rest, "DELETE", peerURL, adminUserName, adminUserPassword, &errResp)
+		if status != http.StatusForbidden || errResp.Code != http.StatusForbidden {
+			t.Errorf("pinners should not be able to remove peers: %d", status)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+// makeRequestWithKey performs a request authenticated with the given API
+// key token and returns the response status.
+func makeRequestWithKey(t *testing.T, rest *API, method, url, token string, resp interface{}) int {
+	h := test.MakeHost(t, rest)
+	defer h.Close()
+	c := test.HTTPClient(t, h, test.IsHTTPS(url))
+	req, _ := http.NewRequest(method, url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	httpResp, err := c.Do(req)
+	test.ProcessResp(t, httpResp, err, resp)
+	return httpResp.StatusCode
+}
+
+func TestAPIKeysEndpoints(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPIwithOwnership(t)
+	defer rest.Shutdown(ctx)
+
+	owner := clustertest.PinOwner
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		keysURL := url(rest) + "/keys"
+		keyURL := keysURL + "/" + clustertest.APIKeyID
+
+		var keys []api.APIKey
+		status := makeRequestAs(t, rest, "GET", keysURL, validUserName, validUserPassword, &keys)
+		if status != http.StatusOK || len(keys) != 0 {
+			t.Errorf("users should only see their own keys: %d %+v", status, keys)
+		}
+		keys = nil
+		status = makeRequestAs(t, rest, "GET", keysURL, adminUserName, adminUserPassword, &keys)
+		if status != http.StatusOK || len(keys) != 1 || keys[0].User != owner {
+			t.Errorf("admins should see every key: %d %+v", status, keys)
+		}
+
+		var key api.APIKey
+		status = makeRequestAs(t, rest, "POST", keysURL+"?scopes=read,pin&expire-in=1h", owner, validUserPassword, &key)
+		if status != http.StatusOK || key.User != owner || key.Token() == "" || !key.HasScope(api.APIKeyScopePin) {
+			t.Errorf("unexpected created key: %d %+v", status, key)
+		}
+
+		var errResp api.Error
+		status = makeRequestAs(t, rest, "POST", keysURL+"?user="+owner+"&scopes=read&expire-in=1h", validUserName, validUserPassword, &errResp)
+		if status != http.StatusForbidden {
+			t.Errorf("only admins can create keys for others: %d", status)
+		}
+
+		errResp = api.Error{}
+		status = makeRequestAs(t, rest, "POST", keysURL+"?scopes=read", owner, validUserPassword, &errResp)
+		if status != http.StatusBadRequest {
+			t.Errorf("keys without expiry should be rejected: %d", status)
+		}
+
+		errResp = api.Error{}
+		status = makeRequestWithKey(t, rest, "POST", keysURL+"?scopes=pin&expire-in=1h", clustertest.APIKeyToken, &errResp)
+		if status != http.StatusForbidden {
+			t.Errorf("keys cannot create keys with more scopes: %d", status)
+		}
+
+		errResp = api.Error{}
+		status = makeRequestAs(t, rest, "DELETE", keyURL, validUserName, validUserPassword, &errResp)
+		if status != http.StatusNotFound {
+			t.Errorf("users cannot revoke the keys of others: %d", status)
+		}
+		status = makeRequestAs(t, rest, "DELETE", keyURL, owner, validUserPassword, &errResp)
+		if status >= 400 {
+			t.Errorf("users should be able to revoke their keys: %d", status)
+		}
+
+		errResp = api.Error{}
+		status = makeRequestWithKey(t, rest, "POST", url(rest)+"/pins/"+clustertest.Cid1.String(), clustertest.APIKeyToken, &errResp)
+		if status != http.StatusForbidden {
+			t.Errorf("read keys should not be able to pin: %d", status)
+		}
+		var id api.ID
+		status = makeRequestWithKey(t, rest, "GET", url(rest)+"/id", clustertest.APIKeyToken, &id)
+		if status != http.StatusOK {
+			t.Errorf("read keys should be able to read: %d", status)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIAllocationsEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -520,11 +870,28 @@ func TestAPIAllocationsEndpoint(t *testing.T) {
 			t.Error("unexpected pin list: ", resp)
 		}
 
+		test.MakeStreamingGet(t, rest, url(rest)+"/allocations?replication=-1", &resp, false)
+		if len(resp) != 2 ||
+			!resp[0].Cid.Equals(clustertest.Cid1) || !resp[1].Cid.Equals(clustertest.Cid3) {
+			t.Error("unexpected pin list: ", resp)
+		}
+
+		test.MakeStreamingGet(t, rest, url(rest)+"/allocations?limit=1&cursor="+clustertest.Cid1.String(), &resp, false)
+		if len(resp) != 1 || !resp[0].Cid.Equals(clustertest.Cid2) {
+			t.Error("unexpected pin list: ", resp)
+		}
+
 		errResp := api.Error{}
 		test.MakeStreamingGet(t, rest, url(rest)+"/allocations?filter=invalid", &errResp, false)
 		if errResp.Code != http.StatusBadRequest {
 			t.Error("an invalid filter value should 400")
 		}
+
+		errResp = api.Error{}
+		test.MakeStreamingGet(t, rest, url(rest)+"/allocations?limit=-1", &errResp, false)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("an invalid limit should 400")
+		}
 	}
 
 	test.BothEndpoints(t, tf)
@@ -552,6 +919,120 @@ func TestAPIAllocationEndpoint(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIAllocationPreviewEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp api.AllocationPreview
+		test.MakePost(t, rest, url(rest)+"/allocations/preview?replication=1&cid="+clustertest.Cid1.String(), []byte{}, &resp)
+		if !resp.Cid.Equals(clustertest.Cid1) {
+			t.Errorf("cid should be the same: %s %s", resp.Cid, clustertest.Cid1)
+		}
+		if len(resp.Allocations) != 1 || resp.Allocations[0] != clustertest.PeerID1 {
+			t.Errorf("unexpected allocations: %s", resp.Allocations)
+		}
+		if len(resp.Peers) != 2 || !resp.Peers[0].Chosen || resp.Peers[1].Group != api.AllocationGroupExcluded {
+			t.Errorf("unexpected peer reports: %+v", resp.Peers)
+		}
+
+		resp = api.AllocationPreview{}
+		test.MakePost(t, rest, url(rest)+"/allocations/preview?replication=1", []byte{}, &resp)
+		if resp.Cid.Defined() || len(resp.Allocations) != 1 {
+			t.Errorf("unexpected preview without cid: %+v", resp)
+		}
+
+		errResp := api.Error{}
+		test.MakePost(t, rest, url(rest)+"/allocations/preview?cid=abc", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with a bad cid")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIAllocationParentsEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp []api.Pin
+		test.MakeGet(t, rest, url(rest)+"/allocations/"+clustertest.Cid1.String()+"/parents", &resp)
+		if len(resp) != 1 || resp[0].Type != api.MetaType {
+			t.Errorf("expected a single meta-pin parent: %+v", resp)
+		}
+
+		errResp := api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/allocations/"+clustertest.Cid4.String()+"/parents", &errResp)
+		if errResp.Code != 404 {
+			t.Error("a non-pinned cid should 404")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIExportCAREndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		h := test.MakeHost(t, rest)
+		defer h.Close()
+		c := test.HTTPClient(t, h, test.IsHTTPS(url(rest)))
+		httpResp, err := c.Get(url(rest) + "/pins/" + clustertest.Cid6.String() + "/car")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer httpResp.Body.Close()
+		if httpResp.StatusCode != http.StatusOK {
+			t.Fatal("expected 200 but got", httpResp.StatusCode)
+		}
+		if ct := httpResp.Header.Get("Content-Type"); ct != "application/vnd.ipld.car" {
+			t.Error("unexpected content type:", ct)
+		}
+
+		cr, err := car.NewCarReader(httpResp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cr.Header.Roots) != 1 || !cr.Header.Roots[0].Equals(clustertest.Cid6.Cid) {
+			t.Error("unexpected CAR roots:", cr.Header.Roots)
+		}
+		blk, err := cr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(blk.RawData()) != clustertest.Cid6Data {
+			t.Error("unexpected block data")
+		}
+		if _, err := cr.Next(); err != io.EOF {
+			t.Error("expected a single block")
+		}
+		if trailer := httpResp.Trailer.Get("X-Stream-Error"); trailer != "" {
+			t.Error("unexpected stream error:", trailer)
+		}
+
+		errResp := api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/pins/"+clustertest.Cid4.String()+"/car", &errResp)
+		if errResp.Code != 404 {
+			t.Error("a non-pinned cid should 404")
+		}
+
+		errResp = api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/pins/"+clustertest.Cid1.String()+"/car", &errResp)
+		if errResp.Code != 500 {
+			t.Error("a cid whose blocks cannot be retrieved should error")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIMetricsEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -608,6 +1089,108 @@ func TestAPIAlertsEndpoint(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIRebalanceStatusEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp api.RebalanceStatus
+		test.MakeGet(t, rest, url(rest)+"/health/rebalance", &resp)
+		if !resp.Enabled || resp.Peer != clustertest.PeerID1 {
+			t.Errorf("unexpected rebalance status: %+v", resp)
+		}
+		if !resp.Migrating.Equals(clustertest.Cid1) || resp.Migrated != 1 {
+			t.Errorf("unexpected rebalance progress: %+v", resp)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIReplicationReportEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp []api.ReplicationReport
+		test.MakeStreamingGet(t, rest, url(rest)+"/health/replication", &resp, false)
+		if len(resp) != 2 {
+			t.Fatalf("expected 2 reports, got %d", len(resp))
+		}
+		if !resp[0].Cid.Equals(clustertest.Cid1) || resp[0].State != api.ReplicationUnder || len(resp[0].Healthy) != 1 {
+			t.Errorf("unexpected report: %+v", resp[0])
+		}
+		if resp[1].State != api.ReplicationUnavailable {
+			t.Errorf("unexpected report: %+v", resp[1])
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIEventsEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp []api.Event
+		test.MakeStreamingGet(t, rest, url(rest)+"/events", &resp, false)
+		if len(resp) != 4 {
+			t.Fatalf("expected 4 events, got %d", len(resp))
+		}
+		if resp[0].Type != api.EventPinsetAdd || !resp[0].Cid.Equals(clustertest.Cid1) {
+			t.Errorf("unexpected event: %+v", resp[0])
+		}
+		if resp[2].Status != api.TrackerStatusPinned {
+			t.Errorf("unexpected event: %+v", resp[2])
+		}
+
+		var resp2 []api.Event
+		test.MakeStreamingGet(t, rest, url(rest)+"/events?cid="+clustertest.Cid1.String()+"&type=pinning,pinned", &resp2, false)
+		if len(resp2) != 2 || resp2[0].Type != api.EventPinning || resp2[1].Type != api.EventPinned {
+			t.Errorf("unexpected filtered events: %+v", resp2)
+		}
+
+		var resp3 []api.Event
+		test.MakeStreamingGet(t, rest, url(rest)+"/events?name=test", &resp3, false)
+		if len(resp3) != 3 {
+			t.Errorf("expected 3 events for name, got %d", len(resp3))
+		}
+
+		errResp := api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/events?type=abc", &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("should fail with an invalid event type")
+		}
+
+		h := test.MakeHost(t, rest)
+		defer h.Close()
+		c := test.HTTPClient(t, h, test.IsHTTPS(url(rest)))
+		req, _ := http.NewRequest(http.MethodGet, url(rest)+"/events?type=error", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		httpResp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer httpResp.Body.Close()
+		if ct := httpResp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Error("unexpected content type:", ct)
+		}
+		body, err := ioutil.ReadAll(httpResp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(body), "event: error\ndata: {") || !strings.HasSuffix(string(body), "}\n\n") {
+			t.Errorf("unexpected server-sent events: %s", body)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIStatusAllEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -776,6 +1359,92 @@ func TestAPIRecoverEndpoint(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIVerifyEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp api.GlobalPinInfo
+		test.MakePost(t, rest, url(rest)+"/pins/"+clustertest.Cid1.String()+"/verify", []byte{}, &resp)
+
+		if !resp.Cid.Equals(clustertest.Cid1) {
+			t.Error("expected the same cid")
+		}
+		info, ok := resp.PeerMap[peer.Encode(clustertest.PeerID1)]
+		if !ok {
+			t.Fatal("expected info for clustertest.PeerID1")
+		}
+		if info.Status.String() != "pinned" {
+			t.Error("expected different status")
+		}
+
+		var resp2 api.GlobalPinInfo
+		test.MakePost(t, rest, url(rest)+"/pins/"+clustertest.Cid1.String()+"/verify?local=true", []byte{}, &resp2)
+		if len(resp2.PeerMap) != 1 {
+			t.Error("expected a single peer in the local response")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPICollectionEndpoints(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	collCid, err := api.CollectionCid("photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var coll api.Pin
+		test.MakePost(t, rest, url(rest)+"/collections/photos?replication-min=2&replication-max=3", []byte{}, &coll)
+		if coll.Type != api.CollectionType || coll.Name != "photos" || !coll.Cid.Equals(collCid) {
+			t.Error("unexpected collection: ", coll)
+		}
+		if coll.ReplicationFactorMin != 2 || coll.ReplicationFactorMax != 3 {
+			t.Error("collection options should be set from the query")
+		}
+
+		body, _ := json.Marshal([]api.Cid{clustertest.Cid1, clustertest.Cid2})
+		var pins []api.Pin
+		test.MakePost(t, rest, url(rest)+"/collections/photos/members", body, &pins)
+		if len(pins) != 2 || !pins[0].HasParent(collCid) {
+			t.Error("unexpected members: ", pins)
+		}
+
+		var gpi api.GlobalPinInfo
+		test.MakeGet(t, rest, url(rest)+"/collections/photos/status", &gpi)
+		if gpi.Name != "photos" || !gpi.Cid.Equals(collCid) {
+			t.Error("unexpected collection status: ", gpi)
+		}
+
+		var colls []api.Pin
+		test.MakeStreamingGet(t, rest, url(rest)+"/collections", &colls, false)
+		if len(colls) != 0 {
+			t.Error("the mock pinset has no collections")
+		}
+
+		errResp := api.Error{}
+		test.MakePost(t, rest, url(rest)+"/collections/photos/members", []byte("not json"), &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("a bad body should 400")
+		}
+
+		errResp = api.Error{}
+		name := strings.Repeat("a", api.MaxCollectionNameLength+1)
+		test.MakeGet(t, rest, url(rest)+"/collections/"+name+"/status", &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("an invalid collection name should 400")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIRecoverAllEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -24,6 +24,7 @@ import (
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	protocol "github.com/libp2p/go-libp2p-core/protocol"
 	multiaddr "github.com/multiformats/go-multiaddr"
+	multihash "github.com/multiformats/go-multihash"
 
 	// needed to parse /ws multiaddresses
 	_ "github.com/libp2p/go-libp2p/p2p/transport/websocket"
@@ -77,6 +78,9 @@ const (
 	// The item is in the state and should be pinned, but
 	// it is however not pinned and not queued/pinning.
 	TrackerStatusUnexpectedlyUnpinned
+	// The item is pinned but verification found that some of its
+	// blocks are missing or do not match their hashes.
+	TrackerStatusCorrupted
 )
 
 // Composite TrackerStatus.
@@ -104,6 +108,7 @@ var trackerStatusString = map[TrackerStatus]string{
 	TrackerStatusQueued:               "queued",
 	TrackerStatusSharded:              "sharded",
 	TrackerStatusUnexpectedlyUnpinned: "unexpectedly_unpinned",
+	TrackerStatusCorrupted:            "corrupted",
 }
 
 // values autofilled in init()
@@ -353,6 +358,7 @@ type GlobalPinInfo struct {
 	Origins     []Multiaddr       `json:"origins" codec:"g,omitempty"`
 	Created     time.Time         `json:"created" codec:"t,omitempty"`
 	Metadata    map[string]string `json:"metadata" codec:"m,omitempty"`
+	Priority    int               `json:"priority,omitempty" codec:"pr,omitempty"`
 
 	// https://github.com/golang/go/issues/28827
 	// Peer IDs are of string Kind(). We can't use peer IDs here
@@ -379,6 +385,7 @@ func (gpi *GlobalPinInfo) Add(pi PinInfo) {
 		gpi.Origins = pi.Origins
 		gpi.Created = pi.Created
 		gpi.Metadata = pi.Metadata
+		gpi.Priority = pi.Priority
 	}
 
 	if gpi.PeerMap == nil {
@@ -440,6 +447,7 @@ type PinInfo struct {
 	Origins     []Multiaddr       `json:"origins" codec:"g,omitempty"`
 	Created     time.Time         `json:"created" codec:"t,omitempty"`
 	Metadata    map[string]string `json:"metadata" codec:"md,omitempty"`
+	Priority    int               `json:"priority,omitempty" codec:"pr,omitempty"`
 
 	PinInfoShort
 }
@@ -559,6 +567,9 @@ type ID struct {
 	Error                 string      `json:"error" codec:"e,omitempty"`
 	IPFS                  IPFSID      `json:"ipfs,omitempty" codec:"ip,omitempty"`
 	Peername              string      `json:"peername" codec:"pn,omitempty"`
+	// Maintenance is set when the peer is known to be in maintenance
+	// mode.
+	Maintenance *MaintenanceStatus `json:"maintenance,omitempty" codec:"m,omitempty"`
 	//PublicKey          crypto.PubKey
 }
 
@@ -611,10 +622,22 @@ const (
 	// ShardTypes are pinned with MaxDepth=1 (root and
 	// direct children only).
 	ShardType
+	// CollectionType pins represent a named group of pins. They are not
+	// pinned in IPFS and carry no allocations. Their CID is derived from
+	// the collection name (see CollectionCid) and their PinOptions
+	// apply to every member. Members list the collection CID in their
+	// Parents.
+	CollectionType
+	// RecordType pins store data that cluster peers share, like the
+	// state of peer drains. They are not pinned in IPFS and carry no
+	// allocations. Their CID is derived from the record kind and key
+	// (see RecordCid) and their value is kept in their metadata.
+	RecordType
 )
 
-// AllType is a PinType used for filtering all pin types
-const AllType PinType = DataType | MetaType | ClusterDAGType | ShardType
+// AllType is a PinType used for filtering all pin types. Records are
+// internal to cluster and are left out.
+const AllType PinType = DataType | MetaType | ClusterDAGType | ShardType | CollectionType
 
 // PinTypeFromString is the inverse of String.  It returns the PinType value
 // corresponding to the input string
@@ -628,6 +651,10 @@ func PinTypeFromString(str string) PinType {
 		return ClusterDAGType
 	case "shard-pin":
 		return ShardType
+	case "collection":
+		return CollectionType
+	case "record":
+		return RecordType
 	case "all":
 		return AllType
 	case "":
@@ -648,6 +675,10 @@ func (pT PinType) String() string {
 		return "clusterdag-pin"
 	case ShardType:
 		return "shard-pin"
+	case CollectionType:
+		return "collection"
+	case RecordType:
+		return "record"
 	case AllType:
 		return "all"
 	default:
@@ -761,6 +792,20 @@ type PinOptions struct {
 	Metadata             map[string]string `json:"metadata" codec:"m,omitempty"`
 	PinUpdate            Cid               `json:"pin_update,omitempty" codec:"pu,omitempty"`
 	Origins              []Multiaddr       `json:"origins" codec:"g,omitempty"`
+	// Pins with a positive Priority are queued for pinning ahead of
+	// everything else. Negative values mark bulk pins that can wait.
+	Priority int `json:"priority,omitempty" codec:"pr,omitempty"`
+	// AntiAffinity and Spread are placement constraints given as metric
+	// names, like "tag:rack". See ApplyPlacement.
+	AntiAffinity []string `json:"anti_affinity,omitempty" codec:"aa,omitempty"`
+	Spread       []string `json:"spread,omitempty" codec:"sp,omitempty"`
+	// CallbackURL receives a PinCallback once the pin is fully
+	// replicated or has failed. It is ignored for all types of pins
+	// but DataType.
+	CallbackURL string `json:"callback_url,omitempty" codec:"cb,omitempty"`
+	// Owner is the API user which pinned the item. It is set by the
+	// APIs after authentication and is not a query option.
+	Owner string `json:"owner,omitempty" codec:"ow,omitempty"`
 }
 
 // Equals returns true if two PinOption objects are equivalent. po and po2 may
@@ -786,6 +831,26 @@ func (po PinOptions) Equals(po2 PinOptions) bool {
 		return false
 	}
 
+	if po.Priority != po2.Priority {
+		return false
+	}
+
+	if strings.Join(po.AntiAffinity, ",") != strings.Join(po2.AntiAffinity, ",") {
+		return false
+	}
+
+	if strings.Join(po.Spread, ",") != strings.Join(po2.Spread, ",") {
+		return false
+	}
+
+	if po.CallbackURL != po2.CallbackURL {
+		return false
+	}
+
+	if po.Owner != po2.Owner {
+		return false
+	}
+
 	lenAllocs1 := len(po.UserAllocations)
 	lenAllocs2 := len(po2.UserAllocations)
 	if lenAllocs1 != lenAllocs2 {
@@ -869,6 +934,22 @@ func (po PinOptions) ToQuery() (string, error) {
 		q.Set("origins", strings.Join(origins, ","))
 	}
 
+	if po.Priority != 0 {
+		q.Set("priority", fmt.Sprintf("%d", po.Priority))
+	}
+
+	if len(po.AntiAffinity) > 0 {
+		q.Set("anti-affinity", strings.Join(po.AntiAffinity, ","))
+	}
+
+	if len(po.Spread) > 0 {
+		q.Set("spread", strings.Join(po.Spread, ","))
+	}
+
+	if po.CallbackURL != "" {
+		q.Set("callback-url", po.CallbackURL)
+	}
+
 	return q.Encode(), nil
 }
 
@@ -894,6 +975,11 @@ func (po *PinOptions) FromQuery(q url.Values) error {
 		return err
 	}
 
+	err = parseIntParam(q, "priority", &po.Priority)
+	if err != nil {
+		return err
+	}
+
 	if v := q.Get("shard-size"); v != "" {
 		shardSize, err := strconv.ParseUint(v, 10, 64)
 		if err != nil {
@@ -906,6 +992,22 @@ func (po *PinOptions) FromQuery(q url.Values) error {
 		po.UserAllocations = StringsToPeers(strings.Split(allocs, ","))
 	}
 
+	if v := q.Get("anti-affinity"); v != "" {
+		po.AntiAffinity = strings.Split(v, ",")
+	}
+
+	if v := q.Get("spread"); v != "" {
+		po.Spread = strings.Split(v, ",")
+	}
+
+	if v := q.Get("callback-url"); v != "" {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("parameter callback-url is invalid")
+		}
+		po.CallbackURL = v
+	}
+
 	if v := q.Get("expire-at"); v != "" {
 		var tm time.Time
 		err := tm.UnmarshalText([]byte(v))
@@ -971,13 +1073,15 @@ func (po *PinOptions) FromQuery(q url.Values) error {
 // -1 meaning "to the bottom", or "recursive".
 type PinDepth int
 
-// ToPinMode converts PinDepth to PinMode
+// ToPinMode converts PinDepth to PinMode. Positive depths (used by shard
+// pins) are reported by IPFS as recursive pins, so they map to
+// PinModeRecursive.
 func (pd PinDepth) ToPinMode() PinMode {
-	switch pd {
-	case -1:
-		return PinModeRecursive
-	case 0:
+	switch {
+	case pd == 0:
 		return PinModeDirect
+	case pd > 0, pd == -1:
+		return PinModeRecursive
 	default:
 		logger.Warnf("bad pin depth: %d", pd)
 		return PinModeRecursive
@@ -1011,6 +1115,21 @@ type Pin struct {
 
 	// The time that the pin was submitted to the consensus layer.
 	Timestamp time.Time `json:"timestamp" codec:"i,omitempty"`
+
+	// For ClusterDAGs and Shards, the MetaPin CIDs which reference
+	// them. For collection members, the CIDs of the collections they
+	// belong to. They are only unpinned when no parents are left. Parents
+	// are managed by Cluster and cannot be set by the user.
+	Parents []Cid `json:"parents,omitempty" codec:"pa,omitempty"`
+
+	// FailedAllocations are the peers which could not pin the item and
+	// were replaced by others. They are not allocated the pin again.
+	// They are managed by Cluster and cannot be set by the user.
+	FailedAllocations []peer.ID `json:"failed_allocations,omitempty" codec:"fa,omitempty"`
+
+	// Size is the size of the DAG, as reported by IPFS. It is only
+	// recorded for pins whose Owner has a size quota.
+	Size uint64 `json:"size,omitempty" codec:"sz,omitempty"`
 }
 
 // String is a string representation of a Pin.
@@ -1023,9 +1142,28 @@ func (pin Pin) String() string {
 	if pin.Reference != nil {
 		fmt.Fprintf(&b, "reference: %s\n", pin.Reference)
 	}
+	if len(pin.Parents) > 0 {
+		fmt.Fprintf(&b, "parents: %v\n", pin.Parents)
+	}
+	if len(pin.FailedAllocations) > 0 {
+		fmt.Fprintf(&b, "failed allocations: %v\n", pin.FailedAllocations)
+	}
+	if pin.Owner != "" {
+		fmt.Fprintf(&b, "owner: %s\n", pin.Owner)
+	}
 	return b.String()
 }
 
+// HasParent returns true if the given CID is among the parents of this pin.
+func (pin Pin) HasParent(c Cid) bool {
+	for _, p := range pin.Parents {
+		if p.Equals(c) {
+			return true
+		}
+	}
+	return false
+}
+
 // IsPinEverywhere returns when the both replication factors are set to -1.
 func (pin Pin) IsPinEverywhere() bool {
 	return pin.ReplicationFactorMin == -1 && pin.ReplicationFactorMax == -1
@@ -1064,6 +1202,123 @@ func PinWithOpts(c Cid, opts PinOptions) Pin {
 	return p
 }
 
+// collectionCidPrefix is hashed along with the collection name to obtain
+// the collection CID.
+const collectionCidPrefix = "/ipfs-cluster/collection/"
+
+// MaxCollectionNameLength is the maximum length (in bytes) of a
+// collection name.
+const MaxCollectionNameLength = 255
+
+// ValidateCollectionName returns an error when the given string cannot be
+// used as a collection name.
+func ValidateCollectionName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("collection name cannot be empty")
+	case len(name) > MaxCollectionNameLength:
+		return fmt.Errorf("collection name cannot be longer than %d bytes", MaxCollectionNameLength)
+	case strings.Contains(name, "/"):
+		return errors.New("collection name cannot contain '/'")
+	}
+	return nil
+}
+
+// CollectionCid returns the CID used to store the collection with the
+// given name in the shared state. It is a raw CIDv1 whose multihash is
+// derived from the name, so that it never points to actual content.
+func CollectionCid(name string) (Cid, error) {
+	if err := ValidateCollectionName(name); err != nil {
+		return CidUndef, err
+	}
+	mh, err := multihash.Sum([]byte(collectionCidPrefix+name), multihash.SHA2_256, -1)
+	if err != nil {
+		return CidUndef, err
+	}
+	return NewCid(cid.NewCidV1(cid.Raw, mh)), nil
+}
+
+// CollectionPin returns the Pin object representing a collection with
+// the given name and options.
+func CollectionPin(name string, opts PinOptions) (Pin, error) {
+	ci, err := CollectionCid(name)
+	if err != nil {
+		return Pin{}, err
+	}
+	opts.Name = name
+	pin := PinWithOpts(ci, opts)
+	pin.Type = CollectionType
+	return pin, nil
+}
+
+// recordCidPrefix is inlined along with the record kind and key in the
+// record CID.
+const recordCidPrefix = "/ipfs-cluster/record/"
+
+// recordMetadataKey is the metadata key holding the value of a record.
+const recordMetadataKey = "record"
+
+// RecordCid returns the CID used to store the record of the given kind and
+// key in the shared state. It is a raw CIDv1 with an identity multihash
+// which inlines the kind and the key, so that records can be told apart
+// by their CID alone (see IsRecordCid).
+func RecordCid(kind, key string) (Cid, error) {
+	if kind == "" || key == "" {
+		return CidUndef, errors.New("record kind and key cannot be empty")
+	}
+	mh, err := multihash.Sum([]byte(recordCidPrefix+kind+"/"+key), multihash.IDENTITY, -1)
+	if err != nil {
+		return CidUndef, err
+	}
+	return NewCid(cid.NewCidV1(cid.Raw, mh)), nil
+}
+
+// IsRecordCid returns true when the given CID is that of a record.
+func IsRecordCid(ci Cid) bool {
+	if !ci.Defined() {
+		return false
+	}
+	dmh, err := multihash.Decode(ci.Cid.Hash())
+	if err != nil {
+		return false
+	}
+	return dmh.Code == multihash.IDENTITY && strings.HasPrefix(string(dmh.Digest), recordCidPrefix)
+}
+
+// RecordPin returns the Pin object storing the given value, encoded as
+// JSON, as the record of the given kind and key.
+func RecordPin(kind, key string, value interface{}) (Pin, error) {
+	ci, err := RecordCid(kind, key)
+	if err != nil {
+		return Pin{}, err
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		return Pin{}, err
+	}
+	pin := PinWithOpts(ci, PinOptions{
+		Name:     kind + "/" + key,
+		Metadata: map[string]string{recordMetadataKey: string(v)},
+	})
+	pin.Type = RecordType
+	return pin, nil
+}
+
+// RecordValue decodes the value of a record pin into v.
+func (pin Pin) RecordValue(v interface{}) error {
+	if pin.Type != RecordType {
+		return fmt.Errorf("%s is not a record", pin.Cid)
+	}
+	return json.Unmarshal([]byte(pin.Metadata[recordMetadataKey]), v)
+}
+
+// CollectionMembers is used to add or remove several CIDs from a
+// collection.
+type CollectionMembers struct {
+	Name string `json:"name" codec:"n"`
+	Cids []Cid  `json:"cids" codec:"c,omitempty"`
+}
+
 func convertPinType(t PinType) pb.Pin_PinType {
 	var i pb.Pin_PinType
 	for t != 1 {
@@ -1136,6 +1391,11 @@ func (pin Pin) ProtoMarshal() ([]byte, error) {
 		// UserAllocations:      pin.UserAllocations,
 		Origins:        origins,
 		SortedMetadata: sortedMetadata,
+		Priority:       int32(pin.Priority),
+		AntiAffinity:   pin.AntiAffinity,
+		Spread:         pin.Spread,
+		CallbackURL:    pin.CallbackURL,
+		Owner:          pin.Owner,
 	}
 
 	pbPin := &pb.Pin{
@@ -1145,10 +1405,21 @@ func (pin Pin) ProtoMarshal() ([]byte, error) {
 		MaxDepth:    int32(pin.MaxDepth),
 		Options:     opts,
 		Timestamp:   timestampProto,
+		Size:        pin.Size,
 	}
 	if ref := pin.Reference; ref != nil {
 		pbPin.Reference = ref.Bytes()
 	}
+	for _, p := range pin.Parents {
+		pbPin.Parents = append(pbPin.Parents, p.Bytes())
+	}
+	for _, pid := range pin.FailedAllocations {
+		bs, err := pid.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		pbPin.FailedAllocations = append(pbPin.FailedAllocations, bs)
+	}
 	return proto.Marshal(pbPin)
 }
 
@@ -1194,11 +1465,38 @@ func (pin *Pin) ProtoUnmarshal(data []byte) error {
 		pin.Timestamp = time.Unix(int64(ts), 0)
 	}
 
+	pbParents := pbPin.GetParents()
+	if len(pbParents) > 0 {
+		pin.Parents = make([]Cid, 0, len(pbParents))
+	}
+	for _, pbParent := range pbParents {
+		parent, err := CastCid(pbParent)
+		if err != nil {
+			return err
+		}
+		pin.Parents = append(pin.Parents, parent)
+	}
+
+	for _, pidb := range pbPin.GetFailedAllocations() {
+		pid, err := peer.IDFromBytes(pidb)
+		if err != nil {
+			return err
+		}
+		pin.FailedAllocations = append(pin.FailedAllocations, pid)
+	}
+
+	pin.Size = pbPin.GetSize()
+
 	opts := pbPin.GetOptions()
 	pin.ReplicationFactorMin = int(opts.GetReplicationFactorMin())
 	pin.ReplicationFactorMax = int(opts.GetReplicationFactorMax())
 	pin.Name = opts.GetName()
 	pin.ShardSize = opts.GetShardSize()
+	pin.Priority = int(opts.GetPriority())
+	pin.AntiAffinity = opts.GetAntiAffinity()
+	pin.Spread = opts.GetSpread()
+	pin.CallbackURL = opts.GetCallbackURL()
+	pin.Owner = opts.GetOwner()
 
 	// pin.UserAllocations = opts.GetUserAllocations()
 	exp := opts.GetExpireAt()
@@ -1275,6 +1573,23 @@ func (pin Pin) Equals(pin2 Pin) bool {
 		return false
 	}
 
+	if len(pin.Parents) != len(pin2.Parents) {
+		return false
+	}
+	for _, p := range pin.Parents {
+		if !pin2.HasParent(p) {
+			return false
+		}
+	}
+
+	failed1 := PeersToStrings(pin.FailedAllocations)
+	sort.Strings(failed1)
+	failed2 := PeersToStrings(pin2.FailedAllocations)
+	sort.Strings(failed2)
+	if strings.Join(failed1, ",") != strings.Join(failed2, ",") {
+		return false
+	}
+
 	return pin.PinOptions.Equals(pin2.PinOptions)
 }
 
@@ -1403,12 +1718,406 @@ func (es MetricSlice) Less(i, j int) bool {
 	return es[i].Peer < es[j].Peer
 }
 
+// Groups in which peers are classified when allocating a pin.
+const (
+	AllocationGroupCurrent   = "current"
+	AllocationGroupPriority  = "priority"
+	AllocationGroupCandidate = "candidate"
+	AllocationGroupExcluded  = "excluded"
+)
+
+// AllocationPreview describes the allocations that pinning a CID would
+// produce and how every peer was considered, without pinning anything.
+type AllocationPreview struct {
+	Cid                  Cid                    `json:"cid" codec:"c"`
+	ReplicationFactorMin int                    `json:"replication_factor_min" codec:"rn,omitempty"`
+	ReplicationFactorMax int                    `json:"replication_factor_max" codec:"rx,omitempty"`
+	Allocations          []peer.ID              `json:"allocations" codec:"a,omitempty"`
+	Peers                []AllocationPeerReport `json:"peers" codec:"p,omitempty"`
+	// Error is set when the allocation would fail.
+	Error string `json:"error,omitempty" codec:"e,omitempty"`
+}
+
+// AllocationPeerReport explains how a peer was considered when
+// allocating a pin.
+type AllocationPeerReport struct {
+	Peer peer.ID `json:"peer" codec:"p"`
+	// Group is one of the AllocationGroup values.
+	Group string `json:"group" codec:"g,omitempty"`
+	// Partition lists the values of the partitionable metrics used by
+	// the allocator, which decide how peers are grouped when balancing.
+	Partition string `json:"partition,omitempty" codec:"pt,omitempty"`
+	// Rank is the position of the peer in the order given by the
+	// allocator, starting at 1. It is 0 for peers that were not ranked.
+	Rank    int      `json:"rank,omitempty" codec:"r,omitempty"`
+	Chosen  bool     `json:"chosen" codec:"c,omitempty"`
+	Reason  string   `json:"reason" codec:"rs,omitempty"`
+	Metrics []Metric `json:"metrics,omitempty" codec:"m,omitempty"`
+}
+
+// RebalanceStatus reports the progress of the rebalancer of a peer, which
+// migrates pins to the peers that the allocator would choose for them now.
+type RebalanceStatus struct {
+	Peer    peer.ID `json:"peer" codec:"p"`
+	Enabled bool    `json:"enabled" codec:"e,omitempty"`
+	// Running is true while a rebalancing cycle is in progress.
+	Running bool      `json:"running" codec:"r,omitempty"`
+	LastRun time.Time `json:"last_run" codec:"l,omitempty"`
+	NextRun time.Time `json:"next_run" codec:"n,omitempty"`
+	// Pending is the number of misplaced pins found on the current or
+	// last cycle, up to the number of pins migrated per cycle.
+	Pending int `json:"pending" codec:"pe,omitempty"`
+	// Migrating is the pin being migrated, if any.
+	Migrating Cid `json:"migrating" codec:"mi,omitempty"`
+	// Migrated and Failed count migrations since the peer started.
+	Migrated  uint64 `json:"migrated" codec:"m,omitempty"`
+	Failed    uint64 `json:"failed" codec:"f,omitempty"`
+	LastError string `json:"last_error,omitempty" codec:"le,omitempty"`
+}
+
+// Drain phases.
+const (
+	// DrainPhaseDraining is set while the pins of the peer are moved.
+	DrainPhaseDraining = "draining"
+	// DrainPhaseDone is set when all the pins have been moved and the
+	// peer was not removed. It does not receive new allocations until
+	// the drain is cancelled.
+	DrainPhaseDone = "done"
+	// DrainPhaseRemoved is set when the peer was removed from the
+	// cluster after moving all its pins.
+	DrainPhaseRemoved = "removed"
+	// DrainPhaseFailed is set when some pins could not be moved.
+	DrainPhaseFailed = "failed"
+	// DrainPhaseCancelled is set when the drain was cancelled.
+	DrainPhaseCancelled = "cancelled"
+)
+
+// DrainStatus reports the progress of draining a peer, which moves all its
+// pins to other peers. It is also used to request a drain, in which case
+// only Peer and Remove are considered.
+type DrainStatus struct {
+	Peer peer.ID `json:"peer" codec:"p"`
+	// Coordinator is the peer which moves the pins.
+	Coordinator peer.ID `json:"coordinator" codec:"c,omitempty"`
+	// Remove indicates that the peer is removed from the cluster once
+	// drained.
+	Remove   bool      `json:"remove" codec:"r,omitempty"`
+	Phase    string    `json:"phase" codec:"ph,omitempty"`
+	Started  time.Time `json:"started" codec:"s,omitempty"`
+	Finished time.Time `json:"finished" codec:"fi,omitempty"`
+	// Pins is the number of pins allocated to the peer that have been
+	// found so far. Moved and Failed count those already handled.
+	Pins   int `json:"pins" codec:"n,omitempty"`
+	Moved  int `json:"moved" codec:"m,omitempty"`
+	Failed int `json:"failed" codec:"f,omitempty"`
+	// Moving is the pin being moved, if any.
+	Moving Cid    `json:"moving" codec:"mv,omitempty"`
+	Error  string `json:"error,omitempty" codec:"e,omitempty"`
+}
+
+// MaintenanceStatus tells whether a peer is in maintenance mode. Peers in
+// maintenance do not receive new allocations and their pins are not
+// re-allocated when they go down, until the maintenance ends.
+type MaintenanceStatus struct {
+	Peer    peer.ID   `json:"peer" codec:"p"`
+	Enabled bool      `json:"enabled" codec:"e,omitempty"`
+	Started time.Time `json:"started" codec:"s,omitempty"`
+	// Until is when the maintenance ends, unless stopped earlier.
+	Until time.Time `json:"until" codec:"u,omitempty"`
+}
+
+// Replication states used in replication reports.
+const (
+	// ReplicationUnder is set when a pin has fewer healthy copies than
+	// its minimum replication factor.
+	ReplicationUnder = "under-replicated"
+	// ReplicationOver is set when a pin has more healthy copies than its
+	// maximum replication factor.
+	ReplicationOver = "over-replicated"
+	// ReplicationUnavailable is set when no peer has a healthy copy of a
+	// pin.
+	ReplicationUnavailable = "unavailable"
+)
+
+// ReplicationReport describes a pin whose number of healthy (pinned)
+// copies is outside of its replication factors.
+type ReplicationReport struct {
+	Cid                  Cid       `json:"cid" codec:"c"`
+	Name                 string    `json:"name" codec:"n,omitempty"`
+	State                string    `json:"state" codec:"s"`
+	ReplicationFactorMin int       `json:"replication_factor_min" codec:"rn,omitempty"`
+	ReplicationFactorMax int       `json:"replication_factor_max" codec:"rx,omitempty"`
+	Allocations          []peer.ID `json:"allocations" codec:"a,omitempty"`
+	// Healthy lists the peers that have pinned the item.
+	Healthy []peer.ID `json:"healthy" codec:"h,omitempty"`
+}
+
 // Alert carries alerting information about a peer.
 type Alert struct {
 	Metric
 	TriggeredAt time.Time `json:"triggered_at" codec:"r,omitempty"`
 }
 
+// EventType identifies the kind of change described by an Event.
+type EventType string
+
+// EventType values. Pinset events are emitted by every peer when the shared
+// state changes. The rest follow the status of the items tracked by a
+// peer.
+const (
+	EventPinsetAdd    EventType = "pinset_add"
+	EventPinsetRemove EventType = "pinset_remove"
+	EventQueued       EventType = "queued"
+	EventPinning      EventType = "pinning"
+	EventPinned       EventType = "pinned"
+	EventUnpinning    EventType = "unpinning"
+	EventUnpinned     EventType = "unpinned"
+	EventError        EventType = "error"
+)
+
+var eventTypes = []EventType{
+	EventPinsetAdd,
+	EventPinsetRemove,
+	EventQueued,
+	EventPinning,
+	EventPinned,
+	EventUnpinning,
+	EventUnpinned,
+	EventError,
+}
+
+// IsValid returns true if the EventType is one of the known types.
+func (t EventType) IsValid() bool {
+	for _, et := range eventTypes {
+		if t == et {
+			return true
+		}
+	}
+	return false
+}
+
+// Event describes a change in the pinset or in the status of an item
+// tracked by a peer.
+type Event struct {
+	Type     EventType `json:"type" codec:"y"`
+	Cid      Cid       `json:"cid" codec:"c"`
+	Name     string    `json:"name,omitempty" codec:"n,omitempty"`
+	Peer     peer.ID   `json:"peer" codec:"p,omitempty"`
+	PeerName string    `json:"peername,omitempty" codec:"pn,omitempty"`
+	// Status is the status of the item in the peer. It is not set for
+	// pinset events.
+	Status    TrackerStatus `json:"status,omitempty" codec:"st,omitempty"`
+	Error     string        `json:"error,omitempty" codec:"e,omitempty"`
+	Timestamp time.Time     `json:"timestamp" codec:"t,omitempty"`
+}
+
+// EventFilter selects Events by Cid, name and type. Empty fields match all
+// events.
+type EventFilter struct {
+	Cids  []Cid       `json:"cids,omitempty" codec:"c,omitempty"`
+	Names []string    `json:"names,omitempty" codec:"n,omitempty"`
+	Types []EventType `json:"types,omitempty" codec:"y,omitempty"`
+}
+
+// Match returns true if the Event is selected by the filter.
+func (ef EventFilter) Match(ev Event) bool {
+	if len(ef.Cids) > 0 {
+		found := false
+		for _, c := range ef.Cids {
+			if c.Equals(ev.Cid) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(ef.Names) > 0 {
+		found := false
+		for _, n := range ef.Names {
+			if n == ev.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(ef.Types) > 0 {
+		found := false
+		for _, t := range ef.Types {
+			if t == ev.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// PinCallback is sent to the CallbackURL of a pin once it has been pinned
+// by ReplicationFactorMin peers (Type is "pinned") or when it cannot be
+// (Type is "error").
+type PinCallback struct {
+	Type                 EventType     `json:"type" codec:"y"`
+	Cid                  Cid           `json:"cid" codec:"c"`
+	Name                 string        `json:"name,omitempty" codec:"n,omitempty"`
+	ReplicationFactorMin int           `json:"replication_factor_min" codec:"rn,omitempty"`
+	Pinned               int           `json:"pinned" codec:"pd,omitempty"`
+	Error                string        `json:"error,omitempty" codec:"e,omitempty"`
+	Status               GlobalPinInfo `json:"status" codec:"st,omitempty"`
+	Timestamp            time.Time     `json:"timestamp" codec:"t,omitempty"`
+}
+
+// ErrQuotaExceeded is returned when pinning an item would make its owner
+// exceed their quota.
+var ErrQuotaExceeded = errors.New("forbidden: quota exceeded")
+
+// Usage reports the pins owned by an API user and their quota. Zero
+// maximums mean no limit.
+type Usage struct {
+	User    string `json:"user" codec:"u"`
+	Pins    int    `json:"pins" codec:"p,omitempty"`
+	Size    uint64 `json:"size" codec:"s,omitempty"`
+	MaxPins int    `json:"max_pins,omitempty" codec:"mp,omitempty"`
+	MaxSize uint64 `json:"max_size,omitempty" codec:"ms,omitempty"`
+}
+
+// APIKey scopes. They allow using the API routes available to readers,
+// pinners and admins respectively.
+const (
+	APIKeyScopeRead  = "read"
+	APIKeyScopePin   = "pin"
+	APIKeyScopeAdmin = "admin"
+)
+
+// apiKeyTokenPrefix distinguishes API key tokens from JWT tokens.
+const apiKeyTokenPrefix = "ck_"
+
+// APIKey authenticates requests to the HTTP APIs on behalf of a user, when
+// used as a Bearer token. A key can only be used for the routes allowed by
+// its scopes and until its expiry. Peers only store a hash of the Secret,
+// which is therefore only set when the key is created.
+type APIKey struct {
+	ID       string    `json:"id" codec:"i,omitempty"`
+	User     string    `json:"user" codec:"u,omitempty"`
+	Scopes   []string  `json:"scopes" codec:"s,omitempty"`
+	Expiry   time.Time `json:"expiry" codec:"e,omitempty"`
+	Created  time.Time `json:"created" codec:"c,omitempty"`
+	LastUsed time.Time `json:"last_used" codec:"l,omitempty"`
+	Secret   string    `json:"secret,omitempty" codec:"x,omitempty"`
+}
+
+// Token returns the Bearer token for this key, or an empty string when
+// the Secret is not known.
+func (k APIKey) Token() string {
+	if k.Secret == "" {
+		return ""
+	}
+	return apiKeyTokenPrefix + k.ID + "_" + k.Secret
+}
+
+// ParseAPIKeyToken returns the ID and the secret of the API key in the
+// given token, and false when the token is not an API key.
+func ParseAPIKeyToken(token string) (string, string, bool) {
+	if !strings.HasPrefix(token, apiKeyTokenPrefix) {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(token, apiKeyTokenPrefix), "_")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// HasScope returns true when the key has the given scope.
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired returns true when the key can no longer be used.
+func (k APIKey) Expired() bool {
+	return !time.Now().Before(k.Expiry)
+}
+
+// Validate returns an error when the key does not have a user, a valid
+// list of scopes or an expiry in the future.
+func (k APIKey) Validate() error {
+	if k.User == "" {
+		return errors.New("api key user is not set")
+	}
+	if len(k.Scopes) == 0 {
+		return errors.New("api key has no scopes")
+	}
+	for _, s := range k.Scopes {
+		switch s {
+		case APIKeyScopeRead, APIKeyScopePin, APIKeyScopeAdmin:
+		default:
+			return fmt.Errorf("unknown api key scope: %s", s)
+		}
+	}
+	if k.Expired() {
+		return errors.New("api key expiry must be in the future")
+	}
+	return nil
+}
+
+// ToQuery returns the user, scopes and expiry of the key as query
+// arguments.
+func (k APIKey) ToQuery() (string, error) {
+	q := url.Values{}
+	if k.User != "" {
+		q.Set("user", k.User)
+	}
+	q.Set("scopes", strings.Join(k.Scopes, ","))
+	if !k.Expiry.IsZero() {
+		v, err := k.Expiry.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		q.Set("expire-at", string(v))
+	}
+	return q.Encode(), nil
+}
+
+// FromQuery is the inverse of ToQuery(). The expiry can also be given as a
+// duration with "expire-in".
+func (k *APIKey) FromQuery(q url.Values) error {
+	k.User = q.Get("user")
+
+	if v := q.Get("scopes"); v != "" {
+		k.Scopes = strings.Split(v, ",")
+	}
+
+	if v := q.Get("expire-at"); v != "" {
+		var tm time.Time
+		err := tm.UnmarshalText([]byte(v))
+		if err != nil {
+			return errors.Wrap(err, "expire-at cannot be parsed")
+		}
+		k.Expiry = tm
+	} else if v = q.Get("expire-in"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Wrap(err, "expire-in cannot be parsed")
+		}
+		k.Expiry = time.Now().Add(d)
+	}
+	return nil
+}
+
 // Error can be used by APIs to return errors.
 type Error struct {
 	Code    int    `json:"code" codec:"o,omitempty"`
@@ -1426,6 +2135,40 @@ type IPFSRepoStat struct {
 	StorageMax uint64 `codec:"s, omitempty"`
 }
 
+// IPFSVerification is the result of walking the DAG of a pin in the IPFS
+// daemon and re-hashing every block.
+type IPFSVerification struct {
+	Cid     Cid   `json:"cid" codec:"c"`
+	Blocks  int   `json:"blocks" codec:"b,omitempty"`
+	Missing []Cid `json:"missing,omitempty" codec:"m,omitempty"`
+	Corrupt []Cid `json:"corrupt,omitempty" codec:"co,omitempty"`
+}
+
+// Err returns an error describing the missing and corrupt blocks, or nil
+// when the DAG is complete.
+func (v IPFSVerification) Err() error {
+	if len(v.Missing) == 0 && len(v.Corrupt) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d missing and %d corrupt blocks out of %d", len(v.Missing), len(v.Corrupt), v.Blocks)
+	// Do not flood the error message with cids.
+	bad := append(append([]Cid{}, v.Missing...), v.Corrupt...)
+	if len(bad) > 10 {
+		bad = bad[:10]
+	}
+	for i, c := range bad {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(c.String())
+	}
+	return errors.New(b.String())
+}
+
 // IPFSRepoGC represents the streaming response sent from repo gc API of IPFS.
 type IPFSRepoGC struct {
 	Key   Cid    `json:"key,omitempty" codec:"k,omitempty"`
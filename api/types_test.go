@@ -43,6 +43,31 @@ func BenchmarkIPFSPinStatusFromString(b *testing.B) {
 	}
 }
 
+func TestIPFSVerificationErr(t *testing.T) {
+	c1, _ := DecodeCid("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+	c2, _ := DecodeCid("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmma")
+
+	v := IPFSVerification{Cid: c1, Blocks: 5}
+	if v.Err() != nil {
+		t.Error("a complete DAG should not error")
+	}
+
+	v.Missing = []Cid{c1}
+	v.Corrupt = []Cid{c2}
+	err := v.Err()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "1 missing and 1 corrupt") ||
+		!strings.Contains(err.Error(), c2.String()) {
+		t.Error("unexpected error message:", err)
+	}
+
+	if TrackerStatusFromString("corrupted") != TrackerStatusCorrupted {
+		t.Error("corrupted should parse as TrackerStatusCorrupted")
+	}
+}
+
 func TestMetric(t *testing.T) {
 	m := Metric{
 		Name:  "hello",
@@ -84,7 +109,7 @@ func TestMetric(t *testing.T) {
 }
 
 func TestConvertPinType(t *testing.T) {
-	for _, t1 := range []PinType{BadType, ShardType} {
+	for _, t1 := range []PinType{BadType, ShardType, CollectionType} {
 		i := convertPinType(t1)
 		t2 := PinType(1 << uint64(i))
 		if t2 != t1 {
@@ -93,6 +118,96 @@ func TestConvertPinType(t *testing.T) {
 	}
 }
 
+func TestCollectionCid(t *testing.T) {
+	c1, err := CollectionCid("photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := CollectionCid("photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c1.Equals(c2) {
+		t.Error("collection CIDs should be deterministic")
+	}
+	c3, err := CollectionCid("videos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1.Equals(c3) {
+		t.Error("different names should give different CIDs")
+	}
+
+	for _, name := range []string{"", "a/b", strings.Repeat("a", MaxCollectionNameLength+1)} {
+		if _, err := CollectionCid(name); err == nil {
+			t.Errorf("expected an error for name %q", name)
+		}
+	}
+
+	pin, err := CollectionPin("photos", PinOptions{ReplicationFactorMin: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Type != CollectionType || pin.Name != "photos" || !pin.Cid.Equals(c1) {
+		t.Error("bad collection pin")
+	}
+	if PinTypeFromString(pin.Type.String()) != CollectionType {
+		t.Error("collection type should survive a string round trip")
+	}
+}
+
+func TestRecordPin(t *testing.T) {
+	type value struct {
+		A string `json:"a"`
+		B int    `json:"b"`
+	}
+
+	pin, err := RecordPin("test", "key", value{A: "a", B: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci, err := RecordCid("test", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	coll, err := CollectionCid("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Type != RecordType || !pin.Cid.Equals(ci) || pin.Cid.Equals(coll) {
+		t.Error("bad record pin")
+	}
+	if !IsRecordCid(ci) || IsRecordCid(coll) {
+		t.Error("only record CIDs should be identified as such")
+	}
+
+	// records are stored in the state with protobuf.
+	pbBytes, err := pin.ProtoMarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pin2 Pin
+	err = pin2.ProtoUnmarshal(pbBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v value
+	err = pin2.RecordValue(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin2.Type != RecordType || v.A != "a" || v.B != 1 {
+		t.Errorf("record did not survive a round trip: %+v %+v", pin2, v)
+	}
+
+	if _, err := RecordCid("", "key"); err == nil {
+		t.Error("expected an error for an empty kind")
+	}
+	if err := PinCid(ci).RecordValue(&v); err == nil {
+		t.Error("expected an error decoding a regular pin")
+	}
+}
+
 func checkDupTags(t *testing.T, name string, typ reflect.Type, tags map[string]struct{}) {
 	if tags == nil {
 		tags = make(map[string]struct{})
@@ -177,6 +292,10 @@ func TestPinOptionsQuery(t *testing.T) {
 				NewMultiaddrWithValue(multiaddr.StringCast("/ip4/1.2.3.4/tcp/1234/p2p/12D3KooWKewdAMAU3WjYHm8qkAJc5eW6KHbHWNigWraXXtE1UCng")),
 				NewMultiaddrWithValue(multiaddr.StringCast("/ip4/2.3.3.4/tcp/1234/p2p/12D3KooWF6BgwX966ge5AVFs9Gd2wVTBmypxZVvaBR12eYnUmXkR")),
 			},
+			Priority:     10,
+			AntiAffinity: []string{"tag:rack"},
+			Spread:       []string{"tag:region", "tag:zone"},
+			CallbackURL:  "https://example.com/callback?id=1",
 		},
 		{
 			ReplicationFactorMax: -1,
@@ -185,6 +304,7 @@ func TestPinOptionsQuery(t *testing.T) {
 			ShardSize:            0,
 			UserAllocations:      []peer.ID{},
 			Metadata:             nil,
+			Priority:             -3,
 		},
 		{
 			ReplicationFactorMax: -1,
@@ -221,6 +341,17 @@ func TestPinOptionsQuery(t *testing.T) {
 	}
 }
 
+func TestPinOptionsQueryCallbackURL(t *testing.T) {
+	for _, u := range []string{"ftp://example.com", "example.com/callback", "http://"} {
+		q := url.Values{}
+		q.Set("callback-url", u)
+		po := PinOptions{}
+		if err := po.FromQuery(q); err == nil {
+			t.Errorf("expected an error parsing callback-url %s", u)
+		}
+	}
+}
+
 func TestIDCodec(t *testing.T) {
 	TestPeerID1, _ := peer.Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
 	TestPeerID2, _ := peer.Decode("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
@@ -281,3 +412,219 @@ func TestPinCodec(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPinProtoParents(t *testing.T) {
+	ci, _ := DecodeCid("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	parent, _ := DecodeCid("QmUx1xqz4SP5vH7bDHU8rzHWFu7TwMvT3j3CwXDpk6GUpK")
+	pin := PinCid(ci)
+	pin.Type = ShardType
+	pin.MaxDepth = 1
+	pin.Parents = []Cid{parent}
+
+	data, err := pin.ProtoMarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pin2 Pin
+	err = pin2.ProtoUnmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !pin2.HasParent(parent) || len(pin2.Parents) != 1 {
+		t.Error("parents should have been preserved")
+	}
+	if !pin.Equals(pin2) {
+		t.Error("pins should be equal")
+	}
+}
+
+func TestPinProtoPriority(t *testing.T) {
+	ci, _ := DecodeCid("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	for _, prio := range []int{-2, 0, 7} {
+		pin := PinCid(ci)
+		pin.Priority = prio
+
+		data, err := pin.ProtoMarshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var pin2 Pin
+		err = pin2.ProtoUnmarshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pin2.Priority != prio {
+			t.Errorf("expected priority %d, got %d", prio, pin2.Priority)
+		}
+	}
+}
+
+func TestPinProtoPlacement(t *testing.T) {
+	ci, _ := DecodeCid("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	pin := PinCid(ci)
+	pin.AntiAffinity = []string{"tag:rack"}
+	pin.Spread = []string{"tag:region"}
+	pin.CallbackURL = "http://localhost:8080/callback"
+
+	data, err := pin.ProtoMarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pin2 Pin
+	err = pin2.ProtoUnmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pin.PinOptions.Equals(pin2.PinOptions) {
+		t.Errorf("expected %v and %v, got %v and %v", pin.AntiAffinity, pin.Spread, pin2.AntiAffinity, pin2.Spread)
+	}
+	if pin2.CallbackURL != pin.CallbackURL {
+		t.Errorf("expected callback URL %s, got %s", pin.CallbackURL, pin2.CallbackURL)
+	}
+}
+
+func TestPinProtoOwner(t *testing.T) {
+	ci, _ := DecodeCid("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	pin := PinCid(ci)
+	pin.Owner = "alice"
+	pin.Size = 1024
+
+	data, err := pin.ProtoMarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pin2 Pin
+	err = pin2.ProtoUnmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pin.Equals(pin2) {
+		t.Errorf("expected owner %s, got %s", pin.Owner, pin2.Owner)
+	}
+	if pin2.Size != pin.Size {
+		t.Errorf("expected size %d, got %d", pin.Size, pin2.Size)
+	}
+}
+
+func TestPinProtoFailedAllocations(t *testing.T) {
+	ci, _ := DecodeCid("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	pid1, _ := peer.Decode("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+	pid2, _ := peer.Decode("QmPGDFvBkgWhvzEK9qaTWrWurSwqXNmhnK3hgELPdZZNPa")
+	pin := PinCid(ci)
+	pin.FailedAllocations = []peer.ID{pid1, pid2}
+
+	data, err := pin.ProtoMarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pin2 Pin
+	err = pin2.ProtoUnmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pin2.FailedAllocations) != 2 {
+		t.Fatal("failed allocations should have been preserved")
+	}
+	if !pin.Equals(pin2) {
+		t.Error("pins should be equal")
+	}
+
+	pin2.FailedAllocations = pin2.FailedAllocations[:1]
+	if pin.Equals(pin2) {
+		t.Error("pins should not be equal")
+	}
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	ci1, _ := DecodeCid("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	ci2, _ := DecodeCid("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+	ev := Event{
+		Type: EventPinned,
+		Cid:  ci1,
+		Name: "a",
+	}
+
+	testcases := []struct {
+		filter EventFilter
+		match  bool
+	}{
+		{EventFilter{}, true},
+		{EventFilter{Cids: []Cid{ci2, ci1}}, true},
+		{EventFilter{Cids: []Cid{ci2}}, false},
+		{EventFilter{Names: []string{"a"}}, true},
+		{EventFilter{Names: []string{"b"}}, false},
+		{EventFilter{Types: []EventType{EventError, EventPinned}}, true},
+		{EventFilter{Types: []EventType{EventError}}, false},
+		{EventFilter{Cids: []Cid{ci1}, Names: []string{"b"}}, false},
+		{EventFilter{Cids: []Cid{ci1}, Names: []string{"a"}, Types: []EventType{EventPinned}}, true},
+	}
+
+	for i, tc := range testcases {
+		if tc.filter.Match(ev) != tc.match {
+			t.Errorf("testcase %d: expected match to be %t", i, tc.match)
+		}
+	}
+
+	if !EventPinsetAdd.IsValid() || EventType("abc").IsValid() {
+		t.Error("IsValid returned unexpected results")
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	key := APIKey{
+		ID:     "abcd",
+		User:   "alice",
+		Scopes: []string{APIKeyScopeRead, APIKeyScopePin},
+		Expiry: time.Now().Add(time.Hour).Round(time.Second),
+		Secret: "1234",
+	}
+	if err := key.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	id, secret, ok := ParseAPIKeyToken(key.Token())
+	if !ok || id != key.ID || secret != key.Secret {
+		t.Error("token should contain the key ID and secret")
+	}
+	for _, tok := range []string{"", "ck_", "ck_abcd", "ck_abcd_", "ck_a_b_c", "eyJhbGciOiJIUzI1NiJ9.e30.x"} {
+		if _, _, ok := ParseAPIKeyToken(tok); ok {
+			t.Errorf("%q should not be an api key token", tok)
+		}
+	}
+
+	if !key.HasScope(APIKeyScopePin) || key.HasScope(APIKeyScopeAdmin) {
+		t.Error("HasScope is not working")
+	}
+
+	q, err := key.ToQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := url.ParseQuery(q)
+	var key2 APIKey
+	if err := key2.FromQuery(v); err != nil {
+		t.Fatal(err)
+	}
+	if key2.User != key.User || !reflect.DeepEqual(key2.Scopes, key.Scopes) || !key2.Expiry.Equal(key.Expiry) {
+		t.Errorf("query round trip failed: %+v", key2)
+	}
+
+	invalid := []APIKey{
+		{Scopes: key.Scopes, Expiry: key.Expiry},
+		{User: "alice", Expiry: key.Expiry},
+		{User: "alice", Scopes: []string{"write"}, Expiry: key.Expiry},
+		{User: "alice", Scopes: key.Scopes},
+		{User: "alice", Scopes: key.Scopes, Expiry: time.Now().Add(-time.Minute)},
+	}
+	for i, k := range invalid {
+		if k.Validate() == nil {
+			t.Errorf("key %d should not validate", i)
+		}
+	}
+}
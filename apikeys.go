@@ -0,0 +1,270 @@
+package ipfscluster
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/state"
+
+	"go.opencensus.io/trace"
+)
+
+// This file contains the API keys store. API keys authenticate requests to
+// the HTTP APIs of any peer on behalf of a user. They are stored in the
+// shared state as records (see api.RecordPin), which only keep a hash of
+// their secret, so creating or revoking a key on one peer applies to all
+// of them.
+//
+// When a key was last used is kept in a separate record, so that recording
+// a use cannot bring back a key revoked meanwhile. Every peer records the
+// use of a key at most once per apiKeyUseInterval.
+
+const (
+	apiKeyRecordKind    = "apikey"
+	apiKeyUseRecordKind = "apikey-use"
+)
+
+// apiKeyUseInterval is the minimum time between two records of the use of
+// an API key by this peer.
+var apiKeyUseInterval = time.Minute
+
+// API key errors.
+var (
+	// ErrAPIKeyNotFound is returned when revoking a key which does not
+	// exist.
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrAPIKeyInvalid is returned when verifying a token which does not
+	// belong to an existing key, or whose key has expired.
+	ErrAPIKeyInvalid = errors.New("invalid or expired api key")
+)
+
+// storedAPIKey is the record value of an API key.
+type storedAPIKey struct {
+	api.APIKey
+	Hash []byte `json:"hash"`
+}
+
+// apiKeyUse is the record value of the last use of an API key.
+type apiKeyUse struct {
+	LastUsed time.Time `json:"last_used"`
+}
+
+func hashAPIKeySecret(secret string) []byte {
+	h := sha256.Sum256([]byte(secret))
+	return h[:]
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// getAPIKeyRecord returns the record of the given kind for the API key with
+// the given ID.
+func (c *Cluster) getAPIKeyRecord(ctx context.Context, kind, id string) (api.Pin, error) {
+	ci, err := api.RecordCid(kind, id)
+	if err != nil {
+		return api.Pin{}, err
+	}
+	return c.PinGet(ctx, ci)
+}
+
+func (c *Cluster) getAPIKey(ctx context.Context, id string) (storedAPIKey, error) {
+	var key storedAPIKey
+	pin, err := c.getAPIKeyRecord(ctx, apiKeyRecordKind, id)
+	if err == state.ErrNotFound {
+		return key, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return key, err
+	}
+	err = pin.RecordValue(&key)
+	return key, err
+}
+
+func (c *Cluster) putAPIKey(ctx context.Context, key storedAPIKey) error {
+	key.Secret = ""
+	key.LastUsed = time.Time{}
+	pin, err := api.RecordPin(apiKeyRecordKind, key.ID, key)
+	if err != nil {
+		return err
+	}
+	return c.consensus.LogPin(ctx, pin)
+}
+
+// apiKeyRecords returns the values of all the records of the given kind,
+// by API key ID.
+func (c *Cluster) apiKeyRecords(ctx context.Context, kind string, newValue func() interface{}) (map[string]interface{}, error) {
+	out := make(chan api.Pin, 1024)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.PinsQuery(ctx, api.PinQuery{Type: api.RecordType, Name: kind + "/"}, out)
+	}()
+
+	values := make(map[string]interface{})
+	for pin := range out {
+		if !strings.HasPrefix(pin.Name, kind+"/") {
+			continue
+		}
+		v := newValue()
+		if err := pin.RecordValue(v); err != nil {
+			logger.Errorf("error decoding API key record %s: %s", pin.Name, err)
+			continue
+		}
+		values[strings.TrimPrefix(pin.Name, kind+"/")] = v
+	}
+	return values, <-errCh
+}
+
+// recordAPIKeyUse stores when the given API key was last used, unless this
+// peer did so less than apiKeyUseInterval ago.
+func (c *Cluster) recordAPIKeyUse(ctx context.Context, id string, now time.Time) {
+	c.apiKeysMux.Lock()
+	if now.Sub(c.apiKeysUsed[id]) < apiKeyUseInterval {
+		c.apiKeysMux.Unlock()
+		return
+	}
+	c.apiKeysUsed[id] = now
+	c.apiKeysMux.Unlock()
+
+	pin, err := api.RecordPin(apiKeyUseRecordKind, id, apiKeyUse{LastUsed: now})
+	if err == nil {
+		err = c.consensus.LogPin(ctx, pin)
+	}
+	if err != nil {
+		logger.Errorf("error recording the use of API key %s: %s", id, err)
+	}
+}
+
+// APIKeyCreate creates a new API key for the user, scopes and expiry of the
+// given key. The returned key carries the secret, which cannot be
+// retrieved later.
+func (c *Cluster) APIKeyCreate(ctx context.Context, key api.APIKey) (api.APIKey, error) {
+	_, span := trace.StartSpan(ctx, "cluster/APIKeyCreate")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	if err := key.Validate(); err != nil {
+		return api.APIKey{}, err
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return api.APIKey{}, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return api.APIKey{}, err
+	}
+
+	key.ID = id
+	key.Created = time.Now()
+	key.LastUsed = time.Time{}
+	key.Secret = secret
+
+	err = c.putAPIKey(ctx, storedAPIKey{APIKey: key, Hash: hashAPIKeySecret(secret)})
+	if err != nil {
+		return api.APIKey{}, err
+	}
+	logger.Infof("created API key %s for %s", key.ID, key.User)
+	return key, nil
+}
+
+// APIKeys returns all the API keys in the shared state, without their
+// secrets.
+func (c *Cluster) APIKeys(ctx context.Context) ([]api.APIKey, error) {
+	_, span := trace.StartSpan(ctx, "cluster/APIKeys")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	stored, err := c.apiKeyRecords(ctx, apiKeyRecordKind, func() interface{} { return &storedAPIKey{} })
+	if err != nil {
+		return nil, err
+	}
+	uses, err := c.apiKeyRecords(ctx, apiKeyUseRecordKind, func() interface{} { return &apiKeyUse{} })
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]api.APIKey, 0, len(stored))
+	for id, v := range stored {
+		key := v.(*storedAPIKey).APIKey
+		if use, ok := uses[id]; ok {
+			key.LastUsed = use.(*apiKeyUse).LastUsed
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// APIKeyRevoke removes the API key with the given ID so that it can no
+// longer be used on any peer.
+func (c *Cluster) APIKeyRevoke(ctx context.Context, id string) error {
+	_, span := trace.StartSpan(ctx, "cluster/APIKeyRevoke")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	pin, err := c.getAPIKeyRecord(ctx, apiKeyRecordKind, id)
+	if err == state.ErrNotFound {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	logger.Infof("revoking API key %s", id)
+	if err := c.consensus.LogUnpin(ctx, pin); err != nil {
+		return err
+	}
+
+	c.apiKeysMux.Lock()
+	delete(c.apiKeysUsed, id)
+	c.apiKeysMux.Unlock()
+
+	use, err := c.getAPIKeyRecord(ctx, apiKeyUseRecordKind, id)
+	if err == nil {
+		err = c.consensus.LogUnpin(ctx, use)
+	}
+	if err != nil && err != state.ErrNotFound {
+		logger.Errorf("error removing the use record of API key %s: %s", id, err)
+	}
+	return nil
+}
+
+// APIKeyVerify returns the API key for the given token and records its
+// use. It returns ErrAPIKeyInvalid when the token does not match a key or
+// when the key has expired.
+func (c *Cluster) APIKeyVerify(ctx context.Context, token string) (api.APIKey, error) {
+	_, span := trace.StartSpan(ctx, "cluster/APIKeyVerify")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	id, secret, ok := api.ParseAPIKeyToken(token)
+	if !ok {
+		return api.APIKey{}, ErrAPIKeyInvalid
+	}
+
+	key, err := c.getAPIKey(ctx, id)
+	if err == ErrAPIKeyNotFound {
+		return api.APIKey{}, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return api.APIKey{}, err
+	}
+	if subtle.ConstantTimeCompare(key.Hash, hashAPIKeySecret(secret)) != 1 || key.Expired() {
+		return api.APIKey{}, ErrAPIKeyInvalid
+	}
+
+	key.LastUsed = time.Now()
+	c.recordAPIKeyUse(ctx, id, key.LastUsed)
+	return key.APIKey, nil
+}
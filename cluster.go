@@ -44,6 +44,16 @@ const (
 	reBootstrapInterval = 30 * time.Second
 	mdnsServiceTag      = "_ipfs-cluster-discovery._udp"
 	maxAlerts           = 1000
+
+	// a globalPinInfo type of request should be relatively fast. We
+	// cannot block response indefinitely due to an unresponsive node.
+	globalPinInfoTimeout = 15 * time.Second
+	// verifying walks and rehashes full DAGs on every allocation, which
+	// takes considerably longer.
+	verifyTimeout = 10 * time.Minute
+	// how many times an update to the Parents of a pin is committed
+	// when re-reading the pin shows that it was lost.
+	parentUpdateAttempts = 3
 )
 
 var errFollowerMode = errors.New("this peer is configured to be in follower mode. Write operations are disabled")
@@ -74,8 +84,35 @@ type Cluster struct {
 	informers []Informer
 	tracer    Tracer
 
-	alerts    []api.Alert
-	alertsMux sync.Mutex
+	dispatcher AlertDispatcher
+	alerts     []api.Alert
+	alertsMux  sync.Mutex
+
+	rebalanceStatus api.RebalanceStatus
+	rebalanceMux    sync.Mutex
+	rebalanceCursor api.Cid
+
+	reallocateCursor api.Cid
+
+	drains    map[peer.ID]*drain
+	drainsMux sync.Mutex
+
+	maintenance    *maintenance
+	maintenanceMux sync.Mutex
+
+	pinCallbacks    map[api.Cid]*pinCallback
+	pinCallbacksMux sync.Mutex
+	pinCallbacksCh  chan struct{}
+
+	usage    map[string]ownerUsage
+	usageMux sync.Mutex
+
+	apiKeysUsed map[string]time.Time
+	apiKeysMux  sync.Mutex
+
+	// serializes updates to the Parents of shards and clusterDAGs made
+	// by this peer. Other peers may still update them concurrently.
+	parentLocks cidLocks
 
 	doneCh  chan struct{}
 	readyCh chan struct{}
@@ -99,6 +136,8 @@ type Cluster struct {
 // The new cluster peer may still be performing initialization tasks when
 // this call returns (consensus may still be bootstrapping). Use Cluster.Ready()
 // if you need to wait until the peer is fully up.
+//
+// The AlertDispatcher is optional and can be nil.
 func NewCluster(
 	ctx context.Context,
 	host host.Host,
@@ -113,6 +152,7 @@ func NewCluster(
 	allocator PinAllocator,
 	informers []Informer,
 	tracer Tracer,
+	dispatcher AlertDispatcher,
 ) (*Cluster, error) {
 	err := cfg.Validate()
 	if err != nil {
@@ -148,29 +188,34 @@ func NewCluster(
 	}
 
 	c := &Cluster{
-		ctx:         ctx,
-		cancel:      cancel,
-		id:          host.ID(),
-		config:      cfg,
-		host:        host,
-		dht:         dht,
-		discovery:   mdnsSvc,
-		datastore:   datastore,
-		consensus:   consensus,
-		apis:        apis,
-		ipfs:        ipfs,
-		tracker:     tracker,
-		monitor:     monitor,
-		allocator:   allocator,
-		informers:   informers,
-		tracer:      tracer,
-		alerts:      []api.Alert{},
-		peerManager: peerManager,
-		shutdownB:   false,
-		removed:     false,
-		doneCh:      make(chan struct{}),
-		readyCh:     make(chan struct{}),
-		readyB:      false,
+		ctx:            ctx,
+		cancel:         cancel,
+		id:             host.ID(),
+		config:         cfg,
+		host:           host,
+		dht:            dht,
+		discovery:      mdnsSvc,
+		datastore:      datastore,
+		consensus:      consensus,
+		apis:           apis,
+		ipfs:           ipfs,
+		tracker:        tracker,
+		monitor:        monitor,
+		allocator:      allocator,
+		informers:      informers,
+		tracer:         tracer,
+		dispatcher:     dispatcher,
+		alerts:         []api.Alert{},
+		drains:         make(map[peer.ID]*drain),
+		pinCallbacks:   make(map[api.Cid]*pinCallback),
+		pinCallbacksCh: make(chan struct{}, 1),
+		apiKeysUsed:    make(map[string]time.Time),
+		peerManager:    peerManager,
+		shutdownB:      false,
+		removed:        false,
+		doneCh:         make(chan struct{}),
+		readyCh:        make(chan struct{}),
+		readyB:         false,
 	}
 
 	// Import known cluster peers from peerstore file and config. Set
@@ -246,6 +291,9 @@ func (c *Cluster) setupRPCClients() {
 	for _, informer := range c.informers {
 		informer.SetClient(c.rpcClient)
 	}
+	if c.dispatcher != nil {
+		c.dispatcher.SetClient(c.rpcClient)
+	}
 }
 
 // watchPinset triggers recurrent operations that loop on the pinset.
@@ -269,6 +317,8 @@ func (c *Cluster) watchPinset() {
 			c.StateSync(ctx)
 			stateSyncTimer.Reset(c.config.StateSyncInterval)
 		case <-recoverTimer.C:
+			c.reallocateFailedPins(ctx)
+
 			logger.Debug("auto-triggering RecoverAllLocal()")
 
 			out := make(chan api.PinInfo, 1024)
@@ -500,25 +550,55 @@ func (c *Cluster) alertsHandler() {
 			}
 			c.alertsMux.Unlock()
 
-			if alrt.Name != pingMetricName {
-				continue // only handle ping alerts
+			// Peers in maintenance are expected to go down.
+			inMaintenance := alrt.Name == pingMetricName && c.inMaintenance(c.ctx, alrt.Peer)
+
+			// The dispatcher only forwards the alerts for the
+			// metrics in its configuration.
+			if c.dispatcher != nil && !inMaintenance {
+				if err := c.dispatcher.Dispatch(c.ctx, alrt); err != nil {
+					logger.Error(err)
+				}
+			}
+
+			switch alrt.Name {
+			case pingMetricName:
+				if inMaintenance {
+					logger.Infof("%s is in maintenance. Its pins will not be re-allocated", alrt.Peer)
+					continue
+				}
+			case maintenanceMetricName:
+				// The ping alerts of the peer were ignored during
+				// the maintenance. Handle them now if it is still
+				// down.
+				status, err := maintenanceFromMetric(alrt.Metric)
+				if err != nil || !status.Enabled {
+					continue
+				}
+				ping := c.monitor.LatestForPeer(c.ctx, pingMetricName, alrt.Peer)
+				if ping.Valid && !ping.Expired() {
+					continue
+				}
+				logger.Warnf("maintenance of %s ended and it is down", alrt.Peer)
+			default:
+				continue // only handle ping and maintenance alerts
 			}
 
 			if c.config.DisableRepinning {
 				logger.Debugf("repinning is disabled. Will not re-allocate pins on alerts")
-				return
+				continue
 			}
 
 			cState, err := c.consensus.State(c.ctx)
 			if err != nil {
 				logger.Warn(err)
-				return
+				continue
 			}
 
 			distance, err := c.distances(c.ctx, alrt.Peer)
 			if err != nil {
 				logger.Warn(err)
-				return
+				continue
 			}
 
 			pinCh := make(chan api.Pin, 1024)
@@ -686,6 +766,28 @@ func (c *Cluster) run() {
 		defer c.wg.Done()
 		c.reBootstrap()
 	}()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.pinCallbacksLoop()
+	}()
+
+	if c.rebalanceEnabled() {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.rebalanceLoop()
+		}()
+	}
+
+	if !c.config.FollowerMode {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.resumeDrains(c.ctx)
+		}()
+	}
 }
 
 func (c *Cluster) ready(timeout time.Duration) {
@@ -837,6 +939,13 @@ func (c *Cluster) Shutdown(ctx context.Context) error {
 		return err
 	}
 
+	if c.dispatcher != nil {
+		if err := c.dispatcher.Shutdown(ctx); err != nil {
+			logger.Errorf("error stopping alert dispatcher: %s", err)
+			return err
+		}
+	}
+
 	if err := c.ipfs.Shutdown(ctx); err != nil {
 		logger.Errorf("error stopping IPFS Connector: %s", err)
 		return err
@@ -928,6 +1037,9 @@ func (c *Cluster) ID(ctx context.Context) api.ID {
 	if err != nil {
 		id.Error = err.Error()
 	}
+	if status, ok := c.localMaintenance(); ok {
+		id.Maintenance = &status
+	}
 
 	return id
 }
@@ -1131,6 +1243,7 @@ func (c *Cluster) distances(ctx context.Context, exclude peer.ID) (*distanceChec
 // StateSyncInterval. Currently it:
 //   * Sends unpin for expired items for which this peer is "closest"
 //     (skipped for follower peers)
+//   * Recounts the pins owned by every API user (see Usage)
 func (c *Cluster) StateSync(ctx context.Context) error {
 	_, span := trace.StartSpan(ctx, "cluster/StateSync")
 	defer span.End()
@@ -1138,10 +1251,6 @@ func (c *Cluster) StateSync(ctx context.Context) error {
 
 	ctx = trace.NewContext(c.ctx, span)
 
-	if c.config.FollowerMode {
-		return nil
-	}
-
 	cState, err := c.consensus.State(ctx)
 	if err != nil {
 		return err
@@ -1153,29 +1262,39 @@ func (c *Cluster) StateSync(ctx context.Context) error {
 	// other trusted peers. We cannot know if our peer ID is trusted by
 	// other peers in the Cluster. This assumes yes. Setting FollowerMode
 	// is a way to assume the opposite and skip this completely.
-	distance, err := c.distances(ctx, "")
-	if err != nil {
-		return err // could not list peers
+	var distance *distanceChecker
+	if !c.config.FollowerMode {
+		distance, err = c.distances(ctx, "")
+		if err != nil {
+			return err // could not list peers
+		}
 	}
 
 	clusterPins := make(chan api.Pin, 1024)
+	listErr := make(chan error, 1)
 	go func() {
-		err = cState.List(ctx, clusterPins)
-		if err != nil {
-			logger.Error(err)
-		}
+		listErr <- cState.List(ctx, clusterPins)
 	}()
 
-	// Unpin expired items when we are the closest peer to them.
+	usage := make(map[string]ownerUsage)
 	for p := range clusterPins {
-		if p.ExpiredAt(timeNow) && distance.isClosest(p.Cid) {
+		// Unpin expired items when we are the closest peer to them.
+		if distance != nil && p.ExpiredAt(timeNow) && distance.isClosest(p.Cid) {
 			logger.Infof("Unpinning %s: pin expired at %s", p.Cid, p.ExpireAt)
-			if _, err := c.Unpin(ctx, p.Cid); err != nil {
-				logger.Error(err)
+			_, err := c.Unpin(ctx, p.Cid)
+			if err == nil {
+				continue
 			}
+			logger.Error(err)
 		}
+		countUsage(usage, p)
 	}
 
+	if err := <-listErr; err != nil {
+		logger.Error(err)
+		return nil
+	}
+	c.setUsage(usage)
 	return nil
 }
 
@@ -1212,7 +1331,7 @@ func (c *Cluster) Status(ctx context.Context, h api.Cid) (api.GlobalPinInfo, err
 	defer span.End()
 	ctx = trace.NewContext(c.ctx, span)
 
-	return c.globalPinInfoCid(ctx, "PinTracker", "Status", h)
+	return c.globalPinInfoCid(ctx, "PinTracker", "Status", h, globalPinInfoTimeout)
 }
 
 // StatusLocal returns this peer's PinInfo for a given Cid.
@@ -1224,7 +1343,7 @@ func (c *Cluster) StatusLocal(ctx context.Context, h api.Cid) api.PinInfo {
 	return c.tracker.Status(ctx, h)
 }
 
-// used for RecoverLocal and SyncLocal.
+// used for RecoverLocal and VerifyLocal.
 func (c *Cluster) localPinInfoOp(
 	ctx context.Context,
 	h api.Cid,
@@ -1286,12 +1405,32 @@ func (c *Cluster) RecoverAllLocal(ctx context.Context, out chan<- api.PinInfo) e
 // Recover operations ask IPFS to pin or unpin items in error state. Recover
 // is faster than calling Pin on the same CID as it avoids committing an
 // identical pin to the consensus layer.
+//
+// When h is a meta-pin, the clusterDAG and all the shards of the sharded DAG
+// are recovered too.
 func (c *Cluster) Recover(ctx context.Context, h api.Cid) (api.GlobalPinInfo, error) {
 	_, span := trace.StartSpan(ctx, "cluster/Recover")
 	defer span.End()
 	ctx = trace.NewContext(c.ctx, span)
 
-	return c.globalPinInfoCid(ctx, "PinTracker", "Recover", h)
+	pin, err := c.PinGet(ctx, h)
+	if err == nil && pin.Type == api.MetaType {
+		cids, err := c.cidsFromMetaPin(ctx, h)
+		if err != nil {
+			return api.GlobalPinInfo{}, err
+		}
+		for _, ci := range cids {
+			if ci.Equals(h) {
+				continue
+			}
+			_, err := c.globalPinInfoCid(ctx, "PinTracker", "Recover", ci, globalPinInfoTimeout)
+			if err != nil {
+				logger.Errorf("error recovering %s (part of %s): %s", ci, h, err)
+			}
+		}
+	}
+
+	return c.globalPinInfoCid(ctx, "PinTracker", "Recover", h, globalPinInfoTimeout)
 }
 
 // RecoverLocal triggers a recover operation for a given Cid in this peer only.
@@ -1308,6 +1447,48 @@ func (c *Cluster) RecoverLocal(ctx context.Context, h api.Cid) (api.PinInfo, err
 	return c.localPinInfoOp(ctx, h, c.tracker.Recover)
 }
 
+// Verify triggers an integrity check of the given Cid in all the peers
+// where it is allocated. Each peer walks the DAG in its IPFS daemon and
+// rehashes every block. Items with missing or corrupt blocks are reported
+// with the "corrupted" status, which can be fixed with Recover.
+//
+// When h is a meta-pin, the clusterDAG and all the shards of the sharded DAG
+// are verified too.
+func (c *Cluster) Verify(ctx context.Context, h api.Cid) (api.GlobalPinInfo, error) {
+	_, span := trace.StartSpan(ctx, "cluster/Verify")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	pin, err := c.PinGet(ctx, h)
+	if err == nil && pin.Type == api.MetaType {
+		cids, err := c.cidsFromMetaPin(ctx, h)
+		if err != nil {
+			return api.GlobalPinInfo{}, err
+		}
+		for _, ci := range cids {
+			if ci.Equals(h) {
+				continue
+			}
+			_, err := c.globalPinInfoCid(ctx, "PinTracker", "Verify", ci, verifyTimeout)
+			if err != nil {
+				logger.Errorf("error verifying %s (part of %s): %s", ci, h, err)
+			}
+		}
+	}
+
+	return c.globalPinInfoCid(ctx, "PinTracker", "Verify", h, verifyTimeout)
+}
+
+// VerifyLocal triggers an integrity check of the given Cid in this peer
+// only. It returns the resulting PinInfo.
+func (c *Cluster) VerifyLocal(ctx context.Context, h api.Cid) (api.PinInfo, error) {
+	_, span := trace.StartSpan(ctx, "cluster/VerifyLocal")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	return c.localPinInfoOp(ctx, h, c.tracker.Verify)
+}
+
 // Pins sends pins on the given out channel as it iterates the full
 // pinset (current global state). This is the source of truth as to which pins
 // are managed and their allocation, but does not indicate if the item is
@@ -1323,9 +1504,44 @@ func (c *Cluster) Pins(ctx context.Context, out chan<- api.Pin) error {
 	cState, err := c.consensus.State(ctx)
 	if err != nil {
 		logger.Error(err)
+		close(out)
 		return err
 	}
-	return cState.List(ctx, out)
+
+	// Records are internal to cluster and are left out.
+	pins := make(chan api.Pin, 1024)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- cState.List(ctx, pins)
+	}()
+	defer close(out)
+	for pin := range pins {
+		if pin.Type == api.RecordType {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case out <- pin:
+		}
+	}
+	return <-errCh
+}
+
+// PinsQuery sends the pins selected by the given query on the out channel.
+// Pins are sent in a stable order, starting after the query Cursor, and
+// no more than query.Limit pins are sent when it is set.
+func (c *Cluster) PinsQuery(ctx context.Context, query api.PinQuery, out chan<- api.Pin) error {
+	_, span := trace.StartSpan(ctx, "cluster/PinsQuery")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	cState, err := c.consensus.State(ctx)
+	if err != nil {
+		logger.Error(err)
+		close(out)
+		return err
+	}
+	return cState.Query(ctx, query, out)
 }
 
 // pinsSlice returns the list of Cids managed by Cluster and which are part
@@ -1337,16 +1553,16 @@ func (c *Cluster) Pins(ctx context.Context, out chan<- api.Pin) error {
 // loading the full pinset in memory!
 func (c *Cluster) pinsSlice(ctx context.Context) ([]api.Pin, error) {
 	out := make(chan api.Pin, 1024)
-	var err error
+	errCh := make(chan error, 1)
 	go func() {
-		err = c.Pins(ctx, out)
+		errCh <- c.Pins(ctx, out)
 	}()
 
 	var pins []api.Pin
 	for pin := range out {
 		pins = append(pins, pin)
 	}
-	return pins, err
+	return pins, <-errCh
 }
 
 // PinGet returns information for a single Cid managed by Cluster.
@@ -1399,8 +1615,64 @@ func (c *Cluster) Pin(ctx context.Context, h api.Cid, opts api.PinOptions) (api.
 	ctx = trace.NewContext(c.ctx, span)
 	pin := api.PinWithOpts(h, opts)
 
+	if err := c.checkPinCallbackURL(pin.CallbackURL); err != nil {
+		return api.Pin{}, err
+	}
+
 	result, _, err := c.pin(ctx, pin, []peer.ID{})
-	return result, err
+	if err != nil {
+		return result, err
+	}
+	c.watchPinCallback(result)
+	return result, nil
+}
+
+// AllocationPreview runs the allocation process for pinning a CID with the
+// given options and returns the resulting allocations along with an
+// explanation of how every peer was considered. Nothing is pinned. The CID
+// may be undefined to preview the allocations for new content.
+//
+// Allocation errors are reported in the preview rather than returned.
+func (c *Cluster) AllocationPreview(ctx context.Context, h api.Cid, opts api.PinOptions) (api.AllocationPreview, error) {
+	_, span := trace.StartSpan(ctx, "cluster/AllocationPreview")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	pin := api.PinWithOpts(h, opts)
+
+	var existing api.Pin
+	if h.Defined() {
+		var err error
+		existing, err = c.PinGet(ctx, h)
+		if err != nil && err != state.ErrNotFound {
+			return api.AllocationPreview{}, err
+		}
+	}
+
+	pin, err := c.setupPin(ctx, pin, existing)
+	if err != nil {
+		return api.AllocationPreview{}, err
+	}
+
+	allocs, details, err := c.allocateWithDetails(
+		ctx,
+		pin,
+		existing,
+		nil,
+		pin.UserAllocations,
+	)
+
+	preview := api.AllocationPreview{
+		Cid:                  h,
+		ReplicationFactorMin: pin.ReplicationFactorMin,
+		ReplicationFactorMax: pin.ReplicationFactorMax,
+		Allocations:          allocs,
+		Peers:                details.report(allocs, c.allocator.Metrics()),
+	}
+	if err != nil {
+		preview.Error = err.Error()
+	}
+	return preview, nil
 }
 
 // sets the default replication factor in a pin when it's set to 0
@@ -1428,6 +1700,22 @@ func (c *Cluster) setupReplicationFactor(pin api.Pin) (api.Pin, error) {
 	return pin, isReplicationFactorValid(rplMin, rplMax)
 }
 
+// setupPlacement sets the default placement constraints on pins that do
+// not have any.
+func (c *Cluster) setupPlacement(pin api.Pin) (api.Pin, error) {
+	if !pin.HasPlacementConstraints() {
+		pin.AntiAffinity = c.config.AntiAffinity
+		pin.Spread = c.config.Spread
+	}
+
+	for _, name := range pin.PlacementMetrics() {
+		if name == "" {
+			return pin, errors.New("placement constraints cannot use empty metric names")
+		}
+	}
+	return pin, nil
+}
+
 // basic checks on the pin type to check it's well-formed.
 func checkPinType(pin api.Pin) error {
 	switch pin.Type {
@@ -1460,6 +1748,13 @@ func checkPinType(pin api.Pin) error {
 		if pin.Reference == nil {
 			return errors.New("metaPins should reference a ClusterDAG")
 		}
+	case api.CollectionType:
+		if len(pin.Allocations) != 0 {
+			return errors.New("collections should not specify allocations")
+		}
+		if pin.Reference != nil {
+			return errors.New("collections should not reference other pins")
+		}
 
 	default:
 		return errors.New("unrecognized pin type")
@@ -1475,11 +1770,30 @@ func (c *Cluster) setupPin(ctx context.Context, pin, existing api.Pin) (api.Pin,
 	defer span.End()
 	var err error
 
+	// Parents are only modified by Cluster when pinning and unpinning
+	// meta-pins and when adding and removing collection members.
+	pin.Parents = existing.Parents
+	// Same for the peers which failed to pin the item.
+	pin.FailedAllocations = existing.FailedAllocations
+	// Items keep the owner which pinned them first. The size is kept
+	// when repinning without it.
+	if existing.Owner != "" {
+		pin.Owner = existing.Owner
+	}
+	if pin.Size == 0 {
+		pin.Size = existing.Size
+	}
+
 	pin, err = c.setupReplicationFactor(pin)
 	if err != nil {
 		return pin, err
 	}
 
+	pin, err = c.setupPlacement(pin)
+	if err != nil {
+		return pin, err
+	}
+
 	if !pin.ExpireAt.IsZero() && pin.ExpireAt.Before(time.Now()) {
 		return pin, errors.New("pin.ExpireAt set before current time")
 	}
@@ -1515,6 +1829,17 @@ func (c *Cluster) pin(
 	ctx context.Context,
 	pin api.Pin,
 	blacklist []peer.ID,
+) (api.Pin, bool, error) {
+	return c.pinWithParents(ctx, pin, blacklist, nil)
+}
+
+// pinWithParents works like pin but additionally adds the given CIDs to
+// the Parents of the pin. It is used to add items to collections.
+func (c *Cluster) pinWithParents(
+	ctx context.Context,
+	pin api.Pin,
+	blacklist []peer.ID,
+	parents []api.Cid,
 ) (api.Pin, bool, error) {
 	ctx, span := trace.StartSpan(ctx, "cluster/pin")
 	defer span.End()
@@ -1547,8 +1872,20 @@ func (c *Cluster) pin(
 	// "option".
 	pin.Timestamp = time.Now()
 
-	if pin.Type == api.MetaType {
-		return pin, true, c.consensus.LogPin(ctx, pin)
+	switch pin.Type {
+	case api.MetaType:
+		// Reference the meta-pin from its children before
+		// committing it. If anything fails, the worst outcome is
+		// a parent reference which does not exist.
+		err = c.addMetaPinParent(ctx, pin)
+		if err != nil {
+			return pin, false, err
+		}
+		return pin, true, c.logPin(ctx, pin, existing)
+	case api.CollectionType:
+		// Collections are not pinned anywhere.
+		pin.Allocations = nil
+		return pin, true, c.logPin(ctx, pin, existing)
 	}
 
 	// We did not change ANY options and the pin exists so we just repin
@@ -1567,6 +1904,23 @@ func (c *Cluster) pin(
 		pin = existing
 	}
 
+	// Record the size of owned content so that it counts towards the
+	// size quota of its owner.
+	if pin.Type == api.DataType && pin.Size == 0 && c.hasSizeQuota(pin.Owner) {
+		size, err := c.ipfs.DAGSize(ctx, pin.Cid)
+		if err != nil {
+			logger.Errorf("error obtaining the size of %s: %s", pin.Cid, err)
+		} else {
+			pin.Size = size
+		}
+	}
+
+	for _, p := range parents {
+		if !pin.HasParent(p) {
+			pin.Parents = append(pin.Parents, p)
+		}
+	}
+
 	// Usually allocations are unset when pinning normally, however, the
 	// allocations may have been preset by the adder in which case they
 	// need to be respected. Whenever allocations are set. We don't
@@ -1578,10 +1932,8 @@ func (c *Cluster) pin(
 		// allocations.
 		allocs, err := c.allocate(
 			ctx,
-			pin.Cid,
+			pin,
 			existing,
-			pin.ReplicationFactorMin,
-			pin.ReplicationFactorMax,
 			blacklist,
 			pin.UserAllocations,
 		)
@@ -1598,7 +1950,7 @@ func (c *Cluster) pin(
 		logger.Infof("pinning %s on %s:", pin.Cid, pin.Allocations)
 	}
 
-	return pin, true, c.consensus.LogPin(ctx, pin)
+	return pin, true, c.logPin(ctx, pin, existing)
 }
 
 // Unpin removes a previously pinned Cid from Cluster. It returns
@@ -1624,7 +1976,12 @@ func (c *Cluster) Unpin(ctx context.Context, h api.Cid) (api.Pin, error) {
 
 	switch pin.Type {
 	case api.DataType:
-		return pin, c.consensus.LogUnpin(ctx, pin)
+		if len(pin.Parents) > 0 {
+			err := "cannot unpin a collection member directly. Remove it from its collections instead"
+			return pin, errors.New(err)
+		}
+		c.cancelPinCallback(h)
+		return pin, c.logUnpin(ctx, pin)
 	case api.ShardType:
 		err := "cannot unpin a shard directly. Unpin content root CID instead"
 		return pin, errors.New(err)
@@ -1634,19 +1991,83 @@ func (c *Cluster) Unpin(ctx context.Context, h api.Cid) (api.Pin, error) {
 		if err != nil {
 			return pin, err
 		}
-		return pin, c.consensus.LogUnpin(ctx, pin)
+		return pin, c.logUnpin(ctx, pin)
 	case api.ClusterDAGType:
 		err := "cannot unpin a Cluster DAG directly. Unpin content root CID instead"
 		return pin, errors.New(err)
+	case api.CollectionType:
+		// Remove members first so that the collection can be
+		// deleted again should anything fail.
+		err := c.removeCollectionMembers(ctx, pin.Cid, nil)
+		if err != nil {
+			return pin, err
+		}
+		return pin, c.consensus.LogUnpin(ctx, pin)
 	default:
 		return pin, errors.New("unrecognized pin type")
 	}
 }
 
-// unpinClusterDag unpins the clusterDAG metadata node and the shard metadata
-// nodes that it references.  It handles the case where multiple parents
-// reference the same metadata node, only unpinning those nodes without
-// existing references
+// addMetaPinParent adds the given meta-pin to the Parents of the
+// ClusterDAG and Shard pins that it references.
+func (c *Cluster) addMetaPinParent(ctx context.Context, metaPin api.Pin) error {
+	ctx, span := trace.StartSpan(ctx, "cluster/addMetaPinParent")
+	defer span.End()
+
+	cids, err := c.metaPinChildren(ctx, metaPin)
+	if err != nil {
+		return err
+	}
+
+	for _, ci := range cids {
+		err := c.addPinParent(ctx, ci, metaPin.Cid)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addPinParent adds parent to the Parents of the pin for ci.
+//
+// Parents are updated with a read-modify-write of the whole pin, which is
+// only serialized among the updates made by this peer. When two peers update
+// the same pin concurrently, the last write wins (e.g. with CRDT consensus)
+// and one of the references may be lost. The pin is therefore re-read after
+// committing and the update is retried when the parent is missing.
+func (c *Cluster) addPinParent(ctx context.Context, ci, parent api.Cid) error {
+	unlock := c.parentLocks.lock(ci)
+	defer unlock()
+
+	for i := 0; i < parentUpdateAttempts; i++ {
+		pin, err := c.PinGet(ctx, ci)
+		if err != nil {
+			return fmt.Errorf("error getting %s, referenced by %s: %w", ci, parent, err)
+		}
+		if pin.HasParent(parent) {
+			return nil
+		}
+		pin.Parents = append(pin.Parents, parent)
+		err = c.consensus.LogPin(ctx, pin)
+		if err != nil {
+			return err
+		}
+	}
+	// The commit may not be visible yet (e.g. batched or pending in
+	// the leader).
+	logger.Warnf("could not verify that %s is a parent of %s", parent, ci)
+	return nil
+}
+
+// unpinClusterDag removes the given meta-pin from the Parents of the
+// clusterDAG and the shards that it references and unpins those that are
+// not referenced by any other meta-pin. The meta-pin itself is not
+// unpinned.
+//
+// Pins without any Parents (which were created before parent references
+// were tracked) are only unpinned when no other meta-pin in the pinset
+// references them. Otherwise their Parents are filled in, so that the
+// meta-pins do not need to be looked up again.
 func (c *Cluster) unpinClusterDag(metaPin api.Pin) error {
 	ctx, span := trace.StartSpan(c.ctx, "cluster/unpinClusterDag")
 	defer span.End()
@@ -1656,21 +2077,160 @@ func (c *Cluster) unpinClusterDag(metaPin api.Pin) error {
 		return err
 	}
 
-	// TODO: FIXME: potentially unpinning shards which are referenced
-	// by other clusterDAGs.
+	var refs map[api.Cid][]api.Cid
+	references := func() (map[api.Cid][]api.Cid, error) {
+		if refs != nil {
+			return refs, nil
+		}
+		refs, err = c.metaPinReferences(ctx, metaPin.Cid)
+		return refs, err
+	}
+
+	// cids are sorted so that shards come first, then the clusterDAG.
+	// Should anything fail, the meta-pin and the clusterDAG stay in
+	// the pinset and the unpin operation can be retried.
 	for _, ci := range cids {
-		err = c.consensus.LogUnpin(ctx, api.PinCid(ci))
+		if ci.Equals(metaPin.Cid) {
+			continue
+		}
+
+		err := c.removePinParent(ctx, ci, metaPin.Cid, references)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removePinParent removes parent from the Parents of the pin for ci and
+// unpins it when no other meta-pin references it. references is only
+// called for pins without Parents. Like addPinParent, it re-reads the pin
+// after committing new Parents, as concurrent updates from other peers may
+// overwrite them.
+func (c *Cluster) removePinParent(ctx context.Context, ci, parent api.Cid, references func() (map[api.Cid][]api.Cid, error)) error {
+	unlock := c.parentLocks.lock(ci)
+	defer unlock()
+
+	for i := 0; i < parentUpdateAttempts; i++ {
+		pin, err := c.PinGet(ctx, ci)
+		if err == state.ErrNotFound {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
+
+		switch {
+		case len(pin.Parents) == 0:
+			refs, err := references()
+			if err != nil {
+				return err
+			}
+			if parents := refs[ci]; len(parents) > 0 {
+				pin.Parents = parents
+				logger.Infof("%s is referenced by other sharded pins. Not unpinning", ci)
+				return c.consensus.LogPin(ctx, pin)
+			}
+		case !pin.HasParent(parent):
+			if i == 0 {
+				logger.Warnf("%s is not referenced by %s. Not unpinning", ci, parent)
+			}
+			return nil
+		case len(pin.Parents) > 1:
+			parents := make([]api.Cid, 0, len(pin.Parents)-1)
+			for _, p := range pin.Parents {
+				if !p.Equals(parent) {
+					parents = append(parents, p)
+				}
+			}
+			pin.Parents = parents
+			logger.Infof("%s is referenced by other sharded pins. Not unpinning", ci)
+			err = c.consensus.LogPin(ctx, pin)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		return c.consensus.LogUnpin(ctx, pin)
 	}
+	logger.Warnf("could not verify that %s is no longer a parent of %s", parent, ci)
 	return nil
 }
 
+// PinParents returns the meta-pins which reference the given ClusterDAG or
+// Shard CID. It returns an empty slice for other pin types.
+func (c *Cluster) PinParents(ctx context.Context, h api.Cid) ([]api.Pin, error) {
+	_, span := trace.StartSpan(ctx, "cluster/PinParents")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	pin, err := c.PinGet(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make([]api.Pin, 0, len(pin.Parents))
+	for _, p := range pin.Parents {
+		parent, err := c.PinGet(ctx, p)
+		if err == state.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, parent)
+	}
+	return parents, nil
+}
+
+// metaPinReferences returns the clusterDAG and shard CIDs referenced by all
+// the meta-pins in the pinset, except the given one, along with the
+// meta-pins referencing them.
+func (c *Cluster) metaPinReferences(ctx context.Context, exclude api.Cid) (map[api.Cid][]api.Cid, error) {
+	ctx, span := trace.StartSpan(ctx, "cluster/metaPinReferences")
+	defer span.End()
+
+	query := api.PinQuery{
+		Type: api.MetaType,
+	}
+	statePins := make(chan api.Pin, 1024)
+	queryErr := make(chan error, 1)
+	go func() {
+		queryErr <- c.PinsQuery(ctx, query, statePins)
+	}()
+
+	var metaPins []api.Cid
+	for p := range statePins {
+		if !p.Cid.Equals(exclude) {
+			metaPins = append(metaPins, p.Cid)
+		}
+	}
+	if err := <-queryErr; err != nil {
+		return nil, err
+	}
+
+	refs := make(map[api.Cid][]api.Cid)
+	for _, m := range metaPins {
+		cids, err := c.cidsFromMetaPin(ctx, m)
+		if err != nil {
+			// cidsFromMetaPin returns whatever it could
+			// figure out (at least the clusterDAG).
+			logger.Warnf("error reading references from %s: %s", m, err)
+		}
+		for _, ci := range cids {
+			if !ci.Equals(m) {
+				refs[ci] = append(refs[ci], m)
+			}
+		}
+	}
+	return refs, nil
+}
+
 // PinUpdate pins a new CID based on an existing cluster Pin. The allocations
 // and most pin options (replication factors) are copied from the existing
-// Pin.  The options object can be used to set the Name for the new pin and
-// might support additional options in the future.
+// Pin.  The options object can be used to set the Name and the Owner for
+// the new pin and might support additional options in the future.
 //
 // The from pin is NOT unpinned upon completion. The new pin might take
 // advantage of efficient pin/update operation on IPFS-side (if the
@@ -1698,7 +2258,24 @@ func (c *Cluster) PinUpdate(ctx context.Context, from api.Cid, to api.Cid, opts
 	if !opts.ExpireAt.IsZero() && opts.ExpireAt.After(time.Now()) {
 		existing.ExpireAt = opts.ExpireAt
 	}
-	return existing, c.consensus.LogPin(ctx, existing)
+	if opts.Owner != "" {
+		existing.Owner = opts.Owner
+	}
+	existing.Size = 0
+	if c.hasSizeQuota(existing.Owner) {
+		size, err := c.ipfs.DAGSize(ctx, to)
+		if err != nil {
+			logger.Errorf("error obtaining the size of %s: %s", to, err)
+		} else {
+			existing.Size = size
+		}
+	}
+
+	prev, err := c.PinGet(ctx, to)
+	if err != nil && err != state.ErrNotFound {
+		return api.Pin{}, err
+	}
+	return existing, c.logPin(ctx, existing, prev)
 }
 
 // PinPath pins an CID resolved from its IPFS Path. It returns the resolved
@@ -1799,10 +2376,21 @@ func (c *Cluster) peersWithFilter(ctx context.Context, peers []peer.ID, out chan
 		)
 	}()
 
+	// Peers may be down during their maintenance, so we report what
+	// we know about it.
+	inMaintenance := c.peersInMaintenance(ctx)
+	withMaintenance := func(id api.ID) api.ID {
+		if status, ok := inMaintenance[id.ID]; ok && id.Maintenance == nil {
+			id.Maintenance = &status
+		}
+		return id
+	}
+
 	// Unfortunately, we need to use idsOut as intermediary channel
 	// because it is closed when MultiStream ends and we cannot keep
 	// adding things on it (the errors below).
 	for id := range idsOut {
+		id = withMaintenance(id)
 		select {
 		case <-ctx.Done():
 			logger.Errorf("Peers call aborted: %s", ctx.Err())
@@ -1823,10 +2411,10 @@ func (c *Cluster) peersWithFilter(ctx context.Context, peers []peer.ID, out chan
 		select {
 		case <-ctx.Done():
 			logger.Errorf("Peers call aborted: %s", ctx.Err())
-		case out <- api.ID{
+		case out <- withMaintenance(api.ID{
 			ID:    peers[i],
 			Error: err.Error(),
-		}:
+		}):
 		}
 	}
 }
@@ -1861,6 +2449,7 @@ func (c *Cluster) setTrackerStatus(gpin *api.GlobalPinInfo, h api.Cid, peers []p
 			Origins:     pin.Origins,
 			Created:     pin.Timestamp,
 			Metadata:    pin.Metadata,
+			Priority:    pin.Priority,
 			Peer:        p,
 			PinInfoShort: api.PinInfoShort{
 				PeerName:      pv.Peername,
@@ -1873,7 +2462,7 @@ func (c *Cluster) setTrackerStatus(gpin *api.GlobalPinInfo, h api.Cid, peers []p
 	}
 }
 
-func (c *Cluster) globalPinInfoCid(ctx context.Context, comp, method string, h api.Cid) (api.GlobalPinInfo, error) {
+func (c *Cluster) globalPinInfoCid(ctx context.Context, comp, method string, h api.Cid, timeout time.Duration) (api.GlobalPinInfo, error) {
 	ctx, span := trace.StartSpan(ctx, "cluster/globalPinInfoCid")
 	defer span.End()
 
@@ -1950,9 +2539,6 @@ func (c *Cluster) globalPinInfoCid(ctx context.Context, comp, method string, h a
 	lenDests := len(dests)
 	replies := make([]api.PinInfo, lenDests)
 
-	// a globalPinInfo type of request should be relatively fast. We
-	// cannot block response indefinitely due to an unresponsive node.
-	timeout := 15 * time.Second
 	ctxs, cancels := rpcutil.CtxsWithTimeout(ctx, lenDests, timeout)
 	defer rpcutil.MultiCancel(cancels)
 
@@ -1991,6 +2577,7 @@ func (c *Cluster) globalPinInfoCid(ctx context.Context, comp, method string, h a
 			Origins:     pin.Origins,
 			Created:     pin.Timestamp,
 			Metadata:    pin.Metadata,
+			Priority:    pin.Priority,
 			PinInfoShort: api.PinInfoShort{
 				PeerName:      pv.Peername,
 				IPFS:          pv.IPFSID,
@@ -2005,6 +2592,31 @@ func (c *Cluster) globalPinInfoCid(ctx context.Context, comp, method string, h a
 	return gpin, nil
 }
 
+// globalPinInfoCids returns the GlobalPinInfo of the given cids. Unlike
+// globalPinInfoCid, every peer is contacted only once for all of them.
+func (c *Cluster) globalPinInfoCids(ctx context.Context, cids []api.Cid) (map[api.Cid]api.GlobalPinInfo, error) {
+	ctx, span := trace.StartSpan(ctx, "cluster/globalPinInfoCids")
+	defer span.End()
+
+	in := make(chan api.Cid, len(cids))
+	for _, ci := range cids {
+		in <- ci
+	}
+	close(in)
+
+	out := make(chan api.GlobalPinInfo, 1024)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.globalPinInfoStream(ctx, "PinTracker", "StatusCids", in, out)
+	}()
+
+	gpis := make(map[api.Cid]api.GlobalPinInfo, len(cids))
+	for gpi := range out {
+		gpis[gpi.Cid] = gpi
+	}
+	return gpis, <-errCh
+}
+
 func (c *Cluster) globalPinInfoStream(ctx context.Context, comp, method string, inChan interface{}, out chan<- api.GlobalPinInfo) error {
 	defer close(out)
 
@@ -2170,11 +2782,19 @@ func (c *Cluster) cidsFromMetaPin(ctx context.Context, h api.Cid) ([]api.Cid, er
 		return list, nil
 	}
 
-	if pin.Reference == nil {
+	refs, err := c.metaPinChildren(ctx, pin)
+	return append(refs, list...), err
+}
+
+// metaPinChildren returns the CIDs of the Shards and the ClusterDAG
+// referenced by the given meta-pin, in that order. The meta-pin does not need
+// to be part of the pinset, but the ClusterDAG must.
+func (c *Cluster) metaPinChildren(ctx context.Context, metaPin api.Pin) ([]api.Cid, error) {
+	if metaPin.Reference == nil {
 		return nil, errors.New("metaPin.Reference is unset")
 	}
-	list = append([]api.Cid{*pin.Reference}, list...)
-	clusterDagPin, err := c.PinGet(ctx, *pin.Reference)
+	list := []api.Cid{*metaPin.Reference}
+	clusterDagPin, err := c.PinGet(ctx, *metaPin.Reference)
 	if err != nil {
 		return list, fmt.Errorf("could not get clusterDAG pin from state. Malformed pin?: %s", err)
 	}
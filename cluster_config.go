@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -46,6 +47,22 @@ const (
 	DefaultDialPeerTimeout       = 3 * time.Second
 	DefaultFollowerMode          = false
 	DefaultMDNSInterval          = 10 * time.Second
+
+	DefaultRebalanceInterval         = 0
+	DefaultRebalancePinsPerCycle     = 10
+	DefaultRebalanceScanPerCycle     = 1000
+	DefaultRebalanceThreshold        = 0.1
+	DefaultRebalanceMigrationTimeout = 10 * time.Minute
+	DefaultMaintenanceWindow         = time.Hour
+
+	DefaultPinErrorReallocateAttempts = 0
+	DefaultPinErrorReallocateAge      = 0
+	DefaultPinErrorScanPerCycle       = 1000
+
+	DefaultPinCallbackTimeout       = 24 * time.Hour
+	DefaultPinCallbackCheckInterval = 10 * time.Second
+	DefaultPinCallbackMaxRetries    = 3
+	DefaultPinCallbackRetryBackoff  = 2 * time.Second
 )
 
 // ConnMgrConfig configures the libp2p host connection manager.
@@ -55,6 +72,13 @@ type ConnMgrConfig struct {
 	GracePeriod time.Duration
 }
 
+// Quota sets the maximum number of pins and the maximum total size of the
+// content that an API user can own. Zero values mean no limit.
+type Quota struct {
+	MaxPins int    `json:"max_pins"`
+	MaxSize uint64 `json:"max_size"`
+}
+
 // Config is the configuration object containing customizable variables to
 // initialize the main ipfs-cluster component. It implements the
 // config.ComponentConfig interface.
@@ -122,6 +146,14 @@ type Config struct {
 	// possible.
 	ReplicationFactorMin int
 
+	// AntiAffinity and Spread are the placement constraints used for
+	// pins which do not set any. They are metric names, usually of the
+	// form "tag:<name>". No two allocations of a pin may share a value
+	// of an AntiAffinity metric, and every value of a Spread metric
+	// must have at least one allocation.
+	AntiAffinity []string
+	Spread       []string
+
 	// MonitorPingInterval is the frequency with which a cluster peer
 	// sends a "ping" metric. The metric has a TTL set to the double of
 	// this value. This metric sends information about this peer to other
@@ -148,6 +180,101 @@ type Config struct {
 	// when not wanting to rely on the monitoring system which needs a revamp.
 	DisableRepinning bool
 
+	// RebalanceInterval is the time between runs of the rebalancer,
+	// which migrates pins to the peers that the allocator would choose
+	// for them now. This is useful after adding new peers, which
+	// otherwise only receive new pins. Set to 0 to disable. Peers with
+	// it enabled only run it while they are the consensus leader or,
+	// when there is none, the peer with the lowest ID.
+	RebalanceInterval time.Duration
+
+	// RebalancePinsPerCycle is the maximum number of pins migrated on
+	// every run of the rebalancer.
+	RebalancePinsPerCycle int
+
+	// RebalanceScanPerCycle is the maximum number of pins checked on
+	// every run of the rebalancer. The next run continues after the
+	// last pin checked.
+	RebalanceScanPerCycle int
+
+	// RebalanceThreshold is the minimum relative difference between the
+	// metrics of two peers for the rebalancer to move a pin from one
+	// to the other (i.e. 0.1 means 10%). It avoids migrating pins back
+	// and forth between similar peers.
+	RebalanceThreshold float64
+
+	// RebalanceMigrationTimeout is how long the rebalancer and peer
+	// drains wait for the new allocations of a pin to pin it. When it
+	// expires, the previous allocations are restored.
+	RebalanceMigrationTimeout time.Duration
+
+	// MaintenanceWindow is the maximum duration of the maintenance mode
+	// of a peer. While in maintenance, a peer does not receive new
+	// allocations and its pins are not re-allocated when it goes down.
+	// When the window ends, the peer is handled like any other.
+	MaintenanceWindow time.Duration
+
+	// PinErrorReallocateAttempts is the number of failed attempts to
+	// pin an item after which the allocation of a peer is handed to a
+	// different peer by the first allocation of the pin. The peer is not
+	// allocated that item again until all the allocations have pinned
+	// it. Set to 0 to disable.
+	PinErrorReallocateAttempts int
+
+	// PinErrorReallocateAge is how long an item can stay in pin_error on
+	// a peer, counting from the time of the error, before its allocation
+	// is handed to a different peer. Set to 0 to disable.
+	PinErrorReallocateAge time.Duration
+
+	// PinErrorScanPerCycle is the maximum number of pins, among those
+	// that this peer is the first allocation of, whose status is
+	// requested from their other allocations before every automatic
+	// recover. The next cycle continues after the last pin checked. Items
+	// in pin_error in this peer are always checked.
+	PinErrorScanPerCycle int
+
+	// PinCallbackURL receives a callback for every pin which does not
+	// set its own callback_url option. Callbacks are POSTed by the peer
+	// that received the pin request once the pin is pinned by
+	// replication_factor_min peers or has failed. Leave empty to only
+	// send callbacks for pins that request them.
+	PinCallbackURL string
+
+	// PinCallbackAllowedHosts lists the hosts which can receive the
+	// callbacks requested by pins with their callback_url option.
+	// Pin requests with a callback_url for any other host are rejected.
+	// "*" allows any host. PinCallbackURL is always allowed.
+	PinCallbackAllowedHosts []string
+
+	// PinCallbackSecret, when set, is used to sign the callbacks. The
+	// hex-encoded HMAC-SHA256 of the request body is sent in the
+	// X-Cluster-Signature header.
+	PinCallbackSecret string
+
+	// PinCallbackTimeout is how long a pin can take to complete before
+	// an error callback is sent for it.
+	PinCallbackTimeout time.Duration
+
+	// PinCallbackCheckInterval is the time between checks of the status
+	// of pins waiting to send a callback.
+	PinCallbackCheckInterval time.Duration
+
+	// PinCallbackMaxRetries is the number of times that a failed
+	// callback request is retried. PinCallbackRetryBackoff is the time
+	// to wait before the first retry. It doubles with every retry.
+	PinCallbackMaxRetries   int
+	PinCallbackRetryBackoff time.Duration
+
+	// Quotas limit what each API user can own (the pins made through the
+	// APIs when authentication is enabled). Users without a quota are not
+	// limited. Every peer enforces them with its own count of the pinset,
+	// which includes the pins made by other peers after every
+	// StateSyncInterval, so concurrent pins made on several peers can
+	// exceed them. Sizes are the cumulative sizes that the root of every
+	// DAG declares, which IPFS does not verify, so size quotas are only
+	// advisory.
+	Quotas map[string]Quota
+
 	// FollowerMode disables broadcast requests from this peer
 	// (sync, recover, status) and disallows pinset management
 	// operations (Pin/Unpin).
@@ -170,27 +297,46 @@ type Config struct {
 // saved using JSON. Most configuration keys are converted into simple types
 // like strings, and key names aim to be self-explanatory for the user.
 type configJSON struct {
-	ID                    string             `json:"id,omitempty"`
-	Peername              string             `json:"peername"`
-	PrivateKey            string             `json:"private_key,omitempty" hidden:"true"`
-	Secret                string             `json:"secret" hidden:"true"`
-	LeaveOnShutdown       bool               `json:"leave_on_shutdown"`
-	ListenMultiaddress    ipfsconfig.Strings `json:"listen_multiaddress"`
-	EnableRelayHop        bool               `json:"enable_relay_hop"`
-	ConnectionManager     *connMgrConfigJSON `json:"connection_manager"`
-	DialPeerTimeout       string             `json:"dial_peer_timeout"`
-	StateSyncInterval     string             `json:"state_sync_interval"`
-	PinRecoverInterval    string             `json:"pin_recover_interval"`
-	ReplicationFactorMin  int                `json:"replication_factor_min"`
-	ReplicationFactorMax  int                `json:"replication_factor_max"`
-	MonitorPingInterval   string             `json:"monitor_ping_interval"`
-	PeerWatchInterval     string             `json:"peer_watch_interval"`
-	MDNSInterval          string             `json:"mdns_interval"`
-	PinOnlyOnTrustedPeers bool               `json:"pin_only_on_trusted_peers"`
-	DisableRepinning      bool               `json:"disable_repinning"`
-	FollowerMode          bool               `json:"follower_mode,omitempty"`
-	PeerstoreFile         string             `json:"peerstore_file,omitempty"`
-	PeerAddresses         []string           `json:"peer_addresses"`
+	ID                         string             `json:"id,omitempty"`
+	Peername                   string             `json:"peername"`
+	PrivateKey                 string             `json:"private_key,omitempty" hidden:"true"`
+	Secret                     string             `json:"secret" hidden:"true"`
+	LeaveOnShutdown            bool               `json:"leave_on_shutdown"`
+	ListenMultiaddress         ipfsconfig.Strings `json:"listen_multiaddress"`
+	EnableRelayHop             bool               `json:"enable_relay_hop"`
+	ConnectionManager          *connMgrConfigJSON `json:"connection_manager"`
+	DialPeerTimeout            string             `json:"dial_peer_timeout"`
+	StateSyncInterval          string             `json:"state_sync_interval"`
+	PinRecoverInterval         string             `json:"pin_recover_interval"`
+	ReplicationFactorMin       int                `json:"replication_factor_min"`
+	ReplicationFactorMax       int                `json:"replication_factor_max"`
+	AntiAffinity               []string           `json:"anti_affinity,omitempty"`
+	Spread                     []string           `json:"spread,omitempty"`
+	MonitorPingInterval        string             `json:"monitor_ping_interval"`
+	PeerWatchInterval          string             `json:"peer_watch_interval"`
+	MDNSInterval               string             `json:"mdns_interval"`
+	PinOnlyOnTrustedPeers      bool               `json:"pin_only_on_trusted_peers"`
+	DisableRepinning           bool               `json:"disable_repinning"`
+	RebalanceInterval          string             `json:"rebalance_interval"`
+	RebalancePinsPerCycle      int                `json:"rebalance_pins_per_cycle"`
+	RebalanceScanPerCycle      int                `json:"rebalance_scan_per_cycle"`
+	RebalanceThreshold         float64            `json:"rebalance_threshold"`
+	RebalanceMigrationTimeout  string             `json:"rebalance_migration_timeout"`
+	MaintenanceWindow          string             `json:"maintenance_window"`
+	PinErrorReallocateAttempts int                `json:"pin_error_reallocate_attempts"`
+	PinErrorReallocateAge      string             `json:"pin_error_reallocate_age"`
+	PinErrorScanPerCycle       int                `json:"pin_error_scan_per_cycle"`
+	PinCallbackURL             string             `json:"pin_callback_url"`
+	PinCallbackAllowedHosts    []string           `json:"pin_callback_allowed_hosts,omitempty"`
+	PinCallbackSecret          string             `json:"pin_callback_secret" hidden:"true"`
+	PinCallbackTimeout         string             `json:"pin_callback_timeout"`
+	PinCallbackCheckInterval   string             `json:"pin_callback_check_interval"`
+	PinCallbackMaxRetries      int                `json:"pin_callback_max_retries"`
+	PinCallbackRetryBackoff    string             `json:"pin_callback_retry_backoff"`
+	Quotas                     map[string]Quota   `json:"quotas,omitempty"`
+	FollowerMode               bool               `json:"follower_mode,omitempty"`
+	PeerstoreFile              string             `json:"peerstore_file,omitempty"`
+	PeerAddresses              []string           `json:"peer_addresses"`
 }
 
 // connMgrConfigJSON configures the libp2p host connection manager.
@@ -295,6 +441,89 @@ func (cfg *Config) Validate() error {
 		return err
 	}
 
+	if cfg.RebalanceInterval < 0 {
+		return errors.New("cluster.rebalance_interval is invalid")
+	}
+
+	if cfg.RebalanceInterval > 0 {
+		if cfg.RebalancePinsPerCycle <= 0 {
+			return errors.New("cluster.rebalance_pins_per_cycle is invalid")
+		}
+		if cfg.RebalanceScanPerCycle <= 0 {
+			return errors.New("cluster.rebalance_scan_per_cycle is invalid")
+		}
+		if cfg.RebalanceThreshold < 0 {
+			return errors.New("cluster.rebalance_threshold is invalid")
+		}
+		if cfg.RebalanceMigrationTimeout <= 0 {
+			return errors.New("cluster.rebalance_migration_timeout is invalid")
+		}
+	}
+
+	if cfg.MaintenanceWindow <= 0 {
+		return errors.New("cluster.maintenance_window is invalid")
+	}
+
+	if cfg.PinErrorReallocateAttempts < 0 {
+		return errors.New("cluster.pin_error_reallocate_attempts is invalid")
+	}
+
+	if cfg.PinErrorReallocateAge < 0 {
+		return errors.New("cluster.pin_error_reallocate_age is invalid")
+	}
+
+	reallocate := cfg.PinErrorReallocateAttempts > 0 || cfg.PinErrorReallocateAge > 0
+	if reallocate && cfg.PinErrorScanPerCycle <= 0 {
+		return errors.New("cluster.pin_error_scan_per_cycle is invalid")
+	}
+
+	if cfg.PinCallbackURL != "" {
+		u, err := url.Parse(cfg.PinCallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("cluster.pin_callback_url is invalid")
+		}
+	}
+
+	for _, host := range cfg.PinCallbackAllowedHosts {
+		if host == "" {
+			return errors.New("cluster.pin_callback_allowed_hosts contains an empty host")
+		}
+	}
+
+	if cfg.PinCallbackTimeout <= 0 {
+		return errors.New("cluster.pin_callback_timeout is invalid")
+	}
+
+	if cfg.PinCallbackCheckInterval <= 0 {
+		return errors.New("cluster.pin_callback_check_interval is invalid")
+	}
+
+	if cfg.PinCallbackMaxRetries < 0 {
+		return errors.New("cluster.pin_callback_max_retries is invalid")
+	}
+
+	if cfg.PinCallbackRetryBackoff < 0 {
+		return errors.New("cluster.pin_callback_retry_backoff is invalid")
+	}
+
+	for _, name := range cfg.AntiAffinity {
+		if name == "" {
+			return errors.New("cluster.anti_affinity contains an empty metric name")
+		}
+	}
+
+	for _, name := range cfg.Spread {
+		if name == "" {
+			return errors.New("cluster.spread contains an empty metric name")
+		}
+	}
+
+	for user, quota := range cfg.Quotas {
+		if user == "" || quota.MaxPins < 0 {
+			return errors.New("cluster.quotas is invalid")
+		}
+	}
+
 	return isRPCPolicyValid(cfg.RPCPolicy)
 }
 
@@ -381,6 +610,23 @@ func (cfg *Config) setDefaults() {
 	cfg.MDNSInterval = DefaultMDNSInterval
 	cfg.PinOnlyOnTrustedPeers = DefaultPinOnlyOnTrustedPeers
 	cfg.DisableRepinning = DefaultDisableRepinning
+	cfg.RebalanceInterval = DefaultRebalanceInterval
+	cfg.RebalancePinsPerCycle = DefaultRebalancePinsPerCycle
+	cfg.RebalanceScanPerCycle = DefaultRebalanceScanPerCycle
+	cfg.RebalanceThreshold = DefaultRebalanceThreshold
+	cfg.RebalanceMigrationTimeout = DefaultRebalanceMigrationTimeout
+	cfg.MaintenanceWindow = DefaultMaintenanceWindow
+	cfg.PinErrorReallocateAttempts = DefaultPinErrorReallocateAttempts
+	cfg.PinErrorReallocateAge = DefaultPinErrorReallocateAge
+	cfg.PinErrorScanPerCycle = DefaultPinErrorScanPerCycle
+	cfg.PinCallbackURL = ""
+	cfg.PinCallbackAllowedHosts = nil
+	cfg.PinCallbackSecret = ""
+	cfg.PinCallbackTimeout = DefaultPinCallbackTimeout
+	cfg.PinCallbackCheckInterval = DefaultPinCallbackCheckInterval
+	cfg.PinCallbackMaxRetries = DefaultPinCallbackMaxRetries
+	cfg.PinCallbackRetryBackoff = DefaultPinCallbackRetryBackoff
+	cfg.Quotas = nil
 	cfg.FollowerMode = DefaultFollowerMode
 	cfg.PeerstoreFile = "" // empty so it gets omitted.
 	cfg.PeerAddresses = []ma.Multiaddr{}
@@ -444,6 +690,18 @@ func (cfg *Config) applyConfigJSON(jcfg *configJSON) error {
 	rplMax := jcfg.ReplicationFactorMax
 	config.SetIfNotDefault(rplMin, &cfg.ReplicationFactorMin)
 	config.SetIfNotDefault(rplMax, &cfg.ReplicationFactorMax)
+	config.SetIfNotDefault(jcfg.RebalancePinsPerCycle, &cfg.RebalancePinsPerCycle)
+	config.SetIfNotDefault(jcfg.RebalanceScanPerCycle, &cfg.RebalanceScanPerCycle)
+	cfg.RebalanceThreshold = jcfg.RebalanceThreshold
+	config.SetIfNotDefault(jcfg.PinErrorReallocateAttempts, &cfg.PinErrorReallocateAttempts)
+	config.SetIfNotDefault(jcfg.PinErrorScanPerCycle, &cfg.PinErrorScanPerCycle)
+	config.SetIfNotDefault(jcfg.PinCallbackMaxRetries, &cfg.PinCallbackMaxRetries)
+	cfg.PinCallbackURL = jcfg.PinCallbackURL
+	cfg.PinCallbackAllowedHosts = jcfg.PinCallbackAllowedHosts
+	cfg.PinCallbackSecret = jcfg.PinCallbackSecret
+	cfg.AntiAffinity = jcfg.AntiAffinity
+	cfg.Spread = jcfg.Spread
+	cfg.Quotas = jcfg.Quotas
 
 	err = config.ParseDurations("cluster",
 		&config.DurationOpt{Duration: jcfg.DialPeerTimeout, Dst: &cfg.DialPeerTimeout, Name: "dial_peer_timeout"},
@@ -452,6 +710,13 @@ func (cfg *Config) applyConfigJSON(jcfg *configJSON) error {
 		&config.DurationOpt{Duration: jcfg.MonitorPingInterval, Dst: &cfg.MonitorPingInterval, Name: "monitor_ping_interval"},
 		&config.DurationOpt{Duration: jcfg.PeerWatchInterval, Dst: &cfg.PeerWatchInterval, Name: "peer_watch_interval"},
 		&config.DurationOpt{Duration: jcfg.MDNSInterval, Dst: &cfg.MDNSInterval, Name: "mdns_interval"},
+		&config.DurationOpt{Duration: jcfg.RebalanceInterval, Dst: &cfg.RebalanceInterval, Name: "rebalance_interval"},
+		&config.DurationOpt{Duration: jcfg.RebalanceMigrationTimeout, Dst: &cfg.RebalanceMigrationTimeout, Name: "rebalance_migration_timeout"},
+		&config.DurationOpt{Duration: jcfg.MaintenanceWindow, Dst: &cfg.MaintenanceWindow, Name: "maintenance_window"},
+		&config.DurationOpt{Duration: jcfg.PinErrorReallocateAge, Dst: &cfg.PinErrorReallocateAge, Name: "pin_error_reallocate_age"},
+		&config.DurationOpt{Duration: jcfg.PinCallbackTimeout, Dst: &cfg.PinCallbackTimeout, Name: "pin_callback_timeout"},
+		&config.DurationOpt{Duration: jcfg.PinCallbackCheckInterval, Dst: &cfg.PinCallbackCheckInterval, Name: "pin_callback_check_interval"},
+		&config.DurationOpt{Duration: jcfg.PinCallbackRetryBackoff, Dst: &cfg.PinCallbackRetryBackoff, Name: "pin_callback_retry_backoff"},
 	)
 	if err != nil {
 		return err
@@ -502,6 +767,8 @@ func (cfg *Config) toConfigJSON() (jcfg *configJSON, err error) {
 	jcfg.Secret = EncodeProtectorKey(cfg.Secret)
 	jcfg.ReplicationFactorMin = cfg.ReplicationFactorMin
 	jcfg.ReplicationFactorMax = cfg.ReplicationFactorMax
+	jcfg.AntiAffinity = cfg.AntiAffinity
+	jcfg.Spread = cfg.Spread
 	jcfg.LeaveOnShutdown = cfg.LeaveOnShutdown
 	var listenAddrs ipfsconfig.Strings
 	for _, addr := range cfg.ListenAddr {
@@ -522,6 +789,23 @@ func (cfg *Config) toConfigJSON() (jcfg *configJSON, err error) {
 	jcfg.MDNSInterval = cfg.MDNSInterval.String()
 	jcfg.PinOnlyOnTrustedPeers = cfg.PinOnlyOnTrustedPeers
 	jcfg.DisableRepinning = cfg.DisableRepinning
+	jcfg.RebalanceInterval = cfg.RebalanceInterval.String()
+	jcfg.RebalancePinsPerCycle = cfg.RebalancePinsPerCycle
+	jcfg.RebalanceScanPerCycle = cfg.RebalanceScanPerCycle
+	jcfg.RebalanceThreshold = cfg.RebalanceThreshold
+	jcfg.RebalanceMigrationTimeout = cfg.RebalanceMigrationTimeout.String()
+	jcfg.MaintenanceWindow = cfg.MaintenanceWindow.String()
+	jcfg.PinErrorReallocateAttempts = cfg.PinErrorReallocateAttempts
+	jcfg.PinErrorReallocateAge = cfg.PinErrorReallocateAge.String()
+	jcfg.PinErrorScanPerCycle = cfg.PinErrorScanPerCycle
+	jcfg.PinCallbackURL = cfg.PinCallbackURL
+	jcfg.PinCallbackAllowedHosts = cfg.PinCallbackAllowedHosts
+	jcfg.PinCallbackSecret = cfg.PinCallbackSecret
+	jcfg.PinCallbackTimeout = cfg.PinCallbackTimeout.String()
+	jcfg.PinCallbackCheckInterval = cfg.PinCallbackCheckInterval.String()
+	jcfg.PinCallbackMaxRetries = cfg.PinCallbackMaxRetries
+	jcfg.PinCallbackRetryBackoff = cfg.PinCallbackRetryBackoff.String()
+	jcfg.Quotas = cfg.Quotas
 	jcfg.PeerstoreFile = cfg.PeerstoreFile
 	jcfg.PeerAddresses = []string{}
 	for _, addr := range cfg.PeerAddresses {
@@ -199,6 +199,139 @@ func TestLoadJSON(t *testing.T) {
 		}
 	})
 
+	t.Run("placement constraints", func(t *testing.T) {
+		cfg, err := loadJSON2(
+			t,
+			func(j *configJSON) {
+				j.AntiAffinity = []string{"tag:rack"}
+				j.Spread = []string{"tag:region"}
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cfg.AntiAffinity) != 1 || cfg.AntiAffinity[0] != "tag:rack" {
+			t.Error("expected anti_affinity to be set")
+		}
+		if len(cfg.Spread) != 1 || cfg.Spread[0] != "tag:region" {
+			t.Error("expected spread to be set")
+		}
+	})
+
+	t.Run("rebalancer", func(t *testing.T) {
+		cfg, err := loadJSON2(
+			t,
+			func(j *configJSON) {
+				j.RebalanceInterval = "1h"
+				j.RebalancePinsPerCycle = 50
+				j.RebalanceThreshold = 0.25
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.RebalanceInterval != time.Hour || cfg.RebalancePinsPerCycle != 50 {
+			t.Error("expected rebalancer options to be set")
+		}
+		if cfg.RebalanceMigrationTimeout != DefaultRebalanceMigrationTimeout {
+			t.Error("expected default rebalance_migration_timeout")
+		}
+		if cfg.RebalanceScanPerCycle != DefaultRebalanceScanPerCycle {
+			t.Error("expected default rebalance_scan_per_cycle")
+		}
+		if cfg.RebalanceThreshold != 0.25 {
+			t.Error("expected rebalance_threshold to be set")
+		}
+	})
+
+	t.Run("maintenance window", func(t *testing.T) {
+		cfg, err := loadJSON2(
+			t,
+			func(j *configJSON) {
+				j.MaintenanceWindow = "6h"
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.MaintenanceWindow != 6*time.Hour {
+			t.Error("expected maintenance_window to be set")
+		}
+	})
+
+	t.Run("pin error reallocation", func(t *testing.T) {
+		cfg, err := loadJSON2(
+			t,
+			func(j *configJSON) {
+				j.PinErrorReallocateAttempts = 5
+				j.PinErrorReallocateAge = "2h"
+				j.PinErrorScanPerCycle = 20
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.PinErrorReallocateAttempts != 5 {
+			t.Error("expected pin_error_reallocate_attempts to be set")
+		}
+		if cfg.PinErrorReallocateAge != 2*time.Hour {
+			t.Error("expected pin_error_reallocate_age to be set")
+		}
+		if cfg.PinErrorScanPerCycle != 20 {
+			t.Error("expected pin_error_scan_per_cycle to be set")
+		}
+	})
+
+	t.Run("pin callbacks", func(t *testing.T) {
+		cfg, err := loadJSON2(
+			t,
+			func(j *configJSON) {
+				j.PinCallbackURL = "https://example.com/callback"
+				j.PinCallbackAllowedHosts = []string{"example.org"}
+				j.PinCallbackSecret = "abc"
+				j.PinCallbackTimeout = "1h"
+				j.PinCallbackCheckInterval = "30s"
+				j.PinCallbackMaxRetries = 5
+				j.PinCallbackRetryBackoff = "5s"
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.PinCallbackURL != "https://example.com/callback" || cfg.PinCallbackSecret != "abc" {
+			t.Error("expected pin_callback_url and pin_callback_secret to be set")
+		}
+		if len(cfg.PinCallbackAllowedHosts) != 1 || cfg.PinCallbackAllowedHosts[0] != "example.org" {
+			t.Error("expected pin_callback_allowed_hosts to be set")
+		}
+		if cfg.PinCallbackTimeout != time.Hour || cfg.PinCallbackCheckInterval != 30*time.Second {
+			t.Error("expected pin_callback_timeout and pin_callback_check_interval to be set")
+		}
+		if cfg.PinCallbackMaxRetries != 5 || cfg.PinCallbackRetryBackoff != 5*time.Second {
+			t.Error("expected pin_callback_max_retries and pin_callback_retry_backoff to be set")
+		}
+
+		_, err = loadJSON2(
+			t,
+			func(j *configJSON) {
+				j.PinCallbackURL = "example.com"
+			},
+		)
+		if err == nil {
+			t.Error("expected an error with an invalid pin_callback_url")
+		}
+
+		_, err = loadJSON2(
+			t,
+			func(j *configJSON) {
+				j.PinCallbackAllowedHosts = []string{""}
+			},
+		)
+		if err == nil {
+			t.Error("expected an error with an empty pin_callback_allowed_hosts value")
+		}
+	})
+
 	t.Run("conn manager default", func(t *testing.T) {
 		cfg, err := loadJSON2(
 			t,
@@ -283,4 +416,86 @@ func TestValidate(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.Spread = []string{""}
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.RebalanceInterval = time.Minute
+	cfg.RebalancePinsPerCycle = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.RebalanceInterval = time.Minute
+	cfg.RebalanceScanPerCycle = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.RebalanceInterval = time.Minute
+	cfg.RebalanceThreshold = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.MaintenanceWindow = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PinErrorReallocateAttempts = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PinErrorReallocateAge = -time.Minute
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PinErrorReallocateAttempts = 3
+	cfg.PinErrorScanPerCycle = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PinCallbackTimeout = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PinCallbackCheckInterval = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PinCallbackMaxRetries = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.Quotas = map[string]Quota{"": {MaxPins: 1}}
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.Quotas = map[string]Quota{"alice": {MaxPins: -1}}
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
 }
@@ -2,14 +2,19 @@ package ipfscluster
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/lubanproj/ipfs-cluster/adder"
 	"github.com/lubanproj/ipfs-cluster/adder/sharding"
 	"github.com/lubanproj/ipfs-cluster/allocator/balanced"
 	"github.com/lubanproj/ipfs-cluster/api"
@@ -21,9 +26,12 @@ import (
 	"github.com/lubanproj/ipfs-cluster/test"
 	"github.com/lubanproj/ipfs-cluster/version"
 
+	cid "github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
 	gopath "github.com/ipfs/go-path"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
+	mh "github.com/multiformats/go-multihash"
 )
 
 type mockComponent struct {
@@ -148,10 +156,43 @@ func (ipfs *mockConnector) BlockGet(ctx context.Context, c api.Cid) ([]byte, err
 	return d.([]byte), nil
 }
 
+func (ipfs *mockConnector) BlockRm(ctx context.Context, c api.Cid) error {
+	ipfs.blocks.Delete(c.String())
+	return nil
+}
+
+func (ipfs *mockConnector) DAGSize(ctx context.Context, c api.Cid) (uint64, error) {
+	return test.DAGSize, nil
+}
+
+func (ipfs *mockConnector) VerifyDAG(ctx context.Context, pin api.Pin) (api.IPFSVerification, error) {
+	return api.IPFSVerification{Cid: pin.Cid, Blocks: 1}, nil
+}
+
 type mockTracer struct {
 	mockComponent
 }
 
+type mockDispatcher struct {
+	mockComponent
+
+	mu     sync.Mutex
+	alerts []api.Alert
+}
+
+func (d *mockDispatcher) Dispatch(ctx context.Context, alrt api.Alert) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.alerts = append(d.alerts, alrt)
+	return nil
+}
+
+func (d *mockDispatcher) dispatched() []api.Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]api.Alert{}, d.alerts...)
+}
+
 func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, PinTracker) {
 	ident, clusterCfg, _, _, _, badgerCfg, levelDBCfg, raftCfg, crdtCfg, statelesstrackerCfg, psmonCfg, _, _, _ := testingConfigs()
 	ctx := context.Background()
@@ -170,6 +211,7 @@ func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, PinTracke
 	ipfs := &mockConnector{}
 
 	tracer := &mockTracer{}
+	dispatcher := &mockDispatcher{}
 
 	store := makeStore(t, badgerCfg, levelDBCfg)
 	cons := makeConsensus(t, store, host, pubsub, dht, raftCfg, false, crdtCfg)
@@ -211,6 +253,7 @@ func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, PinTracke
 		alloc,
 		[]Informer{inf},
 		tracer,
+		dispatcher,
 	)
 	if err != nil {
 		t.Fatal("cannot create cluster:", err)
@@ -322,6 +365,550 @@ func TestClusterPin(t *testing.T) {
 	}
 }
 
+func TestClusterPinOwner(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	cl.config.Quotas = map[string]Quota{"alice": {MaxSize: 10 * test.DAGSize}}
+
+	res, err := cl.Pin(ctx, test.Cid1, api.PinOptions{Owner: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Owner != "alice" || res.Size != test.DAGSize {
+		t.Errorf("expected the owner and size to be recorded: %s %d", res.Owner, res.Size)
+	}
+
+	// Repinning keeps the original owner and the size.
+	res, err = cl.Pin(ctx, test.Cid1, api.PinOptions{Owner: "bob", Name: "renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Owner != "alice" || res.Size != test.DAGSize {
+		t.Errorf("expected the owner and size to be kept: %s %d", res.Owner, res.Size)
+	}
+
+	// Unowned pins, and pins of owners without a size quota, do not
+	// record a size.
+	res, err = cl.Pin(ctx, test.Cid2, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Owner != "" || res.Size != 0 {
+		t.Errorf("unexpected owner or size: %s %d", res.Owner, res.Size)
+	}
+	res, err = cl.Pin(ctx, test.Cid3, api.PinOptions{Owner: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Owner != "bob" || res.Size != 0 {
+		t.Errorf("unexpected owner or size: %s %d", res.Owner, res.Size)
+	}
+}
+
+func TestClusterPinQuota(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	cl.config.Quotas = map[string]Quota{
+		"alice": {MaxPins: 1, MaxSize: 10 * test.DAGSize},
+		"bob":   {MaxSize: test.DAGSize},
+	}
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{Owner: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Pin(ctx, test.Cid2, api.PinOptions{Owner: "alice"})
+	if !errors.Is(err, api.ErrQuotaExceeded) {
+		t.Fatal("expected the pin quota to be exceeded:", err)
+	}
+
+	// Repinning does not count twice.
+	_, err = cl.Pin(ctx, test.Cid1, api.PinOptions{Owner: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := cl.Usage(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Pins != 1 || usage.Size != test.DAGSize || usage.MaxPins != 1 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+
+	_, err = cl.Pin(ctx, test.Cid2, api.PinOptions{Owner: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Pin(ctx, test.Cid3, api.PinOptions{Owner: "bob"})
+	if !errors.Is(err, api.ErrQuotaExceeded) {
+		t.Fatal("expected the size quota to be exceeded:", err)
+	}
+
+	// Unpinning releases the quota.
+	_, err = cl.Unpin(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, err = cl.Usage(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Pins != 0 || usage.Size != 0 {
+		t.Errorf("expected the usage to be released: %+v", usage)
+	}
+	_, err = cl.Pin(ctx, test.Cid3, api.PinOptions{Owner: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClusterPinUpdateQuota(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	cl.config.Quotas = map[string]Quota{
+		"alice": {MaxPins: 1},
+		"bob":   {MaxPins: 1},
+	}
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{Owner: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Pin(ctx, test.Cid2, api.PinOptions{Owner: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Giving Cid1 to bob would exceed his quota.
+	_, err = cl.PinUpdate(ctx, test.Cid2, test.Cid1, api.PinOptions{Owner: "bob"})
+	if !errors.Is(err, api.ErrQuotaExceeded) {
+		t.Fatal("expected the pin quota to be exceeded:", err)
+	}
+	usage, err := cl.Usage(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Pins != 1 {
+		t.Errorf("a failed update should not change the usage: %+v", usage)
+	}
+
+	_, err = cl.Unpin(ctx, test.Cid2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Pin(ctx, test.Cid2, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The existing pin of Cid1 is no longer counted for alice.
+	_, err = cl.PinUpdate(ctx, test.Cid2, test.Cid1, api.PinOptions{Owner: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for user, pins := range map[string]int{"alice": 0, "bob": 1} {
+		usage, err := cl.Usage(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if usage.Pins != pins {
+			t.Errorf("unexpected usage for %s: %+v", user, usage)
+		}
+	}
+}
+
+func TestClusterAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	key, err := cl.APIKeyCreate(ctx, api.APIKey{
+		User:   "alice",
+		Scopes: []string{api.APIKeyScopePin},
+		Expiry: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID == "" || key.Token() == "" {
+		t.Fatal("expected the key to have an ID and a token")
+	}
+
+	_, err = cl.APIKeyCreate(ctx, api.APIKey{User: "alice", Scopes: []string{"all"}, Expiry: time.Now().Add(time.Hour)})
+	if err == nil {
+		t.Error("expected an error with an invalid scope")
+	}
+
+	verified, err := cl.APIKeyVerify(ctx, key.Token())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified.User != "alice" || !verified.HasScope(api.APIKeyScopePin) || verified.Secret != "" {
+		t.Errorf("unexpected verified key: %+v", verified)
+	}
+
+	_, secret, _ := api.ParseAPIKeyToken(key.Token())
+	wrong := api.APIKey{ID: key.ID, Secret: secret + "0"}
+	if _, err := cl.APIKeyVerify(ctx, wrong.Token()); err != ErrAPIKeyInvalid {
+		t.Error("expected an error with a wrong secret")
+	}
+
+	keys, err := cl.APIKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != key.ID || keys[0].LastUsed.IsZero() || keys[0].Secret != "" {
+		t.Errorf("unexpected keys: %+v", keys)
+	}
+
+	// Uses are only recorded once per apiKeyUseInterval.
+	lastUsed := keys[0].LastUsed
+	if _, err := cl.APIKeyVerify(ctx, key.Token()); err != nil {
+		t.Fatal(err)
+	}
+	keys, err = cl.APIKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || !keys[0].LastUsed.Equal(lastUsed) {
+		t.Errorf("the use of the key should not have been recorded again: %+v", keys)
+	}
+
+	err = cl.APIKeyRevoke(ctx, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.APIKeyVerify(ctx, key.Token()); err != ErrAPIKeyInvalid {
+		t.Error("revoked keys should not verify")
+	}
+	if err := cl.APIKeyRevoke(ctx, key.ID); err != ErrAPIKeyNotFound {
+		t.Error("expected an error revoking a missing key")
+	}
+	keys, err = cl.APIKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("expected no keys after revoking: %+v", keys)
+	}
+}
+
+func TestClusterEvents(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	evCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	filter := api.EventFilter{
+		Cids:  []api.Cid{test.Cid1},
+		Types: []api.EventType{api.EventPinsetAdd, api.EventPinned},
+	}
+	out := make(chan api.Event, 10)
+	go cl.Events(evCtx, filter, out)
+	time.Sleep(100 * time.Millisecond) // let it subscribe
+
+	_, err := cl.Pin(ctx, test.Cid2, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Pin(ctx, test.Cid1, api.PinOptions{Name: "events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, typ := range []api.EventType{api.EventPinsetAdd, api.EventPinned} {
+		select {
+		case ev := <-out:
+			if ev.Type != typ || !ev.Cid.Equals(test.Cid1) || ev.Name != "events" || ev.Peer != cl.id {
+				t.Errorf("unexpected event: %+v", ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s event", typ)
+		}
+	}
+
+	cancel()
+	for ev := range out {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+}
+
+func TestClusterPinCallback(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	cl.config.PinCallbackCheckInterval = 100 * time.Millisecond
+	cl.config.PinCallbackSecret = "secret"
+
+	callbacks := make(chan api.PinCallback, 10)
+	attempts := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts <- struct{}{}
+		// fail the first request to test retries.
+		if len(attempts) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if sig := r.Header.Get("X-Cluster-Signature"); sig != signPinCallback("secret", body) {
+			t.Error("bad signature:", sig)
+		}
+		var cb api.PinCallback
+		err = json.Unmarshal(body, &cb)
+		if err != nil {
+			t.Error(err)
+		}
+		callbacks <- cb
+	}))
+	defer srv.Close()
+	cl.config.PinCallbackRetryBackoff = 10 * time.Millisecond
+
+	waitCallback := func(h api.Cid) api.PinCallback {
+		select {
+		case cb := <-callbacks:
+			if !cb.Cid.Equals(h) {
+				t.Fatal("unexpected callback:", cb)
+			}
+			return cb
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for callback")
+		}
+		return api.PinCallback{}
+	}
+
+	// callback hosts must be allowed.
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{CallbackURL: srv.URL})
+	if err == nil {
+		t.Fatal("expected an error with a callback host which is not allowed")
+	}
+	cl.config.PinCallbackAllowedHosts = []string{"127.0.0.1"}
+
+	_, err = cl.Pin(ctx, test.Cid1, api.PinOptions{CallbackURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb := waitCallback(test.Cid1)
+	if cb.Type != api.EventPinned || cb.Pinned != 1 {
+		t.Errorf("unexpected callback: %+v", cb)
+	}
+	if len(attempts) != 2 {
+		t.Errorf("expected 2 attempts, got %d", len(attempts))
+	}
+
+	// The configured URL is used when pins do not set one.
+	cl.config.PinCallbackURL = srv.URL
+	_, err = cl.Pin(ctx, test.ErrorCid, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb = waitCallback(test.ErrorCid)
+	if cb.Type != api.EventError || cb.Pinned != 0 || cb.Error == "" {
+		t.Errorf("unexpected callback: %+v", cb)
+	}
+
+	// Unpinning cancels pending callbacks.
+	cl.config.PinCallbackCheckInterval = time.Second
+	_, err = cl.Pin(ctx, test.Cid2, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Unpin(ctx, test.Cid2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Redirects are not followed.
+	redirects := make(chan struct{}, 10)
+	redirSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirects <- struct{}{}
+		http.Redirect(w, r, srv.URL, http.StatusTemporaryRedirect)
+	}))
+	defer redirSrv.Close()
+	_, err = cl.Pin(ctx, test.Cid3, api.PinOptions{CallbackURL: redirSrv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case cb := <-callbacks:
+		t.Error("unexpected callback:", cb)
+	case <-time.After(3 * time.Second):
+	}
+	if len(redirects) != 1 {
+		t.Errorf("expected 1 request to the redirecting server, got %d", len(redirects))
+	}
+}
+
+func TestPinCallbackFor(t *testing.T) {
+	pin := api.PinCid(test.Cid1)
+	pin.ReplicationFactorMin = 2
+	pin.ReplicationFactorMax = 3
+	pin.Allocations = []peer.ID{test.PeerID1, test.PeerID2, test.PeerID3}
+
+	gpi := func(statuses ...api.TrackerStatus) api.GlobalPinInfo {
+		peers := []peer.ID{test.PeerID1, test.PeerID2, test.PeerID3, test.PeerID4}
+		gpi := api.GlobalPinInfo{
+			Cid:     test.Cid1,
+			PeerMap: make(map[string]api.PinInfoShort),
+		}
+		for i, st := range statuses {
+			gpi.PeerMap[peer.Encode(peers[i])] = api.PinInfoShort{Status: st}
+		}
+		return gpi
+	}
+
+	testcases := []struct {
+		gpi  api.GlobalPinInfo
+		done bool
+		typ  api.EventType
+	}{
+		{gpi(api.TrackerStatusPinning, api.TrackerStatusPinQueued, api.TrackerStatusPinned, api.TrackerStatusRemote), false, ""},
+		{gpi(api.TrackerStatusPinned, api.TrackerStatusPinError, api.TrackerStatusPinning, api.TrackerStatusRemote), false, ""},
+		{gpi(api.TrackerStatusPinned, api.TrackerStatusPinError, api.TrackerStatusPinned, api.TrackerStatusRemote), true, api.EventPinned},
+		{gpi(api.TrackerStatusPinned, api.TrackerStatusPinError, api.TrackerStatusPinError, api.TrackerStatusRemote), true, api.EventError},
+	}
+
+	for i, tc := range testcases {
+		cb, done := pinCallbackFor(pin, tc.gpi)
+		if done != tc.done || cb.Type != tc.typ {
+			t.Errorf("testcase %d: unexpected result %t, %s", i, done, cb.Type)
+		}
+	}
+}
+
+func TestClusterPinPlacement(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	cl.config.AntiAffinity = []string{"numpin"}
+	// wait for the numpin metric to be available for allocations.
+	for i := 0; len(cl.monitor.LatestMetrics(ctx, "numpin")) == 0; i++ {
+		if i == 50 {
+			t.Fatal("numpin metric not received")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	res, err := cl.Pin(ctx, test.Cid1, api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+	})
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	if len(res.AntiAffinity) != 1 || res.AntiAffinity[0] != "numpin" {
+		t.Error("default anti-affinity should have been set")
+	}
+	if len(res.Allocations) != 1 || res.Allocations[0] != cl.id {
+		t.Error("pin should be allocated to the only peer")
+	}
+
+	res, err = cl.Pin(ctx, test.Cid2, api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+		Spread:               []string{"numpin"},
+	})
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	if len(res.AntiAffinity) != 0 {
+		t.Error("pin constraints should override the defaults")
+	}
+
+	_, err = cl.Pin(ctx, test.Cid3, api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+		Spread:               []string{""},
+	})
+	if err == nil {
+		t.Error("expected an error with an empty metric name")
+	}
+}
+
+func TestClusterAllocationPreview(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	for i := 0; len(cl.monitor.LatestMetrics(ctx, "numpin")) == 0; i++ {
+		if i == 50 {
+			t.Fatal("numpin metric not received")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	opts := api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+	}
+	preview, err := cl.AllocationPreview(ctx, test.Cid1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Error != "" {
+		t.Fatal(preview.Error)
+	}
+	if len(preview.Allocations) != 1 || preview.Allocations[0] != cl.id {
+		t.Errorf("unexpected allocations: %s", preview.Allocations)
+	}
+	if len(preview.Peers) != 1 {
+		t.Fatalf("expected a single peer report: %+v", preview.Peers)
+	}
+	report := preview.Peers[0]
+	if !report.Chosen || report.Rank != 1 || report.Group != api.AllocationGroupCandidate || len(report.Metrics) != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	_, err = cl.PinGet(ctx, test.Cid1)
+	if err != state.ErrNotFound {
+		t.Error("a preview should not pin anything")
+	}
+
+	_, err = cl.Pin(ctx, test.Cid1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview, err = cl.AllocationPreview(ctx, test.Cid1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := preview.Peers[0]; report.Group != api.AllocationGroupCurrent || !report.Chosen {
+		t.Errorf("expected the current allocation to be kept: %+v", report)
+	}
+
+	opts.ReplicationFactorMin = 2
+	opts.ReplicationFactorMax = 2
+	preview, err = cl.AllocationPreview(ctx, api.CidUndef, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Error == "" {
+		t.Error("expected an allocation error in the preview")
+	}
+}
+
 func TestPinExpired(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
@@ -499,6 +1086,132 @@ func TestUnpinShard(t *testing.T) {
 	})
 }
 
+func TestUnpinSharedShard(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+	sth := test.NewShardingTestHelper()
+	defer sth.Clean(t)
+
+	params := api.DefaultAddParams()
+	params.Shard = true
+	params.ShardSize = 1024 * 300 // so that there are several shards
+	params.Name = "testshard"
+	mfr, closer := sth.GetTreeMultiReader(t)
+	defer closer.Close()
+	r := multipart.NewReader(mfr, mfr.Boundary())
+	root, err := cl.AddFile(ctx, r, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinDelay()
+
+	metaPin, err := cl.PinGet(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cDagBlock, err := cl.ipfs.BlockGet(ctx, *metaPin.Reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cDagNode, err := sharding.CborDataToNode(cDagBlock, "cbor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := api.NewCid(cDagNode.Links()[0].Cid)
+	notShared := api.NewCid(cDagNode.Links()[1].Cid)
+
+	// Build a second sharded DAG which re-uses the first shard.
+	cDag2Node, err := cbor.WrapObject(
+		map[string]cid.Cid{"0": shared.Cid},
+		mh.SHA2_256,
+		-1,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := make(chan api.NodeWithMeta, 1)
+	blocks <- adder.IpldNodeToNodeWithMeta(cDag2Node)
+	close(blocks)
+	err = cl.ipfs.BlockStream(ctx, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta2 := test.Cid4
+	cDag2 := api.PinWithOpts(api.NewCid(cDag2Node.Cid()), api.PinOptions{
+		ReplicationFactorMin: -1,
+		ReplicationFactorMax: -1,
+	})
+	cDag2.Type = api.ClusterDAGType
+	cDag2.MaxDepth = 0
+	cDag2.Reference = &meta2
+	_, _, err = cl.pin(ctx, cDag2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaPin2 := api.PinWithOpts(meta2, api.PinOptions{})
+	metaPin2.Type = api.MetaType
+	metaPin2.Reference = &cDag2.Cid
+	_, _, err = cl.pin(ctx, metaPin2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinDelay()
+
+	parents, err := cl.PinParents(ctx, shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parents) != 2 {
+		t.Fatal("shared shard should have two parents")
+	}
+	parents, err = cl.PinParents(ctx, notShared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parents) != 1 || !parents[0].Cid.Equals(root) {
+		t.Fatal("unshared shard should have the first meta-pin as parent")
+	}
+
+	_, err = cl.Unpin(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinDelay()
+
+	sharedPin, err := cl.PinGet(ctx, shared)
+	if err != nil {
+		t.Fatal("shard referenced by the second meta-pin should not be unpinned")
+	}
+	if len(sharedPin.Parents) != 1 || !sharedPin.Parents[0].Equals(meta2) {
+		t.Error("shared shard should only reference the second meta-pin")
+	}
+	if _, err := cl.PinGet(ctx, notShared); err != state.ErrNotFound {
+		t.Error("shard only referenced by the unpinned meta-pin should be unpinned")
+	}
+	if _, err := cl.PinGet(ctx, root); err != state.ErrNotFound {
+		t.Error("meta-pin should be unpinned")
+	}
+
+	_, err = cl.Unpin(ctx, meta2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinDelay()
+
+	for _, c := range []api.Cid{shared, cDag2.Cid, meta2} {
+		if _, err := cl.PinGet(ctx, c); err != state.ErrNotFound {
+			t.Errorf("%s should have been unpinned", c)
+		}
+	}
+}
+
 // func singleShardedPin(t *testing.T, cl *Cluster) {
 // 	cShard, _ := cid.Decode(test.ShardCid)
 // 	cCdag, _ := cid.Decode(test.CdagCid)
@@ -810,6 +1523,58 @@ func TestClusterPins(t *testing.T) {
 	}
 }
 
+func TestClusterPinsQuery(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	names := []string{"pin-0", "pin-1", "pin-0", "pin-1"}
+	for i, ci := range []api.Cid{test.Cid1, test.Cid2, test.Cid3, test.Cid4} {
+		_, err := cl.Pin(ctx, ci, api.PinOptions{Name: names[i]})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pinDelay()
+
+	query := func(q api.PinQuery) []api.Pin {
+		out := make(chan api.Pin, 10)
+		err := cl.PinsQuery(ctx, q, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pins []api.Pin
+		for p := range out {
+			pins = append(pins, p)
+		}
+		return pins
+	}
+
+	if pins := query(api.PinQuery{Name: "pin-1"}); len(pins) != 2 {
+		t.Errorf("expected 2 pins named pin-1, got %d", len(pins))
+	}
+
+	// Go through the pinset in pages of one pin.
+	seen := make(map[api.Cid]struct{})
+	q := api.PinQuery{Limit: 1}
+	for i := 0; i < 5; i++ {
+		pins := query(q)
+		if len(pins) == 0 {
+			break
+		}
+		if len(pins) != 1 {
+			t.Fatal("expected a single pin per page")
+		}
+		seen[pins[0].Cid] = struct{}{}
+		q.Cursor = pins[0].Cid
+	}
+	if len(seen) != 4 {
+		t.Errorf("expected to page through 4 pins, got %d", len(seen))
+	}
+}
+
 func TestClusterPinGet(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
@@ -871,6 +1636,116 @@ func TestClusterUnpin(t *testing.T) {
 	}
 }
 
+func TestClusterCollections(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	opts := api.PinOptions{
+		ReplicationFactorMin: -1,
+		ReplicationFactorMax: -1,
+		Priority:             2,
+	}
+	coll, err := cl.CollectionCreate(ctx, "photos", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coll.Type != api.CollectionType || coll.Name != "photos" {
+		t.Error("unexpected collection")
+	}
+	_, err = cl.CollectionCreate(ctx, "photos", opts)
+	if err != ErrCollectionExists {
+		t.Error("creating a collection twice should fail")
+	}
+	other, err := cl.CollectionCreate(ctx, "other", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cid1 was pinned before and keeps its name and metadata.
+	_, err = cl.Pin(ctx, test.Cid1, api.PinOptions{
+		Name:     "one",
+		Metadata: map[string]string{"kind": "raw"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins, err := cl.CollectionAdd(ctx, "photos", []api.Cid{test.Cid1, test.Cid2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 2 {
+		t.Fatal("expected two members")
+	}
+	for _, p := range pins {
+		if !p.HasParent(coll.Cid) || p.Priority != 2 || !p.IsPinEverywhere() {
+			t.Errorf("%s should use the collection options", p.Cid)
+		}
+	}
+	if pins[0].Name != "one" || pins[0].Metadata["kind"] != "raw" {
+		t.Error("members should keep their name and metadata")
+	}
+	_, err = cl.CollectionAdd(ctx, "other", []api.Cid{test.Cid2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Unpin(ctx, test.Cid2)
+	if err == nil {
+		t.Error("collection members cannot be unpinned directly")
+	}
+	_, err = cl.CollectionAdd(ctx, "photos", []api.Cid{coll.Cid})
+	if err == nil {
+		t.Error("collections cannot be members")
+	}
+	_, err = cl.CollectionAdd(ctx, "missing", []api.Cid{test.Cid3})
+	if err == nil {
+		t.Error("adding to a missing collection should fail")
+	}
+
+	pinDelay()
+
+	gpi, err := cl.CollectionStatus(ctx, "photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gpi.Cid.Equals(coll.Cid) || gpi.Name != "photos" {
+		t.Error("unexpected collection status")
+	}
+	pi, ok := gpi.PeerMap[peer.Encode(cl.id)]
+	if !ok || pi.Status != api.TrackerStatusPinned {
+		t.Error("collection should be pinned")
+	}
+	if st := cl.StatusLocal(ctx, coll.Cid); st.Status != api.TrackerStatusRemote {
+		t.Error("collections are not pinned in IPFS")
+	}
+
+	// Cid1 is only in photos, so it is unpinned.
+	err = cl.CollectionRemove(ctx, "photos", []api.Cid{test.Cid1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.PinGet(ctx, test.Cid1); err != state.ErrNotFound {
+		t.Error("cid1 should have been unpinned")
+	}
+
+	// Cid2 stays pinned as part of other.
+	_, err = cl.Unpin(ctx, coll.Cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.PinGet(ctx, coll.Cid); err != state.ErrNotFound {
+		t.Error("the collection should have been removed")
+	}
+	p, err := cl.PinGet(ctx, test.Cid2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Parents) != 1 || !p.HasParent(other.Cid) {
+		t.Error("cid2 should only belong to the other collection")
+	}
+}
+
 func TestClusterUnpinPath(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
@@ -964,6 +1839,46 @@ func TestClusterRecoverAllLocal(t *testing.T) {
 	// Recovery will fail, but the pin appearing in the response is good enough to know it was requeued.
 }
 
+func TestClusterAlertDispatcher(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.MaintenanceStart(ctx, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendAlert := func(name string, pid peer.ID) {
+		alrt := api.Alert{
+			Metric: api.Metric{
+				Name:  name,
+				Peer:  pid,
+				Valid: true,
+			},
+			TriggeredAt: time.Now(),
+		}
+		err := cl.monitor.SendAlert(ctx, alrt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sendAlert("scrub", test.PeerID1)
+	sendAlert(pingMetricName, test.PeerID1)
+	sendAlert(pingMetricName, cl.id)
+	time.Sleep(500 * time.Millisecond)
+
+	// Ping alerts for peers in maintenance are not dispatched.
+	dispatched := cl.dispatcher.(*mockDispatcher).dispatched()
+	if len(dispatched) != 2 || dispatched[0].Name != "scrub" || dispatched[1].Name != pingMetricName || dispatched[1].Peer != test.PeerID1 {
+		t.Errorf("expected the scrub and ping alerts for %s to be dispatched: %v", test.PeerID1, dispatched)
+	}
+	if len(cl.Alerts()) != 3 {
+		t.Error("all alerts should have been recorded")
+	}
+}
+
 func TestClusterRepoGC(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
@@ -58,6 +58,10 @@ func jsonFormatPrint(obj interface{}) {
 		for o := range r {
 			print(o)
 		}
+	case chan api.ReplicationReport:
+		for o := range r {
+			print(o)
+		}
 	default:
 		print(obj)
 	}
@@ -88,6 +92,20 @@ func textFormatObject(resp interface{}) {
 		textFormatPrintMetric(r)
 	case api.Alert:
 		textFormatPrintAlert(r)
+	case api.AllocationPreview:
+		textFormatPrintAllocationPreview(r)
+	case api.RebalanceStatus:
+		textFormatPrintRebalanceStatus(r)
+	case api.Usage:
+		textFormatPrintUsage(r)
+	case api.APIKey:
+		textFormatPrintAPIKey(r)
+	case api.DrainStatus:
+		textFormatPrintDrainStatus(r)
+	case api.MaintenanceStatus:
+		textFormatPrintMaintenanceStatus(r)
+	case api.ReplicationReport:
+		textFormatPrintReplicationReport(r)
 	case chan api.ID:
 		for item := range r {
 			textFormatObject(item)
@@ -100,6 +118,22 @@ func textFormatObject(resp interface{}) {
 		for item := range r {
 			textFormatObject(item)
 		}
+	case chan api.ReplicationReport:
+		counts := make(map[string]int)
+		for item := range r {
+			counts[item.State]++
+			textFormatObject(item)
+		}
+		fmt.Printf(
+			"Under-replicated: %d | Over-replicated: %d | Unavailable: %d\n",
+			counts[api.ReplicationUnder],
+			counts[api.ReplicationOver],
+			counts[api.ReplicationUnavailable],
+		)
+	case []api.Pin:
+		for _, item := range r {
+			textFormatObject(item)
+		}
 	case []api.AddedOutput:
 		for _, item := range r {
 			textFormatObject(item)
@@ -122,22 +156,32 @@ func textFormatObject(resp interface{}) {
 		for _, item := range r {
 			textFormatObject(item)
 		}
+	case []api.APIKey:
+		for _, item := range r {
+			textFormatObject(item)
+		}
 	default:
 		checkErr("", errors.New("unsupported type returned"+reflect.TypeOf(r).String()))
 	}
 }
 
 func textFormatPrintID(obj api.ID) {
+	maintenance := ""
+	if m := obj.Maintenance; m != nil && m.Enabled {
+		maintenance = fmt.Sprintf(" | MAINTENANCE (ends %s)", humanize.Time(m.Until))
+	}
+
 	if obj.Error != "" {
-		fmt.Printf("%s | ERROR: %s\n", obj.ID.Pretty(), obj.Error)
+		fmt.Printf("%s | ERROR: %s%s\n", obj.ID.Pretty(), obj.Error, maintenance)
 		return
 	}
 
 	fmt.Printf(
-		"%s | %s | Sees %d other peers\n",
+		"%s | %s | Sees %d other peers%s\n",
 		obj.ID.Pretty(),
 		obj.Peername,
 		len(obj.ClusterPeers)-1,
+		maintenance,
 	)
 
 	addrs := make(sort.StringSlice, 0, len(obj.Addresses))
@@ -245,6 +289,22 @@ func textFormatPrintPin(obj api.Pin) {
 	}
 	fmt.Printf(" | Exp: %s", expireAt)
 
+	if obj.Priority != 0 {
+		fmt.Printf(" | Priority: %d", obj.Priority)
+	}
+
+	if len(obj.AntiAffinity) > 0 {
+		fmt.Printf(" | Anti-affinity: %s", strings.Join(obj.AntiAffinity, ","))
+	}
+
+	if len(obj.Spread) > 0 {
+		fmt.Printf(" | Spread: %s", strings.Join(obj.Spread, ","))
+	}
+
+	if obj.Owner != "" {
+		fmt.Printf(" | Owner: %s", obj.Owner)
+	}
+
 	added := "unknown"
 	if !obj.Timestamp.IsZero() {
 		added = obj.Timestamp.Format("2006-01-02 15:04:05")
@@ -282,6 +342,162 @@ func textFormatPrintAlert(obj api.Alert) {
 	)
 }
 
+func textFormatPrintAllocationPreview(obj api.AllocationPreview) {
+	cid := "<new content>"
+	if obj.Cid.Defined() {
+		cid = obj.Cid.String()
+	}
+	fmt.Printf("%s | Repl. Factor: %d--%d\n", cid, obj.ReplicationFactorMin, obj.ReplicationFactorMax)
+	if obj.Error != "" {
+		fmt.Printf("  > ERROR: %s\n", obj.Error)
+	}
+	if obj.ReplicationFactorMin < 0 {
+		fmt.Println("  > Allocations: [everywhere]")
+		return
+	}
+	fmt.Printf("  > Allocations: %s\n", obj.Allocations)
+
+	for _, r := range obj.Peers {
+		chosen := " "
+		if r.Chosen {
+			chosen = "*"
+		}
+		fmt.Printf("  %s %s | %s", chosen, peer.Encode(r.Peer), r.Group)
+		if r.Rank > 0 {
+			fmt.Printf(" | Rank: %d", r.Rank)
+		}
+		if r.Partition != "" {
+			fmt.Printf(" | Partition: %s", r.Partition)
+		}
+		fmt.Printf(" | %s\n", r.Reason)
+		for _, m := range r.Metrics {
+			v := m.Value
+			if m.Name == "freespace" && m.Weight > 0 {
+				v = humanize.Bytes(uint64(m.Weight))
+			}
+			fmt.Printf("      - %s: %s\n", m.Name, v)
+		}
+	}
+}
+
+func textFormatPrintUsage(obj api.Usage) {
+	pins := fmt.Sprintf("%d", obj.Pins)
+	if obj.MaxPins > 0 {
+		pins += fmt.Sprintf(" / %d", obj.MaxPins)
+	}
+	size := humanize.Bytes(obj.Size)
+	if obj.MaxSize > 0 {
+		size += " / " + humanize.Bytes(obj.MaxSize)
+	}
+	fmt.Printf("%s | Pins: %s | Size: %s\n", obj.User, pins, size)
+}
+
+func textFormatPrintAPIKey(obj api.APIKey) {
+	lastUsed := "never"
+	if !obj.LastUsed.IsZero() {
+		lastUsed = humanize.Time(obj.LastUsed)
+	}
+	expiry := "expires " + humanize.Time(obj.Expiry)
+	if obj.Expired() {
+		expiry = "EXPIRED"
+	}
+	fmt.Printf("%s | %s | Scopes: %s | %s | Last used: %s\n",
+		obj.ID,
+		obj.User,
+		strings.Join(obj.Scopes, ","),
+		expiry,
+		lastUsed,
+	)
+	if token := obj.Token(); token != "" {
+		fmt.Printf("  > Token: %s\n", token)
+	}
+}
+
+func textFormatPrintRebalanceStatus(obj api.RebalanceStatus) {
+	if !obj.Enabled {
+		fmt.Printf("%s | Rebalancer: disabled\n", peer.Encode(obj.Peer))
+		return
+	}
+
+	state := "idle"
+	if obj.Running {
+		state = "running"
+	}
+	fmt.Printf("%s | Rebalancer: %s\n", peer.Encode(obj.Peer), state)
+	if !obj.LastRun.IsZero() {
+		fmt.Printf("  > Last run: %s\n", humanize.Time(obj.LastRun))
+	}
+	if !obj.NextRun.IsZero() {
+		fmt.Printf("  > Next run: %s\n", humanize.Time(obj.NextRun))
+	}
+	fmt.Printf("  > Misplaced pins found: %d\n", obj.Pending)
+	if obj.Migrating.Defined() {
+		fmt.Printf("  > Migrating: %s\n", obj.Migrating)
+	}
+	fmt.Printf("  > Migrated: %d | Failed: %d\n", obj.Migrated, obj.Failed)
+	if obj.LastError != "" {
+		fmt.Printf("  > Last error: %s\n", obj.LastError)
+	}
+}
+
+func textFormatPrintDrainStatus(obj api.DrainStatus) {
+	remove := ""
+	if obj.Remove {
+		remove = " (remove when done)"
+	}
+	fmt.Printf("%s | Drain: %s%s | Coordinator: %s\n", peer.Encode(obj.Peer), obj.Phase, remove, peer.Encode(obj.Coordinator))
+	fmt.Printf("  > Started: %s\n", humanize.Time(obj.Started))
+	if !obj.Finished.IsZero() {
+		fmt.Printf("  > Finished: %s\n", humanize.Time(obj.Finished))
+	}
+	fmt.Printf("  > Pins: %d | Moved: %d | Failed: %d\n", obj.Pins, obj.Moved, obj.Failed)
+	if obj.Moving.Defined() {
+		fmt.Printf("  > Moving: %s\n", obj.Moving)
+	}
+	if obj.Error != "" {
+		fmt.Printf("  > Error: %s\n", obj.Error)
+	}
+}
+
+func textFormatPrintMaintenanceStatus(obj api.MaintenanceStatus) {
+	if !obj.Enabled {
+		fmt.Printf("%s | Maintenance: off\n", peer.Encode(obj.Peer))
+		return
+	}
+	fmt.Printf("%s | Maintenance: on\n", peer.Encode(obj.Peer))
+	fmt.Printf("  > Started: %s\n", humanize.Time(obj.Started))
+	fmt.Printf("  > Ends: %s\n", humanize.Time(obj.Until))
+}
+
+func textFormatPrintReplicationReport(obj api.ReplicationReport) {
+	name := obj.Name
+	if name == "" {
+		name = "-"
+	}
+	fmt.Printf(
+		"%s | %s | %s | Healthy: %d | Min: %d | Max: %d\n",
+		obj.Cid,
+		name,
+		strings.ToUpper(obj.State),
+		len(obj.Healthy),
+		obj.ReplicationFactorMin,
+		obj.ReplicationFactorMax,
+	)
+
+	printPeers := func(title string, peers []peer.ID) {
+		if len(peers) == 0 {
+			return
+		}
+		strs := make([]string, len(peers))
+		for i, p := range peers {
+			strs[i] = peer.Encode(p)
+		}
+		fmt.Printf("  > %s: %s\n", title, strings.Join(strs, ", "))
+	}
+	printPeers("Allocations", obj.Allocations)
+	printPeers("Healthy", obj.Healthy)
+}
+
 func textFormatPrintGlobalRepoGC(obj api.GlobalRepoGC) {
 	peers := make(sort.StringSlice, 0, len(obj.PeerMap))
 	for peer := range obj.PeerMap {
@@ -137,9 +137,15 @@ func main() {
 requires authorization. implies --https, which you can disable with --force-http`,
 			EnvVar: "CLUSTER_CREDENTIALS",
 		},
+		cli.StringFlag{
+			Name: "api-key",
+			Usage: `API key token to authenticate with, instead of BasicAuth credentials.
+implies --https, which you can disable with --force-http`,
+			EnvVar: "CLUSTER_API_KEY",
+		},
 		cli.BoolFlag{
 			Name:  "force-http, f",
-			Usage: "force HTTP. only valid when using BasicAuth",
+			Usage: "force HTTP. only valid when using BasicAuth or an API key",
 		},
 	}
 
@@ -166,10 +172,15 @@ requires authorization. implies --https, which you can disable with --force-http
 		user, pass := parseCredentials(c.String("basic-auth"))
 		cfg.Username = user
 		cfg.Password = pass
+		cfg.APIKey = c.String("api-key")
 		if user != "" && !cfg.SSL && !c.Bool("force-http") {
 			logger.Warn("SSL automatically enabled with basic auth credentials. Set \"force-http\" to disable")
 			cfg.SSL = true
 		}
+		if cfg.APIKey != "" && !cfg.SSL && !c.Bool("force-http") {
+			logger.Warn("SSL automatically enabled with an API key. Set \"force-http\" to disable")
+			cfg.SSL = true
+		}
 
 		enc := c.String("encoding")
 		if enc != "text" && enc != "json" {
@@ -246,6 +257,8 @@ This command displays information about the peer that the tool is contacting
 					Usage: "list the nodes participating in the IPFS Cluster",
 					Description: `
 This command provides a list of the ID information of all the peers in the Cluster.
+Peers in maintenance mode are flagged with "MAINTENANCE", even when they are
+down.
 `,
 					Flags:     []cli.Flag{},
 					ArgsUsage: " ",
@@ -282,6 +295,112 @@ cluster peers.
 						return nil
 					},
 				},
+				{
+					Name:  "drain",
+					Usage: "move all the pins of a peer to other peers",
+					Description: `
+This command starts draining a peer: every pin allocated to it is allocated to
+a different peer and, once pinned there, removed from the drained peer. During
+and after the drain, the peer does not receive new allocations. With --remove,
+the peer is removed from the cluster once drained. This avoids the window of
+under-replication left by "peers rm".
+
+The drain runs in the background in the cluster peer that receives the
+request, and resumes when that peer restarts. Drains are stored in the shared
+state, so any peer can report their progress (--status) or cancel them
+(--cancel). Cancelling a drain makes the peer allocatable again.
+`,
+					ArgsUsage: "<peer ID>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "remove",
+							Usage: "remove the peer from the cluster once drained",
+						},
+						cli.BoolFlag{
+							Name:  "wait",
+							Usage: "wait until the drain finishes",
+						},
+						cli.BoolFlag{
+							Name:  "status",
+							Usage: "show the progress of an ongoing drain",
+						},
+						cli.BoolFlag{
+							Name:  "cancel",
+							Usage: "stop draining the peer",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						pid := c.Args().First()
+						p, err := peer.Decode(pid)
+						checkErr("parsing peer ID", err)
+
+						var resp api.DrainStatus
+						var cerr error
+						switch {
+						case c.Bool("cancel"):
+							resp, cerr = globalClient.PeerDrainCancel(ctx, p)
+						case c.Bool("status"):
+							resp, cerr = globalClient.PeerDrainStatus(ctx, p)
+						default:
+							resp, cerr = globalClient.PeerDrain(ctx, p, c.Bool("remove"))
+						}
+
+						for c.Bool("wait") && cerr == nil && resp.Phase == api.DrainPhaseDraining {
+							time.Sleep(time.Second)
+							resp, cerr = globalClient.PeerDrainStatus(ctx, p)
+						}
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "maintenance",
+					Usage: "put a peer in maintenance mode",
+					Description: `
+This command puts a peer in maintenance mode, i.e. before taking it down to
+swap a disk. While in maintenance, the peer does not receive new allocations
+and its pins are not re-allocated to other peers when it goes down.
+
+Maintenance lasts for the given --duration, which cannot exceed the
+"maintenance_window" configured in the peer (used by default). If the peer is
+still down when the maintenance ends, its pins are re-allocated as usual.
+Use --stop to end it earlier and --status to check it. Peers in maintenance are
+flagged in the output of "peers ls".
+`,
+					ArgsUsage: "<peer ID>",
+					Flags: []cli.Flag{
+						cli.DurationFlag{
+							Name:  "duration",
+							Usage: "how long the maintenance lasts. Defaults to the peer's maintenance window",
+						},
+						cli.BoolFlag{
+							Name:  "status",
+							Usage: "show whether the peer is in maintenance",
+						},
+						cli.BoolFlag{
+							Name:  "stop",
+							Usage: "end the maintenance of the peer",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						pid := c.Args().First()
+						p, err := peer.Decode(pid)
+						checkErr("parsing peer ID", err)
+
+						var resp api.MaintenanceStatus
+						var cerr error
+						switch {
+						case c.Bool("stop"):
+							resp, cerr = globalClient.PeerMaintenanceStop(ctx, p)
+						case c.Bool("status"):
+							resp, cerr = globalClient.PeerMaintenanceStatus(ctx, p)
+						default:
+							resp, cerr = globalClient.PeerMaintenanceStart(ctx, p, c.Duration("duration"))
+						}
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
 			},
 		},
 		{
@@ -292,12 +411,14 @@ cluster peers.
 Add allows to add and replicate content to several ipfs daemons, performing
 a Cluster Pin operation on success. It takes elements from local paths as
 well as from web URLs (accessed with a GET request). Providing several
-arguments will automatically set --wrap-in-directory.
+arguments will automatically set --wrap-in-directory (except for CAR files).
 
 Cluster "add" works, by default, just like "ipfs add" and has similar options
 in terms of DAG layout, chunker, hash function etc. It also supports adding
-CAR files directly (--format car), as long as they have a single root. When
-adding CAR files, all the options related to dag-building are ignored.
+CAR files directly (--format car). Several CAR files can be provided and each
+of them can have several roots: every root is pinned separately with the same
+options. When adding CAR files, all the options related to dag-building are
+ignored.
 
 Added content will be allocated and sent block by block to the peers that
 should pin it (among which may not necessarily be the local ipfs daemon).
@@ -312,16 +433,16 @@ Optional replication-min and replication-max factors can be provided: -1 means
 "pin everywhere" and 0 means use cluster's default setting (i.e., replication
 factor set in config). Positive values indicate how many peers should pin this
 content.
+
+Cluster Add supports handling huge files and sharding the resulting DAG among
+several ipfs daemons (--shard). In this case, a single ipfs daemon will not
+contain the full dag, but only parts of it (shards). Desired shard size can
+be provided with the --shard-size flag. Each shard is pinned following the
+replication options given.
+
+We recommend setting a --name for sharded pins. Otherwise, it will be
+automatically generated.
 `,
-			/*
-				Cluster Add supports handling huge files and sharding the resulting DAG among
-				several ipfs daemons (--shard). In this case, a single ipfs daemon will not
-				contain the full dag, but only parts of it (shards). Desired shard size can
-				be provided with the --shard-size flag.
-
-				We recommend setting a --name for sharded pins. Otherwise, it will be
-				automatically generated.
-			*/
 			Flags: []cli.Flag{
 				cli.BoolFlag{
 					Name:  "recursive, r",
@@ -362,6 +483,22 @@ content.
 					Name:  "expire-in",
 					Usage: "Duration after which the pin should be unpinned automatically",
 				},
+				cli.IntFlag{
+					Name:  "priority",
+					Usage: "Pinning priority. Positive values are pinned before anything else, negative ones after",
+				},
+				cli.StringFlag{
+					Name:  "anti-affinity",
+					Usage: "Comma-separated list of metrics (i.e. tag:rack) whose values no two allocations may share",
+				},
+				cli.StringFlag{
+					Name:  "spread",
+					Usage: "Comma-separated list of metrics (i.e. tag:region) whose values must all hold an allocation",
+				},
+				cli.StringFlag{
+					Name:  "callback-url",
+					Usage: "URL which receives a POST request once the content is pinned by replication-min peers or fails (ignored with --shard)",
+				},
 				cli.StringSliceFlag{
 					Name:  "metadata",
 					Usage: "Pin metadata: key=value. Can be added multiple times",
@@ -424,16 +561,15 @@ content.
 					Usage: "Add the URL using filestore. Implies raw-leaves. (experimental)",
 				},
 
-				// TODO: Uncomment when sharding is supported.
-				// cli.BoolFlag{
-				//	Name:  "shard",
-				//	Usage: "Break the file into pieces (shards) and distributed among peers",
-				// },
-				// cli.Uint64Flag{
-				//	Name:  "shard-size",
-				//	Value: defaultAddParams.ShardSize,
-				//	Usage: "Sets the maximum replication factor for pinning this file",
-				// },
+				cli.BoolFlag{
+					Name:  "shard",
+					Usage: "Break the file into pieces (shards) and distributed among peers",
+				},
+				cli.Uint64Flag{
+					Name:  "shard-size",
+					Value: defaultAddParams.ShardSize,
+					Usage: "Sets the maximum size (in bytes) of each shard",
+				},
 				// TODO: Figure progress over total bar.
 				// cli.BoolFlag{
 				//	Name:  "progress, p",
@@ -474,21 +610,24 @@ content.
 				}
 
 				p.Metadata = parseMetadata(c.StringSlice("metadata"))
+				p.Priority = c.Int("priority")
+				p.AntiAffinity = parseMetricNames(c.String("anti-affinity"))
+				p.Spread = parseMetricNames(c.String("spread"))
+				p.CallbackURL = c.String("callback-url")
 				p.Name = name
 				if c.String("allocations") != "" {
 					p.UserAllocations = api.StringsToPeers(strings.Split(c.String("allocations"), ","))
 				}
 				p.Format = c.String("format")
-				//p.Shard = shard
-				//p.ShardSize = c.Uint64("shard-size")
-				p.Shard = false
+				p.Shard = shard
+				p.ShardSize = c.Uint64("shard-size")
 				p.Recursive = c.Bool("recursive")
 				p.Local = c.Bool("local")
 				p.Layout = c.String("layout")
 				p.Chunker = c.String("chunker")
 				p.RawLeaves = c.Bool("raw-leaves")
 				p.Hidden = c.Bool("hidden")
-				p.Wrap = c.Bool("wrap-with-directory") || len(paths) > 1
+				p.Wrap = c.Bool("wrap-with-directory") || (len(paths) > 1 && p.Format != "car")
 				p.CidVersion = c.Int("cid-version")
 				p.HashFun = c.String("hash")
 				if p.HashFun != defaultAddParams.HashFun {
@@ -504,7 +643,10 @@ content.
 
 				// Prevent footgun
 				if p.Wrap && p.Format == "car" {
-					checkErr("", errors.New("only a single CAR file can be added and wrap-with-directory is not supported"))
+					checkErr("", errors.New("wrap-with-directory is not supported when adding CAR files"))
+				}
+				if p.Shard && p.Local {
+					checkErr("", errors.New("--shard and --local cannot be used together"))
 				}
 
 				out := make(chan api.AddedOutput, 1)
@@ -589,6 +731,21 @@ An optional allocations argument can be provided, allocations should be a
 comma-separated list of peer IDs on which we want to pin. Peers in allocations
 are prioritized over automatically-determined ones, but replication factors
 would still be respected.
+
+Placement constraints can be set with --anti-affinity and --spread, which take
+metric names like those produced by the tags informer (i.e. "tag:rack"). No two
+allocations will share a value of an anti-affinity metric, and every value of a
+spread metric will hold at least one allocation. Pinning fails when this is
+not possible. The cluster defaults are used when none are given.
+
+With --callback-url, the peer receiving the request POSTs a JSON object to the
+given URL once the pin has been pinned by replication-min peers, or when it
+fails. This avoids waiting with --wait. The host of the URL must be listed in
+the pin_callback_allowed_hosts of the peer.
+
+With --dry-run, nothing is pinned. Instead, the command shows the peers that
+would be allocated, along with the metrics and the decisions behind the
+choice of every peer.
 `,
 					ArgsUsage: "<CID|Path>",
 					Flags: []cli.Flag{
@@ -625,10 +782,30 @@ would still be respected.
 							Name:  "expire-in",
 							Usage: "Duration after which pin should be unpinned automatically",
 						},
+						cli.IntFlag{
+							Name:  "priority",
+							Usage: "Pinning priority. Positive values are pinned before anything else, negative ones after",
+						},
+						cli.StringFlag{
+							Name:  "anti-affinity",
+							Usage: "Comma-separated list of metrics (i.e. tag:rack) whose values no two allocations may share",
+						},
+						cli.StringFlag{
+							Name:  "spread",
+							Usage: "Comma-separated list of metrics (i.e. tag:region) whose values must all hold an allocation",
+						},
+						cli.StringFlag{
+							Name:  "callback-url",
+							Usage: "URL which receives a POST request once the pin is pinned by replication-min peers or fails",
+						},
 						cli.StringSliceFlag{
 							Name:  "metadata",
 							Usage: "Pin metadata: key=value. Can be added multiple times",
 						},
+						cli.BoolFlag{
+							Name:  "dry-run",
+							Usage: "Show the peers that would be allocated and why, without pinning",
+						},
 						cli.BoolFlag{
 							Name:  "no-status, ns",
 							Usage: "Prevents fetching pin status after pinning (faster, quieter)",
@@ -679,6 +856,18 @@ would still be respected.
 							UserAllocations:      userAllocs,
 							ExpireAt:             expireAt,
 							Metadata:             parseMetadata(c.StringSlice("metadata")),
+							Priority:             c.Int("priority"),
+							AntiAffinity:         parseMetricNames(c.String("anti-affinity")),
+							Spread:               parseMetricNames(c.String("spread")),
+							CallbackURL:          c.String("callback-url"),
+						}
+
+						if c.Bool("dry-run") {
+							ci, err := api.DecodeCid(arg)
+							checkErr("parsing cid (--dry-run needs a CID)", err)
+							preview, cerr := globalClient.AllocationPreview(ctx, ci, opts)
+							formatResponse(c, preview, cerr)
+							return nil
 						}
 
 						pin, cerr := globalClient.PinPath(ctx, arg, opts)
@@ -829,6 +1018,19 @@ The filter only takes effect when listing all pins. The possible values are:
   - meta-pin (sharded pins)
   - clusterdag-pin (sharding-dag root pins)
   - shard-pin (individual shard pins)
+  - collection (pin collections)
+
+The rest of the flags allow selecting pins by name, metadata, creation and
+expiration dates (in RFC3339 format), allocation and replication factors.
+Filtering happens on the cluster peer, so only matching pins are sent.
+
+Pins can be sorted by "name", "created" or "expire" date with --sort. A "-"
+prefix ("-created") reverses the order. Sorting requires the peer to hold all
+the selected pins in memory, while unsorted listings are streamed.
+
+Large pinsets can be listed in pages with --limit. Pins are always listed in
+the same order, and the next page can be obtained by passing the CID of the
+last pin listed to --cursor.
 `,
 					ArgsUsage: "[CID]",
 					Flags: []cli.Flag{
@@ -837,6 +1039,54 @@ The filter only takes effect when listing all pins. The possible values are:
 							Usage: "Comma separated list of pin types. See help above.",
 							Value: "all",
 						},
+						cli.StringFlag{
+							Name:  "name",
+							Usage: "List pins whose name contains the given string",
+						},
+						cli.StringFlag{
+							Name:  "name-regexp",
+							Usage: "List pins whose name matches the given regular expression",
+						},
+						cli.StringSliceFlag{
+							Name:  "metadata",
+							Usage: "List pins with the given metadata: key=value. Can be added multiple times",
+						},
+						cli.StringFlag{
+							Name:  "created-after",
+							Usage: "List pins created after the given date",
+						},
+						cli.StringFlag{
+							Name:  "created-before",
+							Usage: "List pins created before the given date",
+						},
+						cli.StringFlag{
+							Name:  "expire-before",
+							Usage: "List pins expiring before the given date",
+						},
+						cli.StringFlag{
+							Name:  "allocation",
+							Usage: "List pins allocated to the given peer ID",
+						},
+						cli.IntFlag{
+							Name:  "replication-min, rmin",
+							Usage: "List pins with the given minimum replication factor",
+						},
+						cli.IntFlag{
+							Name:  "replication-max, rmax",
+							Usage: "List pins with the given maximum replication factor",
+						},
+						cli.IntFlag{
+							Name:  "limit",
+							Usage: "List at most this number of pins",
+						},
+						cli.StringFlag{
+							Name:  "cursor",
+							Usage: "List pins after the given CID. See help above.",
+						},
+						cli.StringFlag{
+							Name:  "sort",
+							Usage: "Sort pins by name, created or expire. See help above.",
+						},
 					},
 					Action: func(c *cli.Context) error {
 						cidStr := c.Args().First()
@@ -846,17 +1096,12 @@ The filter only takes effect when listing all pins. The possible values are:
 							resp, cerr := globalClient.Allocation(ctx, ci)
 							formatResponse(c, resp, cerr)
 						} else {
-							var filter api.PinType
-							strFilter := strings.Split(c.String("filter"), ",")
-							for _, f := range strFilter {
-								filter |= api.PinTypeFromString(f)
-							}
-
+							query := parsePinQuery(c)
 							allocs := make(chan api.Pin, 1024)
 							errCh := make(chan error, 1)
 							go func() {
 								defer close(errCh)
-								errCh <- globalClient.Allocations(ctx, filter, allocs)
+								errCh <- globalClient.Allocations(ctx, query, allocs)
 							}()
 							formatResponse(c, allocs, nil)
 							err := <-errCh
@@ -865,6 +1110,264 @@ The filter only takes effect when listing all pins. The possible values are:
 						return nil
 					},
 				},
+				{
+					Name:  "export",
+					Usage: "Export a pinned item as a CAR file",
+					Description: `
+This command retrieves the full DAG of a pinned CID and writes it as a CARv1
+file to the standard output (or to the file given with --output):
+
+  $ ipfs-cluster-ctl pin export <cid> > out.car
+
+Blocks are read from the IPFS daemon of the cluster peer serving the request,
+which fetches them from the network when it does not have them.
+`,
+					ArgsUsage: "<CID>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "Write the CAR file to the given path instead of stdout",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						ci, err := api.DecodeCid(c.Args().First())
+						checkErr("parsing cid", err)
+
+						out := os.Stdout
+						if path := c.String("output"); path != "" {
+							f, err := os.Create(path)
+							checkErr("creating output file", err)
+							out = f
+						}
+
+						// Errors go to stderr so that they do not
+						// end up mixed with the CAR data.
+						err = globalClient.ExportCAR(ctx, ci, out)
+						// checkErr exits, so close the file first
+						// for whatever was written to be flushed.
+						if out != os.Stdout {
+							closeErr := out.Close()
+							if err == nil {
+								err = closeErr
+							}
+						}
+						checkErr("exporting CAR", err)
+						return nil
+					},
+				},
+				{
+					Name:  "verify",
+					Usage: "Check the integrity of a pinned item",
+					Description: `
+This command asks the peers where a CID is allocated to walk its DAG in their
+IPFS daemons and rehash every block. It waits for the verification to finish
+and returns the resulting status for each peer.
+
+Peers with missing or corrupt blocks report the item as "corrupted". Use
+"ipfs-cluster-ctl recover" to unpin the item, drop the corrupt blocks and
+pin it again.
+
+When the --local flag is passed, only the contacted peer verifies the item.
+Note that verifying large DAGs may take a considerably long time.
+`,
+					ArgsUsage: "<CID>",
+					Flags: []cli.Flag{
+						localFlag(),
+					},
+					Action: func(c *cli.Context) error {
+						ci, err := api.DecodeCid(c.Args().First())
+						checkErr("parsing cid", err)
+						resp, cerr := globalClient.Verify(ctx, ci, c.Bool("local"))
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:        "collection",
+			Usage:       "Manage named collections of pins",
+			Description: "Manage named collections of pins",
+			Subcommands: []cli.Command{
+				{
+					Name:  "create",
+					Usage: "Create a new collection",
+					Description: `
+This command creates a new, empty collection. A collection is a named group
+of pins which is stored in the cluster shared state. Items added to the
+collection are pinned with the options given here (replication factors,
+allocations, mode, metadata and priority).
+
+When an expiration is set, the collection and all its members are unpinned
+when it is reached.
+`,
+					ArgsUsage: "<name>",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "replication, r",
+							Value: 0,
+							Usage: "Sets a custom replication factor (overrides -rmax and -rmin)",
+						},
+						cli.IntFlag{
+							Name:  "replication-min, rmin",
+							Value: 0,
+							Usage: "Sets the minimum replication factor for the members",
+						},
+						cli.IntFlag{
+							Name:  "replication-max, rmax",
+							Value: 0,
+							Usage: "Sets the maximum replication factor for the members",
+						},
+						cli.StringFlag{
+							Name:  "allocations, allocs",
+							Usage: "Optional comma-separated list of peer IDs",
+						},
+						cli.StringFlag{
+							Name:  "mode",
+							Value: "recursive",
+							Usage: "Select a way to pin the members: recursive or direct",
+						},
+						cli.StringFlag{
+							Name:  "expire-in",
+							Usage: "Duration after which the collection should be removed automatically",
+						},
+						cli.IntFlag{
+							Name:  "priority",
+							Usage: "Pinning priority for the members",
+						},
+						cli.StringSliceFlag{
+							Name:  "metadata",
+							Usage: "Collection metadata: key=value. Can be added multiple times",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						name := c.Args().First()
+						rplMin := c.Int("replication-min")
+						rplMax := c.Int("replication-max")
+						if rpl := c.Int("replication"); rpl != 0 {
+							rplMin = rpl
+							rplMax = rpl
+						}
+
+						var userAllocs []peer.ID
+						if c.String("allocations") != "" {
+							allocs := strings.Split(c.String("allocations"), ",")
+							for i := range allocs {
+								allocs[i] = strings.TrimSpace(allocs[i])
+							}
+							userAllocs = api.StringsToPeers(allocs)
+							if len(userAllocs) != len(allocs) {
+								checkErr("decoding allocations", errors.New("some peer IDs could not be decoded"))
+							}
+						}
+						var expireAt time.Time
+						if expireIn := c.String("expire-in"); expireIn != "" {
+							d, err := time.ParseDuration(expireIn)
+							checkErr("parsing expire-in", err)
+							expireAt = time.Now().Add(d)
+						}
+
+						opts := api.PinOptions{
+							ReplicationFactorMin: rplMin,
+							ReplicationFactorMax: rplMax,
+							Mode:                 api.PinModeFromString(c.String("mode")),
+							UserAllocations:      userAllocs,
+							ExpireAt:             expireAt,
+							Metadata:             parseMetadata(c.StringSlice("metadata")),
+							Priority:             c.Int("priority"),
+						}
+						resp, cerr := globalClient.CollectionCreate(ctx, name, opts)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "ls",
+					Usage: "List collections or the members of a collection",
+					Description: `
+Without arguments, this command lists all the collections. When a collection
+name is given, it lists the pins which belong to it.
+`,
+					ArgsUsage: "[name]",
+					Action: func(c *cli.Context) error {
+						name := c.Args().First()
+						out := make(chan api.Pin, 1024)
+						errCh := make(chan error, 1)
+						go func() {
+							defer close(errCh)
+							if name == "" {
+								errCh <- globalClient.Collections(ctx, out)
+							} else {
+								errCh <- globalClient.CollectionMembers(ctx, name, out)
+							}
+						}()
+						formatResponse(c, out, nil)
+						err := <-errCh
+						formatResponse(c, nil, err)
+						return nil
+					},
+				},
+				{
+					Name:  "add",
+					Usage: "Add items to a collection",
+					Description: `
+This command pins the given CIDs as members of a collection, using the
+collection pin options. Items which are already pinned take the collection
+options and keep their name.
+`,
+					ArgsUsage: "<name> <CID> [CID]...",
+					Action: func(c *cli.Context) error {
+						name, cids := parseCollectionArgs(c)
+						resp, cerr := globalClient.CollectionAdd(ctx, name, cids)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "rm",
+					Usage: "Remove items from a collection",
+					Description: `
+This command removes the given CIDs from a collection. Items which do not
+belong to any other collection are unpinned.
+`,
+					ArgsUsage: "<name> <CID> [CID]...",
+					Action: func(c *cli.Context) error {
+						name, cids := parseCollectionArgs(c)
+						cerr := globalClient.CollectionRemove(ctx, name, cids)
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "delete",
+					Usage: "Delete a collection",
+					Description: `
+This command deletes a collection. Its members are unpinned unless they belong
+to other collections.
+`,
+					ArgsUsage: "<name>",
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.CollectionDelete(ctx, c.Args().First())
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "status",
+					Usage: "Retrieve the status of a collection",
+					Description: `
+This command retrieves the status of a collection on every peer, aggregated
+across its members. For each peer, the status of the member in the worst
+condition is shown (i.e. errors take precedence over items being pinned,
+which take precedence over pinned items).
+`,
+					ArgsUsage: "<name>",
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.CollectionStatus(ctx, c.Args().First())
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
 			},
 		},
 		{
@@ -934,6 +1437,8 @@ separated list). The following are valid status values:
 			Description: `
 This command asks Cluster peers to re-track or re-forget CIDs in
 error state, usually because the IPFS pin or unpin operation has failed.
+CIDs in "corrupted" state (see "pin verify") are unpinned, cleared of
+corrupt blocks and pinned again.
 
 The command will wait for any operations to succeed and will return the status
 of the item upon completion. Note that, when running on the full sets of tracked
@@ -968,6 +1473,114 @@ operations on the contacted peer (as opposed to on every peer).
 			},
 		},
 
+		{
+			Name:  "keys",
+			Usage: "Manage API keys",
+			Description: `
+API keys authenticate requests to the REST and pinning service APIs on behalf
+of a user, as an alternative to sharing their basic auth password. They are
+sent as Bearer tokens, for example with the --api-key flag. Each key has a list
+of scopes which limits what it can do ("read", "pin" and "admin") and an
+expiry, after which it stops working.
+
+Keys are stored in the shared cluster state and work against the APIs of any
+peer. Revoking a key applies to all peers. When a key was last used is
+recorded at most once per minute by each peer.
+`,
+			Subcommands: []cli.Command{
+				{
+					Name:  "ls",
+					Usage: "list API keys",
+					Description: `
+This command lists the API keys of the authenticated user, or those of every
+user for admins, along with their scopes, expiry and when they were last used.
+`,
+					ArgsUsage: " ",
+					Flags:     []cli.Flag{},
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.APIKeys(ctx)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "create",
+					Usage: "create an API key",
+					Description: `
+This command creates an API key for the authenticated user, or for the given
+user when run by an admin. The key token is only shown once and cannot be
+retrieved later.
+`,
+					ArgsUsage: " ",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "user",
+							Usage: "user the key authenticates as (admins only)",
+						},
+						cli.StringFlag{
+							Name:  "scopes",
+							Value: api.APIKeyScopeRead,
+							Usage: "comma-separated list of scopes: read, pin, admin",
+						},
+						cli.StringFlag{
+							Name:  "expire-in",
+							Value: "720h",
+							Usage: "duration after which the key expires",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						expireIn, err := time.ParseDuration(c.String("expire-in"))
+						checkErr("parsing expire-in", err)
+						key := api.APIKey{
+							User:   c.String("user"),
+							Scopes: strings.Split(c.String("scopes"), ","),
+							Expiry: time.Now().Add(expireIn),
+						}
+						resp, cerr := globalClient.APIKeyCreate(ctx, key)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "revoke",
+					Usage: "revoke an API key",
+					Description: `
+This command revokes the API key with the given ID, which stops working
+immediately. Users can revoke their own keys and admins can revoke any key.
+`,
+					ArgsUsage: "<key ID>",
+					Flags:     []cli.Flag{},
+					Action: func(c *cli.Context) error {
+						id := c.Args().First()
+						if id == "" {
+							checkErr("", errors.New("a key ID is required"))
+						}
+						cerr := globalClient.APIKeyRevoke(ctx, id)
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "usage",
+			Usage: "Show the pins owned by a user and their quota",
+			Description: `
+This command shows the number and the total size of the items pinned through
+the REST API by the authenticated user, along with the quota set for them in
+the "quotas" section of the API configuration, if any.
+
+Admin users can show the usage of other users by giving their name. The name
+is required when the API does not use authentication.
+`,
+			ArgsUsage: "[user]",
+			Flags:     []cli.Flag{},
+			Action: func(c *cli.Context) error {
+				resp, cerr := globalClient.Usage(ctx, c.Args().First())
+				formatResponse(c, resp, cerr)
+				return nil
+			},
+		},
 		{
 			Name:  "version",
 			Usage: "Retrieve cluster version",
@@ -1075,6 +1688,51 @@ trigger automatic repinnings if configured.
 						return nil
 					},
 				},
+				{
+					Name:  "rebalance",
+					Usage: "Show the progress of the rebalancer",
+					Description: `
+This command shows the status of the rebalancer of the peer, which regularly
+moves pins to the peers that the allocator would choose for them now (for
+example, after adding new peers to the cluster). It is disabled unless
+"rebalance_interval" is set in the cluster configuration of the peer.
+
+Pins are migrated by first pinning them in the new allocations and, once
+they are pinned, removing the old allocations.
+`,
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.RebalanceStatus(ctx)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "replication",
+					Usage: "List under-replicated, over-replicated and unavailable pins",
+					Description: `
+This command checks how many peers have pinned every item in the pinset and
+lists those which have fewer copies than their minimum replication factor
+(under-replicated), more copies than their maximum replication factor
+(over-replicated) or no copies at all (unavailable). Only copies in "pinned"
+state count as healthy. Items being pinned are reported as under-replicated
+until they finish pinning.
+
+This requires asking every peer for the status of all the pins, which may
+take a while in large clusters.
+`,
+					Action: func(c *cli.Context) error {
+						out := make(chan api.ReplicationReport, 1024)
+						errCh := make(chan error, 1)
+						go func() {
+							defer close(errCh)
+							errCh <- globalClient.ReplicationReport(ctx, out)
+						}()
+						formatResponse(c, out, nil)
+						err := <-errCh
+						formatResponse(c, nil, err)
+						return nil
+					},
+				},
 			},
 		},
 		{
@@ -1140,6 +1798,22 @@ func walkCommands(cmds []cli.Command, parentHelpName string) {
 	}
 }
 
+// parseCollectionArgs returns the collection name and the CIDs given as
+// arguments.
+func parseCollectionArgs(c *cli.Context) (string, []api.Cid) {
+	args := c.Args()
+	if len(args) < 2 {
+		checkErr("", errors.New("a collection name and at least one CID are needed"))
+	}
+	cids := make([]api.Cid, len(args)-1)
+	for i, cStr := range args[1:] {
+		ci, err := api.DecodeCid(cStr)
+		checkErr("parsing cid", err)
+		cids[i] = ci
+	}
+	return args[0], cids
+}
+
 func formatResponse(c *cli.Context, resp interface{}, err error) {
 	enc := c.GlobalString("encoding")
 	if resp == nil && err == nil {
@@ -1248,6 +1922,52 @@ func waitFor(
 	return client.WaitFor(ctx, globalClient, fp)
 }
 
+// parsePinQuery builds the query for "pin ls" from the command flags.
+func parsePinQuery(c *cli.Context) api.PinQuery {
+	var query api.PinQuery
+	for _, f := range strings.Split(c.String("filter"), ",") {
+		query.Type |= api.PinTypeFromString(f)
+	}
+	if query.Type == api.BadType {
+		checkErr("parsing filter", errors.New("invalid filter value"))
+	}
+
+	query.Name = c.String("name")
+	query.NameRegexp = c.String("name-regexp")
+	if len(c.StringSlice("metadata")) > 0 {
+		query.Metadata = parseMetadata(c.StringSlice("metadata"))
+	}
+
+	for flag, tm := range map[string]*time.Time{
+		"created-after":  &query.CreatedAfter,
+		"created-before": &query.CreatedBefore,
+		"expire-before":  &query.ExpireBefore,
+	} {
+		if v := c.String(flag); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			checkErr("parsing "+flag, err)
+			*tm = t
+		}
+	}
+
+	if v := c.String("allocation"); v != "" {
+		pid, err := peer.Decode(v)
+		checkErr("parsing allocation", err)
+		query.Allocation = pid
+	}
+	query.ReplicationFactorMin = c.Int("replication-min")
+	query.ReplicationFactorMax = c.Int("replication-max")
+	query.Limit = c.Int("limit")
+	query.Sort = c.String("sort")
+
+	if v := c.String("cursor"); v != "" {
+		ci, err := api.DecodeCid(v)
+		checkErr("parsing cursor", err)
+		query.Cursor = ci
+	}
+	return query
+}
+
 func parseMetadata(metadata []string) map[string]string {
 	metadataMap := make(map[string]string)
 	for _, str := range metadata {
@@ -1261,6 +1981,17 @@ func parseMetadata(metadata []string) map[string]string {
 	return metadataMap
 }
 
+func parseMetricNames(str string) []string {
+	if str == "" {
+		return nil
+	}
+	names := strings.Split(str, ",")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+	return names
+}
+
 // func setupTracing(config tracingConfig) {
 // 	if !config.Enable {
 // 		return
@@ -210,7 +210,7 @@ func initCluster(c *cli.Context, ignoreReinit bool, cfgURL string) error {
 	// Setting the datastore here is useless, as we initialize with remote
 	// config and we will have an empty service.json with the source only.
 	// That source will decide which datastore is actually used.
-	cfgHelper := cmdutils.NewConfigHelper(configPath, identityPath, "crdt", "")
+	cfgHelper := cmdutils.NewConfigHelper(configPath, identityPath, "crdt", "", "balanced")
 	cfgHelper.Manager().Shutdown()
 	cfgHelper.Manager().Source = cfgURL
 	err := cfgHelper.Manager().Default()
@@ -404,6 +404,7 @@ func runCmd(c *cli.Context) error {
 		alloc,
 		[]ipfscluster.Informer{informer},
 		tracer,
+		nil,
 	)
 	if err != nil {
 		store.Close()
@@ -471,7 +472,7 @@ func listCmd(c *cli.Context) error {
 	if hasBadger {
 		dstoreType = "badger"
 	}
-	cfgHelper := cmdutils.NewConfigHelper(configPath, identityPath, "crdt", dstoreType)
+	cfgHelper := cmdutils.NewConfigHelper(configPath, identityPath, "crdt", dstoreType, "balanced")
 	cfgHelper.Manager().Shutdown() // not needed
 	cfgHelper.Configs().Badger.SetBaseDir(absPath)
 	cfgHelper.Configs().LevelDB.SetBaseDir(absPath)
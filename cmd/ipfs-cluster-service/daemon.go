@@ -6,7 +6,11 @@ import (
 	"time"
 
 	ipfscluster "github.com/lubanproj/ipfs-cluster"
+	"github.com/lubanproj/ipfs-cluster/alerts/dispatcher"
 	"github.com/lubanproj/ipfs-cluster/allocator/balanced"
+	"github.com/lubanproj/ipfs-cluster/allocator/fillfirst"
+	"github.com/lubanproj/ipfs-cluster/allocator/latency"
+	"github.com/lubanproj/ipfs-cluster/allocator/weighted"
 	"github.com/lubanproj/ipfs-cluster/api/ipfsproxy"
 	"github.com/lubanproj/ipfs-cluster/api/pinsvcapi"
 	"github.com/lubanproj/ipfs-cluster/api/rest"
@@ -189,15 +193,7 @@ func createCluster(
 		informers = append(informers, pinQueueInf)
 	}
 
-	// For legacy compatibility we need to make the allocator
-	// automatically compatible with informers that have been loaded. For
-	// simplicity we assume that anyone that does not specify an allocator
-	// configuration (legacy configs), will be using "freespace"
-	if !cfgMgr.IsLoadedFromJSON(config.Allocator, cfgs.BalancedAlloc.ConfigKey()) {
-		cfgs.BalancedAlloc.AllocateBy = []string{"freespace"}
-	}
-	alloc, err := balanced.New(cfgs.BalancedAlloc)
-	checkErr("creating allocator", err)
+	alloc := setupAllocator(cfgHelper)
 
 	ipfscluster.ReadyTimeout = cfgs.Raft.WaitForLeaderTimeout + 5*time.Second
 
@@ -228,6 +224,15 @@ func createCluster(
 		checkErr("setting up PeerMonitor", err)
 	}
 
+	var alertDispatcher ipfscluster.AlertDispatcher
+	if cfgMgr.IsLoadedFromJSON(config.Alerts, cfgs.Dispatcher.ConfigKey()) {
+		alertDispatcher, err = dispatcher.New(cfgs.Dispatcher)
+		if err != nil {
+			store.Close()
+			checkErr("setting up alert dispatcher", err)
+		}
+	}
+
 	return ipfscluster.NewCluster(
 		ctx,
 		host,
@@ -242,6 +247,7 @@ func createCluster(
 		alloc,
 		informers,
 		tracer,
+		alertDispatcher,
 	)
 }
 
@@ -257,6 +263,37 @@ func bootstrap(ctx context.Context, cluster *ipfscluster.Cluster, bootstraps []m
 	}
 }
 
+func setupAllocator(cfgHelper *cmdutils.ConfigHelper) ipfscluster.PinAllocator {
+	cfgs := cfgHelper.Configs()
+	cfgMgr := cfgHelper.Manager()
+
+	var alloc ipfscluster.PinAllocator
+	var err error
+	switch cfgHelper.GetAllocator() {
+	case cfgs.BalancedAlloc.ConfigKey():
+		// For legacy compatibility we need to make the allocator
+		// automatically compatible with informers that have been
+		// loaded. For simplicity we assume that anyone that does not
+		// specify an allocator configuration (legacy configs), will be
+		// using "freespace"
+		if !cfgMgr.IsLoadedFromJSON(config.Allocator, cfgs.BalancedAlloc.ConfigKey()) {
+			cfgs.BalancedAlloc.AllocateBy = []string{"freespace"}
+		}
+		alloc, err = balanced.New(cfgs.BalancedAlloc)
+	case cfgs.WeightedAlloc.ConfigKey():
+		alloc, err = weighted.New(cfgs.WeightedAlloc)
+	case cfgs.FillFirstAlloc.ConfigKey():
+		alloc, err = fillfirst.New(cfgs.FillFirstAlloc)
+	case cfgs.LatencyAlloc.ConfigKey():
+		alloc, err = latency.New(cfgs.LatencyAlloc)
+	default:
+		err = errors.New("only one allocator configuration section should be present")
+	}
+	checkErr("creating allocator", err)
+	logger.Infof("Allocator: %s", cfgHelper.GetAllocator())
+	return alloc
+}
+
 func setupDatastore(cfgHelper *cmdutils.ConfigHelper) ds.Datastore {
 	dsName := cfgHelper.GetDatastore()
 	stmgr, err := cmdutils.NewStateManager(cfgHelper.GetConsensus(), dsName, cfgHelper.Identity(), cfgHelper.Configs())
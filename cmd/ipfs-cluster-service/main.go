@@ -33,6 +33,7 @@ const (
 	defaultLogLevel  = "info"
 	defaultConsensus = "crdt"
 	defaultDatastore = "badger"
+	defaultAllocator = "balanced"
 )
 
 const (
@@ -241,7 +242,9 @@ provided with --custom-secret (in which case it will be prompted), or
 by setting the CLUSTER_SECRET environment variable.
 
 The --consensus flag allows to select an alternative consensus components for
-in the newly-generated configuration.
+in the newly-generated configuration. Similarly, the --allocator flag selects
+the allocation policy: "balanced" (default), "weighted" (weighted-random by
+free space), "fillfirst" (bin-packing) or "latency" (closest peers first).
 
 Note that the --force flag allows to overwrite an existing
 configuration with default values. To generate a new identity, please
@@ -272,6 +275,11 @@ the peer IDs in the given multiaddresses.
 					Usage: "select datastore component: 'badger' or 'leveldb'",
 					Value: defaultDatastore,
 				},
+				cli.StringFlag{
+					Name:  "allocator",
+					Usage: "select allocator component: 'balanced', 'weighted', 'fillfirst' or 'latency'",
+					Value: defaultAllocator,
+				},
 				cli.BoolFlag{
 					Name:  "custom-secret, s",
 					Usage: "prompt for the cluster secret (when no source specified)",
@@ -304,7 +312,14 @@ the peer IDs in the given multiaddresses.
 					checkErr("choosing datastore", errors.New("flag value must be set to 'leveldb' or 'badger'"))
 				}
 
-				cfgHelper := cmdutils.NewConfigHelper(configPath, identityPath, consensus, datastore)
+				allocator := c.String("allocator")
+				switch allocator {
+				case "balanced", "weighted", "fillfirst", "latency":
+				default:
+					checkErr("choosing allocator", errors.New("flag value must be set to 'balanced', 'weighted', 'fillfirst' or 'latency'"))
+				}
+
+				cfgHelper := cmdutils.NewConfigHelper(configPath, identityPath, consensus, datastore, allocator)
 				defer cfgHelper.Manager().Shutdown() // wait for saves
 
 				configExists := false
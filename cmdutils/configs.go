@@ -8,7 +8,11 @@ import (
 	"github.com/pkg/errors"
 
 	ipfscluster "github.com/lubanproj/ipfs-cluster"
+	"github.com/lubanproj/ipfs-cluster/alerts/dispatcher"
 	"github.com/lubanproj/ipfs-cluster/allocator/balanced"
+	"github.com/lubanproj/ipfs-cluster/allocator/fillfirst"
+	"github.com/lubanproj/ipfs-cluster/allocator/latency"
+	"github.com/lubanproj/ipfs-cluster/allocator/weighted"
 	"github.com/lubanproj/ipfs-cluster/api/ipfsproxy"
 	"github.com/lubanproj/ipfs-cluster/api/pinsvcapi"
 	"github.com/lubanproj/ipfs-cluster/api/rest"
@@ -39,6 +43,9 @@ type Configs struct {
 	Statelesstracker *stateless.Config
 	Pubsubmon        *pubsubmon.Config
 	BalancedAlloc    *balanced.Config
+	WeightedAlloc    *weighted.Config
+	FillFirstAlloc   *fillfirst.Config
+	LatencyAlloc     *latency.Config
 	DiskInf          *disk.Config
 	NumpinInf        *numpin.Config
 	TagsInf          *tags.Config
@@ -47,6 +54,7 @@ type Configs struct {
 	Tracing          *observations.TracingConfig
 	Badger           *badger.Config
 	LevelDB          *leveldb.Config
+	Dispatcher       *dispatcher.Config
 }
 
 // ConfigHelper helps managing the configuration and identity files with the
@@ -60,17 +68,21 @@ type ConfigHelper struct {
 	identityPath string
 	consensus    string
 	datastore    string
+	allocator    string
 }
 
 // NewConfigHelper creates a config helper given the paths to the
-// configuration and identity files.
+// configuration and identity files. When consensus, datastore or allocator
+// are empty, the configurations for all the available components of that
+// type are registered.
 // Remember to Shutdown() the ConfigHelper.Manager() after use.
-func NewConfigHelper(configPath, identityPath, consensus, datastore string) *ConfigHelper {
+func NewConfigHelper(configPath, identityPath, consensus, datastore, allocator string) *ConfigHelper {
 	ch := &ConfigHelper{
 		configPath:   configPath,
 		identityPath: identityPath,
 		consensus:    consensus,
 		datastore:    datastore,
+		allocator:    allocator,
 	}
 	ch.init()
 	return ch
@@ -80,7 +92,7 @@ func NewConfigHelper(configPath, identityPath, consensus, datastore string) *Con
 // configuration and identity files and loads the configurations from disk.
 // Remember to Shutdown() the ConfigHelper.Manager() after use.
 func NewLoadedConfigHelper(configPath, identityPath string) (*ConfigHelper, error) {
-	cfgHelper := NewConfigHelper(configPath, identityPath, "", "")
+	cfgHelper := NewConfigHelper(configPath, identityPath, "", "", "")
 	err := cfgHelper.LoadFromDisk()
 	return cfgHelper, err
 }
@@ -216,6 +228,40 @@ func (ch *ConfigHelper) GetDatastore() string {
 	}
 }
 
+// GetAllocator attempts to return the configured allocator. If the
+// ConfigHelper was initialized with an allocator string, then it returns
+// that.
+//
+// Otherwise it checks which allocator configuration has been loaded. When
+// none has been loaded, it returns the balanced allocator key, which was
+// the only one available in the past. When more than one has been loaded,
+// it returns an empty string.
+func (ch *ConfigHelper) GetAllocator() string {
+	if ch.allocator != "" {
+		return ch.allocator
+	}
+
+	var loaded []string
+	for _, key := range []string{
+		ch.configs.BalancedAlloc.ConfigKey(),
+		ch.configs.WeightedAlloc.ConfigKey(),
+		ch.configs.FillFirstAlloc.ConfigKey(),
+		ch.configs.LatencyAlloc.ConfigKey(),
+	} {
+		if ch.manager.IsLoadedFromJSON(config.Allocator, key) {
+			loaded = append(loaded, key)
+		}
+	}
+	switch len(loaded) {
+	case 0:
+		return ch.configs.BalancedAlloc.ConfigKey()
+	case 1:
+		return loaded[0]
+	default:
+		return ""
+	}
+}
+
 // register all current cluster components
 func (ch *ConfigHelper) init() {
 	man := config.NewManager()
@@ -230,6 +276,9 @@ func (ch *ConfigHelper) init() {
 		Statelesstracker: &stateless.Config{},
 		Pubsubmon:        &pubsubmon.Config{},
 		BalancedAlloc:    &balanced.Config{},
+		WeightedAlloc:    &weighted.Config{},
+		FillFirstAlloc:   &fillfirst.Config{},
+		LatencyAlloc:     &latency.Config{},
 		DiskInf:          &disk.Config{},
 		NumpinInf:        &numpin.Config{},
 		TagsInf:          &tags.Config{},
@@ -238,6 +287,7 @@ func (ch *ConfigHelper) init() {
 		Tracing:          &observations.TracingConfig{},
 		Badger:           &badger.Config{},
 		LevelDB:          &leveldb.Config{},
+		Dispatcher:       &dispatcher.Config{},
 	}
 	man.RegisterComponent(config.Cluster, cfgs.Cluster)
 	man.RegisterComponent(config.API, cfgs.Restapi)
@@ -246,13 +296,29 @@ func (ch *ConfigHelper) init() {
 	man.RegisterComponent(config.IPFSConn, cfgs.Ipfshttp)
 	man.RegisterComponent(config.PinTracker, cfgs.Statelesstracker)
 	man.RegisterComponent(config.Monitor, cfgs.Pubsubmon)
-	man.RegisterComponent(config.Allocator, cfgs.BalancedAlloc)
 	man.RegisterComponent(config.Informer, cfgs.DiskInf)
 	// man.RegisterComponent(config.Informer, cfgs.Numpininf)
 	man.RegisterComponent(config.Informer, cfgs.TagsInf)
 	man.RegisterComponent(config.Informer, cfgs.PinQueueInf)
 	man.RegisterComponent(config.Observations, cfgs.Metrics)
 	man.RegisterComponent(config.Observations, cfgs.Tracing)
+	man.RegisterComponent(config.Alerts, cfgs.Dispatcher)
+
+	switch ch.allocator {
+	case cfgs.BalancedAlloc.ConfigKey():
+		man.RegisterComponent(config.Allocator, cfgs.BalancedAlloc)
+	case cfgs.WeightedAlloc.ConfigKey():
+		man.RegisterComponent(config.Allocator, cfgs.WeightedAlloc)
+	case cfgs.FillFirstAlloc.ConfigKey():
+		man.RegisterComponent(config.Allocator, cfgs.FillFirstAlloc)
+	case cfgs.LatencyAlloc.ConfigKey():
+		man.RegisterComponent(config.Allocator, cfgs.LatencyAlloc)
+	default:
+		man.RegisterComponent(config.Allocator, cfgs.BalancedAlloc)
+		man.RegisterComponent(config.Allocator, cfgs.WeightedAlloc)
+		man.RegisterComponent(config.Allocator, cfgs.FillFirstAlloc)
+		man.RegisterComponent(config.Allocator, cfgs.LatencyAlloc)
+	}
 
 	registerDatastores := false
 
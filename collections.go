@@ -0,0 +1,333 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/state"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	"go.opencensus.io/trace"
+)
+
+// This file gathers the logic to manage collections. A collection is a
+// named group of pins stored in the shared state as a CollectionType pin,
+// whose CID is derived from the name. The collection carries the
+// PinOptions used for its members. Members are regular pins which list
+// the collection CID among their Parents, so that an item can belong to
+// several collections and is only unpinned when it leaves the last one.
+
+// ErrCollectionExists is returned when creating a collection with a name
+// which is already in use.
+var ErrCollectionExists = errors.New("collection already exists")
+
+// CollectionCreate creates a new, empty collection with the given name. The
+// given options are applied to every item added to the collection.
+func (c *Cluster) CollectionCreate(ctx context.Context, name string, opts api.PinOptions) (api.Pin, error) {
+	_, span := trace.StartSpan(ctx, "cluster/CollectionCreate")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	pin, err := api.CollectionPin(name, opts)
+	if err != nil {
+		return api.Pin{}, err
+	}
+
+	_, err = c.PinGet(ctx, pin.Cid)
+	if err == nil {
+		return api.Pin{}, ErrCollectionExists
+	}
+	if err != state.ErrNotFound {
+		return api.Pin{}, err
+	}
+
+	result, _, err := c.pin(ctx, pin, []peer.ID{})
+	return result, err
+}
+
+// collection returns the collection with the given name from the shared
+// state.
+func (c *Cluster) collection(ctx context.Context, name string) (api.Pin, error) {
+	ci, err := api.CollectionCid(name)
+	if err != nil {
+		return api.Pin{}, err
+	}
+	pin, err := c.PinGet(ctx, ci)
+	if err != nil {
+		return api.Pin{}, err
+	}
+	if pin.Type != api.CollectionType {
+		return api.Pin{}, fmt.Errorf("%s is not a collection", ci)
+	}
+	return pin, nil
+}
+
+// CollectionAdd pins the given CIDs as members of the collection, using
+// the collection options. The options of items which are already pinned
+// are merged with those of the collection (see mergeMemberOptions). It
+// returns the pins as stored in the shared state.
+func (c *Cluster) CollectionAdd(ctx context.Context, name string, cids []api.Cid) ([]api.Pin, error) {
+	_, span := trace.StartSpan(ctx, "cluster/CollectionAdd")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	coll, err := c.collection(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := coll.PinOptions
+	opts.Name = ""
+	opts.ExpireAt = time.Time{} // the collection expiration applies
+	opts.PinUpdate = api.CidUndef
+
+	pins := make([]api.Pin, 0, len(cids))
+	for _, ci := range cids {
+		pin := api.PinWithOpts(ci, opts)
+		existing, err := c.PinGet(ctx, ci)
+		if err != nil && err != state.ErrNotFound {
+			return pins, err
+		}
+		if err == nil {
+			if existing.Type != api.DataType {
+				return pins, fmt.Errorf("%s: only regular pins can be added to a collection", ci)
+			}
+			pin = api.PinWithOpts(ci, mergeMemberOptions(existing.PinOptions, opts))
+		}
+
+		result, _, err := c.pinWithParents(ctx, pin, []peer.ID{}, []api.Cid{coll.Cid})
+		if err != nil {
+			return pins, fmt.Errorf("error adding %s to %s: %w", ci, name, err)
+		}
+		pins = append(pins, result)
+	}
+	return pins, nil
+}
+
+// mergeMemberOptions returns the options for an existing pin which is added
+// to a collection. The highest replication factors and priority win,
+// metadata and placement constraints are combined, and anything else is
+// kept from the existing pin. The expiration is cleared, as that
+// of the collection applies.
+func mergeMemberOptions(existing, coll api.PinOptions) api.PinOptions {
+	opts := existing
+	opts.ExpireAt = time.Time{}
+	opts.PinUpdate = api.CidUndef
+
+	if existing.ReplicationFactorMin == -1 || coll.ReplicationFactorMin == -1 ||
+		existing.ReplicationFactorMax == -1 || coll.ReplicationFactorMax == -1 {
+		opts.ReplicationFactorMin = -1
+		opts.ReplicationFactorMax = -1
+	} else {
+		if coll.ReplicationFactorMin > opts.ReplicationFactorMin {
+			opts.ReplicationFactorMin = coll.ReplicationFactorMin
+		}
+		if coll.ReplicationFactorMax > opts.ReplicationFactorMax {
+			opts.ReplicationFactorMax = coll.ReplicationFactorMax
+		}
+	}
+
+	if coll.Priority > opts.Priority {
+		opts.Priority = coll.Priority
+	}
+
+	if len(coll.Metadata) > 0 {
+		opts.Metadata = make(map[string]string, len(existing.Metadata)+len(coll.Metadata))
+		for k, v := range coll.Metadata {
+			opts.Metadata[k] = v
+		}
+		for k, v := range existing.Metadata {
+			opts.Metadata[k] = v
+		}
+	}
+
+	if len(opts.UserAllocations) == 0 {
+		opts.UserAllocations = coll.UserAllocations
+	}
+	opts.AntiAffinity = mergeStrings(existing.AntiAffinity, coll.AntiAffinity)
+	opts.Spread = mergeStrings(existing.Spread, coll.Spread)
+
+	return opts
+}
+
+// mergeStrings returns the strings in a followed by those in b which are
+// not in a.
+func mergeStrings(a, b []string) []string {
+	out := a
+	for _, s := range b {
+		if !containsString(a, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// CollectionRemove removes the given CIDs from the collection. Items that
+// do not belong to any other collection are unpinned.
+func (c *Cluster) CollectionRemove(ctx context.Context, name string, cids []api.Cid) error {
+	_, span := trace.StartSpan(ctx, "cluster/CollectionRemove")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	if c.config.FollowerMode {
+		return errFollowerMode
+	}
+
+	coll, err := c.collection(ctx, name)
+	if err != nil {
+		return err
+	}
+	return c.removeCollectionMembers(ctx, coll.Cid, cids)
+}
+
+// CollectionStatus returns the status of a collection, aggregated across
+// its members. For every peer, it reports the status of the member in
+// the worst condition, so that, for example, a collection is only shown
+// as pinned on a peer when none of its members are in error or still
+// being pinned there.
+func (c *Cluster) CollectionStatus(ctx context.Context, name string) (api.GlobalPinInfo, error) {
+	_, span := trace.StartSpan(ctx, "cluster/CollectionStatus")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	coll, err := c.collection(ctx, name)
+	if err != nil {
+		return api.GlobalPinInfo{}, err
+	}
+
+	members, err := c.collectionMembers(ctx, coll.Cid)
+	if err != nil {
+		return api.GlobalPinInfo{}, err
+	}
+
+	gpin := api.GlobalPinInfo{
+		Cid:         coll.Cid,
+		Name:        coll.Name,
+		Allocations: []peer.ID{},
+		Origins:     coll.Origins,
+		Created:     coll.Timestamp,
+		Metadata:    coll.Metadata,
+		Priority:    coll.Priority,
+		PeerMap:     make(map[string]api.PinInfoShort),
+	}
+
+	cids := make([]api.Cid, len(members))
+	for i, m := range members {
+		cids[i] = m.Cid
+	}
+	gpis, err := c.globalPinInfoCids(ctx, cids)
+	if err != nil {
+		return api.GlobalPinInfo{}, err
+	}
+
+	for _, mgpin := range gpis {
+		for p, pis := range mgpin.PeerMap {
+			cur, ok := gpin.PeerMap[p]
+			if !ok || collectionStatusRank(pis.Status) > collectionStatusRank(cur.Status) {
+				gpin.PeerMap[p] = pis
+			}
+		}
+	}
+	return gpin, nil
+}
+
+// collectionStatusRank orders tracker statuses by how much attention they
+// need, in order to pick the one that represents a collection on a peer.
+func collectionStatusRank(st api.TrackerStatus) int {
+	switch {
+	case st.Match(api.TrackerStatusError | api.TrackerStatusUnexpectedlyUnpinned | api.TrackerStatusCorrupted):
+		return 5
+	case st.Match(api.TrackerStatusQueued | api.TrackerStatusPinning | api.TrackerStatusUnpinning):
+		return 4
+	case st == api.TrackerStatusPinned:
+		return 3
+	case st == api.TrackerStatusRemote:
+		return 2
+	case st == api.TrackerStatusUnpinned:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// collectionMembers returns the pins which belong to the given
+// collection.
+func (c *Cluster) collectionMembers(ctx context.Context, coll api.Cid) ([]api.Pin, error) {
+	ctx, span := trace.StartSpan(ctx, "cluster/collectionMembers")
+	defer span.End()
+
+	query := api.PinQuery{
+		Parent: coll,
+	}
+	statePins := make(chan api.Pin, 1024)
+	queryErr := make(chan error, 1)
+	go func() {
+		queryErr <- c.PinsQuery(ctx, query, statePins)
+	}()
+
+	var members []api.Pin
+	for p := range statePins {
+		members = append(members, p)
+	}
+	return members, <-queryErr
+}
+
+// removeCollectionMembers removes the given CIDs from the collection, or
+// all the members when cids is nil. Members are unpinned when the
+// collection was their last parent.
+func (c *Cluster) removeCollectionMembers(ctx context.Context, coll api.Cid, cids []api.Cid) error {
+	ctx, span := trace.StartSpan(ctx, "cluster/removeCollectionMembers")
+	defer span.End()
+
+	var members []api.Pin
+	if cids == nil {
+		var err error
+		members, err = c.collectionMembers(ctx, coll)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, ci := range cids {
+			pin, err := c.PinGet(ctx, ci)
+			if err == state.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			members = append(members, pin)
+		}
+	}
+
+	for _, pin := range members {
+		if !pin.HasParent(coll) {
+			logger.Warnf("%s is not a member of %s", pin.Cid, coll)
+			continue
+		}
+
+		if len(pin.Parents) == 1 {
+			err := c.logUnpin(ctx, pin)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		parents := make([]api.Cid, 0, len(pin.Parents)-1)
+		for _, p := range pin.Parents {
+			if !p.Equals(coll) {
+				parents = append(parents, p)
+			}
+		}
+		pin.Parents = parents
+		err := c.consensus.LogPin(ctx, pin)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -76,6 +76,7 @@ const (
 	Informer
 	Observations
 	Datastore
+	Alerts
 	endTypes // keep this at the end
 )
 
@@ -207,6 +208,7 @@ type jsonConfig struct {
 	Informer     jsonSection      `json:"informer,omitempty"`
 	Observations jsonSection      `json:"observations,omitempty"`
 	Datastore    jsonSection      `json:"datastore,omitempty"`
+	Alerts       jsonSection      `json:"alerts,omitempty"`
 }
 
 func (jcfg *jsonConfig) getSection(i SectionType) *jsonSection {
@@ -231,6 +233,8 @@ func (jcfg *jsonConfig) getSection(i SectionType) *jsonSection {
 		return &jcfg.Observations
 	case Datastore:
 		return &jcfg.Datastore
+	case Alerts:
+		return &jcfg.Alerts
 	default:
 		return nil
 	}
@@ -61,6 +61,11 @@ var mockJSON = []byte(`{
     "mock": {
       "a": "b"
     }
+  },
+  "alerts": {
+    "mock": {
+      "a": "b"
+    }
   }
 }`)
 
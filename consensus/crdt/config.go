@@ -83,6 +83,13 @@ type Config struct {
 	// datastore is marked dirty.
 	RepairInterval time.Duration
 
+	// StateIndexes enables the secondary indexes of the shared state,
+	// which speed up pinset queries by name, metadata, expiry,
+	// allocation and parent at the cost of additional writes. Indexes
+	// are kept locally by every peer. The names of removed pins, which
+	// are included in pinset removal events, are only known with them.
+	StateIndexes bool
+
 	// Tracing enables propagation of contexts across binary boundaries.
 	Tracing bool
 }
@@ -102,6 +109,7 @@ type jsonConfig struct {
 
 	PeersetMetric      string `json:"peerset_metric,omitempty"`
 	DatastoreNamespace string `json:"datastore_namespace,omitempty"`
+	StateIndexes       bool   `json:"state_indexes,omitempty"`
 }
 
 // ConfigKey returns the section name for this type of configuration.
@@ -171,6 +179,7 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 	config.SetIfNotDefault(jcfg.Batching.MaxQueueSize, &cfg.Batching.MaxQueueSize)
 	config.SetIfNotDefault(jcfg.PeersetMetric, &cfg.PeersetMetric)
 	config.SetIfNotDefault(jcfg.DatastoreNamespace, &cfg.DatastoreNamespace)
+	cfg.StateIndexes = jcfg.StateIndexes
 	config.ParseDurations(
 		"crdt",
 		&config.DurationOpt{Duration: jcfg.RebroadcastInterval, Dst: &cfg.RebroadcastInterval, Name: "rebroadcast_interval"},
@@ -192,6 +201,7 @@ func (cfg *Config) toJSONConfig() *jsonConfig {
 		ClusterName:         cfg.ClusterName,
 		PeersetMetric:       "",
 		RebroadcastInterval: "",
+		StateIndexes:        cfg.StateIndexes,
 	}
 
 	if cfg.TrustAll {
@@ -240,6 +250,7 @@ func (cfg *Config) Default() error {
 		MaxQueueSize: DefaultBatchingMaxQueueSize,
 	}
 	cfg.RepairInterval = DefaultRepairInterval
+	cfg.StateIndexes = false
 	return nil
 }
 
@@ -15,7 +15,8 @@ var cfgJSON = []byte(`
         "max_batch_age": "5s",
         "max_queue_size": 150
     },
-    "repair_interval": "1m"
+    "repair_interval": "1m",
+    "state_indexes": true
 }
 `)
 
@@ -37,6 +38,9 @@ func TestLoadJSON(t *testing.T) {
 	if cfg.RepairInterval != time.Minute {
 		t.Error("repair interval not set")
 	}
+	if !cfg.StateIndexes {
+		t.Error("expected state_indexes to be enabled")
+	}
 
 	cfg = &Config{}
 	err = cfg.LoadJSON([]byte(`
@@ -37,6 +37,7 @@ var logger = logging.Logger("crdt")
 
 var (
 	blocksNs   = "b" // blockstore namespace
+	indexNs    = "i" // secondary indexes namespace
 	connMgrTag = "crdt"
 )
 
@@ -79,6 +80,11 @@ type Consensus struct {
 	crdt          *crdt.Datastore
 	ipfs          *ipfslite.Peer
 
+	// indexedState updates the secondary indexes when enabled. Updates
+	// wait for indexReady.
+	indexedState *dsstate.State
+	indexReady   chan struct{}
+
 	dht    routing.Routing
 	pubsub *pubsub.PubSub
 
@@ -149,6 +155,7 @@ func New(
 		rpcReady:       make(chan struct{}, 1),
 		readyCh:        make(chan struct{}, 1),
 		stateReady:     make(chan struct{}, 1),
+		indexReady:     make(chan struct{}),
 		sendToBatchCh:  make(chan batchItem),
 		batchItemCh:    make(chan batchItem, cfg.Batching.MaxQueueSize),
 		batchingDone:   make(chan struct{}),
@@ -228,6 +235,12 @@ func (css *Consensus) setup() {
 			return
 		}
 
+		if css.waitForIndexes() {
+			if err := css.indexedState.IndexPin(ctx, pin); err != nil {
+				logger.Errorf("error indexing %s: %s", pin.Cid, err)
+			}
+		}
+
 		// TODO: tracing for this context
 		err = css.rpcClient.CallContext(
 			ctx,
@@ -257,7 +270,19 @@ func (css *Consensus) setup() {
 			return
 		}
 
+		// The pin is gone from the state by now. Its name, which
+		// is included in the removal events, can only be obtained
+		// from the name index.
 		pin := api.PinCid(c)
+		if css.waitForIndexes() {
+			pin.Name, err = css.indexedState.IndexedName(ctx, c)
+			if err != nil {
+				logger.Errorf("error reading the indexed name of %s: %s", c, err)
+			}
+			if err := css.indexedState.UnindexPin(ctx, c); err != nil {
+				logger.Errorf("error unindexing %s: %s", c, err)
+			}
+		}
 
 		err = css.rpcClient.CallContext(
 			ctx,
@@ -314,6 +339,24 @@ func (css *Consensus) setup() {
 	}
 	css.batchingState = batchingState
 
+	if css.config.StateIndexes {
+		// Index entries are local to this peer: they are kept
+		// outside the crdt datastore and updated by the hooks.
+		indexNamespace := css.namespace.ChildString(indexNs).String()
+		clusterState.SetIndexDatastore(css.store, indexNamespace)
+		batchingState.SetIndexDatastore(css.store, indexNamespace)
+		err = clusterState.EnableIndexes(css.ctx, dsstate.AllIndexes)
+		if err == nil {
+			err = batchingState.EnableIndexes(css.ctx, dsstate.AllIndexes)
+		}
+		if err != nil {
+			logger.Errorf("error enabling the state indexes: %s", err)
+			return
+		}
+		css.indexedState = clusterState
+		close(css.indexReady)
+	}
+
 	if css.config.TrustAll {
 		logger.Info("'trust all' mode enabled. Any peer in the cluster can modify the pinset.")
 	}
@@ -639,6 +682,20 @@ func (css *Consensus) RmPeer(ctx context.Context, pid peer.ID) error {
 	return ErrRmPeer
 }
 
+// waitForIndexes returns true when the secondary indexes are enabled, once
+// they are ready to be updated.
+func (css *Consensus) waitForIndexes() bool {
+	if !css.config.StateIndexes {
+		return false
+	}
+	select {
+	case <-css.ctx.Done():
+		return false
+	case <-css.indexReady:
+		return true
+	}
+}
+
 // State returns the cluster shared state. It will block until the consensus
 // component is ready, shutdown or the given context has been canceled.
 func (css *Consensus) State(ctx context.Context) (state.ReadOnly, error) {
@@ -10,6 +10,7 @@ import (
 	"github.com/lubanproj/ipfs-cluster/datastore/inmem"
 	"github.com/lubanproj/ipfs-cluster/test"
 
+	query "github.com/ipfs/go-datastore/query"
 	ipns "github.com/ipfs/go-ipns"
 	libp2p "github.com/libp2p/go-libp2p"
 	host "github.com/libp2p/go-libp2p-core/host"
@@ -140,6 +141,64 @@ func TestConsensusPin(t *testing.T) {
 	}
 }
 
+func TestConsensusStateIndexes(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.StateIndexes = true
+	cc := testingConsensusWithCfg(t, 1, cfg)
+	defer clean(t, cc)
+	defer cc.Shutdown(ctx)
+
+	queryMeta := func() []api.Pin {
+		st, err := cc.State(ctx)
+		if err != nil {
+			t.Fatal("error getting state:", err)
+		}
+		out := make(chan api.Pin, 10)
+		err = st.Query(ctx, api.PinQuery{Metadata: map[string]string{"team": "a"}}, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pins []api.Pin
+		for p := range out {
+			pins = append(pins, p)
+		}
+		return pins
+	}
+
+	pin := testPin(test.Cid1)
+	pin.Metadata = map[string]string{"team": "a"}
+	err := cc.LogPin(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+
+	if pins := queryMeta(); len(pins) != 1 || !pins[0].Cid.Equals(test.Cid1) {
+		t.Error("the added pin should be found by the index")
+	}
+
+	// Index entries are not part of the shared state.
+	results, err := cc.crdt.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := results.Rest()
+	if len(entries) != 1 {
+		t.Errorf("expected only the pin in the crdt datastore, got %d keys", len(entries))
+	}
+
+	err = cc.LogUnpin(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if pins := queryMeta(); len(pins) != 0 {
+		t.Error("the removed pin should not be found by the index")
+	}
+}
+
 func TestConsensusUnpin(t *testing.T) {
 	ctx := context.Background()
 	cc := testingConsensus(t, 1)
@@ -64,6 +64,10 @@ type Config struct {
 	BackupsRotate int
 	// Namespace to use when writing keys to the datastore
 	DatastoreNamespace string
+	// StateIndexes enables the secondary indexes of the shared state,
+	// which speed up pinset queries by name, metadata, expiry and
+	// allocation at the cost of additional writes.
+	StateIndexes bool
 
 	// A Hashicorp Raft's configuration object.
 	RaftConfig *hraft.Config
@@ -106,6 +110,9 @@ type jsonConfig struct {
 
 	DatastoreNamespace string `json:"datastore_namespace,omitempty"`
 
+	// StateIndexes enables the secondary indexes of the shared state.
+	StateIndexes bool `json:"state_indexes,omitempty"`
+
 	// HeartbeatTimeout specifies the time in follower state without
 	// a leader before we attempt an election.
 	HeartbeatTimeout string `json:"heartbeat_timeout,omitempty"`
@@ -224,6 +231,7 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 	cfg.CommitRetries = jcfg.CommitRetries
 	config.SetIfNotDefault(commitRetryDelay, &cfg.CommitRetryDelay)
 	config.SetIfNotDefault(jcfg.BackupsRotate, &cfg.BackupsRotate)
+	cfg.StateIndexes = jcfg.StateIndexes
 
 	// Raft values
 	config.SetIfNotDefault(heartbeatTimeout, &cfg.RaftConfig.HeartbeatTimeout)
@@ -255,6 +263,7 @@ func (cfg *Config) toJSONConfig() *jsonConfig {
 		CommitRetries:        cfg.CommitRetries,
 		CommitRetryDelay:     cfg.CommitRetryDelay.String(),
 		BackupsRotate:        cfg.BackupsRotate,
+		StateIndexes:         cfg.StateIndexes,
 		HeartbeatTimeout:     cfg.RaftConfig.HeartbeatTimeout.String(),
 		ElectionTimeout:      cfg.RaftConfig.ElectionTimeout.String(),
 		CommitTimeout:        cfg.RaftConfig.CommitTimeout.String(),
@@ -281,6 +290,7 @@ func (cfg *Config) Default() error {
 	cfg.CommitRetryDelay = DefaultCommitRetryDelay
 	cfg.BackupsRotate = DefaultBackupsRotate
 	cfg.DatastoreNamespace = DefaultDatastoreNamespace
+	cfg.StateIndexes = false
 	cfg.RaftConfig = hraft.DefaultConfig()
 
 	// These options are imposed over any Default Raft Config.
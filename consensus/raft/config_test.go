@@ -23,7 +23,8 @@ var cfgJSON = []byte(`
     "trailing_logs": 10240,
     "snapshot_interval": "2m0s",
     "snapshot_threshold": 8192,
-    "leader_lease_timeout": "500ms"
+    "leader_lease_timeout": "500ms",
+    "state_indexes": true
 }
 `)
 
@@ -33,6 +34,9 @@ func TestLoadJSON(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if !cfg.StateIndexes {
+		t.Error("expected state_indexes to be enabled")
+	}
 
 	j := &jsonConfig{}
 	json.Unmarshal(cfgJSON, j)
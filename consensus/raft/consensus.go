@@ -85,6 +85,13 @@ func NewConsensus(
 		cancel()
 		return nil, err
 	}
+	if cfg.StateIndexes {
+		err = state.EnableIndexes(ctx, dsstate.AllIndexes)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
 	consensus := libp2praft.NewOpLog(state, baseOp)
 	raft, err := newRaftWrapper(host, cfg, consensus.FSM(), staging)
 	if err != nil {
@@ -34,8 +34,21 @@ type LogOp struct {
 	tracing   bool              `codec:"-"`
 }
 
+// reset clears the operation, keeping the consensus it belongs to.
+func (op *LogOp) reset() {
+	*op = LogOp{
+		consensus: op.consensus,
+		tracing:   op.tracing,
+	}
+}
+
 // ApplyTo applies the operation to the State
 func (op *LogOp) ApplyTo(cstate consensus.State) (consensus.State, error) {
+	// The FSM decodes every log entry into the same op, and decoding
+	// leaves fields which are omitted in the entry untouched, so the
+	// op is reset once applied.
+	defer op.reset()
+
 	var err error
 	ctx := context.Background()
 	if op.tracing {
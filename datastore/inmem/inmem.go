@@ -3,12 +3,32 @@
 package inmem
 
 import (
+	"context"
+
 	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
 	sync "github.com/ipfs/go-datastore/sync"
 )
 
-// New returns a new thread-safe in-memory go-datastore.
+// New returns a new thread-safe in-memory go-datastore. Like the persistent
+// datastores, it returns query results in key order when the query sets no
+// other order.
 func New() ds.Datastore {
 	mapDs := ds.NewMapDatastore()
-	return sync.MutexWrap(mapDs)
+	return &orderedDatastore{sync.MutexWrap(mapDs)}
+}
+
+// orderedDatastore sorts query results by key, as map iteration
+// order is random.
+type orderedDatastore struct {
+	*sync.MutexDatastore
+}
+
+// Query runs the query on the wrapped datastore, ordering results by key
+// unless the query sets its own order.
+func (ods *orderedDatastore) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	if len(q.Orders) == 0 {
+		q.Orders = []query.Order{query.OrderByKey{}}
+	}
+	return ods.MutexDatastore.Query(ctx, q)
 }
@@ -0,0 +1,466 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/state"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	"go.opencensus.io/trace"
+)
+
+// This file contains peer draining. Removing a peer right away leaves its
+// pins under-replicated until they are re-allocated. Draining moves every
+// pin allocated to the peer to other peers first, waiting until they are
+// pinned there, and only then (optionally) removes the peer.
+//
+// Drains are stored in the shared state as records (see api.RecordPin), so
+// every peer leaves drained peers out of new allocations and can report on
+// a drain. The coordinator (the peer running the drain) moves the pins,
+// keeps the record up to date and resumes the drain if it restarts.
+
+const drainRecordKind = "drain"
+
+// drainMaxPasses is the maximum number of times that the pinset is scanned
+// for pins allocated to a drained peer. Other peers may keep allocating
+// pins to it until they see the drain record.
+var drainMaxPasses = 3
+
+var errNoDrain = errors.New("the peer is not being drained")
+
+// drain tracks a drain run by this peer.
+type drain struct {
+	status api.DrainStatus
+	cancel context.CancelFunc
+	// closed when the drain stops running.
+	done chan struct{}
+}
+
+// PeerDrain starts draining the given peer in the background and returns
+// its initial status. The peer does not receive new allocations until the
+// drain is cancelled or the peer is removed, which happens once all its pins
+// have been moved when remove is true. Use PeerDrainStatus to follow the
+// progress.
+func (c *Cluster) PeerDrain(ctx context.Context, pid peer.ID, remove bool) (api.DrainStatus, error) {
+	_, span := trace.StartSpan(ctx, "cluster/PeerDrain")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	if c.config.FollowerMode {
+		return api.DrainStatus{}, errFollowerMode
+	}
+
+	peers, err := c.consensus.Peers(ctx)
+	if err != nil {
+		return api.DrainStatus{}, err
+	}
+	if !containsPeer(peers, pid) {
+		return api.DrainStatus{}, fmt.Errorf("%s is not a cluster peer", pid)
+	}
+	if remove && pid == c.id {
+		return api.DrainStatus{}, errors.New("a peer cannot remove itself after draining. Drain it from a different peer")
+	}
+
+	c.drainsMux.Lock()
+	defer c.drainsMux.Unlock()
+
+	current, err := c.drainRecord(ctx, pid)
+	switch {
+	case err == nil && current.Phase == api.DrainPhaseDraining:
+		return current, fmt.Errorf("%s is already being drained by %s", pid, current.Coordinator)
+	case err != nil && err != errNoDrain:
+		return api.DrainStatus{}, err
+	}
+	// A previous drain may still be running here if it was cancelled
+	// from a peer which could not reach this one.
+	if d, ok := c.drains[pid]; ok {
+		d.cancel()
+	}
+
+	status := api.DrainStatus{
+		Peer:        pid,
+		Coordinator: c.id,
+		Remove:      remove,
+		Phase:       api.DrainPhaseDraining,
+		Started:     time.Now(),
+	}
+	err = c.saveDrainRecord(ctx, status)
+	if err != nil {
+		return api.DrainStatus{}, err
+	}
+
+	logger.Infof("draining %s", pid)
+	c.startDrain(status)
+	return status, nil
+}
+
+// startDrain runs the drain with the given status in the background. It
+// must be called with the drainsMux held.
+func (c *Cluster) startDrain(status api.DrainStatus) {
+	dctx, cancel := context.WithCancel(c.ctx)
+	d := &drain{
+		status: status,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	c.drains[status.Peer] = d
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer close(d.done)
+		c.drainPeer(dctx, d)
+	}()
+}
+
+// resumeDrains restarts the drains coordinated by this peer which had not
+// finished when it shut down.
+func (c *Cluster) resumeDrains(ctx context.Context) {
+	out := make(chan api.Pin, 1024)
+	go func() {
+		err := c.PinsQuery(ctx, api.PinQuery{Type: api.RecordType, Name: drainRecordKind + "/"}, out)
+		if err != nil {
+			logger.Error(err)
+		}
+	}()
+
+	c.drainsMux.Lock()
+	defer c.drainsMux.Unlock()
+	for pin := range out {
+		var status api.DrainStatus
+		if err := pin.RecordValue(&status); err != nil {
+			logger.Errorf("error decoding drain record %s: %s", pin.Name, err)
+			continue
+		}
+		if status.Coordinator != c.id || status.Phase != api.DrainPhaseDraining {
+			continue
+		}
+		if _, ok := c.drains[status.Peer]; ok {
+			continue
+		}
+		logger.Infof("resuming the drain of %s", status.Peer)
+		c.startDrain(status)
+	}
+}
+
+// PeerDrainStatus returns the progress of the drain of the given peer.
+func (c *Cluster) PeerDrainStatus(ctx context.Context, pid peer.ID) (api.DrainStatus, error) {
+	_, span := trace.StartSpan(ctx, "cluster/PeerDrainStatus")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	// Drains run by this peer have the latest progress.
+	c.drainsMux.Lock()
+	d, ok := c.drains[pid]
+	var status api.DrainStatus
+	if ok {
+		status = d.status
+	}
+	c.drainsMux.Unlock()
+	if ok && status.Phase == api.DrainPhaseDraining {
+		return status, nil
+	}
+	return c.drainRecord(ctx, pid)
+}
+
+// PeerDrainCancel stops the drain of the given peer. Pins already moved stay
+// where they are and the peer can receive new allocations again. Drains
+// coordinated by other peers are cancelled by them, unless they cannot be
+// contacted.
+func (c *Cluster) PeerDrainCancel(ctx context.Context, pid peer.ID) (api.DrainStatus, error) {
+	_, span := trace.StartSpan(ctx, "cluster/PeerDrainCancel")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	status, err := c.drainRecord(ctx, pid)
+	if err != nil {
+		return api.DrainStatus{}, err
+	}
+
+	switch status.Phase {
+	case api.DrainPhaseRemoved, api.DrainPhaseCancelled:
+		return status, fmt.Errorf("the drain of %s has already finished", pid)
+	}
+
+	if status.Coordinator != c.id && status.Phase == api.DrainPhaseDraining {
+		var remote api.DrainStatus
+		err := c.rpcClient.CallContext(
+			ctx,
+			status.Coordinator,
+			"Cluster",
+			"PeerDrainCancel",
+			pid,
+			&remote,
+		)
+		if err == nil {
+			return remote, nil
+		}
+		logger.Warnf("cancelling the drain of %s in %s: %s. Cancelling it here", pid, status.Coordinator, err)
+	}
+
+	c.drainsMux.Lock()
+	d, ok := c.drains[pid]
+	delete(c.drains, pid)
+	c.drainsMux.Unlock()
+	if ok {
+		d.cancel()
+		<-d.done
+	}
+
+	status.Phase = api.DrainPhaseCancelled
+	status.Moving = api.CidUndef
+	status.Finished = time.Now()
+	err = c.saveDrainRecord(ctx, status)
+	if err != nil {
+		return status, err
+	}
+	logger.Infof("cancelled the drain of %s", pid)
+	return status, nil
+}
+
+// drainRecord returns the status of the drain of the given peer from the
+// shared state.
+func (c *Cluster) drainRecord(ctx context.Context, pid peer.ID) (api.DrainStatus, error) {
+	var status api.DrainStatus
+	ci, err := api.RecordCid(drainRecordKind, peer.Encode(pid))
+	if err != nil {
+		return status, err
+	}
+	pin, err := c.PinGet(ctx, ci)
+	if err == state.ErrNotFound {
+		return status, errNoDrain
+	}
+	if err != nil {
+		return status, err
+	}
+	err = pin.RecordValue(&status)
+	return status, err
+}
+
+// saveDrainRecord stores the status of a drain in the shared state.
+func (c *Cluster) saveDrainRecord(ctx context.Context, status api.DrainStatus) error {
+	pin, err := api.RecordPin(drainRecordKind, peer.Encode(status.Peer), status)
+	if err != nil {
+		return err
+	}
+	return c.consensus.LogPin(ctx, pin)
+}
+
+// setDrain modifies the status of a drain run by this peer.
+func (c *Cluster) setDrain(d *drain, f func(status *api.DrainStatus)) api.DrainStatus {
+	c.drainsMux.Lock()
+	defer c.drainsMux.Unlock()
+	f(&d.status)
+	return d.status
+}
+
+// updateDrain modifies the status of a drain run by this peer and stores it
+// in the shared state.
+func (c *Cluster) updateDrain(ctx context.Context, d *drain, f func(status *api.DrainStatus)) {
+	status := c.setDrain(d, f)
+
+	// A cancelled drain must not overwrite the cancellation.
+	if ctx.Err() != nil {
+		return
+	}
+	err := c.saveDrainRecord(ctx, status)
+	if err != nil {
+		logger.Errorf("error saving the drain of %s: %s", status.Peer, err)
+	}
+}
+
+// drainCancelled returns true when the drain of the peer has been
+// cancelled in the shared state, i.e. by a peer which could not contact
+// this one.
+func (c *Cluster) drainCancelled(ctx context.Context, pid peer.ID) bool {
+	status, err := c.drainRecord(ctx, pid)
+	return err == nil && status.Phase == api.DrainPhaseCancelled
+}
+
+// unallocatablePeers returns the peers that should not get new allocations
+// and the reason why.
+func (c *Cluster) unallocatablePeers(ctx context.Context) map[peer.ID]string {
+	unallocatable := make(map[peer.ID]string)
+	for pid := range c.peersInMaintenance(ctx) {
+		unallocatable[pid] = "maintenance"
+	}
+
+	peers, err := c.consensus.Peers(ctx)
+	if err != nil {
+		logger.Error(err)
+		return unallocatable
+	}
+	for _, pid := range peers {
+		status, err := c.drainRecord(ctx, pid)
+		if err != nil {
+			continue
+		}
+		switch status.Phase {
+		case api.DrainPhaseDraining, api.DrainPhaseDone, api.DrainPhaseFailed:
+			unallocatable[pid] = "draining"
+		}
+	}
+	return unallocatable
+}
+
+// drainPeer moves all the pins allocated to the drained peer to other
+// peers and removes it when requested.
+func (c *Cluster) drainPeer(ctx context.Context, d *drain) {
+	ctx, span := trace.StartSpan(ctx, "cluster/drainPeer")
+	defer span.End()
+
+	pid := d.status.Peer
+	finish := func(phase string, err error) {
+		c.updateDrain(ctx, d, func(status *api.DrainStatus) {
+			status.Phase = phase
+			status.Moving = api.CidUndef
+			status.Finished = time.Now()
+			if err != nil {
+				status.Error = err.Error()
+			}
+		})
+		if err != nil {
+			logger.Errorf("draining %s: %s", pid, err)
+		} else {
+			logger.Infof("drained %s: %s", pid, phase)
+		}
+	}
+
+	seen := make(map[api.Cid]struct{})
+	failed := make(map[api.Cid]struct{})
+	for pass := 0; ; pass++ {
+		pins, err := c.pinsAllocatedTo(ctx, pid)
+		if ctx.Err() != nil {
+			return // cancelled
+		}
+		if err != nil {
+			finish(api.DrainPhaseFailed, err)
+			return
+		}
+
+		var pending []api.Pin
+		for _, pin := range pins {
+			if _, ok := failed[pin.Cid]; !ok {
+				pending = append(pending, pin)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		if pass == drainMaxPasses {
+			finish(api.DrainPhaseFailed, fmt.Errorf("%d pins are still being allocated to the peer", len(pending)))
+			return
+		}
+
+		for _, pin := range pending {
+			if c.drainCancelled(ctx, pid) {
+				logger.Infof("the drain of %s was cancelled", pid)
+				return
+			}
+
+			c.setDrain(d, func(status *api.DrainStatus) {
+				if _, ok := seen[pin.Cid]; !ok {
+					seen[pin.Cid] = struct{}{}
+					status.Pins++
+				}
+				status.Moving = pin.Cid
+			})
+
+			err := c.drainPin(ctx, pin, pid)
+			if ctx.Err() != nil {
+				return // cancelled
+			}
+			if err != nil {
+				logger.Errorf("draining %s: error moving %s: %s", pid, pin.Cid, err)
+				failed[pin.Cid] = struct{}{}
+				c.updateDrain(ctx, d, func(status *api.DrainStatus) {
+					status.Failed++
+					status.Error = fmt.Sprintf("%s: %s", pin.Cid, err)
+				})
+				continue
+			}
+			c.updateDrain(ctx, d, func(status *api.DrainStatus) {
+				status.Moved++
+			})
+		}
+	}
+
+	if len(failed) > 0 {
+		finish(api.DrainPhaseFailed, fmt.Errorf("%d pins could not be moved", len(failed)))
+		return
+	}
+
+	if !d.status.Remove {
+		finish(api.DrainPhaseDone, nil)
+		return
+	}
+
+	err := c.consensus.RmPeer(ctx, pid)
+	if err != nil {
+		finish(api.DrainPhaseFailed, err)
+		return
+	}
+	finish(api.DrainPhaseRemoved, nil)
+}
+
+// pinsAllocatedTo returns the pins allocated to the given peer which can
+// be moved elsewhere.
+func (c *Cluster) pinsAllocatedTo(ctx context.Context, pid peer.ID) ([]api.Pin, error) {
+	pins, err := c.pinsSlice(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var allocated []api.Pin
+	for _, pin := range pins {
+		// Meta pins, cluster DAGs and collections are not pinned and
+		// pins allocated everywhere do not depend on any peer.
+		if pin.Type != api.DataType && pin.Type != api.ShardType {
+			continue
+		}
+		if containsPeer(pin.Allocations, pid) {
+			allocated = append(allocated, pin)
+		}
+	}
+	return allocated, nil
+}
+
+// drainPin moves a pin away from the given peer, waiting until the new
+// allocations have pinned it.
+func (c *Cluster) drainPin(ctx context.Context, pin api.Pin, pid peer.ID) error {
+	ctx, span := trace.StartSpan(ctx, "cluster/drainPin")
+	defer span.End()
+
+	allocs, err := c.replaceAllocations(ctx, pin, []peer.ID{pid})
+	if err != nil {
+		return err
+	}
+	return c.migratePin(ctx, pin, allocs, c.config.RebalanceMigrationTimeout)
+}
+
+// replaceAllocations returns new allocations for a pin which leave the given
+// peers out. When possible, replacements are allocated so that the pin
+// keeps the same number of allocations. Otherwise, it keeps at least the
+// minimum replication factor.
+func (c *Cluster) replaceAllocations(ctx context.Context, pin api.Pin, pids []peer.ID) ([]peer.ID, error) {
+	current := pin
+	current.Allocations = peersSubtract(pin.Allocations, pids)
+	blacklist := pids
+
+	wanted := pin
+	if n := len(pin.Allocations); n >= pin.ReplicationFactorMin && n <= pin.ReplicationFactorMax {
+		wanted.ReplicationFactorMin = n
+		wanted.ReplicationFactorMax = n
+	}
+
+	allocs, err := c.allocate(ctx, wanted, current, blacklist, pin.UserAllocations)
+	if err != nil {
+		return c.allocate(ctx, pin, current, blacklist, pin.UserAllocations)
+	}
+	return allocs, nil
+}
@@ -0,0 +1,56 @@
+package ipfscluster
+
+import (
+	"context"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+
+	"go.opencensus.io/trace"
+)
+
+// Events streams the changes to the pinset and the status transitions of
+// the items tracked by this peer which are selected by the filter. It
+// blocks until the context is cancelled or the peer shuts down, and closes
+// the out channel when done.
+//
+// Events are local to this peer: they are not fetched from other peers.
+// Pinset changes are seen by every peer, but status transitions are only
+// those of the pins allocated to this one. Subscribers that need the
+// status transitions of the whole cluster must subscribe to every peer.
+func (c *Cluster) Events(ctx context.Context, filter api.EventFilter, out chan<- api.Event) error {
+	defer close(out)
+
+	ctx, span := trace.StartSpan(ctx, "cluster/Events")
+	defer span.End()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.ctx.Done():
+			cancel()
+		}
+	}()
+
+	events := make(chan api.Event, 1024)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.tracker.Events(ctx, events)
+	}()
+
+	for ev := range events {
+		if !filter.Match(ev) {
+			continue
+		}
+		select {
+		case out <- ev:
+		case <-ctx.Done():
+			// drain so that the tracker can finish.
+			for range events {
+			}
+			return <-errCh
+		}
+	}
+	return <-errCh
+}
@@ -98,6 +98,15 @@ type IPFSConnector interface {
 	BlockStream(context.Context, <-chan api.NodeWithMeta) error
 	// BlockGet retrieves the raw data of an IPFS block.
 	BlockGet(context.Context, api.Cid) ([]byte, error)
+	// BlockRm removes a block from the IPFS blockstore.
+	BlockRm(context.Context, api.Cid) error
+	// DAGSize returns the total size of the DAG under the given cid, as
+	// reported by the root node. It is not verified.
+	DAGSize(context.Context, api.Cid) (uint64, error)
+	// VerifyDAG walks the DAG of a pin, without fetching anything from
+	// the network, and checks that every block is present and matches
+	// its hash.
+	VerifyDAG(context.Context, api.Pin) (api.IPFSVerification, error)
 }
 
 // Peered represents a component which needs to be aware of the peers
@@ -116,9 +125,9 @@ type PinTracker interface {
 	// Track tells the tracker that a Cid is now under its supervision
 	// The tracker may decide to perform an IPFS pin.
 	Track(context.Context, api.Pin) error
-	// Untrack tells the tracker that a Cid is to be forgotten. The tracker
+	// Untrack tells the tracker that a pin is to be forgotten. The tracker
 	// may perform an IPFS unpin operation.
-	Untrack(context.Context, api.Cid) error
+	Untrack(context.Context, api.Pin) error
 	// StatusAll returns the list of pins with their local status. Takes a
 	// filter to specify which statuses to report.
 	StatusAll(context.Context, api.TrackerStatus, chan<- api.PinInfo) error
@@ -128,8 +137,14 @@ type PinTracker interface {
 	RecoverAll(context.Context, chan<- api.PinInfo) error
 	// Recover retriggers a Pin/Unpin operation in a Cids with error status.
 	Recover(context.Context, api.Cid) (api.PinInfo, error)
+	// Verify checks the integrity of the local copy of a pinned item
+	// and reports it as corrupted when blocks are missing or broken.
+	Verify(context.Context, api.Cid) (api.PinInfo, error)
 	// PinQueueSize returns the current size of the pinning queue.
 	PinQueueSize(context.Context) (int64, error)
+	// Events sends pinset changes and status changes of the tracked
+	// items on the given channel until the context is cancelled.
+	Events(context.Context, chan<- api.Event) error
 }
 
 // Informer provides Metric information from a peer. The metrics produced by
@@ -155,8 +170,9 @@ type PinAllocator interface {
 	// least). The "current" map contains valid metrics for peers
 	// which are currently pinning the content. The candidates map
 	// contains the metrics for all peers which are eligible for pinning
-	// the content.
-	Allocate(ctx context.Context, c api.Cid, current, candidates, priority api.MetricsSet) ([]peer.ID, error)
+	// the content. The list must honour the placement constraints set
+	// in the pin options, or an error must be returned.
+	Allocate(ctx context.Context, pin api.Pin, current, candidates, priority api.MetricsSet) ([]peer.ID, error)
 	// Metrics returns the list of metrics that the allocator needs.
 	Metrics() []string
 }
@@ -188,6 +204,9 @@ type PeerMonitor interface {
 	// a problem (i.e. metrics not arriving as expected). Alerts can be used
 	// to trigger self-healing measures or re-pinnings of content.
 	Alerts() <-chan api.Alert
+	// SendAlert delivers an alert raised by some other component (i.e.
+	// the pin tracker finding corrupted pins) on the Alerts channel.
+	SendAlert(context.Context, api.Alert) error
 }
 
 // Tracer implements Component as a way
@@ -195,3 +214,13 @@ type PeerMonitor interface {
 type Tracer interface {
 	Component
 }
+
+// AlertDispatcher is a component which forwards the alerts received by
+// Cluster to systems outside of it, like on-call tooling. It decides which
+// alerts are worth forwarding. Cluster does not dispatch the "ping" alerts
+// of peers in maintenance.
+type AlertDispatcher interface {
+	Component
+	// Dispatch queues an alert for delivery. It should not block.
+	Dispatch(context.Context, api.Alert) error
+}
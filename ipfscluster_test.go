@@ -279,7 +279,7 @@ func makeConsensus(t *testing.T, store ds.Datastore, h host.Host, psub *pubsub.P
 }
 
 func createCluster(t *testing.T, host host.Host, dht *dual.DHT, clusterCfg *Config, store ds.Datastore, consensus Consensus, apis []API, ipfs IPFSConnector, tracker PinTracker, mon PeerMonitor, alloc PinAllocator, inf Informer, tracer Tracer) *Cluster {
-	cl, err := NewCluster(context.Background(), host, dht, clusterCfg, store, consensus, apis, ipfs, tracker, mon, alloc, []Informer{inf}, tracer)
+	cl, err := NewCluster(context.Background(), host, dht, clusterCfg, store, consensus, apis, ipfs, tracker, mon, alloc, []Informer{inf}, tracer, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -811,6 +811,48 @@ func TestClustersPinUpdate(t *testing.T) {
 	runF(t, clusters, f)
 }
 
+func TestClustersAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+
+	ttlDelay()
+
+	key, err := clusters[0].APIKeyCreate(ctx, api.APIKey{
+		User:   "alice",
+		Scopes: []string{api.APIKeyScopeRead},
+		Expiry: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinDelay()
+
+	runF(t, clusters, func(t *testing.T, c *Cluster) {
+		verified, err := c.APIKeyVerify(ctx, key.Token())
+		if err != nil {
+			t.Fatal("keys should work on every peer:", err)
+		}
+		if verified.ID != key.ID || verified.User != "alice" {
+			t.Errorf("unexpected verified key: %+v", verified)
+		}
+	})
+
+	err = clusters[nClusters-1].APIKeyRevoke(ctx, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinDelay()
+
+	runF(t, clusters, func(t *testing.T, c *Cluster) {
+		if _, err := c.APIKeyVerify(ctx, key.Token()); err != ErrAPIKeyInvalid {
+			t.Error("revoked keys should not verify on any peer:", err)
+		}
+	})
+}
+
 func TestClustersPinDirect(t *testing.T) {
 	ctx := context.Background()
 	clusters, mock := createClusters(t)
@@ -1326,6 +1368,168 @@ func TestClustersReplicationOverall(t *testing.T) {
 
 // This test checks that we pin with ReplicationFactorMax when
 // we can
+func TestClustersRebalance(t *testing.T) {
+	ctx := context.Background()
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	for _, c := range clusters {
+		c.config.ReplicationFactorMin = 1
+		c.config.ReplicationFactorMax = 1
+		c.config.RebalancePinsPerCycle = 2
+		c.config.RebalanceThreshold = 0
+	}
+
+	ttlDelay()
+
+	rebalancing := 0
+	for _, c := range clusters {
+		if c.isRebalancingPeer(ctx) {
+			rebalancing++
+		}
+	}
+	if rebalancing != 1 {
+		t.Errorf("expected a single rebalancing peer, got %d", rebalancing)
+	}
+
+	// Allocate everything to the first peer, as if the others had
+	// joined afterwards.
+	c0 := clusters[0]
+	prefix := test.Cid1.Prefix()
+	var cids []api.Cid
+	for i := 0; i < 4; i++ {
+		h, err := prefix.Sum(randomBytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pin := api.PinWithOpts(api.NewCid(h), api.PinOptions{})
+		pin.Allocations = []peer.ID{c0.id}
+		_, _, err = c0.pin(ctx, pin, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cids = append(cids, pin.Cid)
+	}
+
+	pinDelay()
+	ttlDelay() // let the freespace metrics account for the new pins
+
+	// The differences in free space are tiny, so nothing should move
+	// with a high threshold.
+	c0.config.RebalanceThreshold = 1
+	err := c0.rebalance(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := c0.RebalanceStatus(ctx); status.Pending != 0 || status.Migrated != 0 {
+		t.Fatalf("nothing should have been migrated: %+v", status)
+	}
+
+	c0.config.RebalanceThreshold = 0
+	err = c0.rebalance(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := c0.RebalanceStatus(ctx)
+	if status.Pending != 2 || status.Migrated != 2 || status.Failed != 0 {
+		t.Fatalf("unexpected rebalance status: %+v", status)
+	}
+	if status.Running || status.Migrating.Defined() {
+		t.Errorf("rebalancer should have finished: %+v", status)
+	}
+
+	pinDelay()
+
+	moved := 0
+	for _, ci := range cids {
+		pin, err := c0.PinGet(ctx, ci)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pin.Allocations) != 1 {
+			t.Fatalf("expected one allocation for %s: %s", ci, pin.Allocations)
+		}
+		if pin.Allocations[0] == c0.id {
+			continue
+		}
+		moved++
+
+		gpi, err := c0.Status(ctx, ci)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pinnedIn(gpi, pin.Allocations) {
+			t.Errorf("%s should be pinned in its new allocation", ci)
+		}
+		if pi := gpi.PeerMap[peer.Encode(c0.id)]; pi.Status != api.TrackerStatusRemote {
+			t.Errorf("%s should have been unpinned from the first peer: %s", ci, pi.Status)
+		}
+	}
+	if moved != 2 {
+		t.Errorf("expected 2 pins to be migrated, got %d", moved)
+	}
+}
+
+func TestClustersReplicationReport(t *testing.T) {
+	ctx := context.Background()
+	if nClusters < 2 {
+		t.Skip("Need at least 2 peers")
+	}
+
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+
+	c0 := clusters[0]
+	c1 := clusters[1]
+	logPin := func(h api.Cid, rfMin, rfMax int, allocs ...peer.ID) {
+		pin := api.PinWithOpts(h, api.PinOptions{
+			ReplicationFactorMin: rfMin,
+			ReplicationFactorMax: rfMax,
+		})
+		pin.Allocations = allocs
+		err := c0.consensus.LogPin(ctx, pin)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logPin(test.Cid1, 1, 1, c0.id)
+	logPin(test.Cid2, 2, 2, c0.id)
+	logPin(test.Cid3, 1, 1, c0.id, c1.id)
+	// allocated to a peer which is not part of the cluster.
+	logPin(test.Cid4, 1, 1, test.PeerID1)
+
+	pinDelay()
+	delay()
+
+	out := make(chan api.ReplicationReport, 10)
+	err := c1.ReplicationReport(ctx, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states := make(map[api.Cid]string)
+	for r := range out {
+		states[r.Cid] = r.State
+	}
+
+	if len(states) != 3 {
+		t.Errorf("expected 3 reports, got %d: %v", len(states), states)
+	}
+	if st, ok := states[test.Cid1]; ok {
+		t.Errorf("%s is correctly replicated but was reported %s", test.Cid1, st)
+	}
+	if st := states[test.Cid2]; st != api.ReplicationUnder {
+		t.Errorf("%s should be under-replicated: %s", test.Cid2, st)
+	}
+	if st := states[test.Cid3]; st != api.ReplicationOver {
+		t.Errorf("%s should be over-replicated: %s", test.Cid3, st)
+	}
+	if st := states[test.Cid4]; st != api.ReplicationUnavailable {
+		t.Errorf("%s should be unavailable: %s", test.Cid4, st)
+	}
+}
+
 func TestClustersReplicationFactorMax(t *testing.T) {
 	ctx := context.Background()
 	if nClusters < 3 {
@@ -2075,6 +2279,238 @@ func TestClustersDisabledRepinning(t *testing.T) {
 	}
 }
 
+// Check that the pins of a peer in maintenance are not re-allocated while
+// it is down, but they are once the maintenance ends.
+func TestClustersPeerMaintenance(t *testing.T) {
+	ctx := context.Background()
+	if nClusters < 3 {
+		t.Skip("Need at least 3 peers")
+	}
+
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	for _, c := range clusters {
+		c.config.ReplicationFactorMin = nClusters - 1
+		c.config.ReplicationFactorMax = nClusters - 1
+	}
+
+	ttlDelay()
+
+	h := test.Cid1
+	_, err := clusters[0].Pin(ctx, h, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	countPinned := func(skip int) int {
+		n := 0
+		for i, c := range clusters {
+			if i == skip {
+				continue
+			}
+			if c.tracker.Status(ctx, h).Status == api.TrackerStatusPinned {
+				n++
+			}
+		}
+		return n
+	}
+
+	// find a peer, other than the first one, which pinned the item.
+	k := -1
+	for i, c := range clusters[1:] {
+		if c.tracker.Status(ctx, h).Status == api.TrackerStatusPinned {
+			k = i + 1
+			break
+		}
+	}
+	if k < 0 {
+		t.Fatal("no peer pinned the item")
+	}
+	maintained := clusters[k]
+
+	status, err := maintained.MaintenanceStart(ctx, 2*clusters[0].config.MaintenanceWindow)
+	if err == nil {
+		t.Error("expected an error with a duration over the window")
+	}
+	maintenanceDuration := 4 * ttlDelayTime
+	status, err = maintained.MaintenanceStart(ctx, maintenanceDuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Enabled || status.Peer != maintained.id {
+		t.Fatalf("unexpected maintenance status: %+v", status)
+	}
+	delay()
+
+	if !clusters[0].PeerMaintenanceStatus(ctx, maintained.id).Enabled {
+		t.Error("the maintenance metric should have arrived")
+	}
+
+	out := make(chan api.ID, nClusters)
+	clusters[0].Peers(ctx, out)
+	for id := range out {
+		inMaintenance := id.Maintenance != nil && id.Maintenance.Enabled
+		if inMaintenance != (id.ID == maintained.id) {
+			t.Errorf("%s: unexpected maintenance status: %+v", id.ID, id.Maintenance)
+		}
+	}
+
+	preview, err := clusters[0].AllocationPreview(ctx, api.CidUndef, api.PinOptions{
+		ReplicationFactorMin: nClusters - 1,
+		ReplicationFactorMax: nClusters - 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Error != "" || containsPeer(preview.Allocations, maintained.id) {
+		t.Errorf("the peer in maintenance should not be allocated: %+v", preview)
+	}
+
+	t.Logf("Shutting down %s", maintained.id)
+	maintained.Shutdown(ctx)
+
+	waitForLeaderAndMetrics(t, clusters)
+	if n := countPinned(k); n != nClusters-2 {
+		t.Errorf("the pin should not have been re-allocated: %d replicas", n)
+	}
+
+	// Wait for the maintenance metric to expire.
+	time.Sleep(time.Until(status.Until))
+	waitForLeaderAndMetrics(t, clusters)
+	if n := countPinned(k); n != nClusters-1 {
+		t.Errorf("the pin should have been re-allocated after the maintenance: %d replicas", n)
+	}
+}
+
+func TestClustersReallocateFailedPins(t *testing.T) {
+	ctx := context.Background()
+	if nClusters < 3 {
+		t.Skip("Need at least 3 peers")
+	}
+
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	for _, c := range clusters {
+		c.config.PinErrorReallocateAttempts = 1
+	}
+
+	ttlDelay()
+
+	// ErrorCid cannot be pinned by any peer.
+	h := test.ErrorCid
+	pin := api.PinWithOpts(h, api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+	})
+	pin.Allocations = []peer.ID{clusters[0].id}
+	err := clusters[0].consensus.LogPin(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	pinfo := clusters[0].tracker.Status(ctx, h)
+	if pinfo.Status != api.TrackerStatusPinError {
+		t.Fatal("expected pin_error:", pinfo.Status)
+	}
+	if clusters[0].shouldReallocate(pin, clusters[0].id, pinfo.PinInfoShort, 0, 0) {
+		t.Error("nothing should be re-allocated when disabled")
+	}
+	if clusters[0].shouldReallocate(pin, clusters[1].id, pinfo.PinInfoShort, 1, 0) {
+		t.Error("only allocated peers should be re-allocated")
+	}
+	if clusters[1].isFirstAllocation(pin) || !clusters[0].isFirstAllocation(pin) {
+		t.Error("only the first allocation should re-allocate")
+	}
+	old := pinfo.PinInfoShort
+	old.TS = time.Now().Add(-time.Hour)
+	if !clusters[0].shouldReallocate(pin, clusters[0].id, old, 0, time.Minute) {
+		t.Error("an old error should be re-allocated")
+	}
+
+	var failed []peer.ID
+	for i := 0; i < 2; i++ {
+		current, err := clusters[0].PinGet(ctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(current.Allocations) != 1 {
+			t.Fatal("expected a single allocation:", current.Allocations)
+		}
+		failing := current.Allocations[0]
+		failed = append(failed, failing)
+
+		for _, c := range clusters {
+			if c.id == failing {
+				c.reallocateFailedPins(ctx)
+			}
+		}
+		delay()
+
+		reallocated, err := clusters[0].PinGet(ctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reallocated.Allocations) != 1 {
+			t.Fatal("expected a single allocation:", reallocated.Allocations)
+		}
+		if containsPeer(failed, reallocated.Allocations[0]) {
+			t.Errorf("re-allocated to a peer that failed: %s", reallocated.Allocations[0])
+		}
+		if len(reallocated.FailedAllocations) != len(failed) || len(peersSubtract(failed, reallocated.FailedAllocations)) != 0 {
+			t.Errorf("expected %s as failed allocations, got %s", failed, reallocated.FailedAllocations)
+		}
+		pinDelay()
+	}
+
+	// The first peer stopped tracking the item.
+	pinfo = clusters[0].tracker.Status(ctx, h)
+	if pinfo.Status != api.TrackerStatusRemote {
+		t.Error("expected remote status:", pinfo.Status)
+	}
+
+	// Failed allocations are forgotten once the item is pinned, one
+	// pin per cycle.
+	clusters[0].config.PinErrorScanPerCycle = 1
+	cids := []api.Cid{test.Cid1, test.Cid2}
+	for _, ci := range cids {
+		pin = api.PinWithOpts(ci, api.PinOptions{
+			ReplicationFactorMin: 1,
+			ReplicationFactorMax: 1,
+		})
+		pin.Allocations = []peer.ID{clusters[0].id}
+		pin.FailedAllocations = []peer.ID{clusters[1].id}
+		err = clusters[0].consensus.LogPin(ctx, pin)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pinDelay()
+
+	countCleared := func() int {
+		cleared := 0
+		for _, ci := range cids {
+			pinned, err := clusters[0].PinGet(ctx, ci)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pinned.FailedAllocations) == 0 {
+				cleared++
+			}
+		}
+		return cleared
+	}
+
+	for i := 1; i <= len(cids); i++ {
+		clusters[0].reallocateFailedPins(ctx)
+		delay()
+		if n := countCleared(); n != i {
+			t.Errorf("expected %d pins with cleared failed allocations, got %d", i, n)
+		}
+	}
+}
+
 func TestRepoGC(t *testing.T) {
 	clusters, mock := createClusters(t)
 	defer shutdownClusters(t, clusters, mock)
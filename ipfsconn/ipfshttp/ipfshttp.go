@@ -20,10 +20,13 @@ import (
 	"github.com/lubanproj/ipfs-cluster/api"
 	"github.com/lubanproj/ipfs-cluster/observations"
 
+	blocks "github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
 	files "github.com/ipfs/go-ipfs-files"
 	ipfspinner "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log/v2"
+	_ "github.com/ipfs/go-merkledag" // registers dag-pb, raw and dag-cbor decoders
 	gopath "github.com/ipfs/go-path"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
@@ -125,6 +128,14 @@ type ipfsBlockPutResp struct {
 	Size int
 }
 
+type ipfsObjectStatResp struct {
+	CumulativeSize uint64
+}
+
+type ipfsBlockStatResp struct {
+	Size uint64
+}
+
 type ipfsPeer struct {
 	Peer string
 }
@@ -1157,6 +1168,144 @@ func (ipfs *Connector) BlockGet(ctx context.Context, c api.Cid) ([]byte, error)
 	return ipfs.postCtx(ctx, url, "", nil)
 }
 
+// BlockRm removes a block from the IPFS blockstore. Removing a block which
+// is not in the blockstore is not an error.
+func (ipfs *Connector) BlockRm(ctx context.Context, c api.Cid) error {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/BlockRm")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+	res, err := ipfs.postCtx(ctx, "block/rm?force=true&arg="+c.String(), "", nil)
+	if err != nil {
+		return err
+	}
+
+	var rmRes struct {
+		Hash  string
+		Error string
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(res, &rmRes); err != nil {
+		return err
+	}
+	if rmRes.Error != "" {
+		return errors.New(rmRes.Error)
+	}
+	return nil
+}
+
+// DAGSize returns the size of the DAG under the given cid without walking
+// it: the cumulative size recorded in the root node for dag-pb nodes, and
+// the size of the root block otherwise. The root block may be fetched from
+// the network. The cumulative size is declared by whoever built the DAG and
+// is not verified.
+func (ipfs *Connector) DAGSize(ctx context.Context, c api.Cid) (uint64, error) {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/DAGSize")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+
+	if c.Prefix().Codec == cid.DagProtobuf {
+		res, err := ipfs.postCtx(ctx, "object/stat?arg="+c.String(), "", nil)
+		if err != nil {
+			return 0, err
+		}
+		var stat ipfsObjectStatResp
+		if err := json.Unmarshal(res, &stat); err != nil {
+			return 0, err
+		}
+		return stat.CumulativeSize, nil
+	}
+
+	res, err := ipfs.postCtx(ctx, "block/stat?arg="+c.String(), "", nil)
+	if err != nil {
+		return 0, err
+	}
+	var stat ipfsBlockStatResp
+	if err := json.Unmarshal(res, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Size, nil
+}
+
+// VerifyDAG walks the DAG of a pin (up to its MaxDepth) using only the
+// blocks that the IPFS daemon has locally and re-hashes every one of them.
+// Blocks that cannot be retrieved are reported as missing and blocks whose
+// data does not match their cid are reported as corrupt. Links from corrupt
+// blocks are not followed.
+func (ipfs *Connector) VerifyDAG(ctx context.Context, pin api.Pin) (api.IPFSVerification, error) {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/VerifyDAG")
+	defer span.End()
+
+	type queued struct {
+		c     cid.Cid
+		depth int
+	}
+
+	result := api.IPFSVerification{Cid: pin.Cid}
+	maxDepth := int(pin.MaxDepth)
+	seen := cid.NewSet()
+	seen.Add(pin.Cid.Cid)
+	// Breadth-first, so that with depth-limited pins we see every
+	// block at the lowest depth it appears at.
+	queue := []queued{{c: pin.Cid.Cid}}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		result.Blocks++
+
+		data, err := ipfs.blockGetOffline(ctx, next.c)
+		if err != nil {
+			var ipfsErr ipfsError
+			if !errors.As(err, &ipfsErr) {
+				// not an answer from IPFS, we cannot
+				// tell if the block is there.
+				return result, err
+			}
+			result.Missing = append(result.Missing, api.NewCid(next.c))
+			continue
+		}
+
+		hashed, err := next.c.Prefix().Sum(data)
+		if err != nil || !hashed.Equals(next.c) {
+			result.Corrupt = append(result.Corrupt, api.NewCid(next.c))
+			continue
+		}
+
+		if maxDepth >= 0 && next.depth >= maxDepth {
+			continue
+		}
+
+		blk, err := blocks.NewBlockWithCid(data, next.c)
+		if err != nil {
+			return result, err
+		}
+		nd, err := ipld.Decode(blk)
+		if err != nil {
+			logger.Warnf("cannot follow links of %s: %s", next.c, err)
+			continue
+		}
+		for _, l := range nd.Links() {
+			if seen.Visit(l.Cid) {
+				queue = append(queue, queued{c: l.Cid, depth: next.depth + 1})
+			}
+		}
+	}
+	return result, nil
+}
+
+// blockGetOffline retrieves a block from the IPFS daemon without letting it
+// search for the block in the network.
+func (ipfs *Connector) blockGetOffline(ctx context.Context, c cid.Cid) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+	return ipfs.postCtx(ctx, "block/get?offline=true&arg="+c.String(), "", nil)
+}
+
 // // FetchRefs asks IPFS to download blocks recursively to the given depth.
 // // It discards the response, but waits until it completes.
 // func (ipfs *Connector) FetchRefs(ctx context.Context, c api.Cid, maxDepth int) error {
@@ -387,6 +387,106 @@ func TestBlockGet(t *testing.T) {
 	}
 }
 
+func TestDAGSize(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown(ctx)
+
+	size, err := ipfs.DAGSize(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != test.DAGSize {
+		t.Errorf("expected the cumulative size of the dag-pb node: %d", size)
+	}
+
+	// Not dag-pb: uses the block size
+	_, err = ipfs.DAGSize(ctx, test.ShardCid)
+	if err == nil {
+		t.Fatal("expected to fail for a missing block")
+	}
+
+	blocks := make(chan api.NodeWithMeta, 1)
+	blocks <- api.NodeWithMeta{
+		Data: test.ShardData,
+		Cid:  test.ShardCid,
+	}
+	close(blocks)
+	err = ipfs.BlockStream(ctx, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err = ipfs.DAGSize(ctx, test.ShardCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != uint64(len(test.ShardData)) {
+		t.Errorf("expected the size of the block: %d", size)
+	}
+}
+
+func TestVerifyDAG(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown(ctx)
+
+	blocks := make(chan api.NodeWithMeta, 1)
+	blocks <- api.NodeWithMeta{
+		Data: test.ShardData,
+		Cid:  test.ShardCid,
+	}
+	close(blocks)
+	err := ipfs.BlockStream(ctx, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pin := api.PinCid(test.ShardCid)
+	pin.MaxDepth = 0
+	res, err := ipfs.VerifyDAG(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err() != nil || res.Blocks != 1 {
+		t.Errorf("the shard block should verify: %+v", res)
+	}
+
+	// The shard links to a block that was never put.
+	pin.MaxDepth = 1
+	res, err = ipfs.VerifyDAG(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Missing) != 1 || len(res.Corrupt) != 0 || res.Blocks != 2 {
+		t.Errorf("expected one missing block: %+v", res)
+	}
+
+	mock.BlockStore[test.ShardCid.String()] = []byte("corrupted")
+	pin.MaxDepth = -1
+	res, err = ipfs.VerifyDAG(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Corrupt) != 1 || !res.Corrupt[0].Equals(test.ShardCid) {
+		t.Errorf("expected the shard block to be corrupt: %+v", res)
+	}
+
+	err = ipfs.BlockRm(ctx, test.ShardCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = ipfs.VerifyDAG(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Missing) != 1 || !res.Missing[0].Equals(test.ShardCid) {
+		t.Errorf("expected the removed block to be missing: %+v", res)
+	}
+}
+
 func TestRepoStat(t *testing.T) {
 	ctx := context.Background()
 	ipfs, mock := testIPFSConnector(t)
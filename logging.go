@@ -32,6 +32,7 @@ var LoggingFacilities = map[string]string{
 	"optracker":    "INFO",
 	"pstoremgr":    "INFO",
 	"allocator":    "INFO",
+	"dispatcher":   "INFO",
 }
 
 // LoggingFacilitiesExtra provides logging identifiers
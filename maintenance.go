@@ -0,0 +1,215 @@
+package ipfscluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	"go.opencensus.io/trace"
+)
+
+// This file contains the maintenance mode. A peer taken out of service for
+// a while (i.e. to swap a disk) would normally have its pins re-allocated
+// as soon as its ping metric expires. Instead, a peer in maintenance
+// broadcasts a "maintenance" metric which expires when the maintenance
+// ends. Peers with a valid maintenance metric do not receive new
+// allocations and their pins are not re-allocated when they go down. If a
+// peer is still down when its maintenance metric expires, its pins are
+// re-allocated then.
+
+const maintenanceMetricName = "maintenance"
+
+// maintenance tracks the maintenance mode of this peer.
+type maintenance struct {
+	status api.MaintenanceStatus
+	cancel context.CancelFunc
+	// closed when maintenance metrics are no longer sent.
+	done chan struct{}
+}
+
+// MaintenanceStart puts this peer in maintenance mode for the given
+// duration, or for MaintenanceWindow when it is 0. Starting the maintenance
+// of a peer already in maintenance extends or shortens it.
+func (c *Cluster) MaintenanceStart(ctx context.Context, d time.Duration) (api.MaintenanceStatus, error) {
+	_, span := trace.StartSpan(ctx, "cluster/MaintenanceStart")
+	defer span.End()
+
+	if d == 0 {
+		d = c.config.MaintenanceWindow
+	}
+	if d < 0 || d > c.config.MaintenanceWindow {
+		return api.MaintenanceStatus{}, fmt.Errorf("the maintenance duration must be between 0 and %s", c.config.MaintenanceWindow)
+	}
+
+	c.maintenanceMux.Lock()
+	defer c.maintenanceMux.Unlock()
+
+	started := time.Now()
+	if m := c.maintenance; m != nil {
+		m.cancel()
+		<-m.done
+		if m.status.Enabled && time.Now().Before(m.status.Until) {
+			started = m.status.Started
+		}
+	}
+
+	mctx, cancel := context.WithCancel(c.ctx)
+	m := &maintenance{
+		status: api.MaintenanceStatus{
+			Peer:    c.id,
+			Enabled: true,
+			Started: started,
+			Until:   time.Now().Add(d),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	c.maintenance = m
+
+	logger.Infof("maintenance mode enabled until %s", m.status.Until)
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer close(m.done)
+		c.pushMaintenanceMetrics(mctx, m.status)
+	}()
+	return m.status, nil
+}
+
+// MaintenanceStop ends the maintenance mode of this peer. The end of the
+// maintenance is broadcasted even if this peer does not know about it (i.e.
+// because it was restarted), so that other peers stop considering it in
+// maintenance right away.
+func (c *Cluster) MaintenanceStop(ctx context.Context) (api.MaintenanceStatus, error) {
+	_, span := trace.StartSpan(ctx, "cluster/MaintenanceStop")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	c.maintenanceMux.Lock()
+	defer c.maintenanceMux.Unlock()
+
+	if m := c.maintenance; m != nil {
+		m.cancel()
+		<-m.done
+		c.maintenance = nil
+	}
+
+	status := api.MaintenanceStatus{Peer: c.id}
+	err := c.sendMaintenanceMetric(ctx, status)
+	if err != nil {
+		return status, err
+	}
+	logger.Info("maintenance mode disabled")
+	return status, nil
+}
+
+// PeerMaintenanceStatus returns whether the given peer is in maintenance
+// mode, as far as this peer knows.
+func (c *Cluster) PeerMaintenanceStatus(ctx context.Context, pid peer.ID) api.MaintenanceStatus {
+	_, span := trace.StartSpan(ctx, "cluster/PeerMaintenanceStatus")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	status, ok := c.peersInMaintenance(ctx)[pid]
+	if !ok {
+		return api.MaintenanceStatus{Peer: pid}
+	}
+	return status
+}
+
+// localMaintenance returns the maintenance status of this peer.
+func (c *Cluster) localMaintenance() (api.MaintenanceStatus, bool) {
+	c.maintenanceMux.Lock()
+	defer c.maintenanceMux.Unlock()
+
+	m := c.maintenance
+	if m == nil || !time.Now().Before(m.status.Until) {
+		return api.MaintenanceStatus{}, false
+	}
+	return m.status, true
+}
+
+// peersInMaintenance returns the peers that are in maintenance mode.
+func (c *Cluster) peersInMaintenance(ctx context.Context) map[peer.ID]api.MaintenanceStatus {
+	inMaintenance := make(map[peer.ID]api.MaintenanceStatus)
+	for _, m := range c.monitor.LatestMetrics(ctx, maintenanceMetricName) {
+		status, err := maintenanceFromMetric(m)
+		if err != nil {
+			logger.Debug(err)
+			continue
+		}
+		if status.Enabled {
+			inMaintenance[m.Peer] = status
+		}
+	}
+
+	// Our own metrics may not have arrived yet.
+	if status, ok := c.localMaintenance(); ok {
+		inMaintenance[c.id] = status
+	}
+	return inMaintenance
+}
+
+// inMaintenance returns true if the given peer is in maintenance mode.
+func (c *Cluster) inMaintenance(ctx context.Context, pid peer.ID) bool {
+	_, ok := c.peersInMaintenance(ctx)[pid]
+	return ok
+}
+
+func (c *Cluster) sendMaintenanceMetric(ctx context.Context, status api.MaintenanceStatus) error {
+	v, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	m := api.Metric{
+		Name:  maintenanceMetricName,
+		Peer:  c.id,
+		Value: string(v),
+		Valid: true,
+	}
+	// The metric expires when the maintenance ends, even if this
+	// peer is down by then.
+	if status.Enabled {
+		m.SetTTL(time.Until(status.Until))
+	} else {
+		m.SetTTL(c.config.MonitorPingInterval * 2)
+	}
+	return c.monitor.PublishMetric(ctx, m)
+}
+
+// pushMaintenanceMetrics broadcasts a maintenance metric every
+// MonitorPingInterval until the maintenance ends or the context is
+// cancelled.
+func (c *Cluster) pushMaintenanceMetrics(ctx context.Context, status api.MaintenanceStatus) {
+	ticker := time.NewTicker(c.config.MonitorPingInterval)
+	defer ticker.Stop()
+	for time.Now().Before(status.Until) {
+		err := c.sendMaintenanceMetric(ctx, status)
+		if err != nil {
+			logger.Error(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// maintenanceFromMetric parses the value of a maintenance metric.
+func maintenanceFromMetric(m api.Metric) (api.MaintenanceStatus, error) {
+	var status api.MaintenanceStatus
+	err := json.Unmarshal([]byte(m.Value), &status)
+	if err != nil {
+		return status, fmt.Errorf("bad maintenance metric from %s: %w", m.Peer, err)
+	}
+	status.Peer = m.Peer
+	return status, nil
+}
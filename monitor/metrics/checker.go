@@ -21,12 +21,24 @@ var MaxAlertThreshold = 1
 // ErrAlertChannelFull is returned if the alert channel is full.
 var ErrAlertChannelFull = errors.New("alert channel is full")
 
+// MinDistributionSize is the number of inter-arrival times needed
+// before the phi-accrual failure detector is used for a metric. Until
+// then, metrics fail when they expire.
+var MinDistributionSize = 5
+
+// MinStdDeviation is the minimum standard deviation of the inter-arrival
+// times used by the phi-accrual failure detector. Metrics which arrive at
+// very regular intervals would otherwise make it fail peers as soon as a
+// metric is slightly late, or produce NaN when all the times are equal.
+var MinStdDeviation = 100 * time.Millisecond
+
 // Checker provides utilities to find expired metrics
 // for a given peerset and send alerts if it proceeds to do so.
 type Checker struct {
-	ctx     context.Context
-	alertCh chan api.Alert
-	metrics *Store
+	ctx       context.Context
+	alertCh   chan api.Alert
+	metrics   *Store
+	threshold float64
 
 	failedPeersMu sync.Mutex
 	failedPeers   map[peer.ID]map[string]int
@@ -37,12 +49,15 @@ type Checker struct {
 // monitored component should be considered to have failed.
 // The greater the threshold value the more leniency is granted.
 //
-// A value between 2.0 and 4.0 is suggested for the threshold.
-func NewChecker(ctx context.Context, metrics *Store) *Checker {
+// A value between 2.0 and 4.0 is suggested for the threshold. A threshold
+// of 0 disables the phi-accrual failure detector and metrics fail as soon
+// as they expire.
+func NewChecker(ctx context.Context, metrics *Store, threshold float64) *Checker {
 	return &Checker{
 		ctx:         ctx,
 		alertCh:     make(chan api.Alert, AlertChannelCap),
 		metrics:     metrics,
+		threshold:   threshold,
 		failedPeers: make(map[peer.ID]map[string]int),
 	}
 }
@@ -137,6 +152,17 @@ func (mc *Checker) alert(pid peer.ID, metricName string) error {
 	return nil
 }
 
+// SendAlert places an alert generated outside of the checker (i.e. by
+// other components) in the alerts channel.
+func (mc *Checker) SendAlert(alrt api.Alert) error {
+	select {
+	case mc.alertCh <- alrt:
+	default:
+		return ErrAlertChannelFull
+	}
+	return nil
+}
+
 // Alerts returns a channel which gets notified by CheckPeers.
 func (mc *Checker) Alerts() <-chan api.Alert {
 	return mc.alertCh
@@ -167,7 +193,24 @@ func (mc *Checker) Watch(ctx context.Context, peersF func(context.Context) ([]pe
 }
 
 // FailedMetric returns if a peer is marked as failed for a particular metric.
+//
+// A metric fails when it expires. When a threshold is set, an expired metric
+// only fails once the phi-accrual failure detector, which learns how often
+// the metric is received from the peer, agrees. This makes the Checker more
+// lenient with peers whose metrics arrive at irregular intervals.
 func (mc *Checker) FailedMetric(metric string, pid peer.ID) bool {
 	latest := mc.metrics.PeerLatest(metric, pid)
-	return latest.Expired()
+	if !latest.Expired() {
+		return false
+	}
+	if mc.threshold <= 0 {
+		return true
+	}
+
+	dist := mc.metrics.Distribution(metric, pid)
+	if len(dist) < MinDistributionSize {
+		return true
+	}
+	v := float64(time.Now().UnixNano() - latest.ReceivedAt)
+	return phi(v, dist) >= mc.threshold
 }
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"context"
+	"math"
 	"testing"
 	"time"
 
@@ -14,7 +15,7 @@ import (
 func TestChecker_CheckPeers(t *testing.T) {
 	t.Run("check with single metric", func(t *testing.T) {
 		metrics := NewStore()
-		checker := NewChecker(context.Background(), metrics)
+		checker := NewChecker(context.Background(), metrics, 0)
 
 		metr := api.Metric{
 			Name:  "ping",
@@ -57,7 +58,7 @@ func TestChecker_CheckPeers(t *testing.T) {
 func TestChecker_CheckAll(t *testing.T) {
 	t.Run("checkall with single metric", func(t *testing.T) {
 		metrics := NewStore()
-		checker := NewChecker(context.Background(), metrics)
+		checker := NewChecker(context.Background(), metrics, 0)
 
 		metr := api.Metric{
 			Name:  "ping",
@@ -102,7 +103,7 @@ func TestChecker_Watch(t *testing.T) {
 	defer cancel()
 
 	metrics := NewStore()
-	checker := NewChecker(context.Background(), metrics)
+	checker := NewChecker(context.Background(), metrics, 0)
 
 	metr := api.Metric{
 		Name:  "ping",
@@ -130,7 +131,7 @@ func TestChecker_Watch(t *testing.T) {
 func TestChecker_Failed(t *testing.T) {
 	t.Run("standard failure check", func(t *testing.T) {
 		metrics := NewStore()
-		checker := NewChecker(context.Background(), metrics)
+		checker := NewChecker(context.Background(), metrics, 0)
 
 		metrics.Add(makePeerMetric(test.PeerID1, "1", 100*time.Millisecond))
 		time.Sleep(50 * time.Millisecond)
@@ -146,13 +147,76 @@ func TestChecker_Failed(t *testing.T) {
 	})
 }
 
+func TestChecker_FailedAccrual(t *testing.T) {
+	metrics := NewStore()
+	checker := NewChecker(context.Background(), metrics, 1)
+
+	// metrics arrive 20ms and 100ms apart, so on average every
+	// 60ms, but they only last 30ms.
+	gaps := []time.Duration{20, 100, 20, 100, 20, 100}
+	for _, gap := range gaps {
+		metrics.Add(makePeerMetric(test.PeerID1, "1", 30*time.Millisecond))
+		time.Sleep(gap * time.Millisecond)
+	}
+	metrics.Add(makePeerMetric(test.PeerID1, "1", 30*time.Millisecond))
+
+	time.Sleep(60 * time.Millisecond)
+	if !metrics.PeerLatest("ping", test.PeerID1).Expired() {
+		t.Fatal("the metric should have expired")
+	}
+	if checker.FailedMetric("ping", test.PeerID1) {
+		t.Error("should not have failed so soon")
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	if !checker.FailedMetric("ping", test.PeerID1) {
+		t.Error("should have failed")
+	}
+
+	// Without enough history, metrics fail when they expire.
+	metrics.Add(makePeerMetric(test.PeerID2, "1", 30*time.Millisecond))
+	time.Sleep(60 * time.Millisecond)
+	if !checker.FailedMetric("ping", test.PeerID2) {
+		t.Error("should have failed")
+	}
+}
+
+func TestPhi(t *testing.T) {
+	ms := float64(time.Millisecond)
+	dist := []float64{500 * ms, 1500 * ms, 500 * ms, 1500 * ms}
+	tests := []struct {
+		v    float64
+		less float64
+		more float64
+	}{
+		{1000 * ms, 0.31, 0.29},
+		{1500 * ms, 0.81, 0.79},
+		{3000 * ms, 4.6, 4.4},
+	}
+	for _, tc := range tests {
+		p := phi(tc.v, dist)
+		if p >= tc.less || p <= tc.more {
+			t.Errorf("phi(%f): expected a value between %f and %f: got %f", tc.v, tc.more, tc.less, p)
+		}
+	}
+
+	// Constant inter-arrival times use the minimum standard deviation.
+	constant := []float64{1000 * ms, 1000 * ms, 1000 * ms, 1000 * ms}
+	if p := phi(1000*ms, constant); math.IsNaN(p) || p >= 0.31 || p <= 0.29 {
+		t.Errorf("phi on time with constant times: expected ~0.3, got %f", p)
+	}
+	if p := phi(1100*ms, constant); math.IsNaN(p) || p >= 0.81 || p <= 0.79 {
+		t.Errorf("phi one stddev late with constant times: expected ~0.8, got %f", p)
+	}
+}
+
 func TestChecker_alert(t *testing.T) {
 	t.Run("remove peer from store after alert", func(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 		defer cancel()
 
 		metrics := NewStore()
-		checker := NewChecker(ctx, metrics)
+		checker := NewChecker(ctx, metrics, 0)
 
 		metr := api.Metric{
 			Name:  "ping",
@@ -79,7 +79,8 @@ func (mtrs *Store) LatestValid(name string) []api.Metric {
 	metrics := make([]api.Metric, 0, len(byPeer))
 	for _, window := range byPeer {
 		m, err := window.Latest()
-		// TODO(ajl): for accrual, does it matter if a ping has expired?
+		// Expired metrics are left out even when the Checker
+		// does not consider their peer failed yet.
 		if err != nil || m.Discard() {
 			continue
 		}
@@ -186,3 +187,21 @@ func (mtrs *Store) MetricNames() []string {
 	}
 	return list
 }
+
+// Distribution returns the inter-arrival times, in nanoseconds, of a
+// particular metric for a particular peer. See Window.Distribution.
+func (mtrs *Store) Distribution(name string, pid peer.ID) []float64 {
+	mtrs.mux.RLock()
+	defer mtrs.mux.RUnlock()
+
+	byPeer, ok := mtrs.byName[name]
+	if !ok {
+		return nil
+	}
+
+	window, ok := byPeer[pid]
+	if !ok {
+		return nil
+	}
+	return window.Distribution()
+}
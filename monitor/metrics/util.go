@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"math"
+
 	"github.com/lubanproj/ipfs-cluster/api"
 
 	peer "github.com/libp2p/go-libp2p-core/peer"
@@ -26,3 +28,32 @@ func PeersetFilter(metrics []api.Metric, peerset []peer.ID) []api.Metric {
 
 	return filtered
 }
+
+// phi returns the suspicion level of the phi-accrual failure detector for a
+// peer given the time elapsed since its last metric was received (v) and
+// the distribution of the time between its metrics (d). A phi of 1 means
+// that the chance of being wrong when considering the peer failed is 10%,
+// 2 means 1%, 3 means 0.1% and so on. Inter-arrival times, in nanoseconds,
+// are assumed to follow a normal distribution, whose standard deviation is
+// at least MinStdDeviation.
+func phi(v float64, d []float64) float64 {
+	u, o := meanStdDev(d)
+	o = math.Max(o, float64(MinStdDeviation))
+	// P(X > v) = 1 - CDF(v)
+	p := 0.5 * math.Erfc((v-u)/(o*math.Sqrt2))
+	return -math.Log10(p)
+}
+
+func meanStdDev(d []float64) (float64, float64) {
+	var sum float64
+	for _, v := range d {
+		sum += v
+	}
+	mean := sum / float64(len(d))
+
+	var sqDiff float64
+	for _, v := range d {
+		sqDiff += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sqDiff / float64(len(d)))
+}
@@ -91,3 +91,19 @@ func (mw *Window) All() []api.Metric {
 
 	return values
 }
+
+// Distribution returns the time elapsed, in nanoseconds, between the
+// reception of every two consecutive metrics in the window, starting with
+// the most recent ones.
+func (mw *Window) Distribution() []float64 {
+	ms := mw.All()
+	if len(ms) < 2 {
+		return nil
+	}
+
+	dist := make([]float64, 0, len(ms)-1)
+	for i := 0; i < len(ms)-1; i++ {
+		dist = append(dist, float64(ms[i].ReceivedAt-ms[i+1].ReceivedAt))
+	}
+	return dist
+}
@@ -276,6 +276,34 @@ func TestWindow_All(t *testing.T) {
 	})
 }
 
+func TestWindow_Distribution(t *testing.T) {
+	t.Run("single metric", func(t *testing.T) {
+		mw := NewWindow(4)
+		mw.Add(makeMetric("1"))
+		if len(mw.Distribution()) != 0 {
+			t.Error("expected an empty distribution")
+		}
+	})
+
+	t.Run("over flow capacity", func(t *testing.T) {
+		mw := NewWindow(4)
+		for i := 0; i < 6; i++ {
+			mw.Add(makeMetric(fmt.Sprint(i)))
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		dist := mw.Distribution()
+		if len(dist) != 3 {
+			t.Fatalf("expected 3 inter-arrival times: got: %d", len(dist))
+		}
+		for _, v := range dist {
+			if v < float64(10*time.Millisecond) {
+				t.Errorf("unexpected inter-arrival time: %s", time.Duration(v))
+			}
+		}
+	})
+}
+
 func TestWindow_AddParallel(t *testing.T) {
 	t.Parallel()
 
@@ -14,7 +14,8 @@ const envConfigKey = "cluster_pubsubmon"
 
 // Default values for this Config.
 const (
-	DefaultCheckInterval = 15 * time.Second
+	DefaultCheckInterval    = 15 * time.Second
+	DefaultFailureThreshold = 0.0
 )
 
 // Config allows to initialize a Monitor and customize some parameters.
@@ -22,10 +23,18 @@ type Config struct {
 	config.Saver
 
 	CheckInterval time.Duration
+
+	// FailureThreshold enables the phi-accrual failure detector when
+	// above 0. Peers are then only considered failed once their expired
+	// metrics are late enough compared to how often they usually
+	// arrive. Higher values are more lenient. Values between 2 and 4
+	// are reasonable.
+	FailureThreshold float64
 }
 
 type jsonConfig struct {
-	CheckInterval string `json:"check_interval"`
+	CheckInterval    string  `json:"check_interval"`
+	FailureThreshold float64 `json:"failure_threshold"`
 }
 
 // ConfigKey provides a human-friendly identifier for this type of Config.
@@ -36,6 +45,7 @@ func (cfg *Config) ConfigKey() string {
 // Default sets the fields of this Config to sensible values.
 func (cfg *Config) Default() error {
 	cfg.CheckInterval = DefaultCheckInterval
+	cfg.FailureThreshold = DefaultFailureThreshold
 	return nil
 }
 
@@ -59,6 +69,10 @@ func (cfg *Config) Validate() error {
 		return errors.New("pubsubmon.check_interval too low")
 	}
 
+	if cfg.FailureThreshold < 0 {
+		return errors.New("pubsubmon.failure_threshold is invalid")
+	}
+
 	return nil
 }
 
@@ -80,6 +94,7 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 	interval, _ := time.ParseDuration(jcfg.CheckInterval)
 	cfg.CheckInterval = interval
+	cfg.FailureThreshold = jcfg.FailureThreshold
 
 	return cfg.Validate()
 }
@@ -93,7 +108,8 @@ func (cfg *Config) ToJSON() ([]byte, error) {
 
 func (cfg *Config) toJSONConfig() *jsonConfig {
 	return &jsonConfig{
-		CheckInterval: cfg.CheckInterval.String(),
+		CheckInterval:    cfg.CheckInterval.String(),
+		FailureThreshold: cfg.FailureThreshold,
 	}
 }
 
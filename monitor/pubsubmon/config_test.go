@@ -9,7 +9,8 @@ import (
 
 var cfgJSON = []byte(`
 {
-      "check_interval": "15s"
+      "check_interval": "15s",
+      "failure_threshold": 3
 }
 `)
 
@@ -20,6 +21,10 @@ func TestLoadJSON(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	if cfg.FailureThreshold != 3 {
+		t.Error("expected failure_threshold to be set")
+	}
+
 	j := &jsonConfig{}
 
 	json.Unmarshal(cfgJSON, j)
@@ -29,6 +34,15 @@ func TestLoadJSON(t *testing.T) {
 	if err == nil {
 		t.Error("expected error decoding check_interval")
 	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.FailureThreshold = -1
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding failure_threshold")
+	}
 }
 
 func TestToJSON(t *testing.T) {
@@ -56,6 +70,12 @@ func TestDefault(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.FailureThreshold = -2
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
 }
 
 func TestApplyEnvVars(t *testing.T) {
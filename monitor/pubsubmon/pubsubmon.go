@@ -72,7 +72,7 @@ func New(
 	ctx, cancel := context.WithCancel(ctx)
 
 	mtrs := metrics.NewStore()
-	checker := metrics.NewChecker(ctx, mtrs)
+	checker := metrics.NewChecker(ctx, mtrs, cfg.FailureThreshold)
 
 	topic, err := psub.Join(PubsubTopic)
 	if err != nil {
@@ -276,6 +276,15 @@ func (mon *Monitor) Alerts() <-chan api.Alert {
 	return mon.checker.Alerts()
 }
 
+// SendAlert delivers an alert raised by another component on the Alerts
+// channel, next to the ones triggered by expired metrics.
+func (mon *Monitor) SendAlert(ctx context.Context, alrt api.Alert) error {
+	_, span := trace.StartSpan(ctx, "monitor/pubsub/SendAlert")
+	defer span.End()
+
+	return mon.checker.SendAlert(alrt)
+}
+
 // MetricNames lists all metric names.
 func (mon *Monitor) MetricNames(ctx context.Context) []string {
 	_, span := trace.StartSpan(ctx, "monitor/pubsub/MetricNames")
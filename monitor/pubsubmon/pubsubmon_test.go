@@ -311,3 +311,30 @@ func TestPeerMonitorAlerts(t *testing.T) {
 		}
 	}
 }
+
+func TestPeerMonitorSendAlert(t *testing.T) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(t)
+	defer shutdown()
+
+	err := pm.SendAlert(ctx, api.Alert{
+		Metric: api.Metric{
+			Name:  "scrub",
+			Peer:  test.PeerID1,
+			Value: test.Cid1.String(),
+		},
+		TriggeredAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("alert should have been delivered")
+	case alrt := <-pm.Alerts():
+		if alrt.Name != "scrub" || alrt.Value != test.Cid1.String() {
+			t.Error("unexpected alert")
+		}
+	}
+}
@@ -39,6 +39,25 @@ var (
 	PinsPinning  = stats.Int64("pins/pinning", "Current number of pins currently pinning", stats.UnitDimensionless)
 	PinsPinError = stats.Int64("pins/pin_error", "Current number of pins in pin_error state", stats.UnitDimensionless)
 
+	// These metrics are managed by the scrubber in pintracker/stateless.
+	PinsScrubbed       = stats.Int64("pins/scrubbed", "Total number of pins verified by the scrubber", stats.UnitDimensionless)
+	PinsScrubCorrupted = stats.Int64("pins/scrub_corrupted", "Total number of corrupted pins found by the scrubber", stats.UnitDimensionless)
+	PinsScrubErrors    = stats.Int64("pins/scrub_errors", "Total number of pins that the scrubber failed to verify", stats.UnitDimensionless)
+
+	// These metrics are managed by the rebalancer in the cluster component.
+	RebalancePending         = stats.Int64("rebalance/pending", "Number of misplaced pins found on the last rebalancer run", stats.UnitDimensionless)
+	RebalanceMigrations      = stats.Int64("rebalance/migrations", "Total number of pins migrated by the rebalancer", stats.UnitDimensionless)
+	RebalanceMigrationErrors = stats.Int64("rebalance/migration_errors", "Total number of failed rebalancer migrations", stats.UnitDimensionless)
+
+	// These metrics are updated every time a replication report is
+	// generated by the cluster component.
+	PinsUnderReplicated = stats.Int64("pins/under_replicated", "Number of pins with fewer healthy copies than replication_factor_min", stats.UnitDimensionless)
+	PinsOverReplicated  = stats.Int64("pins/over_replicated", "Number of pins with more healthy copies than replication_factor_max", stats.UnitDimensionless)
+	PinsUnavailable     = stats.Int64("pins/unavailable", "Number of pins without any healthy copy", stats.UnitDimensionless)
+
+	// This metric is managed by the cluster component.
+	PinsReallocated = stats.Int64("pins/reallocated", "Total number of pin_error allocations handed to other peers", stats.UnitDimensionless)
+
 	// These metrics and managed in the ipfshttp module.
 	PinsIpfsPins    = stats.Int64("pins/ipfs_pins", "Current number of items pinned on IPFS", stats.UnitDimensionless)
 	PinsPinAdd      = stats.Int64("pins/pin_add", "Total number of IPFS pin requests", stats.UnitDimensionless)
@@ -81,6 +100,56 @@ var (
 		Aggregation: view.LastValue(),
 	}
 
+	PinsScrubbedView = &view.View{
+		Measure:     PinsScrubbed,
+		Aggregation: view.Sum(),
+	}
+
+	PinsScrubCorruptedView = &view.View{
+		Measure:     PinsScrubCorrupted,
+		Aggregation: view.Sum(),
+	}
+
+	PinsScrubErrorsView = &view.View{
+		Measure:     PinsScrubErrors,
+		Aggregation: view.Sum(),
+	}
+
+	RebalancePendingView = &view.View{
+		Measure:     RebalancePending,
+		Aggregation: view.LastValue(),
+	}
+
+	RebalanceMigrationsView = &view.View{
+		Measure:     RebalanceMigrations,
+		Aggregation: view.Sum(),
+	}
+
+	RebalanceMigrationErrorsView = &view.View{
+		Measure:     RebalanceMigrationErrors,
+		Aggregation: view.Sum(),
+	}
+
+	PinsUnderReplicatedView = &view.View{
+		Measure:     PinsUnderReplicated,
+		Aggregation: view.LastValue(),
+	}
+
+	PinsOverReplicatedView = &view.View{
+		Measure:     PinsOverReplicated,
+		Aggregation: view.LastValue(),
+	}
+
+	PinsUnavailableView = &view.View{
+		Measure:     PinsUnavailable,
+		Aggregation: view.LastValue(),
+	}
+
+	PinsReallocatedView = &view.View{
+		Measure:     PinsReallocated,
+		Aggregation: view.Sum(),
+	}
+
 	PinsIpfsPinsView = &view.View{
 		Measure:     PinsIpfsPins,
 		Aggregation: view.LastValue(),
@@ -126,6 +195,16 @@ var (
 		PinsQueuedView,
 		PinsPinningView,
 		PinsPinErrorView,
+		PinsScrubbedView,
+		PinsScrubCorruptedView,
+		PinsScrubErrorsView,
+		RebalancePendingView,
+		RebalanceMigrationsView,
+		RebalanceMigrationErrorsView,
+		PinsUnderReplicatedView,
+		PinsOverReplicatedView,
+		PinsUnavailableView,
+		PinsReallocatedView,
 		PinsIpfsPinsView,
 		PinsPinAddView,
 		PinsPinAddErrorView,
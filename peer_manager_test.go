@@ -300,6 +300,128 @@ func TestClustersPeerRemove(t *testing.T) {
 	}
 }
 
+func TestClustersPeerDrain(t *testing.T) {
+	ctx := context.Background()
+	clusters, mocks := createClusters(t)
+	defer shutdownClusters(t, clusters, mocks)
+
+	if len(clusters) < 4 {
+		t.Skip("test needs at least 4 clusters")
+	}
+
+	for _, c := range clusters {
+		c.config.ReplicationFactorMin = 2
+		c.config.ReplicationFactorMax = 2
+	}
+
+	ttlDelay()
+
+	c0 := clusters[0]
+	drained := clusters[1].id
+	prefix := test.Cid1.Prefix()
+	var cids []api.Cid
+	for i := 0; i < 3; i++ {
+		h, err := prefix.Sum(randomBytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pin := api.PinWithOpts(api.NewCid(h), api.PinOptions{})
+		pin.Allocations = []peer.ID{drained, clusters[2].id}
+		_, _, err = c0.pin(ctx, pin, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cids = append(cids, pin.Cid)
+	}
+
+	pinDelay()
+
+	_, err := c0.PeerDrain(ctx, drained, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status api.DrainStatus
+	for i := 0; i < 60; i++ {
+		status, err = c0.PeerDrainStatus(ctx, drained)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Phase != api.DrainPhaseDraining {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if status.Phase != api.DrainPhaseDone || status.Pins != 3 || status.Moved != 3 {
+		t.Fatalf("unexpected drain status: %+v", status)
+	}
+
+	pinDelay()
+
+	// The drain is in the shared state.
+	remote, err := clusters[3].PeerDrainStatus(ctx, drained)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote.Phase != api.DrainPhaseDone || remote.Coordinator != c0.id || remote.Moved != 3 {
+		t.Errorf("unexpected drain status in another peer: %+v", remote)
+	}
+
+	for _, ci := range cids {
+		pin, err := c0.PinGet(ctx, ci)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pin.Allocations) != 2 || containsPeer(pin.Allocations, drained) {
+			t.Errorf("%s should have been moved out of the drained peer: %s", ci, pin.Allocations)
+		}
+		gpi, err := c0.Status(ctx, ci)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pinnedIn(gpi, pin.Allocations) {
+			t.Errorf("%s should be pinned in its new allocations", ci)
+		}
+		if pi := gpi.PeerMap[peer.Encode(drained)]; pi.Status != api.TrackerStatusRemote {
+			t.Errorf("%s should have been unpinned from the drained peer: %s", ci, pi.Status)
+		}
+	}
+
+	// Other peers do not allocate to the drained peer.
+	opts := api.PinOptions{
+		ReplicationFactorMin: nClusters - 1,
+		ReplicationFactorMax: nClusters - 1,
+	}
+	preview, err := clusters[2].AllocationPreview(ctx, api.CidUndef, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Error != "" || containsPeer(preview.Allocations, drained) {
+		t.Errorf("the drained peer should not be allocated: %+v", preview)
+	}
+
+	_, err = clusters[3].PeerDrainCancel(ctx, drained)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts.ReplicationFactorMin = nClusters
+	opts.ReplicationFactorMax = nClusters
+	for i := 0; i < 20; i++ {
+		preview, err = clusters[2].AllocationPreview(ctx, api.CidUndef, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if preview.Error == "" {
+			break
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	if !containsPeer(preview.Allocations, drained) {
+		t.Errorf("the peer should be allocatable after cancelling the drain: %+v", preview)
+	}
+}
+
 func TestClustersPeerRemoveSelf(t *testing.T) {
 	ctx := context.Background()
 	// this test hangs sometimes if there are problems
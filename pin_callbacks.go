@@ -0,0 +1,429 @@
+package ipfscluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/state"
+
+	"go.opencensus.io/trace"
+)
+
+// This file contains pin callbacks. When a pin sets a callback_url, or the
+// configuration sets a PinCallbackURL, the peer that received the pin
+// request follows the status of the pin and POSTs an api.PinCallback to the
+// URL once replication_factor_min peers have pinned it, or as soon as that
+// cannot happen. Callbacks are not persisted: those pending when the peer
+// shuts down are never sent.
+//
+// Only data pins get callbacks. The callback_url of sharded adds (meta
+// pins) and of collections is ignored, and collection members never get
+// one, as they are pinned by the collection and not by a pin request.
+//
+// A single loop checks the pending callbacks every
+// PinCallbackCheckInterval, fetching the status of up to
+// pinCallbackStatusBatch items from every peer at once. Ready callbacks are
+// sent by pinCallbackSenders workers.
+
+// pinCallbackSignatureHeader carries the hex-encoded HMAC-SHA256 of the
+// callback body when a PinCallbackSecret is configured.
+const pinCallbackSignatureHeader = "X-Cluster-Signature"
+
+var (
+	// pinCallbackRequestTimeout is the timeout for every callback
+	// request.
+	pinCallbackRequestTimeout = 30 * time.Second
+	// pinCallbackSenders is the number of callbacks that are sent
+	// concurrently.
+	pinCallbackSenders = 10
+	// pinCallbackStatusBatch is the maximum number of items whose status
+	// is requested in a single call to every peer.
+	pinCallbackStatusBatch = 1000
+)
+
+// pinCallbackClient sends the callbacks. Redirects are not followed, so
+// that callbacks only reach the allowed hosts.
+var pinCallbackClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// pinCallback tracks a callback pending in this peer. Only the callbacks
+// loop reads and updates the pin and the status.
+type pinCallback struct {
+	url      string
+	deadline time.Time
+	pin      api.Pin
+	status   api.GlobalPinInfo
+}
+
+// readyPinCallback is a callback waiting to be sent.
+type readyPinCallback struct {
+	url string
+	cb  api.PinCallback
+}
+
+// checkPinCallbackURL returns an error when the callback URL requested by
+// a pin is not allowed by the PinCallbackAllowedHosts. The configured
+// PinCallbackURL is always allowed.
+func (c *Cluster) checkPinCallbackURL(callbackURL string) error {
+	if callbackURL == "" || callbackURL == c.config.PinCallbackURL {
+		return nil
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	for _, allowed := range c.config.PinCallbackAllowedHosts {
+		if allowed == "*" || strings.EqualFold(allowed, host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("callback_url host %q is not allowed", host)
+}
+
+// watchPinCallback registers a callback for the pin when one has been
+// requested for it. A callback pending for the same item is replaced.
+func (c *Cluster) watchPinCallback(pin api.Pin) {
+	// Meta pins, cluster DAGs and collections are not pinned
+	// themselves.
+	if pin.Type != api.DataType {
+		return
+	}
+
+	callbackURL := pin.CallbackURL
+	if callbackURL == "" {
+		callbackURL = c.config.PinCallbackURL
+	}
+	if callbackURL == "" {
+		return
+	}
+
+	c.pinCallbacksMux.Lock()
+	c.pinCallbacks[pin.Cid] = &pinCallback{
+		url:      callbackURL,
+		deadline: time.Now().Add(c.config.PinCallbackTimeout),
+		pin:      pin,
+	}
+	c.pinCallbacksMux.Unlock()
+
+	// wake up the callbacks loop.
+	select {
+	case c.pinCallbacksCh <- struct{}{}:
+	default:
+	}
+}
+
+// cancelPinCallback discards the callback pending for an item, if any.
+func (c *Cluster) cancelPinCallback(h api.Cid) {
+	c.pinCallbacksMux.Lock()
+	defer c.pinCallbacksMux.Unlock()
+
+	delete(c.pinCallbacks, h)
+}
+
+// forgetPinCallback removes the given callback and returns false if it
+// had already been cancelled or replaced by a newer one.
+func (c *Cluster) forgetPinCallback(pcb *pinCallback) bool {
+	c.pinCallbacksMux.Lock()
+	defer c.pinCallbacksMux.Unlock()
+
+	if c.pinCallbacks[pcb.pin.Cid] != pcb {
+		return false
+	}
+	delete(c.pinCallbacks, pcb.pin.Cid)
+	return true
+}
+
+// pinCallbacksLoop checks the pending callbacks every
+// PinCallbackCheckInterval while there are any, and sends those that are
+// ready.
+func (c *Cluster) pinCallbacksLoop() {
+	queue := make(chan readyPinCallback, pinCallbackSenders)
+	var wg sync.WaitGroup
+	wg.Add(pinCallbackSenders)
+	for i := 0; i < pinCallbackSenders; i++ {
+		go func() {
+			defer wg.Done()
+			for rcb := range queue {
+				err := c.sendPinCallback(c.ctx, rcb.url, rcb.cb)
+				if err != nil {
+					logger.Errorf("error sending the callback for %s: %s", rcb.cb.Cid, err)
+					continue
+				}
+				logger.Debugf("sent %s callback for %s", rcb.cb.Type, rcb.cb.Cid)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(queue)
+
+	// timer is only set while callbacks are pending.
+	var timer *time.Timer
+	for {
+		var timerC <-chan time.Time
+		if timer != nil {
+			timerC = timer.C
+		}
+
+		select {
+		case <-c.ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-c.pinCallbacksCh:
+			if timer == nil {
+				timer = time.NewTimer(c.config.PinCallbackCheckInterval)
+			}
+		case <-timerC:
+			timer = nil
+			if c.checkPinCallbacks(c.ctx, queue) > 0 {
+				timer = time.NewTimer(c.config.PinCallbackCheckInterval)
+			}
+		}
+	}
+}
+
+// checkPinCallbacks checks the status of the pending callbacks, queues
+// those that are ready and returns how many are left.
+func (c *Cluster) checkPinCallbacks(ctx context.Context, queue chan<- readyPinCallback) int {
+	ctx, span := trace.StartSpan(ctx, "cluster/checkPinCallbacks")
+	defer span.End()
+
+	c.pinCallbacksMux.Lock()
+	pending := make([]*pinCallback, 0, len(c.pinCallbacks))
+	for _, pcb := range c.pinCallbacks {
+		pending = append(pending, pcb)
+	}
+	c.pinCallbacksMux.Unlock()
+
+	for len(pending) > 0 {
+		n := len(pending)
+		if n > pinCallbackStatusBatch {
+			n = pinCallbackStatusBatch
+		}
+		c.checkPinCallbackBatch(ctx, pending[:n], queue)
+		pending = pending[n:]
+	}
+
+	c.pinCallbacksMux.Lock()
+	defer c.pinCallbacksMux.Unlock()
+	return len(c.pinCallbacks)
+}
+
+// checkPinCallbackBatch requests the status of the given callbacks from
+// every peer at once and queues those that are ready or have timed out.
+// Callbacks for items that have been unpinned are discarded.
+func (c *Cluster) checkPinCallbackBatch(ctx context.Context, batch []*pinCallback, queue chan<- readyPinCallback) {
+	st, err := c.consensus.State(ctx)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	now := time.Now()
+	cids := make([]api.Cid, 0, len(batch))
+	checked := make([]*pinCallback, 0, len(batch))
+	for _, pcb := range batch {
+		if now.After(pcb.deadline) {
+			cb := newPinCallback(pcb.pin, pcb.status)
+			cb.Type = api.EventError
+			cb.Error = fmt.Sprintf("not pinned by %d peers after %s", cb.ReplicationFactorMin, c.config.PinCallbackTimeout)
+			c.queuePinCallback(ctx, pcb, cb, queue)
+			continue
+		}
+
+		pin, err := st.Get(ctx, pcb.pin.Cid)
+		if err == state.ErrNotFound {
+			c.forgetPinCallback(pcb)
+			continue
+		}
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		// Follow allocation changes.
+		pcb.pin = pin
+		cids = append(cids, pin.Cid)
+		checked = append(checked, pcb)
+	}
+	if len(cids) == 0 {
+		return
+	}
+
+	gpis, err := c.globalPinInfoCids(ctx, cids)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	for _, pcb := range checked {
+		gpi, ok := gpis[pcb.pin.Cid]
+		if !ok {
+			continue
+		}
+		pcb.status = gpi
+		cb, done := pinCallbackFor(pcb.pin, gpi)
+		if done {
+			c.queuePinCallback(ctx, pcb, cb, queue)
+		}
+	}
+}
+
+// queuePinCallback removes the callback from the pending ones and queues
+// it to be sent, unless it was cancelled or replaced in the meantime.
+func (c *Cluster) queuePinCallback(ctx context.Context, pcb *pinCallback, cb api.PinCallback, queue chan<- readyPinCallback) {
+	if !c.forgetPinCallback(pcb) {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case queue <- readyPinCallback{url: pcb.url, cb: cb}:
+	}
+}
+
+// newPinCallback returns a callback for the pin with the given status,
+// without setting its Type.
+func newPinCallback(pin api.Pin, gpi api.GlobalPinInfo) api.PinCallback {
+	cb := api.PinCallback{
+		Cid:                  pin.Cid,
+		Name:                 pin.Name,
+		ReplicationFactorMin: pin.ReplicationFactorMin,
+		Status:               gpi,
+		Timestamp:            time.Now(),
+	}
+	for _, pinfo := range gpi.PeerMap {
+		if pinfo.Status == api.TrackerStatusPinned {
+			cb.Pinned++
+		}
+	}
+	return cb
+}
+
+// pinCallbackFor returns the callback for a pin and whether it is ready to
+// be sent: the pin has been pinned by replication_factor_min peers (or by
+// every peer when pinned everywhere), or enough of them have failed that it
+// cannot be.
+func pinCallbackFor(pin api.Pin, gpi api.GlobalPinInfo) (api.PinCallback, bool) {
+	cb := newPinCallback(pin, gpi)
+
+	var pending, failed int
+	var lastErr string
+	for _, pinfo := range gpi.PeerMap {
+		switch {
+		case pinfo.Status == api.TrackerStatusRemote:
+		case pinfo.Status == api.TrackerStatusPinned:
+		case pinfo.Status&api.TrackerStatusError != 0:
+			failed++
+			lastErr = pinfo.Error
+		default:
+			pending++
+		}
+	}
+
+	want := pin.ReplicationFactorMin
+	if pin.IsPinEverywhere() {
+		want = cb.Pinned + pending + failed
+	}
+	if want <= 0 {
+		return cb, false
+	}
+
+	switch {
+	case cb.Pinned >= want:
+		cb.Type = api.EventPinned
+		return cb, true
+	case failed > 0 && cb.Pinned+pending < want:
+		cb.Type = api.EventError
+		cb.Error = lastErr
+		return cb, true
+	default:
+		return cb, false
+	}
+}
+
+// sendPinCallback POSTs the callback to the given URL, retrying with an
+// exponential backoff.
+func (c *Cluster) sendPinCallback(ctx context.Context, callbackURL string, cb api.PinCallback) error {
+	ctx, span := trace.StartSpan(ctx, "cluster/sendPinCallback")
+	defer span.End()
+
+	body, err := json.Marshal(cb)
+	if err != nil {
+		return err
+	}
+
+	backoff := c.config.PinCallbackRetryBackoff
+	for i := 0; ; i++ {
+		retry, err := c.postPinCallback(ctx, callbackURL, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || i >= c.config.PinCallbackMaxRetries {
+			return err
+		}
+		logger.Debugf("pin callback: %s. Retrying in %s", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// postPinCallback makes a single callback request and returns whether it
+// can be retried when it fails.
+func (c *Cluster) postPinCallback(ctx context.Context, callbackURL string, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, pinCallbackRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := c.config.PinCallbackSecret; secret != "" {
+		req.Header.Set(pinCallbackSignatureHeader, signPinCallback(secret, body))
+	}
+
+	resp, err := pinCallbackClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("callback returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("callback returned %s", resp.Status)
+	}
+}
+
+// signPinCallback returns the hex-encoded HMAC-SHA256 of the body.
+func signPinCallback(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -29,6 +29,10 @@ const (
 	// OperationShard represents a meta pin. We don't
 	// pin these.
 	OperationShard
+	// OperationVerify represents an integrity check of a pinned
+	// item. Failed checks stay in the tracker until the item is
+	// recovered.
+	OperationVerify
 )
 
 //go:generate stringer -type=Phase
@@ -150,6 +154,7 @@ func (op *Operation) SetPhase(ph Phase) {
 		op.tracker.recordMetricUnsafe(op, 1)
 	}
 	op.mu.Unlock()
+	op.tracker.publishOp(op)
 
 	span.End()
 }
@@ -211,6 +216,7 @@ func (op *Operation) SetError(err error) {
 		op.tracker.recordMetricUnsafe(op, 1)
 	}
 	op.mu.Unlock()
+	op.tracker.publishOp(op)
 	span.End()
 }
 
@@ -285,6 +291,13 @@ func (op *Operation) ToTrackerStatus() api.TrackerStatus {
 		return api.TrackerStatusRemote
 	case OperationShard:
 		return api.TrackerStatusSharded
+	case OperationVerify:
+		switch ph {
+		case PhaseError:
+			return api.TrackerStatusCorrupted
+		default:
+			return api.TrackerStatusPinned
+		}
 	default:
 		return api.TrackerStatusUndefined
 	}
@@ -315,6 +328,8 @@ func TrackerStatusToOperationPhase(status api.TrackerStatus) (OperationType, Pha
 		return OperationRemote, PhaseDone
 	case api.TrackerStatusSharded:
 		return OperationShard, PhaseDone
+	case api.TrackerStatusCorrupted:
+		return OperationVerify, PhaseError
 	default:
 		return OperationUnknown, PhaseError
 	}
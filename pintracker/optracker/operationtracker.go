@@ -34,6 +34,9 @@ type OperationTracker struct {
 	mu         sync.RWMutex
 	operations map[api.Cid]*Operation
 
+	subsMu      sync.RWMutex
+	subscribers map[chan api.Event]struct{}
+
 	pinningCount   int64
 	pinErrorCount  int64
 	pinQueuedCount int64
@@ -62,10 +65,11 @@ func NewOperationTracker(ctx context.Context, pid peer.ID, peerName string) *Ope
 	initializeMetrics(ctx)
 
 	return &OperationTracker{
-		ctx:        ctx,
-		pid:        pid,
-		peerName:   peerName,
-		operations: make(map[api.Cid]*Operation),
+		ctx:         ctx,
+		pid:         pid,
+		peerName:    peerName,
+		operations:  make(map[api.Cid]*Operation),
+		subscribers: make(map[chan api.Event]struct{}),
 	}
 }
 
@@ -104,6 +108,7 @@ func (opt *OperationTracker) TrackNewOperation(ctx context.Context, pin api.Pin,
 	logger.Debugf("'%s' on cid '%s' has been created with phase '%s'", typ, pin.Cid, ph)
 	opt.operations[pin.Cid] = op2
 	opt.recordMetricUnsafe(op2, 1)
+	opt.publishOp(op2)
 	return op2
 }
 
@@ -183,6 +188,7 @@ func (opt *OperationTracker) unsafePinInfo(ctx context.Context, op *Operation, i
 		Origins:     op.Pin().Origins,
 		Created:     op.Pin().Timestamp,
 		Metadata:    op.Pin().Metadata,
+		Priority:    op.Pin().Priority,
 		PinInfoShort: api.PinInfoShort{
 			PeerName:      opt.peerName,
 			IPFS:          ipfs.ID,
@@ -396,3 +402,86 @@ func (opt *OperationTracker) recordMetric(op *Operation, val int64) {
 func (opt *OperationTracker) PinQueueSize() int64 {
 	return atomic.LoadInt64(&opt.pinQueuedCount)
 }
+
+// EventBufferSize is the number of events that can wait to be read by every
+// subscriber. Events are dropped for subscribers that fall behind.
+var EventBufferSize = 1024
+
+// Subscribe returns a channel on which all the events published by the
+// OperationTracker are received. The channel is closed when the given
+// context is cancelled.
+func (opt *OperationTracker) Subscribe(ctx context.Context) <-chan api.Event {
+	ch := make(chan api.Event, EventBufferSize)
+
+	opt.subsMu.Lock()
+	opt.subscribers[ch] = struct{}{}
+	opt.subsMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		opt.subsMu.Lock()
+		delete(opt.subscribers, ch)
+		close(ch)
+		opt.subsMu.Unlock()
+	}()
+	return ch
+}
+
+// Publish sends an event to all subscribers. It does not block.
+func (opt *OperationTracker) Publish(ev api.Event) {
+	if opt == nil {
+		return
+	}
+
+	opt.subsMu.RLock()
+	defer opt.subsMu.RUnlock()
+	for ch := range opt.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			logger.Warnf("event subscriber is too slow. Dropping %s event for %s", ev.Type, ev.Cid)
+		}
+	}
+}
+
+// publishOp publishes an event for the current phase of a pin or unpin
+// operation. Other operations do not produce events, except for failed
+// verifications.
+func (opt *OperationTracker) publishOp(op *Operation) {
+	if opt == nil || op == nil {
+		return
+	}
+
+	var typ api.EventType
+	status := op.ToTrackerStatus()
+	switch status {
+	case api.TrackerStatusPinQueued, api.TrackerStatusUnpinQueued:
+		typ = api.EventQueued
+	case api.TrackerStatusPinning:
+		typ = api.EventPinning
+	case api.TrackerStatusUnpinning:
+		typ = api.EventUnpinning
+	case api.TrackerStatusUnpinned:
+		typ = api.EventUnpinned
+	case api.TrackerStatusPinError, api.TrackerStatusUnpinError, api.TrackerStatusCorrupted:
+		typ = api.EventError
+	case api.TrackerStatusPinned:
+		if op.Type() != OperationPin {
+			return // verifications
+		}
+		typ = api.EventPinned
+	default:
+		return
+	}
+
+	opt.Publish(api.Event{
+		Type:      typ,
+		Cid:       op.Cid(),
+		Name:      op.Pin().Name,
+		Peer:      opt.pid,
+		PeerName:  opt.peerName,
+		Status:    status,
+		Error:     op.Error(),
+		Timestamp: op.Timestamp(),
+	})
+}
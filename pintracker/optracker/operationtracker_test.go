@@ -256,3 +256,41 @@ func TestOperationTracker_filterOps(t *testing.T) {
 		}
 	})
 }
+
+func TestOperationTracker_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	opt := testOperationTracker(t)
+
+	subCtx, cancel := context.WithCancel(ctx)
+	events := opt.Subscribe(subCtx)
+
+	op := opt.TrackNewOperation(ctx, api.PinCid(test.Cid1), OperationPin, PhaseQueued)
+	op.SetPhase(PhaseInProgress)
+	op.SetError(errors.New("fake error"))
+	opt.TrackNewOperation(ctx, api.PinCid(test.Cid2), OperationRemote, PhaseInProgress)
+	opt.Publish(api.Event{Type: api.EventPinsetRemove, Cid: test.Cid3})
+
+	expected := []api.EventType{
+		api.EventQueued,
+		api.EventPinning,
+		api.EventError,
+		api.EventPinsetRemove,
+	}
+	for _, typ := range expected {
+		ev := <-events
+		if ev.Type != typ {
+			t.Fatalf("expected %s event, got %s", typ, ev.Type)
+		}
+	}
+
+	select {
+	case ev := <-events:
+		t.Fatal("unexpected event:", ev)
+	default:
+	}
+
+	cancel()
+	for range events {
+	}
+	opt.Publish(api.Event{Type: api.EventPinsetAdd, Cid: test.Cid1})
+}
@@ -4,9 +4,9 @@ package optracker
 
 import "strconv"
 
-const _OperationType_name = "OperationUnknownOperationPinOperationUnpinOperationRemoteOperationShard"
+const _OperationType_name = "OperationUnknownOperationPinOperationUnpinOperationRemoteOperationShardOperationVerify"
 
-var _OperationType_index = [...]uint8{0, 16, 28, 42, 57, 71}
+var _OperationType_index = [...]uint8{0, 16, 28, 42, 57, 71, 86}
 
 func (i OperationType) String() string {
 	if i < 0 || i >= OperationType(len(_OperationType_index)-1) {
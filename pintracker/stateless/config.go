@@ -19,6 +19,8 @@ const (
 	DefaultConcurrentPins        = 10
 	DefaultPriorityPinMaxAge     = 24 * time.Hour
 	DefaultPriorityPinMaxRetries = 5
+	DefaultScrubInterval         = 0 // disabled
+	DefaultScrubPinsPerCycle     = 100
 )
 
 // Config allows to initialize a Monitor and customize some parameters.
@@ -40,6 +42,16 @@ type Config struct {
 	// PriorityPinMaxRetries specifies the maximum amount of retries that
 	// a pin can have before it is moved to a non-prioritary queue.
 	PriorityPinMaxRetries int
+
+	// ScrubInterval specifies how often the scrubber wakes up to verify
+	// the integrity (block presence and hashes) of some of the items
+	// pinned by this peer. 0 disables scrubbing.
+	ScrubInterval time.Duration
+
+	// ScrubPinsPerCycle specifies how many pins are verified every
+	// ScrubInterval. The scrubber goes through the full pinset slowly,
+	// a slice at a time, so that it does not overload the disks.
+	ScrubPinsPerCycle int
 }
 
 type jsonConfig struct {
@@ -47,6 +59,8 @@ type jsonConfig struct {
 	ConcurrentPins        int    `json:"concurrent_pins"`
 	PriorityPinMaxAge     string `json:"priority_pin_max_age"`
 	PriorityPinMaxRetries int    `json:"priority_pin_max_retries"`
+	ScrubInterval         string `json:"scrub_interval"`
+	ScrubPinsPerCycle     int    `json:"scrub_pins_per_cycle"`
 }
 
 // ConfigKey provides a human-friendly identifier for this type of Config.
@@ -60,6 +74,8 @@ func (cfg *Config) Default() error {
 	cfg.ConcurrentPins = DefaultConcurrentPins
 	cfg.PriorityPinMaxAge = DefaultPriorityPinMaxAge
 	cfg.PriorityPinMaxRetries = DefaultPriorityPinMaxRetries
+	cfg.ScrubInterval = DefaultScrubInterval
+	cfg.ScrubPinsPerCycle = DefaultScrubPinsPerCycle
 	return nil
 }
 
@@ -95,6 +111,14 @@ func (cfg *Config) Validate() error {
 		return errors.New("statelesstracker.priority_pin_max_retries is too low")
 	}
 
+	if cfg.ScrubInterval < 0 {
+		return errors.New("statelesstracker.scrub_interval is invalid")
+	}
+
+	if cfg.ScrubPinsPerCycle <= 0 {
+		return errors.New("statelesstracker.scrub_pins_per_cycle is too low")
+	}
+
 	return nil
 }
 
@@ -122,12 +146,18 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 			Dst:      &cfg.PriorityPinMaxAge,
 			Name:     "priority_pin_max_age",
 		},
+		&config.DurationOpt{
+			Duration: jcfg.ScrubInterval,
+			Dst:      &cfg.ScrubInterval,
+			Name:     "scrub_interval",
+		},
 	)
 	if err != nil {
 		return err
 	}
 
 	config.SetIfNotDefault(jcfg.PriorityPinMaxRetries, &cfg.PriorityPinMaxRetries)
+	config.SetIfNotDefault(jcfg.ScrubPinsPerCycle, &cfg.ScrubPinsPerCycle)
 
 	return cfg.Validate()
 }
@@ -144,6 +174,8 @@ func (cfg *Config) toJSONConfig() *jsonConfig {
 		ConcurrentPins:        cfg.ConcurrentPins,
 		PriorityPinMaxAge:     cfg.PriorityPinMaxAge.String(),
 		PriorityPinMaxRetries: cfg.PriorityPinMaxRetries,
+		ScrubInterval:         cfg.ScrubInterval.String(),
+		ScrubPinsPerCycle:     cfg.ScrubPinsPerCycle,
 	}
 	if cfg.MaxPinQueueSize != DefaultMaxPinQueueSize {
 		jCfg.MaxPinQueueSize = cfg.MaxPinQueueSize
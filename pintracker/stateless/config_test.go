@@ -12,7 +12,9 @@ var cfgJSON = []byte(`
 	"max_pin_queue_size": 4092,
 	"concurrent_pins": 2,
 	"priority_pin_max_age": "240h",
-	"priority_pin_max_retries": 4
+	"priority_pin_max_retries": 4,
+	"scrub_interval": "1h",
+	"scrub_pins_per_cycle": 50
 }
 `)
 
@@ -43,6 +45,12 @@ func TestLoadJSON(t *testing.T) {
 	if cfg.PriorityPinMaxRetries != 2 {
 		t.Error("expected 2 max retries")
 	}
+	if cfg.ScrubInterval != time.Hour {
+		t.Error("expected 1h scrub interval")
+	}
+	if cfg.ScrubPinsPerCycle != 50 {
+		t.Error("expected 50 pins per scrub cycle")
+	}
 }
 
 func TestToJSON(t *testing.T) {
@@ -75,6 +83,11 @@ func TestDefault(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+	cfg.PriorityPinMaxRetries = 2
+	cfg.ScrubPinsPerCycle = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
 }
 
 func TestApplyEnvVars(t *testing.T) {
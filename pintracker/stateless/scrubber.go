@@ -0,0 +1,172 @@
+package stateless
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/observations"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/trace"
+)
+
+// ScrubAlertName is the name of the alerts sent to the PeerMonitor when
+// the scrubber finds a corrupted pin. The alert value is the CID.
+const ScrubAlertName = "scrub"
+
+// scrubLoop runs a scrub cycle every ScrubInterval until the tracker is
+// shut down.
+func (spt *Tracker) scrubLoop() {
+	defer spt.wg.Done()
+
+	select {
+	case <-spt.ctx.Done():
+		return
+	case <-spt.rpcReady:
+	}
+
+	ticker := time.NewTicker(spt.config.ScrubInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-spt.ctx.Done():
+			return
+		case <-ticker.C:
+			err := spt.scrub(spt.ctx)
+			if err != nil {
+				logger.Errorf("scrubbing: %s", err)
+			}
+		}
+	}
+}
+
+// scrub verifies the next ScrubPinsPerCycle items allocated to this peer.
+// Corrupted items are reported to the PeerMonitor as alerts and stay in
+// the "corrupted" state until they are recovered.
+func (spt *Tracker) scrub(ctx context.Context) error {
+	ctx, span := trace.StartSpan(ctx, "tracker/stateless/scrub")
+	defer span.End()
+
+	batch, err := spt.nextScrubBatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	logger.Debugf("scrubbing %d pins", len(batch))
+	for _, ci := range batch {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		pi, err := spt.Verify(ctx, ci)
+		if err != nil {
+			logger.Errorf("error scrubbing %s: %s", ci, err)
+			stats.Record(ctx, observations.PinsScrubErrors.M(1))
+			continue
+		}
+
+		switch pi.Status {
+		case api.TrackerStatusPinned:
+			stats.Record(ctx, observations.PinsScrubbed.M(1))
+		case api.TrackerStatusCorrupted:
+			stats.Record(ctx, observations.PinsScrubbed.M(1))
+			stats.Record(ctx, observations.PinsScrubCorrupted.M(1))
+			logger.Errorf("scrubber found corrupted pin %s: %s", ci, pi.Error)
+			spt.sendScrubAlert(ctx, ci)
+		default:
+			// Not pinned (yet) so there was nothing to verify.
+		}
+	}
+	return nil
+}
+
+type scrubItem struct {
+	key string
+	cid api.Cid
+}
+
+// nextScrubBatch returns, in order, the ScrubPinsPerCycle items following
+// the ones checked on the previous cycle. Items are sorted by their CID
+// so that the full pinset is covered regardless of the order in which the
+// state lists them. When the end is reached, the next cycle starts over.
+func (spt *Tracker) nextScrubBatch(ctx context.Context) ([]api.Cid, error) {
+	st, err := spt.getState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statePins := make(chan api.Pin, pinsChannelSize)
+	go func() {
+		err := st.List(ctx, statePins)
+		if err != nil {
+			logger.Error(err)
+		}
+	}()
+
+	n := spt.config.ScrubPinsPerCycle
+	items := make([]scrubItem, 0, n+1)
+	for p := range statePins {
+		// Meta pins, collections and records are not pinned and
+		// remote pins are someone else's business.
+		if p.Type == api.MetaType || p.Type == api.CollectionType || p.Type == api.RecordType ||
+			p.IsRemotePin(spt.peerID) {
+			continue
+		}
+		key := p.Cid.KeyString()
+		if key <= spt.scrubCursor {
+			continue
+		}
+		i := sort.Search(len(items), func(i int) bool {
+			return items[i].key >= key
+		})
+		if i >= n {
+			continue
+		}
+		items = append(items, scrubItem{})
+		copy(items[i+1:], items[i:])
+		items[i] = scrubItem{key: key, cid: p.Cid}
+		if len(items) > n {
+			items = items[:n]
+		}
+	}
+
+	if len(items) < n {
+		spt.scrubCursor = "" // wrap around
+	} else {
+		spt.scrubCursor = items[len(items)-1].key
+	}
+
+	batch := make([]api.Cid, len(items))
+	for i, it := range items {
+		batch[i] = it.cid
+	}
+	return batch, nil
+}
+
+func (spt *Tracker) sendScrubAlert(ctx context.Context, ci api.Cid) {
+	alrt := api.Alert{
+		Metric: api.Metric{
+			Name:       ScrubAlertName,
+			Peer:       spt.peerID,
+			Value:      ci.String(),
+			Valid:      true,
+			ReceivedAt: time.Now().UnixNano(),
+		},
+		TriggeredAt: time.Now(),
+	}
+	err := spt.rpcClient.CallContext(
+		ctx,
+		"",
+		"PeerMonitor",
+		"SendAlert",
+		alrt,
+		&struct{}{},
+	)
+	if err != nil {
+		logger.Errorf("error sending scrub alert for %s: %s", ci, err)
+	}
+}
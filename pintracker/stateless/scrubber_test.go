@@ -0,0 +1,143 @@
+package stateless
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/test"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+)
+
+type mockPeerMonitor struct {
+	alerts chan api.Alert
+}
+
+func (mock *mockPeerMonitor) SendAlert(ctx context.Context, in api.Alert, out *struct{}) error {
+	mock.alerts <- in
+	return nil
+}
+
+func testScrubbingPinTracker(t *testing.T, pins ...api.Pin) (*Tracker, *mockPeerMonitor) {
+	t.Helper()
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ScrubPinsPerCycle = 2
+	spt := New(cfg, test.PeerID1, test.PeerName1, getStateFunc(t, pins...))
+
+	s := rpc.NewServer(nil, "mock")
+	c := rpc.NewClientWithServer(nil, "mock", s)
+	mon := &mockPeerMonitor{alerts: make(chan api.Alert, 10)}
+	for name, svc := range map[string]interface{}{
+		"IPFSConnector": &mockIPFS{},
+		"Cluster":       &mockCluster{},
+		"PeerMonitor":   mon,
+	} {
+		if err := s.RegisterName(name, svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spt.SetClient(c)
+	return spt, mon
+}
+
+func TestNextScrubBatch(t *testing.T) {
+	ctx := context.Background()
+
+	remotePin := api.PinWithOpts(test.Cid4, api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+	})
+	remotePin.Allocations = []peer.ID{test.PeerID2}
+	metaPin := api.PinWithOpts(test.Cid5, pinOpts)
+	metaPin.Type = api.MetaType
+
+	spt, _ := testScrubbingPinTracker(t,
+		api.PinWithOpts(test.Cid1, pinOpts),
+		api.PinWithOpts(test.Cid2, pinOpts),
+		api.PinWithOpts(test.Cid3, pinOpts),
+		remotePin,
+		metaPin,
+	)
+	defer spt.Shutdown(ctx)
+
+	seen := make(map[api.Cid]int)
+	for i := 0; i < 2; i++ {
+		batch, err := spt.nextScrubBatch(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(batch) != 2-i {
+			t.Fatalf("cycle %d: expected %d items, got %d", i, 2-i, len(batch))
+		}
+		for _, ci := range batch {
+			seen[ci]++
+		}
+	}
+
+	for _, ci := range []api.Cid{test.Cid1, test.Cid2, test.Cid3} {
+		if seen[ci] != 1 {
+			t.Errorf("%s should have been scrubbed once, got %d", ci, seen[ci])
+		}
+	}
+	if len(seen) != 3 {
+		t.Error("remote and meta pins should not be scrubbed")
+	}
+
+	// The last cycle reached the end, so we start over.
+	batch, err := spt.nextScrubBatch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch) != 2 {
+		t.Error("scrubbing should start over after a full pass")
+	}
+}
+
+func TestScrub(t *testing.T) {
+	ctx := context.Background()
+
+	// The VerifyDAG mock reports Cid1 as corrupted.
+	spt, mon := testScrubbingPinTracker(t,
+		api.PinWithOpts(test.Cid1, pinOpts),
+		api.PinWithOpts(test.Cid2, pinOpts),
+	)
+	defer spt.Shutdown(ctx)
+
+	err := spt.scrub(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case alrt := <-mon.alerts:
+		if alrt.Name != ScrubAlertName {
+			t.Error("unexpected alert name")
+		}
+		if alrt.Value != test.Cid1.String() {
+			t.Error("the alert should be for cid1")
+		}
+		if alrt.Peer != test.PeerID1 {
+			t.Error("the alert should come from this peer")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a scrub alert")
+	}
+
+	select {
+	case alrt := <-mon.alerts:
+		t.Errorf("unexpected alert for %s", alrt.Value)
+	default:
+	}
+
+	if st := spt.Status(ctx, test.Cid1); st.Status != api.TrackerStatusCorrupted {
+		t.Error("cid1 should be corrupted")
+	}
+	if st := spt.Status(ctx, test.Cid2); st.Status != api.TrackerStatusPinned {
+		t.Error("cid2 should be pinned")
+	}
+}
@@ -51,10 +51,15 @@ type Tracker struct {
 	rpcClient *rpc.Client
 	rpcReady  chan struct{}
 
+	urgentPinCh   chan *optracker.Operation
 	priorityPinCh chan *optracker.Operation
 	pinCh         chan *optracker.Operation
+	lowPinCh      chan *optracker.Operation
 	unpinCh       chan *optracker.Operation
 
+	// only used by the scrubber goroutine.
+	scrubCursor string
+
 	shutdownMu sync.Mutex
 	shutdown   bool
 	wg         sync.WaitGroup
@@ -73,15 +78,22 @@ func New(cfg *Config, pid peer.ID, peerName string, getState func(ctx context.Co
 		getState:      getState,
 		optracker:     optracker.NewOperationTracker(ctx, pid, peerName),
 		rpcReady:      make(chan struct{}, 1),
+		urgentPinCh:   make(chan *optracker.Operation, cfg.MaxPinQueueSize),
 		priorityPinCh: make(chan *optracker.Operation, cfg.MaxPinQueueSize),
 		pinCh:         make(chan *optracker.Operation, cfg.MaxPinQueueSize),
+		lowPinCh:      make(chan *optracker.Operation, cfg.MaxPinQueueSize),
 		unpinCh:       make(chan *optracker.Operation, cfg.MaxPinQueueSize),
 	}
 
 	for i := 0; i < spt.config.ConcurrentPins; i++ {
-		go spt.opWorker(spt.pin, spt.priorityPinCh, spt.pinCh)
+		go spt.opWorker(spt.pin, spt.urgentPinCh, spt.priorityPinCh, spt.pinCh, spt.lowPinCh)
+	}
+	go spt.opWorker(spt.unpin, nil, spt.unpinCh, nil, nil)
+
+	if cfg.ScrubInterval > 0 {
+		spt.wg.Add(1)
+		go spt.scrubLoop()
 	}
-	go spt.opWorker(spt.unpin, spt.unpinCh, nil)
 
 	return spt
 }
@@ -108,16 +120,41 @@ func (spt *Tracker) getIPFSID(ctx context.Context) api.IPFSID {
 }
 
 // receives a pin Function (pin or unpin) and channels.  Used for both pinning
-// and unpinning.
-func (spt *Tracker) opWorker(pinF func(*optracker.Operation) error, prioCh, normalCh chan *optracker.Operation) {
+// and unpinning. Channels are processed in order: urgent, priority, normal
+// and low. A nil channel is never selected.
+func (spt *Tracker) opWorker(pinF func(*optracker.Operation) error, urgentCh, prioCh, normalCh, lowCh chan *optracker.Operation) {
 
 	var op *optracker.Operation
 
 	for {
-		// Process the priority channel first.
+		// Process the urgent channel first.
+		select {
+		case op = <-urgentCh:
+			goto APPLY_OP
+		case <-spt.ctx.Done():
+			return
+		default:
+		}
+
+		// Then the priority channel.
+		select {
+		case op = <-urgentCh:
+			goto APPLY_OP
+		case op = <-prioCh:
+			goto APPLY_OP
+		case <-spt.ctx.Done():
+			return
+		default:
+		}
+
+		// Then the normal channel.
 		select {
+		case op = <-urgentCh:
+			goto APPLY_OP
 		case op = <-prioCh:
 			goto APPLY_OP
+		case op = <-normalCh:
+			goto APPLY_OP
 		case <-spt.ctx.Done():
 			return
 		default:
@@ -126,10 +163,14 @@ func (spt *Tracker) opWorker(pinF func(*optracker.Operation) error, prioCh, norm
 		// Then process things on the other channels.
 		// Block if there are no things to process.
 		select {
+		case op = <-urgentCh:
+			goto APPLY_OP
 		case op = <-prioCh:
 			goto APPLY_OP
 		case op = <-normalCh:
 			goto APPLY_OP
+		case op = <-lowCh:
+			goto APPLY_OP
 		case <-spt.ctx.Done():
 			return
 		}
@@ -220,13 +261,25 @@ func (spt *Tracker) enqueue(ctx context.Context, c api.Pin, typ optracker.Operat
 
 	switch typ {
 	case optracker.OperationPin:
-		isPriorityPin := time.Now().Before(c.Timestamp.Add(spt.config.PriorityPinMaxAge)) &&
-			op.AttemptCount() <= spt.config.PriorityPinMaxRetries
+		// User-set priorities take precedence over the age of
+		// the pin. Positive ones do not survive too many retries,
+		// while pins with a negative priority always wait for
+		// everything else.
+		withinRetries := op.AttemptCount() <= spt.config.PriorityPinMaxRetries
+		isUrgentPin := c.Priority > 0 && withinRetries
+		isPriorityPin := isUrgentPin || (c.Priority == 0 &&
+			time.Now().Before(c.Timestamp.Add(spt.config.PriorityPinMaxAge)) &&
+			withinRetries)
 		op.SetPriorityPin(isPriorityPin)
 
-		if isPriorityPin {
+		switch {
+		case isUrgentPin:
+			ch = spt.urgentPinCh
+		case isPriorityPin:
 			ch = spt.priorityPinCh
-		} else {
+		case c.Priority < 0:
+			ch = spt.lowPinCh
+		default:
 			ch = spt.pinCh
 		}
 	case optracker.OperationUnpin:
@@ -280,12 +333,25 @@ func (spt *Tracker) Track(ctx context.Context, c api.Pin) error {
 	ctx, span := trace.StartSpan(ctx, "tracker/stateless/Track")
 	defer span.End()
 
-	logger.Debugf("tracking %s", c.Cid)
+	// Records only hold data shared by cluster peers.
+	if c.Type == api.RecordType {
+		return nil
+	}
 
-	// Sharded pins are never pinned. A sharded pin cannot turn into
-	// something else or viceversa like it happens with Remote pins so
-	// we just ignore them.
-	if c.Type == api.MetaType {
+	logger.Debugf("tracking %s", c.Cid)
+	spt.optracker.Publish(api.Event{
+		Type:      api.EventPinsetAdd,
+		Cid:       c.Cid,
+		Name:      c.Name,
+		Peer:      spt.peerID,
+		PeerName:  spt.peerName,
+		Timestamp: time.Now(),
+	})
+
+	// Sharded pins and collections are never pinned. They cannot turn
+	// into something else or viceversa like it happens with Remote pins
+	// so we just ignore them.
+	if c.Type == api.MetaType || c.Type == api.CollectionType {
 		return nil
 	}
 
@@ -312,14 +378,30 @@ func (spt *Tracker) Track(ctx context.Context, c api.Pin) error {
 	return spt.enqueue(ctx, c, optracker.OperationPin)
 }
 
-// Untrack tells the StatelessPinTracker to stop managing a Cid.
-// If the Cid is pinned locally, it will be unpinned.
-func (spt *Tracker) Untrack(ctx context.Context, c api.Cid) error {
+// Untrack tells the StatelessPinTracker to stop managing a pin.
+// If the pin is pinned locally, it will be unpinned. The pin may only
+// carry the Cid, but any other fields (like the Name) are included in the
+// published events.
+func (spt *Tracker) Untrack(ctx context.Context, pin api.Pin) error {
 	ctx, span := trace.StartSpan(ctx, "tracker/stateless/Untrack")
 	defer span.End()
 
-	logger.Debugf("untracking %s", c)
-	return spt.enqueue(ctx, api.PinCid(c), optracker.OperationUnpin)
+	// Records only hold data shared by cluster peers. Removals may
+	// only carry the Cid.
+	if pin.Type == api.RecordType || api.IsRecordCid(pin.Cid) {
+		return nil
+	}
+
+	logger.Debugf("untracking %s", pin.Cid)
+	spt.optracker.Publish(api.Event{
+		Type:      api.EventPinsetRemove,
+		Cid:       pin.Cid,
+		Name:      pin.Name,
+		Peer:      spt.peerID,
+		PeerName:  spt.peerName,
+		Timestamp: time.Now(),
+	})
+	return spt.enqueue(ctx, pin, optracker.OperationUnpin)
 }
 
 // StatusAll returns information for all Cids pinned to the local IPFS node.
@@ -389,6 +471,10 @@ func (spt *Tracker) StatusAll(ctx context.Context, filter api.TrackerStatus, out
 		default:
 		}
 
+		if p.Type == api.RecordType {
+			continue
+		}
+
 		// if there is an operation, issue that and move on
 		info, ok := spt.optracker.GetExists(ctx, p.Cid, ipfsid)
 		if ok && filter.Match(info.Status) {
@@ -407,6 +493,7 @@ func (spt *Tracker) StatusAll(ctx context.Context, filter api.TrackerStatus, out
 			Origins:     p.Origins,
 			Created:     p.Timestamp,
 			Metadata:    p.Metadata,
+			Priority:    p.Priority,
 
 			PinInfoShort: api.PinInfoShort{
 				PeerName:      spt.peerName,
@@ -425,6 +512,8 @@ func (spt *Tracker) StatusAll(ctx context.Context, filter api.TrackerStatus, out
 		switch {
 		case p.Type == api.MetaType:
 			info.Status = api.TrackerStatusSharded
+		case p.Type == api.CollectionType:
+			info.Status = api.TrackerStatusRemote
 		case p.IsRemotePin(spt.peerID):
 			info.Status = api.TrackerStatusRemote
 		case pinnedInIpfs:
@@ -507,6 +596,7 @@ func (spt *Tracker) Status(ctx context.Context, c api.Cid) api.PinInfo {
 	pinInfo.Origins = gpin.Origins
 	pinInfo.Created = gpin.Timestamp
 	pinInfo.Metadata = gpin.Metadata
+	pinInfo.Priority = gpin.Priority
 
 	// check if pin is a meta pin
 	if gpin.Type == api.MetaType {
@@ -514,8 +604,9 @@ func (spt *Tracker) Status(ctx context.Context, c api.Cid) api.PinInfo {
 		return pinInfo
 	}
 
-	// check if pin is a remote pin
-	if gpin.IsRemotePin(spt.peerID) {
+	// check if pin is a remote pin. Collections and records are never
+	// pinned locally.
+	if gpin.Type == api.CollectionType || gpin.Type == api.RecordType || gpin.IsRemotePin(spt.peerID) {
 		pinInfo.Status = api.TrackerStatusRemote
 		return pinInfo
 	}
@@ -595,7 +686,8 @@ func (spt *Tracker) RecoverAll(ctx context.Context, out chan<- api.PinInfo) erro
 }
 
 // Recover will trigger pinning or unpinning for items in
-// PinError or UnpinError states.
+// PinError or UnpinError states. Corrupted items are unpinned,
+// cleared of bad blocks and pinned again.
 func (spt *Tracker) Recover(ctx context.Context, c api.Cid) (api.PinInfo, error) {
 	ctx, span := trace.StartSpan(ctx, "tracker/stateless/Recover")
 	defer span.End()
@@ -611,6 +703,125 @@ func (spt *Tracker) Recover(ctx context.Context, c api.Cid) (api.PinInfo, error)
 	return recPi, err
 }
 
+// Verify checks the integrity of a pinned item by asking IPFS to walk the
+// DAG and rehash all its blocks. Items with missing or corrupt blocks are
+// kept in the tracker with the Corrupted status until they are recovered.
+// Items that are not pinned are not verified and their status is returned
+// as is.
+func (spt *Tracker) Verify(ctx context.Context, c api.Cid) (api.PinInfo, error) {
+	ctx, span := trace.StartSpan(ctx, "tracker/stateless/Verify")
+	defer span.End()
+
+	pi := spt.Status(ctx, c)
+	switch pi.Status {
+	case api.TrackerStatusPinned, api.TrackerStatusCorrupted:
+	default:
+		return pi, nil
+	}
+
+	st, err := spt.getState(ctx)
+	if err != nil {
+		logger.Error(err)
+		return pi, err
+	}
+	pin, err := st.Get(ctx, c)
+	if err != nil { // pin was removed in the meantime
+		logger.Warn(err)
+		return spt.Status(ctx, c), nil
+	}
+
+	// While in progress, the item shows as pinned. A pin or unpin
+	// request arriving meanwhile replaces (cancels) this operation.
+	op := spt.optracker.TrackNewOperation(ctx, pin, optracker.OperationVerify, optracker.PhaseInProgress)
+	if op == nil {
+		return spt.Status(ctx, c), nil // ongoing verification
+	}
+
+	logger.Debugf("verifying %s", c)
+	var res api.IPFSVerification
+	err = spt.rpcClient.CallContext(
+		op.Context(),
+		"",
+		"IPFSConnector",
+		"VerifyDAG",
+		pin,
+		&res,
+	)
+	if op.Canceled() {
+		return spt.Status(ctx, c), nil
+	}
+	if err != nil {
+		// Verification could not be performed. This does not
+		// say anything about the item.
+		spt.optracker.Clean(ctx, op)
+		return spt.Status(ctx, c), err
+	}
+
+	if verr := res.Err(); verr != nil {
+		logger.Warnf("verification of %s failed: %s", c, verr)
+		op.SetError(verr)
+		op.Cancel()
+		return spt.Status(ctx, c), nil
+	}
+
+	op.SetPhase(optracker.PhaseDone)
+	op.Cancel()
+	spt.optracker.Clean(ctx, op)
+	return spt.Status(ctx, c), nil
+}
+
+// repair prepares a corrupted item to be pinned again. Pinning something
+// that is already pinned does nothing, so the item is unpinned and any
+// blocks that do not match their hashes are removed before the pin is
+// re-queued. IPFS then fetches whatever is missing.
+func (spt *Tracker) repair(ctx context.Context, pin api.Pin) error {
+	ctx, span := trace.StartSpan(ctx, "tracker/stateless/repair")
+	defer span.End()
+
+	var res api.IPFSVerification
+	err := spt.rpcClient.CallContext(
+		ctx,
+		"",
+		"IPFSConnector",
+		"VerifyDAG",
+		pin,
+		&res,
+	)
+	if err != nil {
+		return err
+	}
+	if res.Err() == nil {
+		return nil // nothing to repair
+	}
+
+	err = spt.rpcClient.CallContext(
+		ctx,
+		"",
+		"IPFSConnector",
+		"Unpin",
+		pin,
+		&struct{}{},
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, ci := range res.Corrupt {
+		err := spt.rpcClient.CallContext(
+			ctx,
+			"",
+			"IPFSConnector",
+			"BlockRm",
+			ci,
+			&struct{}{},
+		)
+		if err != nil {
+			logger.Errorf("error removing corrupt block %s: %s", ci, err)
+		}
+	}
+	return nil
+}
+
 func (spt *Tracker) recoverWithPinInfo(ctx context.Context, pi api.PinInfo) (api.PinInfo, error) {
 	st, err := spt.getState(ctx)
 	if err != nil {
@@ -629,6 +840,18 @@ func (spt *Tracker) recoverWithPinInfo(ctx context.Context, pi api.PinInfo) (api
 		}
 		logger.Infof("Restarting pin operation for %s", pi.Cid)
 		err = spt.enqueue(ctx, pin, optracker.OperationPin)
+	case api.TrackerStatusCorrupted:
+		pin, err = st.Get(ctx, pi.Cid)
+		if err != nil { // ignore error - in case pin was removed while recovering
+			logger.Warn(err)
+			return spt.Status(ctx, pi.Cid), nil
+		}
+		logger.Infof("Repairing corrupted pin %s", pi.Cid)
+		err = spt.repair(ctx, pin)
+		if err != nil {
+			return spt.Status(ctx, pi.Cid), err
+		}
+		err = spt.enqueue(ctx, pin, optracker.OperationPin)
 	case api.TrackerStatusUnpinError:
 		logger.Infof("Restarting unpin operation for %s", pi.Cid)
 		err = spt.enqueue(ctx, api.PinCid(pi.Cid), optracker.OperationUnpin)
@@ -675,6 +898,38 @@ func (spt *Tracker) PinQueueSize(ctx context.Context) (int64, error) {
 	return spt.optracker.PinQueueSize(), nil
 }
 
+// Events sends an Event on the out channel when items are added to or
+// removed from the pinset, and every time that the status of an item
+// tracked by this peer changes. It blocks until the context is cancelled
+// or the tracker is shutdown, and closes the channel when done.
+func (spt *Tracker) Events(ctx context.Context, out chan<- api.Event) error {
+	ctx, span := trace.StartSpan(ctx, "tracker/stateless/Events")
+	defer span.End()
+	defer close(out)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := spt.optracker.Subscribe(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-spt.ctx.Done():
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				return ctx.Err()
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
 // func (spt *Tracker) getErrorsAll(ctx context.Context) []api.PinInfo {
 // 	return spt.optracker.Filter(ctx, optracker.PhaseError)
 // }
@@ -88,6 +88,21 @@ func (mock *mockIPFS) PinLsCid(ctx context.Context, in api.Pin, out *api.IPFSPin
 	return nil
 }
 
+func (mock *mockIPFS) VerifyDAG(ctx context.Context, in api.Pin, out *api.IPFSVerification) error {
+	*out = api.IPFSVerification{
+		Cid:    in.Cid,
+		Blocks: 2,
+	}
+	if in.Cid == test.Cid1 {
+		out.Corrupt = []api.Cid{test.Cid5}
+	}
+	return nil
+}
+
+func (mock *mockIPFS) BlockRm(ctx context.Context, in api.Cid, out *struct{}) error {
+	return nil
+}
+
 type mockCluster struct{}
 
 func (mock *mockCluster) IPFSID(ctx context.Context, in peer.ID, out *api.IPFSID) error {
@@ -187,10 +202,81 @@ func TestUntrackTrack(t *testing.T) {
 
 	time.Sleep(time.Second / 2)
 
-	err = spt.Untrack(context.Background(), h1)
+	err = spt.Untrack(context.Background(), api.PinCid(h1))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown(ctx)
+
+	out := make(chan api.Event, 100)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- spt.Events(ctx, out)
+	}()
+	time.Sleep(100 * time.Millisecond) // let it subscribe
+
+	pin := api.PinWithOpts(test.Cid1, pinOpts)
+	pin.Name = "events"
+	err := spt.Track(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second / 2)
+	err = spt.Untrack(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Removed records produce no events, even without their type.
+	record, err := api.RecordCid("test", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = spt.Untrack(ctx, api.PinCid(record))
 	if err != nil {
 		t.Fatal(err)
 	}
+	time.Sleep(time.Second / 2)
+	cancel()
+
+	var evTypes []api.EventType
+	for ev := range out {
+		if !ev.Cid.Equals(test.Cid1) || ev.Peer != test.PeerID1 {
+			t.Errorf("unexpected event: %+v", ev)
+		}
+		if ev.Type == api.EventPinsetRemove && ev.Name != pin.Name {
+			t.Errorf("expected the pin name in the removal event: %+v", ev)
+		}
+		evTypes = append(evTypes, ev.Type)
+	}
+	if err := <-errCh; err != context.Canceled {
+		t.Error("expected context.Canceled, got:", err)
+	}
+
+	expected := []api.EventType{
+		api.EventPinsetAdd,
+		api.EventQueued,
+		api.EventPinning,
+		api.EventPinned,
+		api.EventPinsetRemove,
+		api.EventQueued,
+		api.EventUnpinning,
+		api.EventUnpinned,
+	}
+	if len(evTypes) != len(expected) {
+		t.Fatalf("expected events %v, got %v", expected, evTypes)
+	}
+	for i := range expected {
+		if evTypes[i] != expected[i] {
+			t.Fatalf("expected events %v, got %v", expected, evTypes)
+		}
+	}
 }
 
 func TestTrackUntrackWithCancel(t *testing.T) {
@@ -217,7 +303,7 @@ func TestTrackUntrackWithCancel(t *testing.T) {
 
 	if pInfo.Status == api.TrackerStatusPinning {
 		go func() {
-			err = spt.Untrack(ctx, slowPinCid)
+			err = spt.Untrack(ctx, api.PinCid(slowPinCid))
 			if err != nil {
 				t.Error(err)
 				return
@@ -272,7 +358,7 @@ func TestTrackUntrackWithNoCancel(t *testing.T) {
 		t.Fatal("fastPin should be tracked")
 	}
 	if fastPInfo.Status == api.TrackerStatusPinQueued {
-		err = spt.Untrack(ctx, fastPinCid)
+		err = spt.Untrack(ctx, api.PinCid(fastPinCid))
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -309,7 +395,7 @@ func TestUntrackTrackWithCancel(t *testing.T) {
 
 	// Untrack should cancel the ongoing request
 	// and unpin right away
-	err = spt.Untrack(ctx, slowPinCid)
+	err = spt.Untrack(ctx, api.PinCid(slowPinCid))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -367,12 +453,12 @@ func TestUntrackTrackWithNoCancel(t *testing.T) {
 
 	time.Sleep(3 * time.Second)
 
-	err = spt.Untrack(ctx, slowPin.Cid)
+	err = spt.Untrack(ctx, slowPin)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = spt.Untrack(ctx, fastPin.Cid)
+	err = spt.Untrack(ctx, fastPin)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -505,6 +591,63 @@ func TestStatus(t *testing.T) {
 	}
 }
 
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	// - Build a state with Cid1 and Cid2
+	// - The IPFS Mock reports both as pinned
+	// - VerifyDAG reports a corrupt block for Cid1
+	spt := testStatelessPinTracker(t,
+		api.PinWithOpts(test.Cid1, pinOpts),
+		api.PinWithOpts(test.Cid2, pinOpts),
+	)
+	defer spt.Shutdown(ctx)
+
+	pi, err := spt.Verify(ctx, test.Cid2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.Status != api.TrackerStatusPinned {
+		t.Error("cid2 should be pinned after verification")
+	}
+
+	pi, err = spt.Verify(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.Status != api.TrackerStatusCorrupted {
+		t.Error("cid1 should be corrupted after verification")
+	}
+	if pi.Error == "" {
+		t.Error("corrupted status should come with an error")
+	}
+
+	st := spt.Status(ctx, test.Cid1)
+	if st.Status != api.TrackerStatusCorrupted {
+		t.Error("cid1 should remain corrupted")
+	}
+
+	// Not in the state: nothing to verify.
+	pi, err = spt.Verify(ctx, test.Cid3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.Status != api.TrackerStatusUnpinned {
+		t.Error("cid3 should be unpinned")
+	}
+
+	_, err = spt.Recover(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	st = spt.Status(ctx, test.Cid1)
+	if st.Status != api.TrackerStatusPinned {
+		t.Errorf("cid1 should be pinned after recover, got %s", st.Status)
+	}
+}
+
 // Test
 func TestAttemptCountAndPriority(t *testing.T) {
 	ctx := context.Background()
@@ -553,7 +696,7 @@ func TestAttemptCountAndPriority(t *testing.T) {
 		t.Errorf("errPin should have 3 attempts and not be priority: %+v", st)
 	}
 
-	err = spt.Untrack(ctx, pinErrCid)
+	err = spt.Untrack(ctx, api.PinCid(pinErrCid))
 	time.Sleep(200 * time.Millisecond) // let the pin be applied
 	if err != nil {
 		t.Fatal(err)
@@ -563,7 +706,7 @@ func TestAttemptCountAndPriority(t *testing.T) {
 		t.Errorf("errPin should have 1 attempt count to unpin: %+v", st)
 	}
 
-	err = spt.Untrack(ctx, pinErrCid)
+	err = spt.Untrack(ctx, api.PinCid(pinErrCid))
 	time.Sleep(200 * time.Millisecond) // let the pin be applied
 	if err != nil {
 		t.Fatal(err)
@@ -573,3 +716,54 @@ func TestAttemptCountAndPriority(t *testing.T) {
 		t.Errorf("errPin should have 2 attempt counts to unpin: %+v", st)
 	}
 }
+
+func TestUserPriority(t *testing.T) {
+	ctx := context.Background()
+
+	spt := testStatelessPinTracker(t)
+	defer spt.Shutdown(ctx)
+
+	// Keep the only pin worker busy so that the rest stays queued.
+	err := spt.Track(ctx, api.PinWithOpts(test.SlowCid1, pinOpts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	bulkOpts := pinOpts
+	bulkOpts.Priority = -1
+	urgentOpts := pinOpts
+	urgentOpts.Priority = 5
+
+	pins := []api.Pin{
+		api.PinWithOpts(test.Cid4, pinOpts),
+		api.PinWithOpts(test.Cid5, bulkOpts),
+		api.PinWithOpts(test.Cid6, urgentOpts),
+	}
+	for _, p := range pins {
+		p.Timestamp = time.Now()
+		err := spt.Track(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if l := len(spt.urgentPinCh); l != 1 {
+		t.Errorf("expected 1 urgent pin queued, got %d", l)
+	}
+	if l := len(spt.priorityPinCh); l != 1 {
+		t.Errorf("expected 1 priority pin queued, got %d", l)
+	}
+	if l := len(spt.lowPinCh); l != 1 {
+		t.Errorf("expected 1 low priority pin queued, got %d", l)
+	}
+
+	st := spt.Status(ctx, test.Cid6)
+	if !st.PriorityPin || st.Priority != 5 {
+		t.Errorf("urgent pin should be a priority pin: %+v", st)
+	}
+	st = spt.Status(ctx, test.Cid5)
+	if st.PriorityPin {
+		t.Errorf("bulk pin should not be a priority pin: %+v", st)
+	}
+}
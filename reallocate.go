@@ -0,0 +1,252 @@
+package ipfscluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/observations"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/trace"
+)
+
+// reallocateFailedPins hands the allocations of the items that peers have
+// failed to pin for too long over to other peers. Only the first allocation
+// of a pin does it, so that several failing peers do not update the pin at
+// the same time. The failing peers are recorded among the FailedAllocations
+// of the pin so that they are not allocated the item again, until it is
+// pinned by all its allocations. It runs before every automatic recover and
+// does nothing unless PinErrorReallocateAttempts or PinErrorReallocateAge
+// are set.
+//
+// The items in pin_error in this peer are found locally. The other
+// allocations are only asked about up to PinErrorScanPerCycle of the pins
+// that this peer is the first allocation of, continuing after the last
+// pin checked on the previous cycle.
+func (c *Cluster) reallocateFailedPins(ctx context.Context) {
+	attempts := c.config.PinErrorReallocateAttempts
+	age := c.config.PinErrorReallocateAge
+	if c.config.FollowerMode || (attempts == 0 && age == 0) {
+		return
+	}
+
+	ctx, span := trace.StartSpan(ctx, "cluster/reallocateFailedPins")
+	defer span.End()
+
+	pins, statuses, err := c.localPinErrors(ctx)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	shared, err := c.sharedFirstAllocations(ctx)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	if len(shared) > 0 {
+		cids := make([]api.Cid, len(shared))
+		for i, pin := range shared {
+			cids[i] = pin.Cid
+		}
+		gpis, err := c.globalPinInfoCids(ctx, cids)
+		if err != nil {
+			// gpis has whatever could be obtained.
+			logger.Error(err)
+		}
+		for _, pin := range shared {
+			if _, ok := statuses[pin.Cid]; !ok {
+				pins = append(pins, pin)
+			}
+			if gpi, ok := gpis[pin.Cid]; ok {
+				statuses[pin.Cid] = gpi
+			}
+		}
+	}
+
+	for _, pin := range pins {
+		gpi, ok := statuses[pin.Cid]
+		if !ok {
+			continue
+		}
+
+		if len(pin.FailedAllocations) > 0 && pinnedIn(gpi, pin.Allocations) {
+			c.clearFailedAllocations(ctx, pin)
+			continue
+		}
+
+		var failing []peer.ID
+		for pidStr, pinfo := range gpi.PeerMap {
+			pid, err := peer.Decode(pidStr)
+			if err != nil {
+				continue
+			}
+			if c.shouldReallocate(pin, pid, pinfo, attempts, age) {
+				failing = append(failing, pid)
+			}
+		}
+		if len(failing) == 0 {
+			continue
+		}
+
+		err = c.reallocateFailedPin(ctx, pin, failing)
+		if err != nil {
+			logger.Errorf("error re-allocating %s, which is in pin_error in %s: %s", pin.Cid, failing, err)
+			continue
+		}
+		logger.Infof("re-allocated %s after %s failed to pin it", pin.Cid, failing)
+		stats.Record(ctx, observations.PinsReallocated.M(int64(len(failing))))
+	}
+}
+
+// localPinErrors returns the pins in pin_error in this peer that this peer
+// is the first allocation of, along with the status of this peer for them.
+func (c *Cluster) localPinErrors(ctx context.Context) ([]api.Pin, map[api.Cid]api.GlobalPinInfo, error) {
+	out := make(chan api.PinInfo, 1024)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.StatusAllLocal(ctx, api.TrackerStatusPinError, out)
+	}()
+
+	var failed []api.PinInfo
+	for pinfo := range out {
+		failed = append(failed, pinfo)
+	}
+	if err := <-errCh; err != nil {
+		return nil, nil, err
+	}
+
+	var pins []api.Pin
+	statuses := make(map[api.Cid]api.GlobalPinInfo, len(failed))
+	for _, pinfo := range failed {
+		pin, err := c.PinGet(ctx, pinfo.Cid)
+		if err != nil {
+			// unpinned in the meantime.
+			continue
+		}
+		if !c.isFirstAllocation(pin) {
+			continue
+		}
+		gpi := api.GlobalPinInfo{}
+		gpi.Add(pinfo)
+		pins = append(pins, pin)
+		statuses[pin.Cid] = gpi
+	}
+	return pins, statuses, nil
+}
+
+// sharedFirstAllocations returns the pins that this peer is the first
+// allocation of and whose status depends on other peers: those with
+// several allocations or with FailedAllocations to be cleared. At most
+// PinErrorScanPerCycle pins are checked, starting after the last one
+// checked on the previous cycle. Pins are listed in key order, which is
+// stable across cycles.
+func (c *Cluster) sharedFirstAllocations(ctx context.Context) ([]api.Pin, error) {
+	query := api.PinQuery{
+		Type:       api.DataType | api.ShardType,
+		Allocation: c.id,
+		Limit:      c.config.PinErrorScanPerCycle,
+		Cursor:     c.reallocateCursor,
+	}
+
+	out := make(chan api.Pin, 1024)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.PinsQuery(ctx, query, out)
+	}()
+
+	var pins []api.Pin
+	listed := 0
+	for pin := range out {
+		listed++
+		c.reallocateCursor = pin.Cid
+		if !c.isFirstAllocation(pin) {
+			continue
+		}
+		if len(pin.Allocations) > 1 || len(pin.FailedAllocations) > 0 {
+			pins = append(pins, pin)
+		}
+	}
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+
+	// Start over on the next cycle once the end of the pinset is
+	// reached.
+	if listed < query.Limit {
+		c.reallocateCursor = api.CidUndef
+	}
+	return pins, nil
+}
+
+// isFirstAllocation returns true when this peer is the first allocation of
+// a pin which can be re-allocated.
+func (c *Cluster) isFirstAllocation(pin api.Pin) bool {
+	// Meta pins, cluster DAGs and collections are not pinned and
+	// pins allocated everywhere cannot go elsewhere.
+	if pin.Type != api.DataType && pin.Type != api.ShardType {
+		return false
+	}
+	return len(pin.Allocations) > 0 && pin.Allocations[0] == c.id
+}
+
+// shouldReallocate returns true when the allocation of a pin to the given
+// peer has been failing for longer than allowed. The age is counted from
+// the time of the error reported in the PinInfo.
+func (c *Cluster) shouldReallocate(pin api.Pin, pid peer.ID, pinfo api.PinInfoShort, attempts int, age time.Duration) bool {
+	if !containsPeer(pin.Allocations, pid) {
+		return false
+	}
+	if pinfo.Status != api.TrackerStatusPinError {
+		return false
+	}
+
+	switch {
+	case attempts > 0 && pinfo.AttemptCount >= attempts:
+		return true
+	case age > 0 && !pinfo.TS.IsZero() && time.Since(pinfo.TS) >= age:
+		return true
+	default:
+		return false
+	}
+}
+
+// reallocateFailedPin replaces the failing peers among the allocations of
+// the pin and commits the updated pin.
+func (c *Cluster) reallocateFailedPin(ctx context.Context, pin api.Pin, failing []peer.ID) error {
+	ctx, span := trace.StartSpan(ctx, "cluster/reallocateFailedPin")
+	defer span.End()
+
+	for _, pid := range failing {
+		if !containsPeer(pin.FailedAllocations, pid) {
+			pin.FailedAllocations = append(pin.FailedAllocations, pid)
+		}
+	}
+
+	allocs, err := c.replaceAllocations(ctx, pin, failing)
+	if err != nil {
+		return err
+	}
+	pin.Allocations = allocs
+	pin.Timestamp = time.Now()
+	return c.consensus.LogPin(ctx, pin)
+}
+
+// clearFailedAllocations forgets the FailedAllocations of a pin once all
+// its allocations have pinned it, so that the failed peers can be allocated
+// the item again in the future.
+func (c *Cluster) clearFailedAllocations(ctx context.Context, pin api.Pin) {
+	if !c.pinUnchanged(ctx, pin) {
+		return
+	}
+
+	pin.FailedAllocations = nil
+	pin.Timestamp = time.Now()
+	err := c.consensus.LogPin(ctx, pin)
+	if err != nil {
+		logger.Errorf("error clearing the failed allocations of %s: %s", pin.Cid, err)
+	}
+}
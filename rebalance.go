@@ -0,0 +1,455 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/observations"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/trace"
+)
+
+// This file contains the rebalancer. Allocations are normally only
+// recomputed when a pin is re-submitted or when a peer goes down, so peers
+// joining the cluster only receive new pins. When enabled, the rebalancer
+// regularly compares the allocations of existing pins with the peers that
+// the allocator would choose for them now and migrates a bounded number of
+// pins on every run. Only one peer runs it at a time: the consensus leader
+// or, when there is none, the peer with the lowest ID.
+//
+// A migration first adds the new allocations to the pin and waits until
+// they have pinned the item. Only then are the allocations that are no
+// longer wanted removed, so the number of replicas never goes down during
+// the process.
+
+// rebalanceCheckInterval is how often a migration checks whether the new
+// allocations have pinned the item.
+var rebalanceCheckInterval = time.Second
+
+// pinMigration is a pin along with the allocations it should be moved to.
+type pinMigration struct {
+	pin    api.Pin
+	allocs []peer.ID
+}
+
+// RebalanceStatus returns the progress of the rebalancer in this peer.
+func (c *Cluster) RebalanceStatus(ctx context.Context) api.RebalanceStatus {
+	_, span := trace.StartSpan(ctx, "cluster/RebalanceStatus")
+	defer span.End()
+
+	c.rebalanceMux.Lock()
+	defer c.rebalanceMux.Unlock()
+	status := c.rebalanceStatus
+	status.Peer = c.id
+	status.Enabled = c.rebalanceEnabled()
+	return status
+}
+
+func (c *Cluster) rebalanceEnabled() bool {
+	return c.config.RebalanceInterval > 0 && !c.config.FollowerMode
+}
+
+func (c *Cluster) updateRebalanceStatus(f func(status *api.RebalanceStatus)) {
+	c.rebalanceMux.Lock()
+	defer c.rebalanceMux.Unlock()
+	f(&c.rebalanceStatus)
+}
+
+// rebalanceLoop runs the rebalancer every RebalanceInterval until the
+// peer shuts down.
+func (c *Cluster) rebalanceLoop() {
+	interval := c.config.RebalanceInterval
+	c.updateRebalanceStatus(func(status *api.RebalanceStatus) {
+		status.NextRun = time.Now().Add(interval)
+	})
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-timer.C:
+			if c.isRebalancingPeer(c.ctx) {
+				err := c.rebalance(c.ctx)
+				if err != nil {
+					logger.Errorf("rebalancing: %s", err)
+				}
+			} else {
+				logger.Debug("rebalancer: another peer is in charge of rebalancing")
+			}
+			c.updateRebalanceStatus(func(status *api.RebalanceStatus) {
+				status.NextRun = time.Now().Add(interval)
+			})
+			timer.Reset(interval)
+		}
+	}
+}
+
+// isRebalancingPeer returns true when this peer should run the
+// rebalancer: the consensus leader when there is one or, otherwise, the
+// peer with the lowest ID among the consensus peers.
+func (c *Cluster) isRebalancingPeer(ctx context.Context) bool {
+	leader, err := c.consensus.Leader(ctx)
+	if err == nil && leader != "" {
+		return leader == c.id
+	}
+
+	peers, err := c.consensus.Peers(ctx)
+	if err != nil {
+		logger.Errorf("rebalancer: error obtaining the consensus peers: %s", err)
+		return false
+	}
+	if !containsPeer(peers, c.id) {
+		return false
+	}
+	for _, p := range peers {
+		if p < c.id {
+			return false
+		}
+	}
+	return true
+}
+
+// rebalance finds up to RebalancePinsPerCycle misplaced pins and migrates
+// them one after the other. Failed migrations are logged and counted, but
+// do not stop the rest.
+func (c *Cluster) rebalance(ctx context.Context) error {
+	ctx, span := trace.StartSpan(ctx, "cluster/rebalance")
+	defer span.End()
+
+	c.updateRebalanceStatus(func(status *api.RebalanceStatus) {
+		status.Running = true
+		status.LastRun = time.Now()
+		status.Pending = 0
+	})
+	defer c.updateRebalanceStatus(func(status *api.RebalanceStatus) {
+		status.Running = false
+		status.Migrating = api.CidUndef
+	})
+
+	migrations, err := c.misplacedPins(ctx)
+	if err != nil {
+		c.updateRebalanceStatus(func(status *api.RebalanceStatus) {
+			status.LastError = err.Error()
+		})
+		return err
+	}
+
+	stats.Record(ctx, observations.RebalancePending.M(int64(len(migrations))))
+	c.updateRebalanceStatus(func(status *api.RebalanceStatus) {
+		status.Pending = len(migrations)
+	})
+
+	for _, m := range migrations {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		c.updateRebalanceStatus(func(status *api.RebalanceStatus) {
+			status.Migrating = m.pin.Cid
+		})
+
+		err := c.migratePin(ctx, m.pin, m.allocs, c.config.RebalanceMigrationTimeout)
+		if err != nil {
+			logger.Errorf("rebalancer: error migrating %s: %s", m.pin.Cid, err)
+			stats.Record(ctx, observations.RebalanceMigrationErrors.M(1))
+			c.updateRebalanceStatus(func(status *api.RebalanceStatus) {
+				status.Failed++
+				status.LastError = fmt.Sprintf("%s: %s", m.pin.Cid, err)
+			})
+			continue
+		}
+
+		logger.Infof("rebalancer: migrated %s to %s", m.pin.Cid, m.allocs)
+		stats.Record(ctx, observations.RebalanceMigrations.M(1))
+		c.updateRebalanceStatus(func(status *api.RebalanceStatus) {
+			status.Migrated++
+		})
+	}
+	return nil
+}
+
+// misplacedPins returns up to RebalancePinsPerCycle pins that should be
+// moved to other peers. At most RebalanceScanPerCycle pins are checked,
+// starting after the last one checked on the previous run, so that every
+// run does a bounded amount of work and the whole pinset is eventually
+// covered. Pins are listed in key order, which is stable across runs.
+func (c *Cluster) misplacedPins(ctx context.Context) ([]pinMigration, error) {
+	query := api.PinQuery{
+		Type:   api.DataType | api.ShardType,
+		Limit:  c.config.RebalanceScanPerCycle,
+		Cursor: c.rebalanceCursor,
+	}
+
+	out := make(chan api.Pin, 1024)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.PinsQuery(ctx, query, out)
+	}()
+
+	var migrations []pinMigration
+	listed := 0
+	for pin := range out {
+		listed++
+		// Keep reading until the channel is closed, but do not
+		// check more pins once we have enough.
+		if len(migrations) >= c.config.RebalancePinsPerCycle {
+			continue
+		}
+		c.rebalanceCursor = pin.Cid
+
+		allocs, ok := c.idealAllocations(ctx, pin)
+		if ok {
+			migrations = append(migrations, pinMigration{pin: pin, allocs: allocs})
+		}
+	}
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+
+	// Start over on the next run once the end of the pinset is
+	// reached.
+	if listed < query.Limit && len(migrations) < c.config.RebalancePinsPerCycle {
+		c.rebalanceCursor = api.CidUndef
+	}
+	return migrations, nil
+}
+
+// idealAllocations returns the allocations that the pin should be moved
+// to, and whether they differ from the current ones. The allocator is asked
+// for the best candidate given the current allocations. Then it ranks that
+// candidate along with the current allocations, and the worst of those is
+// replaced when the candidate goes before it and its metrics are better by
+// more than the RebalanceThreshold. At most one allocation is replaced on
+// every run, so that metrics can catch up with the migrations.
+func (c *Cluster) idealAllocations(ctx context.Context, pin api.Pin) ([]peer.ID, bool) {
+	// Meta pins, cluster DAGs and collections are not allocated
+	// anywhere and pins allocated everywhere have nowhere to go.
+	if pin.Type != api.DataType && pin.Type != api.ShardType {
+		return nil, false
+	}
+	if pin.IsPinEverywhere() || len(pin.Allocations) == 0 {
+		return nil, false
+	}
+
+	mSet, classified := c.classifyMetrics(ctx, pin, pin.Allocations, nil, pin.UserAllocations)
+
+	// Allocations which are down, being drained or without metrics are
+	// handled by repinning and drains.
+	if len(classified.currentPeers) != len(pin.Allocations) {
+		return nil, false
+	}
+	if len(classified.candidatePeers)+len(classified.priorityPeers) == 0 {
+		return nil, false
+	}
+
+	candidates, err := c.allocator.Allocate(ctx, pin, classified.current, classified.candidate, classified.priority)
+	if err != nil {
+		logger.Debugf("rebalancer: cannot allocate %s: %s", pin.Cid, err)
+		return nil, false
+	}
+	if len(candidates) == 0 {
+		return nil, false
+	}
+	best := candidates[0]
+
+	// The candidate already satisfies the placement constraints along
+	// with the current allocations, so they are left out when ranking.
+	plain := pin
+	plain.AntiAffinity = nil
+	plain.Spread = nil
+	contenders := metricsOf(mSet, append([]peer.ID{best}, pin.Allocations...))
+	ranked, err := c.allocator.Allocate(ctx, plain, nil, contenders, nil)
+	if err != nil {
+		logger.Debugf("rebalancer: cannot rank the allocations of %s: %s", pin.Cid, err)
+		return nil, false
+	}
+
+	// The worst current allocation is the last one in the ranking.
+	bestRank, worstRank := -1, -1
+	for i, p := range ranked {
+		switch {
+		case p == best:
+			bestRank = i
+		case containsPeer(pin.Allocations, p):
+			worstRank = i
+		}
+	}
+	if bestRank < 0 || worstRank < bestRank {
+		return nil, false
+	}
+	worst := ranked[worstRank]
+	if !c.rebalanceGain(mSet, worst, best) {
+		return nil, false
+	}
+
+	allocs := make([]peer.ID, 0, len(pin.Allocations))
+	for _, p := range pin.Allocations {
+		if p == worst {
+			p = best
+		}
+		allocs = append(allocs, p)
+	}
+
+	// Make sure that the replacement does not break the placement
+	// constraints, i.e. by leaving a spread value without replicas.
+	if pin.HasPlacementConstraints() {
+		kept := peersSubtract(pin.Allocations, []peer.ID{worst})
+		others := metricsOf(mSet, append(append([]peer.ID{worst}, classified.candidatePeers...), classified.priorityPeers...))
+		placed, err := pin.ApplyPlacement([]peer.ID{best}, metricsOf(mSet, kept), others, nil)
+		if err != nil || !containsPeer(placed, best) {
+			return nil, false
+		}
+	}
+	return allocs, true
+}
+
+// rebalanceGain returns true when the metrics of the "to" peer are better
+// than those of the "from" peer by more than the RebalanceThreshold. The
+// allocator metrics are compared in order and the first one that differs
+// decides. Values that are not numbers, like tags, always count as a gain,
+// as the allocator already ranked the peers by them.
+func (c *Cluster) rebalanceGain(mSet api.MetricsSet, from, to peer.ID) bool {
+	for _, name := range c.allocator.Metrics() {
+		var fromValue, toValue string
+		for _, m := range mSet[name] {
+			switch m.Peer {
+			case from:
+				fromValue = m.Value
+			case to:
+				toValue = m.Value
+			}
+		}
+		if fromValue == toValue {
+			continue
+		}
+
+		a, errA := strconv.ParseFloat(fromValue, 64)
+		b, errB := strconv.ParseFloat(toValue, 64)
+		if errA != nil || errB != nil {
+			return true
+		}
+		return math.Abs(b-a) > c.config.RebalanceThreshold*math.Max(math.Abs(a), 1)
+	}
+	return false
+}
+
+// metricsOf returns the metrics in the set which belong to the given peers.
+func metricsOf(mSet api.MetricsSet, peers []peer.ID) api.MetricsSet {
+	res := make(api.MetricsSet)
+	for name, metrics := range mSet {
+		for _, m := range metrics {
+			if containsPeer(peers, m.Peer) {
+				res[name] = append(res[name], m)
+			}
+		}
+	}
+	return res
+}
+
+// migratePin moves a pin to the given allocations. The new allocations are
+// added to the pin first and, once they have pinned it, the old ones are
+// removed. When the new allocations do not pin the item before the timeout,
+// the original allocations are restored.
+func (c *Cluster) migratePin(ctx context.Context, pin api.Pin, allocs []peer.ID, timeout time.Duration) error {
+	ctx, span := trace.StartSpan(ctx, "cluster/migratePin")
+	defer span.End()
+
+	added := peersSubtract(allocs, pin.Allocations)
+
+	transitional := pin
+	transitional.Allocations = append(append([]peer.ID{}, pin.Allocations...), added...)
+	if len(added) > 0 {
+		transitional.Timestamp = time.Now()
+		err := c.consensus.LogPin(ctx, transitional)
+		if err != nil {
+			return err
+		}
+
+		err = c.waitForPinned(ctx, pin.Cid, added, timeout)
+		if err != nil {
+			// Put things back as they were unless someone else
+			// modified the pin in the meantime.
+			if c.pinUnchanged(ctx, transitional) {
+				pin.Timestamp = time.Now()
+				if rerr := c.consensus.LogPin(ctx, pin); rerr != nil {
+					logger.Errorf("error restoring the allocations of %s: %s", pin.Cid, rerr)
+				}
+			}
+			return err
+		}
+	}
+
+	if !c.pinUnchanged(ctx, transitional) {
+		return errors.New("the pin was modified during the migration")
+	}
+
+	final := pin
+	final.Allocations = allocs
+	final.Timestamp = time.Now()
+	return c.consensus.LogPin(ctx, final)
+}
+
+// waitForPinned waits until all the given peers report the item as pinned.
+func (c *Cluster) waitForPinned(ctx context.Context, h api.Cid, peers []peer.ID, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(rebalanceCheckInterval)
+	defer ticker.Stop()
+	for {
+		gpi, err := c.Status(ctx, h)
+		if err == nil && pinnedIn(gpi, peers) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the new allocations did not pin the item in time: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// pinUnchanged returns true if the pin in the shared state still has the
+// allocations and options of the given one.
+func (c *Cluster) pinUnchanged(ctx context.Context, pin api.Pin) bool {
+	current, err := c.PinGet(ctx, pin.Cid)
+	if err != nil {
+		return false
+	}
+	return current.Type == pin.Type &&
+		current.PinOptions.Equals(pin.PinOptions) &&
+		samePeers(current.Allocations, pin.Allocations)
+}
+
+// pinnedIn returns true if all the given peers report the item as pinned.
+func pinnedIn(gpi api.GlobalPinInfo, peers []peer.ID) bool {
+	for _, p := range peers {
+		pi, ok := gpi.PeerMap[peer.Encode(p)]
+		if !ok || pi.Status != api.TrackerStatusPinned {
+			return false
+		}
+	}
+	return true
+}
+
+// samePeers returns true if both lists contain the same peers, in any
+// order.
+func samePeers(a, b []peer.ID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	return len(peersSubtract(a, b)) == 0 && len(peersSubtract(b, a)) == 0
+}
@@ -0,0 +1,123 @@
+package ipfscluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/observations"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/trace"
+)
+
+// ReplicationReport compares the number of peers that have pinned every
+// item in the pinset with its replication factors and sends a report on the
+// out channel for each under-replicated, over-replicated or unavailable
+// pin. It blocks until done and closes the out channel. Once the whole
+// pinset has been checked, the number of pins in each state is recorded.
+//
+// Pins allocated everywhere are only reported when unavailable.
+func (c *Cluster) ReplicationReport(ctx context.Context, out chan<- api.ReplicationReport) error {
+	defer close(out)
+
+	_, span := trace.StartSpan(ctx, "cluster/ReplicationReport")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cState, err := c.consensus.State(ctx)
+	if err != nil {
+		return err
+	}
+
+	gpis := make(chan api.GlobalPinInfo, 1024)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.StatusAll(ctx, api.TrackerStatusUndefined, gpis)
+	}()
+
+	counts := make(map[string]int64)
+	for gpi := range gpis {
+		pin, err := cState.Get(ctx, gpi.Cid)
+		if err != nil {
+			// unpinned in the meantime.
+			continue
+		}
+
+		report, ok := replicationReport(pin, gpi)
+		if !ok {
+			continue
+		}
+		counts[report.State]++
+
+		select {
+		case <-ctx.Done():
+			err := fmt.Errorf("replication report aborted: %w", ctx.Err())
+			logger.Error(err)
+			return err
+		case out <- report:
+		}
+	}
+
+	err = <-errCh
+	if err != nil {
+		return err
+	}
+
+	stats.Record(
+		ctx,
+		observations.PinsUnderReplicated.M(counts[api.ReplicationUnder]),
+		observations.PinsOverReplicated.M(counts[api.ReplicationOver]),
+		observations.PinsUnavailable.M(counts[api.ReplicationUnavailable]),
+	)
+	return nil
+}
+
+// replicationReport returns the replication report for a pin and whether
+// its number of healthy copies is outside of its replication factors.
+func replicationReport(pin api.Pin, gpi api.GlobalPinInfo) (api.ReplicationReport, bool) {
+	// Meta pins, cluster DAGs and collections do not have
+	// replication factors.
+	if pin.Type != api.DataType && pin.Type != api.ShardType {
+		return api.ReplicationReport{}, false
+	}
+
+	var healthy []peer.ID
+	for pidStr, pinfo := range gpi.PeerMap {
+		if pinfo.Status != api.TrackerStatusPinned {
+			continue
+		}
+		pid, err := peer.Decode(pidStr)
+		if err != nil {
+			continue
+		}
+		healthy = append(healthy, pid)
+	}
+
+	report := api.ReplicationReport{
+		Cid:                  pin.Cid,
+		Name:                 pin.Name,
+		ReplicationFactorMin: pin.ReplicationFactorMin,
+		ReplicationFactorMax: pin.ReplicationFactorMax,
+		Allocations:          pin.Allocations,
+		Healthy:              healthy,
+	}
+
+	switch {
+	case len(healthy) == 0:
+		report.State = api.ReplicationUnavailable
+	case pin.IsPinEverywhere():
+		return report, false
+	case len(healthy) < pin.ReplicationFactorMin:
+		report.State = api.ReplicationUnder
+	case pin.ReplicationFactorMax > 0 && len(healthy) > pin.ReplicationFactorMax:
+		report.State = api.ReplicationOver
+	default:
+		return report, false
+	}
+	return report, true
+}
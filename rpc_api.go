@@ -3,6 +3,7 @@ package ipfscluster
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/lubanproj/ipfs-cluster/api"
 	"github.com/lubanproj/ipfs-cluster/state"
@@ -176,10 +177,14 @@ func (rpcapi *ClusterRPCAPI) Pin(ctx context.Context, in api.Pin, out *api.Pin)
 	// we do not call the Pin method directly since that method does not
 	// allow to pin other than regular DataType pins. The adder will
 	// however send Meta, Shard and ClusterDAG pins.
+	if err := rpcapi.c.checkPinCallbackURL(in.CallbackURL); err != nil {
+		return err
+	}
 	pin, _, err := rpcapi.c.pin(ctx, in, []peer.ID{})
 	if err != nil {
 		return err
 	}
+	rpcapi.c.watchPinCallback(pin)
 	*out = pin
 	return nil
 }
@@ -214,21 +219,122 @@ func (rpcapi *ClusterRPCAPI) UnpinPath(ctx context.Context, in api.PinPath, out
 	return nil
 }
 
+// Usage runs Cluster.Usage().
+func (rpcapi *ClusterRPCAPI) Usage(ctx context.Context, in string, out *api.Usage) error {
+	usage, err := rpcapi.c.Usage(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = usage
+	return nil
+}
+
 // Pins runs Cluster.Pins().
 func (rpcapi *ClusterRPCAPI) Pins(ctx context.Context, in <-chan struct{}, out chan<- api.Pin) error {
 	return rpcapi.c.Pins(ctx, out)
 }
 
+// PinsQuery runs Cluster.PinsQuery().
+func (rpcapi *ClusterRPCAPI) PinsQuery(ctx context.Context, in <-chan api.PinQuery, out chan<- api.Pin) error {
+	query := <-in
+	return rpcapi.c.PinsQuery(ctx, query, out)
+}
+
 // PinGet runs Cluster.PinGet().
 func (rpcapi *ClusterRPCAPI) PinGet(ctx context.Context, in api.Cid, out *api.Pin) error {
 	pin, err := rpcapi.c.PinGet(ctx, in)
 	if err != nil {
 		return err
 	}
+	// Records are internal to cluster.
+	if pin.Type == api.RecordType {
+		return state.ErrNotFound
+	}
+	*out = pin
+	return nil
+}
+
+// PinParents runs Cluster.PinParents().
+func (rpcapi *ClusterRPCAPI) PinParents(ctx context.Context, in api.Cid, out *[]api.Pin) error {
+	parents, err := rpcapi.c.PinParents(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = parents
+	return nil
+}
+
+// CollectionCreate runs Cluster.CollectionCreate(). The collection name is
+// taken from the Pin name.
+func (rpcapi *ClusterRPCAPI) CollectionCreate(ctx context.Context, in api.Pin, out *api.Pin) error {
+	pin, err := rpcapi.c.CollectionCreate(ctx, in.Name, in.PinOptions)
+	if err != nil {
+		return err
+	}
 	*out = pin
 	return nil
 }
 
+// CollectionAdd runs Cluster.CollectionAdd().
+func (rpcapi *ClusterRPCAPI) CollectionAdd(ctx context.Context, in api.CollectionMembers, out *[]api.Pin) error {
+	pins, err := rpcapi.c.CollectionAdd(ctx, in.Name, in.Cids)
+	if err != nil {
+		return err
+	}
+	*out = pins
+	return nil
+}
+
+// CollectionRemove runs Cluster.CollectionRemove().
+func (rpcapi *ClusterRPCAPI) CollectionRemove(ctx context.Context, in api.CollectionMembers, out *struct{}) error {
+	return rpcapi.c.CollectionRemove(ctx, in.Name, in.Cids)
+}
+
+// CollectionStatus runs Cluster.CollectionStatus().
+func (rpcapi *ClusterRPCAPI) CollectionStatus(ctx context.Context, in string, out *api.GlobalPinInfo) error {
+	gpi, err := rpcapi.c.CollectionStatus(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = gpi
+	return nil
+}
+
+// APIKeyCreate runs Cluster.APIKeyCreate().
+func (rpcapi *ClusterRPCAPI) APIKeyCreate(ctx context.Context, in api.APIKey, out *api.APIKey) error {
+	key, err := rpcapi.c.APIKeyCreate(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = key
+	return nil
+}
+
+// APIKeys runs Cluster.APIKeys().
+func (rpcapi *ClusterRPCAPI) APIKeys(ctx context.Context, in struct{}, out *[]api.APIKey) error {
+	keys, err := rpcapi.c.APIKeys(ctx)
+	if err != nil {
+		return err
+	}
+	*out = keys
+	return nil
+}
+
+// APIKeyRevoke runs Cluster.APIKeyRevoke().
+func (rpcapi *ClusterRPCAPI) APIKeyRevoke(ctx context.Context, in string, out *struct{}) error {
+	return rpcapi.c.APIKeyRevoke(ctx, in)
+}
+
+// APIKeyVerify runs Cluster.APIKeyVerify().
+func (rpcapi *ClusterRPCAPI) APIKeyVerify(ctx context.Context, in string, out *api.APIKey) error {
+	key, err := rpcapi.c.APIKeyVerify(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = key
+	return nil
+}
+
 // Version runs Cluster.Version().
 func (rpcapi *ClusterRPCAPI) Version(ctx context.Context, in struct{}, out *api.Version) error {
 	*out = api.Version{
@@ -339,6 +445,36 @@ func (rpcapi *ClusterRPCAPI) RecoverLocal(ctx context.Context, in api.Cid, out *
 	return nil
 }
 
+// Verify runs Cluster.Verify().
+func (rpcapi *ClusterRPCAPI) Verify(ctx context.Context, in api.Cid, out *api.GlobalPinInfo) error {
+	pinfo, err := rpcapi.c.Verify(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = pinfo
+	return nil
+}
+
+// VerifyLocal runs Cluster.VerifyLocal().
+func (rpcapi *ClusterRPCAPI) VerifyLocal(ctx context.Context, in api.Cid, out *api.PinInfo) error {
+	pinfo, err := rpcapi.c.VerifyLocal(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = pinfo
+	return nil
+}
+
+// AllocationPreview runs Cluster.AllocationPreview().
+func (rpcapi *ClusterRPCAPI) AllocationPreview(ctx context.Context, in api.Pin, out *api.AllocationPreview) error {
+	preview, err := rpcapi.c.AllocationPreview(ctx, in.Cid, in.PinOptions)
+	if err != nil {
+		return err
+	}
+	*out = preview
+	return nil
+}
+
 // BlockAllocate returns allocations for blocks. This is used in the adders.
 // It's different from pin allocations when ReplicationFactor < 0.
 func (rpcapi *ClusterRPCAPI) BlockAllocate(ctx context.Context, in api.Pin, out *[]peer.ID) error {
@@ -374,10 +510,8 @@ func (rpcapi *ClusterRPCAPI) BlockAllocate(ctx context.Context, in api.Pin, out
 
 	allocs, err := rpcapi.c.allocate(
 		ctx,
-		in.Cid,
+		in,
 		existing,
-		in.ReplicationFactorMin,
-		in.ReplicationFactorMax,
 		[]peer.ID{},        // blacklist
 		in.UserAllocations, // prio list
 	)
@@ -427,6 +561,65 @@ func (rpcapi *ClusterRPCAPI) Alerts(ctx context.Context, in struct{}, out *[]api
 	return nil
 }
 
+// PeerDrain runs Cluster.PeerDrain() for the Peer in the given status,
+// removing it afterwards when Remove is set.
+func (rpcapi *ClusterRPCAPI) PeerDrain(ctx context.Context, in api.DrainStatus, out *api.DrainStatus) error {
+	status, err := rpcapi.c.PeerDrain(ctx, in.Peer, in.Remove)
+	*out = status
+	return err
+}
+
+// PeerDrainStatus runs Cluster.PeerDrainStatus().
+func (rpcapi *ClusterRPCAPI) PeerDrainStatus(ctx context.Context, in peer.ID, out *api.DrainStatus) error {
+	status, err := rpcapi.c.PeerDrainStatus(ctx, in)
+	*out = status
+	return err
+}
+
+// PeerDrainCancel runs Cluster.PeerDrainCancel().
+func (rpcapi *ClusterRPCAPI) PeerDrainCancel(ctx context.Context, in peer.ID, out *api.DrainStatus) error {
+	status, err := rpcapi.c.PeerDrainCancel(ctx, in)
+	*out = status
+	return err
+}
+
+// MaintenanceStart runs Cluster.MaintenanceStart().
+func (rpcapi *ClusterRPCAPI) MaintenanceStart(ctx context.Context, in time.Duration, out *api.MaintenanceStatus) error {
+	status, err := rpcapi.c.MaintenanceStart(ctx, in)
+	*out = status
+	return err
+}
+
+// MaintenanceStop runs Cluster.MaintenanceStop().
+func (rpcapi *ClusterRPCAPI) MaintenanceStop(ctx context.Context, in struct{}, out *api.MaintenanceStatus) error {
+	status, err := rpcapi.c.MaintenanceStop(ctx)
+	*out = status
+	return err
+}
+
+// PeerMaintenanceStatus runs Cluster.PeerMaintenanceStatus().
+func (rpcapi *ClusterRPCAPI) PeerMaintenanceStatus(ctx context.Context, in peer.ID, out *api.MaintenanceStatus) error {
+	*out = rpcapi.c.PeerMaintenanceStatus(ctx, in)
+	return nil
+}
+
+// ReplicationReport runs Cluster.ReplicationReport().
+func (rpcapi *ClusterRPCAPI) ReplicationReport(ctx context.Context, in <-chan struct{}, out chan<- api.ReplicationReport) error {
+	return rpcapi.c.ReplicationReport(ctx, out)
+}
+
+// Events runs Cluster.Events().
+func (rpcapi *ClusterRPCAPI) Events(ctx context.Context, in <-chan api.EventFilter, out chan<- api.Event) error {
+	filter := <-in
+	return rpcapi.c.Events(ctx, filter, out)
+}
+
+// RebalanceStatus runs Cluster.RebalanceStatus().
+func (rpcapi *ClusterRPCAPI) RebalanceStatus(ctx context.Context, in struct{}, out *api.RebalanceStatus) error {
+	*out = rpcapi.c.RebalanceStatus(ctx)
+	return nil
+}
+
 // IPFSID returns the current cached IPFS ID for a peer.
 func (rpcapi *ClusterRPCAPI) IPFSID(ctx context.Context, in peer.ID, out *api.IPFSID) error {
 	if in == "" {
@@ -456,7 +649,7 @@ func (rpcapi *PinTrackerRPCAPI) Track(ctx context.Context, in api.Pin, out *stru
 func (rpcapi *PinTrackerRPCAPI) Untrack(ctx context.Context, in api.Pin, out *struct{}) error {
 	ctx, span := trace.StartSpan(ctx, "rpc/tracker/Untrack")
 	defer span.End()
-	return rpcapi.tracker.Untrack(ctx, in.Cid)
+	return rpcapi.tracker.Untrack(ctx, in)
 }
 
 // StatusAll runs PinTracker.StatusAll().
@@ -482,6 +675,23 @@ func (rpcapi *PinTrackerRPCAPI) Status(ctx context.Context, in api.Cid, out *api
 	return nil
 }
 
+// StatusCids runs PinTracker.Status() for every Cid received on the in
+// channel.
+func (rpcapi *PinTrackerRPCAPI) StatusCids(ctx context.Context, in <-chan api.Cid, out chan<- api.PinInfo) error {
+	ctx, span := trace.StartSpan(ctx, "rpc/tracker/StatusCids")
+	defer span.End()
+	defer close(out)
+
+	for ci := range in {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- rpcapi.tracker.Status(ctx, ci):
+		}
+	}
+	return nil
+}
+
 // RecoverAll runs PinTracker.RecoverAll().f
 func (rpcapi *PinTrackerRPCAPI) RecoverAll(ctx context.Context, in <-chan struct{}, out chan<- api.PinInfo) error {
 	ctx, span := trace.StartSpan(ctx, "rpc/tracker/RecoverAll")
@@ -498,6 +708,15 @@ func (rpcapi *PinTrackerRPCAPI) Recover(ctx context.Context, in api.Cid, out *ap
 	return err
 }
 
+// Verify runs PinTracker.Verify().
+func (rpcapi *PinTrackerRPCAPI) Verify(ctx context.Context, in api.Cid, out *api.PinInfo) error {
+	ctx, span := trace.StartSpan(ctx, "rpc/tracker/Verify")
+	defer span.End()
+	pinfo, err := rpcapi.tracker.Verify(ctx, in)
+	*out = pinfo
+	return err
+}
+
 // PinQueueSize runs PinTracker.PinQueueSize().
 func (rpcapi *PinTrackerRPCAPI) PinQueueSize(ctx context.Context, in struct{}, out *int64) error {
 	size, err := rpcapi.tracker.PinQueueSize(ctx)
@@ -592,6 +811,21 @@ func (rpcapi *IPFSConnectorRPCAPI) BlockGet(ctx context.Context, in api.Cid, out
 	return nil
 }
 
+// BlockRm runs IPFSConnector.BlockRm().
+func (rpcapi *IPFSConnectorRPCAPI) BlockRm(ctx context.Context, in api.Cid, out *struct{}) error {
+	return rpcapi.ipfs.BlockRm(ctx, in)
+}
+
+// VerifyDAG runs IPFSConnector.VerifyDAG().
+func (rpcapi *IPFSConnectorRPCAPI) VerifyDAG(ctx context.Context, in api.Pin, out *api.IPFSVerification) error {
+	res, err := rpcapi.ipfs.VerifyDAG(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = res
+	return nil
+}
+
 // Resolve runs IPFSConnector.Resolve().
 func (rpcapi *IPFSConnectorRPCAPI) Resolve(ctx context.Context, in string, out *api.Cid) error {
 	c, err := rpcapi.ipfs.Resolve(ctx, in)
@@ -659,3 +893,8 @@ func (rpcapi *PeerMonitorRPCAPI) MetricNames(ctx context.Context, in struct{}, o
 	*out = rpcapi.mon.MetricNames(ctx)
 	return nil
 }
+
+// SendAlert runs PeerMonitor.SendAlert().
+func (rpcapi *PeerMonitorRPCAPI) SendAlert(ctx context.Context, in api.Alert, out *struct{}) error {
+	return rpcapi.mon.SendAlert(ctx, in)
+}
@@ -7,36 +7,59 @@ package ipfscluster
 // without missing any endpoint.
 var DefaultRPCPolicy = map[string]RPCEndpointType{
 	// Cluster methods
-	"Cluster.Alerts":               RPCClosed,
-	"Cluster.BlockAllocate":        RPCClosed,
-	"Cluster.ConnectGraph":         RPCClosed,
-	"Cluster.ID":                   RPCOpen,
-	"Cluster.IDStream":             RPCOpen,
-	"Cluster.IPFSID":               RPCClosed,
-	"Cluster.Join":                 RPCClosed,
-	"Cluster.PeerAdd":              RPCOpen, // Used by Join()
-	"Cluster.PeerRemove":           RPCTrusted,
-	"Cluster.Peers":                RPCTrusted, // Used by ConnectGraph()
-	"Cluster.PeersWithFilter":      RPCClosed,
-	"Cluster.Pin":                  RPCClosed,
-	"Cluster.PinGet":               RPCClosed,
-	"Cluster.PinPath":              RPCClosed,
-	"Cluster.Pins":                 RPCClosed, // Used in stateless tracker, ipfsproxy, restapi
-	"Cluster.Recover":              RPCClosed,
-	"Cluster.RecoverAll":           RPCClosed,
-	"Cluster.RecoverAllLocal":      RPCTrusted,
-	"Cluster.RecoverLocal":         RPCTrusted,
-	"Cluster.RepoGC":               RPCClosed,
-	"Cluster.RepoGCLocal":          RPCTrusted,
-	"Cluster.SendInformerMetrics":  RPCClosed,
-	"Cluster.SendInformersMetrics": RPCClosed,
-	"Cluster.Status":               RPCClosed,
-	"Cluster.StatusAll":            RPCClosed,
-	"Cluster.StatusAllLocal":       RPCClosed,
-	"Cluster.StatusLocal":          RPCClosed,
-	"Cluster.Unpin":                RPCClosed,
-	"Cluster.UnpinPath":            RPCClosed,
-	"Cluster.Version":              RPCOpen,
+	"Cluster.APIKeyCreate":          RPCClosed,
+	"Cluster.APIKeyRevoke":          RPCClosed,
+	"Cluster.APIKeyVerify":          RPCClosed,
+	"Cluster.APIKeys":               RPCClosed,
+	"Cluster.Alerts":                RPCClosed,
+	"Cluster.AllocationPreview":     RPCClosed,
+	"Cluster.BlockAllocate":         RPCClosed,
+	"Cluster.CollectionAdd":         RPCClosed,
+	"Cluster.CollectionCreate":      RPCClosed,
+	"Cluster.CollectionRemove":      RPCClosed,
+	"Cluster.CollectionStatus":      RPCClosed,
+	"Cluster.ConnectGraph":          RPCClosed,
+	"Cluster.Events":                RPCClosed,
+	"Cluster.ID":                    RPCOpen,
+	"Cluster.IDStream":              RPCOpen,
+	"Cluster.IPFSID":                RPCClosed,
+	"Cluster.Join":                  RPCClosed,
+	"Cluster.MaintenanceStart":      RPCTrusted,
+	"Cluster.MaintenanceStop":       RPCTrusted,
+	"Cluster.PeerAdd":               RPCOpen, // Used by Join()
+	"Cluster.PeerDrain":             RPCClosed,
+	"Cluster.PeerDrainCancel":       RPCTrusted, // Called by PeerDrainCancel() in other peers
+	"Cluster.PeerDrainStatus":       RPCClosed,
+	"Cluster.PeerMaintenanceStatus": RPCClosed,
+	"Cluster.PeerRemove":            RPCTrusted,
+	"Cluster.Peers":                 RPCTrusted, // Used by ConnectGraph()
+	"Cluster.PeersWithFilter":       RPCClosed,
+	"Cluster.Pin":                   RPCClosed,
+	"Cluster.PinGet":                RPCClosed,
+	"Cluster.PinParents":            RPCClosed,
+	"Cluster.PinPath":               RPCClosed,
+	"Cluster.Pins":                  RPCClosed, // Used in stateless tracker, ipfsproxy, restapi
+	"Cluster.PinsQuery":             RPCClosed,
+	"Cluster.RebalanceStatus":       RPCClosed,
+	"Cluster.Recover":               RPCClosed,
+	"Cluster.RecoverAll":            RPCClosed,
+	"Cluster.RecoverAllLocal":       RPCTrusted,
+	"Cluster.RecoverLocal":          RPCTrusted,
+	"Cluster.ReplicationReport":     RPCClosed,
+	"Cluster.RepoGC":                RPCClosed,
+	"Cluster.RepoGCLocal":           RPCTrusted,
+	"Cluster.SendInformerMetrics":   RPCClosed,
+	"Cluster.SendInformersMetrics":  RPCClosed,
+	"Cluster.Status":                RPCClosed,
+	"Cluster.StatusAll":             RPCClosed,
+	"Cluster.StatusAllLocal":        RPCClosed,
+	"Cluster.StatusLocal":           RPCClosed,
+	"Cluster.Unpin":                 RPCClosed,
+	"Cluster.UnpinPath":             RPCClosed,
+	"Cluster.Usage":                 RPCClosed,
+	"Cluster.Verify":                RPCClosed,
+	"Cluster.VerifyLocal":           RPCTrusted,
+	"Cluster.Version":               RPCOpen,
 
 	// PinTracker methods
 	"PinTracker.PinQueueSize": RPCClosed,
@@ -44,11 +67,14 @@ var DefaultRPCPolicy = map[string]RPCEndpointType{
 	"PinTracker.RecoverAll":   RPCClosed,  // Broadcast in RecoverAll unimplemented
 	"PinTracker.Status":       RPCTrusted,
 	"PinTracker.StatusAll":    RPCTrusted,
+	"PinTracker.StatusCids":   RPCTrusted, // Called in broadcast from CollectionStatus()
 	"PinTracker.Track":        RPCClosed,
 	"PinTracker.Untrack":      RPCClosed,
+	"PinTracker.Verify":       RPCTrusted, // Called in broadcast from Verify()
 
 	// IPFSConnector methods
-	"IPFSConnector.BlockGet":    RPCClosed,
+	"IPFSConnector.BlockGet":    RPCTrusted, // Called by CAR export
+	"IPFSConnector.BlockRm":     RPCClosed,
 	"IPFSConnector.BlockStream": RPCTrusted, // Called by adders
 	"IPFSConnector.ConfigKey":   RPCClosed,
 	"IPFSConnector.Pin":         RPCClosed,
@@ -58,6 +84,7 @@ var DefaultRPCPolicy = map[string]RPCEndpointType{
 	"IPFSConnector.Resolve":     RPCClosed,
 	"IPFSConnector.SwarmPeers":  RPCTrusted, // Called in ConnectGraph
 	"IPFSConnector.Unpin":       RPCClosed,
+	"IPFSConnector.VerifyDAG":   RPCClosed,
 
 	// Consensus methods
 	"Consensus.AddPeer":  RPCTrusted, // Called by Raft/redirect to leader
@@ -69,4 +96,5 @@ var DefaultRPCPolicy = map[string]RPCEndpointType{
 	// PeerMonitor methods
 	"PeerMonitor.LatestMetrics": RPCClosed,
 	"PeerMonitor.MetricNames":   RPCClosed,
+	"PeerMonitor.SendAlert":     RPCClosed,
 }
@@ -26,11 +26,15 @@ func rpcTypeStr(t cluster.RPCEndpointType) string {
 var comments = map[string]string{
 	"Cluster.PeerAdd":           "Used by Join()",
 	"Cluster.Peers":             "Used by ConnectGraph()",
+	"Cluster.PeerDrainCancel":   "Called by PeerDrainCancel() in other peers",
 	"Cluster.Pins":              "Used in stateless tracker, ipfsproxy, restapi",
 	"PinTracker.Recover":        "Called in broadcast from Recover()",
 	"PinTracker.RecoverAll":     "Broadcast in RecoverAll unimplemented",
+	"PinTracker.Verify":         "Called in broadcast from Verify()",
 	"Pintracker.Status":         "Called in broadcast from Status()",
 	"Pintracker.StatusAll":      "Called in broadcast from StatusAll()",
+	"PinTracker.StatusCids":     "Called in broadcast from CollectionStatus()",
+	"IPFSConnector.BlockGet":    "Called by CAR export",
 	"IPFSConnector.BlockStream": "Called by adders",
 	"IPFSConnector.RepoStat":    "Called in broadcast from proxy/repo/stat",
 	"IPFSConnector.SwarmPeers":  "Called in ConnectGraph",
@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sync"
 	"sync/atomic"
 
 	"github.com/lubanproj/ipfs-cluster/api"
@@ -31,6 +32,9 @@ var logger = logging.Logger("dsstate")
 // a go-datastore and choosing how api.Pin objects are stored
 // in it. It also provides serialization methods for the whole
 // state which are datastore-independent.
+//
+// Paginated listings rely on the datastore returning query results in key
+// order, as all the datastores used by Cluster do.
 type State struct {
 	dsRead      ds.Read
 	dsWrite     ds.Write
@@ -39,6 +43,18 @@ type State struct {
 	// version     int
 
 	totalPins int64
+
+	// indexMux serializes index updates. The enabled indexes (an Index)
+	// are accessed atomically, so that writes do not lock when there
+	// are none.
+	indexMux     sync.Mutex
+	indexes      uint32
+	idxRead      ds.Read
+	idxWrite     ds.Write
+	idxNamespace ds.Key
+	// idxExternal is set when index entries are updated through
+	// IndexPin and UnindexPin only.
+	idxExternal bool
 }
 
 // DefaultHandle returns the codec handler of choice (Msgpack).
@@ -60,11 +76,14 @@ func New(ctx context.Context, dstore ds.Datastore, namespace string, handle code
 	}
 
 	st := &State{
-		dsRead:      dstore,
-		dsWrite:     dstore,
-		codecHandle: handle,
-		namespace:   ds.NewKey(namespace),
-		totalPins:   0,
+		dsRead:       dstore,
+		dsWrite:      dstore,
+		codecHandle:  handle,
+		namespace:    ds.NewKey(namespace),
+		totalPins:    0,
+		idxRead:      dstore,
+		idxWrite:     dstore,
+		idxNamespace: defaultIndexNamespace(ds.NewKey(namespace)),
 	}
 
 	stats.Record(ctx, observations.Pins.M(0))
@@ -73,10 +92,24 @@ func New(ctx context.Context, dstore ds.Datastore, namespace string, handle code
 }
 
 // Add adds a new Pin or replaces an existing one.
-func (st *State) Add(ctx context.Context, c api.Pin) (err error) {
+func (st *State) Add(ctx context.Context, c api.Pin) error {
 	_, span := trace.StartSpan(ctx, "state/dsstate/Add")
 	defer span.End()
 
+	if st.idxExternal || st.enabledIndexes() == 0 {
+		return st.put(ctx, c)
+	}
+
+	st.indexMux.Lock()
+	defer st.indexMux.Unlock()
+
+	if err := st.put(ctx, c); err != nil {
+		return err
+	}
+	return st.updateIndexEntries(ctx, c.Cid, &c)
+}
+
+func (st *State) put(ctx context.Context, c api.Pin) (err error) {
 	ps, err := st.serializePin(c)
 	if err != nil {
 		return
@@ -100,6 +133,20 @@ func (st *State) Rm(ctx context.Context, c api.Cid) error {
 	_, span := trace.StartSpan(ctx, "state/dsstate/Rm")
 	defer span.End()
 
+	if st.idxExternal || st.enabledIndexes() == 0 {
+		return st.rm(ctx, c)
+	}
+
+	st.indexMux.Lock()
+	defer st.indexMux.Unlock()
+
+	if err := st.rm(ctx, c); err != nil {
+		return err
+	}
+	return st.updateIndexEntries(ctx, c, nil)
+}
+
+func (st *State) rm(ctx context.Context, c api.Cid) error {
 	err := st.dsWrite.Delete(ctx, st.key(c))
 	if err == ds.ErrNotFound {
 		return nil
@@ -148,8 +195,6 @@ func (st *State) Has(ctx context.Context, c api.Cid) (bool, error) {
 // List sends all the pins on the pinset on the given channel.
 // Returns and closes channel when done.
 func (st *State) List(ctx context.Context, out chan<- api.Pin) error {
-	defer close(out)
-
 	_, span := trace.StartSpan(ctx, "state/dsstate/List")
 	defer span.End()
 
@@ -157,10 +202,50 @@ func (st *State) List(ctx context.Context, out chan<- api.Pin) error {
 		Prefix: st.namespace.String(),
 	}
 
-	results, err := st.dsRead.Query(ctx, q)
+	total, err := st.list(ctx, q, out)
 	if err != nil {
 		return err
 	}
+	atomic.StoreInt64(&st.totalPins, total)
+	stats.Record(ctx, observations.Pins.M(total))
+	return nil
+}
+
+// ListFrom sends the pins on the pinset on the given channel, ordered by
+// their datastore key and starting after the given CID. Returns and closes
+// the channel when done.
+//
+// The datastore order is used, as asking for an order makes some
+// datastores buffer and sort the whole pinset.
+func (st *State) ListFrom(ctx context.Context, after api.Cid, out chan<- api.Pin) error {
+	_, span := trace.StartSpan(ctx, "state/dsstate/ListFrom")
+	defer span.End()
+
+	q := query.Query{
+		Prefix: st.namespace.String(),
+	}
+	if after.Defined() {
+		q.Filters = []query.Filter{
+			query.FilterKeyCompare{
+				Op:  query.GreaterThan,
+				Key: st.key(after).String(),
+			},
+		}
+	}
+
+	_, err := st.list(ctx, q, out)
+	return err
+}
+
+// list sends the pins resulting from the given query on the given channel
+// and returns how many there were. It closes the channel when done.
+func (st *State) list(ctx context.Context, q query.Query, out chan<- api.Pin) (int64, error) {
+	defer close(out)
+
+	results, err := st.dsRead.Query(ctx, q)
+	if err != nil {
+		return 0, err
+	}
 	defer results.Close()
 
 	var total int64
@@ -168,15 +253,18 @@ func (st *State) List(ctx context.Context, out chan<- api.Pin) error {
 		// Abort if we shutdown.
 		select {
 		case <-ctx.Done():
-			err = fmt.Errorf("full pinset listing aborted: %w", ctx.Err())
+			err = fmt.Errorf("pinset listing aborted: %w", ctx.Err())
 			logger.Warning(err)
-			return err
+			return total, err
 		default:
 		}
 		if r.Error != nil {
 			err := fmt.Errorf("error in query result: %w", r.Error)
 			logger.Error(err)
-			return err
+			return total, err
+		}
+		if st.isIndexKey(r.Key) {
+			continue
 		}
 		k := ds.NewKey(r.Key)
 		ci, err := st.unkey(k)
@@ -200,9 +288,7 @@ func (st *State) List(ctx context.Context, out chan<- api.Pin) error {
 	if total >= 500000 {
 		logger.Infof("Full pinset listing finished: %d pins", total)
 	}
-	atomic.StoreInt64(&st.totalPins, total)
-	stats.Record(ctx, observations.Pins.M(total))
-	return nil
+	return total, nil
 }
 
 // Migrate migrates an older state version to the current one.
@@ -237,6 +323,10 @@ func (st *State) Marshal(w io.Writer) error {
 			logger.Errorf("error in query result: %s", r.Error)
 			return r.Error
 		}
+		// indexes are rebuilt on Unmarshal
+		if st.isIndexKey(r.Key) {
+			continue
+		}
 
 		k := ds.NewKey(r.Key)
 		// reduce snapshot size by not storing the prefix
@@ -255,7 +345,8 @@ func (st *State) Marshal(w io.Writer) error {
 // Unmarshal reads and parses a previous dump of the state.
 // All the parsed key/values are added to the store. As of now,
 // Unmarshal does not empty the existing store from any values
-// before unmarshaling from the given reader.
+// before unmarshaling from the given reader. Enabled indexes are
+// rebuilt afterwards.
 func (st *State) Unmarshal(r io.Reader) error {
 	dec := codec.NewDecoder(r, st.codecHandle)
 	for {
@@ -273,7 +364,12 @@ func (st *State) Unmarshal(r io.Reader) error {
 		}
 	}
 
-	return nil
+	if st.enabledIndexes() == 0 {
+		return nil
+	}
+	st.indexMux.Lock()
+	defer st.indexMux.Unlock()
+	return st.rebuildIndexes(context.Background())
 }
 
 // used to be on go-ipfs-ds-help
@@ -323,6 +419,10 @@ func (st *State) deserializePin(c api.Cid, buf []byte) (api.Pin, error) {
 type BatchingState struct {
 	*State
 	batch ds.Batch
+
+	// pins modified since the last commit, nil when removed. Protected
+	// by the indexMux.
+	pending map[api.Cid]*api.Pin
 }
 
 // NewBatching returns a new batching statate using the given datastore.
@@ -343,23 +443,86 @@ func NewBatching(ctx context.Context, dstore ds.Batching, namespace string, hand
 	}
 
 	st := &State{
-		dsRead:      dstore,
-		dsWrite:     batch,
-		codecHandle: handle,
-		namespace:   ds.NewKey(namespace),
+		dsRead:       dstore,
+		dsWrite:      batch,
+		codecHandle:  handle,
+		namespace:    ds.NewKey(namespace),
+		idxRead:      dstore,
+		idxWrite:     batch,
+		idxNamespace: defaultIndexNamespace(ds.NewKey(namespace)),
 	}
 
 	bst := &BatchingState{}
 	bst.State = st
 	bst.batch = batch
+	bst.pending = make(map[api.Cid]*api.Pin)
 
 	stats.Record(ctx, observations.Pins.M(0))
 	return bst, nil
 }
 
-// Commit persists the batched write operations.
+// Add adds a new Pin or replaces an existing one. The secondary indexes
+// are updated on Commit.
+func (bst *BatchingState) Add(ctx context.Context, c api.Pin) error {
+	_, span := trace.StartSpan(ctx, "state/dsstate/Add")
+	defer span.End()
+
+	if bst.idxExternal || bst.enabledIndexes() == 0 {
+		return bst.put(ctx, c)
+	}
+
+	bst.indexMux.Lock()
+	defer bst.indexMux.Unlock()
+
+	err := bst.put(ctx, c)
+	if err == nil {
+		bst.pending[c.Cid] = &c
+	}
+	return err
+}
+
+// Rm removes an existing Pin. It is a no-op when the item does not exist.
+// The secondary indexes are updated on Commit.
+func (bst *BatchingState) Rm(ctx context.Context, c api.Cid) error {
+	_, span := trace.StartSpan(ctx, "state/dsstate/Rm")
+	defer span.End()
+
+	if bst.idxExternal || bst.enabledIndexes() == 0 {
+		return bst.rm(ctx, c)
+	}
+
+	bst.indexMux.Lock()
+	defer bst.indexMux.Unlock()
+
+	err := bst.rm(ctx, c)
+	if err == nil {
+		bst.pending[c] = nil
+	}
+	return err
+}
+
+// Commit persists the batched write operations, along with the index
+// updates for the pins modified in the batch.
 func (bst *BatchingState) Commit(ctx context.Context) error {
 	_, span := trace.StartSpan(ctx, "state/dsstate/Commit")
 	defer span.End()
-	return bst.batch.Commit(ctx)
+
+	bst.indexMux.Lock()
+	defer bst.indexMux.Unlock()
+
+	// The index entries are committed in the same batch. The previous
+	// entries of every pin are read from the datastore, which is
+	// fine as pending holds a single version of each pin.
+	for ci, p := range bst.pending {
+		if err := bst.updateIndexEntries(ctx, ci, p); err != nil {
+			return err
+		}
+	}
+
+	err := bst.batch.Commit(ctx)
+	if err != nil {
+		return err
+	}
+	bst.pending = make(map[api.Cid]*api.Pin)
+	return nil
 }
@@ -125,6 +125,64 @@ func TestList(t *testing.T) {
 
 }
 
+func TestListFrom(t *testing.T) {
+	ctx := context.Background()
+	st := newState(t)
+
+	cids := []string{
+		"QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq",
+		"QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmma",
+		"QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmb",
+		"QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmc",
+	}
+	for _, cStr := range cids {
+		ci, err := api.DecodeCid(cStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = st.Add(ctx, api.PinCid(ci))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(after api.Cid) []api.Cid {
+		out := make(chan api.Pin, len(cids))
+		err := st.ListFrom(ctx, after, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res []api.Cid
+		for p := range out {
+			res = append(res, p.Cid)
+		}
+		return res
+	}
+
+	all := list(api.CidUndef)
+	if len(all) != len(cids) {
+		t.Fatalf("expected %d pins, got %d", len(cids), len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if st.key(all[i-1]).String() >= st.key(all[i]).String() {
+			t.Error("pins should be sorted by key")
+		}
+	}
+
+	// Listing after each item returns the rest, in the same order.
+	for i, ci := range all {
+		rest := list(ci)
+		if len(rest) != len(all)-i-1 {
+			t.Fatalf("expected %d pins after %s, got %d", len(all)-i-1, ci, len(rest))
+		}
+		for j := range rest {
+			if !rest[j].Equals(all[i+j+1]) {
+				t.Error("unexpected order when listing from a cursor")
+			}
+		}
+	}
+}
+
 func TestMarshalUnmarshal(t *testing.T) {
 	ctx := context.Background()
 	st := newState(t)
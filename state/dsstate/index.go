@@ -0,0 +1,794 @@
+package dsstate
+
+import (
+	"container/heap"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/state"
+
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	codec "github.com/ugorji/go/codec"
+	trace "go.opencensus.io/trace"
+)
+
+// Index selects the secondary indexes maintained by a State. Indexes are
+// stored in a namespace next to that of the pinset (or in the datastore
+// given to SetIndexDatastore) and make queries by name, metadata, expiry,
+// allocation or parent avoid a full scan of the pinset.
+type Index uint8
+
+// Available secondary indexes.
+const (
+	// IndexName indexes pins by name. It is used by queries whose name
+	// regular expression is anchored and starts with a literal prefix.
+	IndexName Index = 1 << iota
+	// IndexMetadata indexes pins by metadata key and value.
+	IndexMetadata
+	// IndexExpiry indexes pins by expiration time.
+	IndexExpiry
+	// IndexAllocations indexes pins by allocated peer.
+	IndexAllocations
+	// IndexParents indexes pins by parent, like collection members.
+	IndexParents
+
+	// AllIndexes enables all the secondary indexes.
+	AllIndexes = IndexName | IndexMetadata | IndexExpiry | IndexAllocations | IndexParents
+)
+
+const (
+	// indexNamespaceSuffix is appended to the pinset namespace to obtain
+	// the default index namespace.
+	indexNamespaceSuffix = "_idx"
+	// indexesKey stores which indexes have been built.
+	indexesKey = "indexes"
+	// pinEntries stores, for every indexed pin, the list of its index
+	// entries, so that they can be removed without reading the
+	// previous version of the pin.
+	pinEntries = "pins"
+
+	nameIndex       = "name"
+	metaIndex       = "meta"
+	expireIndex     = "expire"
+	allocIndex      = "alloc"
+	everywhereIndex = "everywhere"
+	parentIndex     = "parent"
+)
+
+// SetIndexDatastore makes the state keep its secondary indexes in the given
+// datastore, under the given namespace. This is needed when the state
+// datastore is replicated (like a CRDT one), as indexes are local to every
+// peer. Index entries are then only updated by IndexPin and UnindexPin,
+// which must be called for every change to the pinset, including the ones
+// made through this State. It must be called before EnableIndexes.
+func (st *State) SetIndexDatastore(store ds.Datastore, namespace string) {
+	st.indexMux.Lock()
+	defer st.indexMux.Unlock()
+
+	st.idxRead = store
+	st.idxWrite = store
+	st.idxNamespace = ds.NewKey(namespace)
+	st.idxExternal = true
+}
+
+// EnableIndexes makes the state maintain the given secondary indexes from
+// now on. If they do not match the indexes that were built in the
+// datastore, they are rebuilt from the current pinset. Passing 0 removes
+// all indexes. In BatchingStates, rebuilt indexes are written on Commit.
+//
+// It should be called before the state is modified, as changes made
+// concurrently may not be indexed.
+func (st *State) EnableIndexes(ctx context.Context, idx Index) error {
+	_, span := trace.StartSpan(ctx, "state/dsstate/EnableIndexes")
+	defer span.End()
+
+	st.indexMux.Lock()
+	defer st.indexMux.Unlock()
+
+	v, err := st.idxRead.Get(ctx, st.indexKey(indexesKey))
+	switch {
+	case err == ds.ErrNotFound:
+	case err != nil:
+		return err
+	default:
+		built, err := strconv.ParseUint(string(v), 10, 8)
+		if err == nil && Index(built) == idx {
+			st.setIndexes(idx)
+			return nil
+		}
+	}
+
+	st.setIndexes(idx)
+	return st.rebuildIndexes(ctx)
+}
+
+// enabledIndexes returns the indexes maintained by the state. It can be
+// called without holding the indexMux.
+func (st *State) enabledIndexes() Index {
+	return Index(atomic.LoadUint32(&st.indexes))
+}
+
+func (st *State) setIndexes(idx Index) {
+	atomic.StoreUint32(&st.indexes, uint32(idx))
+}
+
+// IndexPin updates the index entries of the given pin. It only needs to be
+// called when the indexes are kept in a separate datastore (see
+// SetIndexDatastore).
+func (st *State) IndexPin(ctx context.Context, p api.Pin) error {
+	if st.enabledIndexes() == 0 {
+		return nil
+	}
+	st.indexMux.Lock()
+	defer st.indexMux.Unlock()
+	return st.updateIndexEntries(ctx, p.Cid, &p)
+}
+
+// UnindexPin removes the index entries of the given pin. It only needs to
+// be called when the indexes are kept in a separate datastore (see
+// SetIndexDatastore).
+func (st *State) UnindexPin(ctx context.Context, ci api.Cid) error {
+	if st.enabledIndexes() == 0 {
+		return nil
+	}
+	st.indexMux.Lock()
+	defer st.indexMux.Unlock()
+	return st.updateIndexEntries(ctx, ci, nil)
+}
+
+// IndexedName returns the name with which the pin for the given CID was
+// indexed, even when the pin has already been removed from the state. It
+// returns an empty string when the pin was not indexed by name.
+func (st *State) IndexedName(ctx context.Context, ci api.Cid) (string, error) {
+	if st.enabledIndexes()&IndexName == 0 {
+		return "", nil
+	}
+	st.indexMux.Lock()
+	defer st.indexMux.Unlock()
+
+	v, err := st.idxRead.Get(ctx, st.indexKey(pinEntries).Child(cidToDsKey(ci)))
+	if err == ds.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var keys []string
+	if err := codec.NewDecoderBytes(v, st.codecHandle).Decode(&keys); err != nil {
+		return "", err
+	}
+
+	prefix := st.indexKey(nameIndex).String() + "/_"
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		component := strings.SplitN(strings.TrimPrefix(k, prefix), "/", 2)[0]
+		name, err := hex.DecodeString(component)
+		if err != nil {
+			return "", err
+		}
+		return string(name), nil
+	}
+	return "", nil
+}
+
+// rebuildIndexes removes all the index entries and creates them again for
+// every pin in the state. It must be called with the indexMux held.
+func (st *State) rebuildIndexes(ctx context.Context) error {
+	logger.Info("rebuilding the pinset secondary indexes")
+
+	results, err := st.idxRead.Query(ctx, query.Query{
+		Prefix:   st.idxNamespace.String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	var oldKeys []ds.Key
+	for r := range results.Next() {
+		if r.Error != nil {
+			results.Close()
+			return r.Error
+		}
+		oldKeys = append(oldKeys, ds.NewKey(r.Key))
+	}
+	results.Close()
+
+	err = st.deleteIndexEntries(ctx, oldKeys)
+	if err != nil {
+		return err
+	}
+
+	if st.enabledIndexes() == 0 {
+		return nil
+	}
+
+	pins := make(chan api.Pin, 1024)
+	listErr := make(chan error, 1)
+	go func() {
+		_, err := st.list(ctx, query.Query{Prefix: st.namespace.String()}, pins)
+		listErr <- err
+	}()
+
+	for p := range pins {
+		if err != nil {
+			continue // drain
+		}
+		err = st.updateIndexEntries(ctx, p.Cid, &p)
+	}
+	if lErr := <-listErr; lErr != nil {
+		return lErr
+	}
+	if err != nil {
+		return err
+	}
+
+	idx := strconv.FormatUint(uint64(st.enabledIndexes()), 10)
+	return st.idxWrite.Put(ctx, st.indexKey(indexesKey), []byte(idx))
+}
+
+// updateIndexEntries replaces the index entries of the given CID with
+// those of the given pin, or removes them when it is nil. It must be
+// called with the indexMux held.
+func (st *State) updateIndexEntries(ctx context.Context, ci api.Cid, p *api.Pin) error {
+	pinKey := st.indexKey(pinEntries).Child(cidToDsKey(ci))
+
+	oldEntries := make(map[string]struct{})
+	v, err := st.idxRead.Get(ctx, pinKey)
+	switch {
+	case err == ds.ErrNotFound:
+	case err != nil:
+		return err
+	default:
+		var keys []string
+		if err := codec.NewDecoderBytes(v, st.codecHandle).Decode(&keys); err != nil {
+			logger.Warnf("bad index entries for %s (ignoring): %s", ci, err)
+		}
+		for _, k := range keys {
+			oldEntries[k] = struct{}{}
+		}
+	}
+
+	newEntries := st.indexEntries(p)
+	var add, rm []ds.Key
+	for k := range newEntries {
+		if _, ok := oldEntries[k]; !ok {
+			add = append(add, ds.RawKey(k))
+		}
+	}
+	for k := range oldEntries {
+		if _, ok := newEntries[k]; !ok {
+			rm = append(rm, ds.RawKey(k))
+		}
+	}
+
+	if err := st.putIndexEntries(ctx, add); err != nil {
+		return err
+	}
+	if err := st.deleteIndexEntries(ctx, rm); err != nil {
+		return err
+	}
+
+	if len(newEntries) == 0 {
+		return st.deleteIndexEntries(ctx, []ds.Key{pinKey})
+	}
+	keys := make([]string, 0, len(newEntries))
+	for k := range newEntries {
+		keys = append(keys, k)
+	}
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, st.codecHandle).Encode(keys); err != nil {
+		return err
+	}
+	return st.idxWrite.Put(ctx, pinKey, buf)
+}
+
+func (st *State) putIndexEntries(ctx context.Context, keys []ds.Key) error {
+	for _, k := range keys {
+		if err := st.idxWrite.Put(ctx, k, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *State) deleteIndexEntries(ctx context.Context, keys []ds.Key) error {
+	for _, k := range keys {
+		err := st.idxWrite.Delete(ctx, k)
+		if err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexEntries returns the keys of the index entries that correspond to
+// the given pin. All of them end with the pin key, so that the CID can be
+// obtained from them.
+func (st *State) indexEntries(p *api.Pin) map[string]struct{} {
+	entries := make(map[string]struct{})
+	indexes := st.enabledIndexes()
+	if p == nil || indexes == 0 {
+		return entries
+	}
+
+	pinKey := cidToDsKey(p.Cid)
+	add := func(k ds.Key) {
+		entries[k.Child(pinKey).String()] = struct{}{}
+	}
+
+	if indexes&IndexName > 0 && p.Name != "" {
+		add(st.indexKey(nameIndex, indexComponent(p.Name)))
+	}
+	if indexes&IndexMetadata > 0 {
+		for k, v := range p.Metadata {
+			if k == "" {
+				continue
+			}
+			add(st.indexKey(metaIndex, indexComponent(k), indexComponent(v)))
+		}
+	}
+	if indexes&IndexExpiry > 0 && !p.ExpireAt.IsZero() && !p.ExpireAt.Equal(time.Unix(0, 0)) {
+		add(st.indexKey(expireIndex, expiryComponent(p.ExpireAt.Unix())))
+	}
+	if indexes&IndexAllocations > 0 {
+		if p.IsPinEverywhere() {
+			add(st.indexKey(everywhereIndex))
+		}
+		for _, pid := range p.Allocations {
+			add(st.indexKey(allocIndex, pid.String()))
+		}
+	}
+	if indexes&IndexParents > 0 {
+		for _, parent := range p.Parents {
+			add(st.indexKey(parentIndex, parent.String()))
+		}
+	}
+	return entries
+}
+
+// indexComponent encodes a string so that it can be used as a key
+// component. The encoding preserves prefixes and ordering, and never
+// produces an empty component.
+func indexComponent(s string) string {
+	return "_" + hex.EncodeToString([]byte(s))
+}
+
+// expiryComponent encodes a timestamp so that lexicographical order
+// matches chronological order. Seconds are used, as that is the precision
+// with which expiration times are stored.
+func expiryComponent(unix int64) string {
+	if unix < 0 {
+		unix = 0
+	}
+	return fmt.Sprintf("%020d", unix)
+}
+
+// defaultIndexNamespace returns the namespace next to the given pinset
+// namespace where indexes are stored by default.
+func defaultIndexNamespace(namespace ds.Key) ds.Key {
+	return ds.NewKey(namespace.String() + indexNamespaceSuffix)
+}
+
+func (st *State) indexKey(components ...string) ds.Key {
+	return st.idxNamespace.Child(ds.KeyWithNamespaces(components))
+}
+
+// isIndexKey returns whether a key returned when listing the pinset
+// belongs to the indexes, which happens when they are stored in the same
+// datastore as a pinset using the root namespace.
+func (st *State) isIndexKey(k string) bool {
+	return !st.idxExternal && strings.HasPrefix(k, st.idxNamespace.String()+"/")
+}
+
+// Query sends the pins selected by the given query on the given channel,
+// in the order of their keys (or the one given by query.Sort) and starting
+// after the query Cursor. It sends no more than query.Limit pins when it is
+// set. When the state maintains a secondary index that serves the query,
+// only the pins found in it are considered. Returns and closes the channel
+// when done.
+func (st *State) Query(ctx context.Context, q api.PinQuery, out chan<- api.Pin) error {
+	_, span := trace.StartSpan(ctx, "state/dsstate/Query")
+	defer span.End()
+
+	match, err := q.Matcher()
+	if err != nil {
+		close(out)
+		return err
+	}
+
+	cmp, err := q.SortCompare()
+	if err != nil {
+		close(out)
+		return err
+	}
+	if cmp != nil {
+		return st.querySorted(ctx, q, cmp, out)
+	}
+
+	if prefixes := st.indexPrefixes(q); len(prefixes) > 0 {
+		return st.queryIndexPrefixes(ctx, prefixes, q, match, out)
+	}
+	if idxQuery, ok := st.indexRangeQuery(q); ok {
+		return st.queryIndexRange(ctx, idxQuery, q, match, out)
+	}
+	return st.queryScan(ctx, q, match, out)
+}
+
+// indexPrefixes returns the prefixes of the index entries of the pins which
+// may be selected by q, when the state has an index that serves it with
+// exact keys. The entries under every prefix are in pin key order.
+func (st *State) indexPrefixes(q api.PinQuery) []ds.Key {
+	indexes := st.enabledIndexes()
+
+	if indexes&IndexParents > 0 && q.Parent.Defined() {
+		return []ds.Key{st.indexKey(parentIndex, q.Parent.String())}
+	}
+
+	if indexes&IndexMetadata > 0 && len(q.Metadata) > 0 {
+		keys := make([]string, 0, len(q.Metadata))
+		for k := range q.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		k := keys[0]
+		return []ds.Key{st.indexKey(metaIndex, indexComponent(k), indexComponent(q.Metadata[k]))}
+	}
+
+	if indexes&IndexAllocations > 0 && q.Allocation != "" {
+		// Pins allocated everywhere match any peer.
+		return []ds.Key{
+			st.indexKey(allocIndex, q.Allocation.String()),
+			st.indexKey(everywhereIndex),
+		}
+	}
+	return nil
+}
+
+// indexRangeQuery returns a datastore query over the index entries of the
+// pins which may be selected by q, when the state has an index that serves
+// it with a range of keys (names with a prefix, expiry dates).
+func (st *State) indexRangeQuery(q api.PinQuery) (query.Query, bool) {
+	indexes := st.enabledIndexes()
+
+	if indexes&IndexName > 0 && strings.HasPrefix(q.NameRegexp, "^") {
+		re, err := regexp.Compile(q.NameRegexp)
+		if err == nil {
+			if prefix, _ := re.LiteralPrefix(); prefix != "" {
+				return query.Query{
+					Prefix: st.indexKey(nameIndex).String(),
+					Filters: []query.Filter{
+						query.FilterKeyPrefix{
+							Prefix: st.indexKey(nameIndex, indexComponent(prefix)).String(),
+						},
+					},
+					KeysOnly: true,
+				}, true
+			}
+		}
+	}
+
+	if indexes&IndexExpiry > 0 && !q.ExpireBefore.IsZero() {
+		before := q.ExpireBefore.Unix()
+		if q.ExpireBefore.Nanosecond() > 0 {
+			before++
+		}
+		return query.Query{
+			Prefix: st.indexKey(expireIndex).String(),
+			Filters: []query.Filter{
+				query.FilterKeyCompare{
+					Op:  query.LessThan,
+					Key: st.indexKey(expireIndex, expiryComponent(before)).String(),
+				},
+			},
+			KeysOnly: true,
+		}, true
+	}
+
+	return query.Query{}, false
+}
+
+// queryIndexPrefixes streams the pins with index entries under the given
+// prefixes, merging them in key order, and sends the matching ones on the
+// out channel.
+func (st *State) queryIndexPrefixes(ctx context.Context, prefixes []ds.Key, q api.PinQuery, match func(api.Pin) bool, out chan<- api.Pin) error {
+	defer close(out)
+
+	var cursor ds.Key
+	if q.Cursor.Defined() {
+		cursor = cidToDsKey(q.Cursor)
+	}
+
+	heads := make([]*indexResults, 0, len(prefixes))
+	defer func() {
+		for _, h := range heads {
+			h.results.Close()
+		}
+	}()
+	for _, prefix := range prefixes {
+		idxQuery := query.Query{
+			Prefix:   prefix.String(),
+			KeysOnly: true,
+		}
+		if q.Cursor.Defined() {
+			idxQuery.Filters = []query.Filter{
+				query.FilterKeyCompare{
+					Op:  query.GreaterThan,
+					Key: prefix.Child(cursor).String(),
+				},
+			}
+		}
+		results, err := st.idxRead.Query(ctx, idxQuery)
+		if err != nil {
+			return err
+		}
+		h := &indexResults{results: results}
+		heads = append(heads, h)
+		if err := h.advance(); err != nil {
+			return err
+		}
+	}
+
+	sent := 0
+	for q.Limit <= 0 || sent < q.Limit {
+		// Pick the lowest pin key among all the results and advance
+		// all the results on it.
+		var next string
+		for _, h := range heads {
+			if !h.done && (next == "" || h.pinKey < next) {
+				next = h.pinKey
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		for _, h := range heads {
+			if !h.done && h.pinKey == next {
+				if err := h.advance(); err != nil {
+					return err
+				}
+			}
+		}
+
+		ok, err := st.sendIndexedPin(ctx, next, match, out)
+		if err != nil {
+			return err
+		}
+		if ok {
+			sent++
+		}
+	}
+	return nil
+}
+
+// indexResults iterates the pin keys of the results of an index query.
+type indexResults struct {
+	results query.Results
+	pinKey  string
+	done    bool
+}
+
+func (ir *indexResults) advance() error {
+	r, ok := ir.results.NextSync()
+	if !ok {
+		ir.done = true
+		return nil
+	}
+	if r.Error != nil {
+		return fmt.Errorf("error in index query result: %w", r.Error)
+	}
+	ir.pinKey = ds.NewKey(r.Key).BaseNamespace()
+	return nil
+}
+
+// queryIndexRange runs the given index query and sends the matching pins,
+// in key order, on the out channel. Entries in a range are not sorted by
+// pin key, so the keys of all the pins in the range are read before
+// sending them.
+func (st *State) queryIndexRange(ctx context.Context, idxQuery query.Query, q api.PinQuery, match func(api.Pin) bool, out chan<- api.Pin) error {
+	defer close(out)
+
+	results, err := st.idxRead.Query(ctx, idxQuery)
+	if err != nil {
+		return err
+	}
+
+	var cursor string
+	if q.Cursor.Defined() {
+		cursor = cidToDsKey(q.Cursor).BaseNamespace()
+	}
+
+	pinKeys := make(map[string]struct{})
+	for r := range results.Next() {
+		if r.Error != nil {
+			results.Close()
+			return fmt.Errorf("error in index query result: %w", r.Error)
+		}
+		if k := ds.NewKey(r.Key).BaseNamespace(); k > cursor {
+			pinKeys[k] = struct{}{}
+		}
+	}
+	results.Close()
+
+	keys := make([]string, 0, len(pinKeys))
+	for k := range pinKeys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	sent := 0
+	for _, k := range keys {
+		if q.Limit > 0 && sent >= q.Limit {
+			break
+		}
+		ok, err := st.sendIndexedPin(ctx, k, match, out)
+		if err != nil {
+			return err
+		}
+		if ok {
+			sent++
+		}
+	}
+	return nil
+}
+
+// sendIndexedPin reads the pin with the given key and sends it on the out
+// channel if it matches. Index entries may be stale, so the pin may be gone
+// or not match anymore.
+func (st *State) sendIndexedPin(ctx context.Context, pinKey string, match func(api.Pin) bool, out chan<- api.Pin) (bool, error) {
+	ci, err := dsKeyToCid(ds.NewKey(pinKey))
+	if err != nil {
+		logger.Warn("bad index entry (ignoring). key: ", pinKey, "error: ", err)
+		return false, nil
+	}
+	p, err := st.Get(ctx, ci)
+	if errors.Is(err, state.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !match(p) {
+		return false, nil
+	}
+	select {
+	case <-ctx.Done():
+		return false, fmt.Errorf("pinset query aborted: %w", ctx.Err())
+	case out <- p:
+		return true, nil
+	}
+}
+
+// querySorted sends the pins selected by the query in the order given by
+// cmp, starting after the query Cursor. Selected pins need to be sorted in
+// memory, but only query.Limit of them are kept when it is set.
+func (st *State) querySorted(ctx context.Context, q api.PinQuery, cmp func(a, b api.Pin) int, out chan<- api.Pin) error {
+	defer close(out)
+
+	less := func(a, b api.Pin) bool {
+		if c := cmp(a, b); c != 0 {
+			return c < 0
+		}
+		return cidToDsKey(a.Cid).String() < cidToDsKey(b.Cid).String()
+	}
+
+	var cursor *api.Pin
+	if q.Cursor.Defined() {
+		p, err := st.Get(ctx, q.Cursor)
+		if err != nil {
+			return fmt.Errorf("error reading cursor %s: %w", q.Cursor, err)
+		}
+		cursor = &p
+	}
+
+	unsorted := q
+	unsorted.Sort = ""
+	unsorted.Limit = 0
+	unsorted.Cursor = api.CidUndef
+
+	pins := make(chan api.Pin, 1024)
+	queryErr := make(chan error, 1)
+	go func() {
+		queryErr <- st.Query(ctx, unsorted, pins)
+	}()
+
+	// A max-heap with the pins to send, so that the last one can be
+	// replaced when a pin going before it is found.
+	h := &pinHeap{less: less}
+	for p := range pins {
+		if cursor != nil && !less(*cursor, p) {
+			continue
+		}
+		if q.Limit > 0 && h.Len() >= q.Limit {
+			if less(p, h.pins[0]) {
+				h.pins[0] = p
+				heap.Fix(h, 0)
+			}
+			continue
+		}
+		heap.Push(h, p)
+	}
+	if err := <-queryErr; err != nil {
+		return err
+	}
+
+	sorted := h.pins
+	sort.Slice(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+	for _, p := range sorted {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("pinset query aborted: %w", ctx.Err())
+		case out <- p:
+		}
+	}
+	return nil
+}
+
+// pinHeap implements heap.Interface with the greatest pin first.
+type pinHeap struct {
+	pins []api.Pin
+	less func(a, b api.Pin) bool
+}
+
+func (h *pinHeap) Len() int           { return len(h.pins) }
+func (h *pinHeap) Less(i, j int) bool { return h.less(h.pins[j], h.pins[i]) }
+func (h *pinHeap) Swap(i, j int)      { h.pins[i], h.pins[j] = h.pins[j], h.pins[i] }
+func (h *pinHeap) Push(x interface{}) { h.pins = append(h.pins, x.(api.Pin)) }
+func (h *pinHeap) Pop() interface{} {
+	p := h.pins[len(h.pins)-1]
+	h.pins = h.pins[:len(h.pins)-1]
+	return p
+}
+
+// queryScan lists the pinset starting after the query Cursor and sends the
+// matching pins on the out channel.
+func (st *State) queryScan(ctx context.Context, q api.PinQuery, match func(api.Pin) bool, out chan<- api.Pin) error {
+	defer close(out)
+
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	statePins := make(chan api.Pin, 1024)
+	listErr := make(chan error, 1)
+	go func() {
+		listErr <- st.ListFrom(listCtx, q.Cursor, statePins)
+	}()
+
+	sent := 0
+	for p := range statePins {
+		if q.Limit > 0 && sent >= q.Limit {
+			// Stop listing and drain.
+			cancel()
+			continue
+		}
+		if !match(p) {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			cancel()
+			continue
+		case out <- p:
+			sent++
+		}
+	}
+
+	err := <-listErr
+	if q.Limit > 0 && sent >= q.Limit && errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,447 @@
+package dsstate
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+	"github.com/lubanproj/ipfs-cluster/datastore/inmem"
+
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+var testPeerID2, _ = peer.Decode("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+var testParentCid, _ = api.DecodeCid("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmme")
+
+func indexTestPins(t *testing.T) []api.Pin {
+	cids := []string{
+		"QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq",
+		"QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmma",
+		"QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmb",
+		"QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmc",
+	}
+	expire := time.Now().Add(time.Hour)
+
+	var pins []api.Pin
+	for i, cStr := range cids {
+		ci, err := api.DecodeCid(cStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := api.PinOptions{
+			ReplicationFactorMin: 1,
+			ReplicationFactorMax: 1,
+			Name:                 []string{"photos-2021", "photos-2022", "videos", ""}[i],
+			Metadata:             map[string]string{"team": []string{"a", "b"}[i%2]},
+		}
+		if i < 2 {
+			opts.ExpireAt = expire.Add(time.Duration(i) * time.Hour)
+		}
+		pin := api.PinWithOpts(ci, opts)
+		pin.Allocations = []peer.ID{[]peer.ID{testPeerID1, testPeerID2}[i%2]}
+		if i%2 == 0 {
+			pin.Parents = []api.Cid{testParentCid}
+		}
+		if i == 3 {
+			pin.ReplicationFactorMin = -1
+			pin.ReplicationFactorMax = -1
+			pin.Allocations = nil
+		}
+		pins = append(pins, pin)
+	}
+	return pins
+}
+
+func indexTestQueries() []api.PinQuery {
+	now := time.Now()
+	return []api.PinQuery{
+		{},
+		{NameRegexp: "^photos-"},
+		{NameRegexp: "^photos-2022$"},
+		{NameRegexp: "^none"},
+		{Metadata: map[string]string{"team": "a"}},
+		{Metadata: map[string]string{"team": "b", "other": "c"}},
+		{ExpireBefore: now.Add(90 * time.Minute)},
+		{ExpireBefore: now.Add(3 * time.Hour)},
+		{Allocation: testPeerID1},
+		{Allocation: testPeerID2, Limit: 1},
+		{Metadata: map[string]string{"team": "a"}, Limit: 1},
+		{Parent: testParentCid},
+		{Sort: api.SortByName},
+		{Sort: "-" + api.SortByExpire, Limit: 3},
+		{Metadata: map[string]string{"team": "a"}, Sort: api.SortByCreated},
+	}
+}
+
+func queryCids(t *testing.T, st *State, q api.PinQuery) []api.Cid {
+	out := make(chan api.Pin, 10)
+	err := st.Query(context.Background(), q, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []api.Cid
+	for p := range out {
+		res = append(res, p.Cid)
+	}
+	return res
+}
+
+// countIndexEntries returns how many index entries exist, without counting
+// the key which records the built indexes nor the lists of entries of
+// every pin.
+func countIndexEntries(t *testing.T, st *State) int {
+	results, err := st.idxRead.Query(context.Background(), query.Query{
+		Prefix:   st.idxNamespace.String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer results.Close()
+	n := 0
+	for r := range results.Next() {
+		if r.Key == st.indexKey(indexesKey).String() ||
+			ds.NewKey(r.Key).IsDescendantOf(st.indexKey(pinEntries)) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func TestQueryIndexes(t *testing.T) {
+	ctx := context.Background()
+	plain := newState(t)
+	indexed := newState(t)
+	err := indexed.EnableIndexes(ctx, AllIndexes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() {
+		t.Helper()
+		for i, q := range indexTestQueries() {
+			exp := queryCids(t, plain, q)
+			res := queryCids(t, indexed, q)
+			if len(exp) != len(res) {
+				t.Fatalf("query %d: expected %d pins, got %d", i, len(exp), len(res))
+			}
+			for j := range exp {
+				if !exp[j].Equals(res[j]) {
+					t.Errorf("query %d: results differ from a full scan", i)
+				}
+			}
+		}
+	}
+
+	pins := indexTestPins(t)
+	for _, p := range pins {
+		plain.Add(ctx, p)
+		indexed.Add(ctx, p)
+	}
+	check()
+
+	if res := queryCids(t, indexed, api.PinQuery{Metadata: map[string]string{"team": "a"}}); len(res) != 2 {
+		t.Errorf("expected 2 pins for team a, got %d", len(res))
+	}
+
+	// Paging with a cursor gives the same results.
+	q := api.PinQuery{Allocation: testPeerID2, Limit: 1}
+	first := queryCids(t, indexed, q)
+	q.Cursor = first[0]
+	second := queryCids(t, indexed, q)
+	if len(second) != 1 || second[0].Equals(first[0]) {
+		t.Error("expected the next pin when using a cursor")
+	}
+
+	// Modify a pin: old entries should be gone.
+	p := pins[0]
+	p.Name = "videos-2021"
+	p.Metadata = map[string]string{"team": "b"}
+	p.ExpireAt = time.Time{}
+	plain.Add(ctx, p)
+	indexed.Add(ctx, p)
+	check()
+
+	// Queries served by an index only look at indexed pins.
+	unindexed := pins[1]
+	unindexed.Cid, _ = api.DecodeCid("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmd")
+	indexed.put(ctx, unindexed)
+	if res := queryCids(t, indexed, api.PinQuery{NameRegexp: "^photos-2022"}); len(res) != 1 {
+		t.Errorf("expected only the indexed pin, got %d pins", len(res))
+	}
+	indexed.rm(ctx, unindexed.Cid)
+
+	for _, p := range pins {
+		plain.Rm(ctx, p.Cid)
+		indexed.Rm(ctx, p.Cid)
+	}
+	check()
+	if n := countIndexEntries(t, indexed); n != 0 {
+		t.Errorf("expected no index entries left, got %d", n)
+	}
+}
+
+func TestQuerySort(t *testing.T) {
+	ctx := context.Background()
+	st := newState(t)
+	pins := indexTestPins(t)
+	for _, p := range pins {
+		st.Add(ctx, p)
+	}
+
+	expect := func(q api.PinQuery, exp ...api.Pin) {
+		t.Helper()
+		res := queryCids(t, st, q)
+		if len(res) != len(exp) {
+			t.Fatalf("%+v: expected %d pins, got %d", q, len(exp), len(res))
+		}
+		for i := range exp {
+			if !res[i].Equals(exp[i].Cid) {
+				t.Errorf("%+v: unexpected pin at position %d", q, i)
+			}
+		}
+	}
+
+	expect(api.PinQuery{Sort: api.SortByName}, pins[3], pins[0], pins[1], pins[2])
+	expect(api.PinQuery{Sort: "-" + api.SortByName, Limit: 2}, pins[2], pins[1])
+	expect(api.PinQuery{Sort: "-" + api.SortByName, Limit: 2, Cursor: pins[1].Cid}, pins[0], pins[3])
+	expect(api.PinQuery{Sort: api.SortByExpire, Limit: 2}, pins[0], pins[1])
+	expect(api.PinQuery{Sort: api.SortByName, NameRegexp: "^photos-"}, pins[0], pins[1])
+
+	out := make(chan api.Pin, 10)
+	if err := st.Query(ctx, api.PinQuery{Sort: "size"}, out); err == nil {
+		t.Error("expected an error for an invalid sort")
+	}
+}
+
+func TestEnableIndexes(t *testing.T) {
+	ctx := context.Background()
+	st := newState(t)
+	for _, p := range indexTestPins(t) {
+		st.Add(ctx, p)
+	}
+	if n := countIndexEntries(t, st); n != 0 {
+		t.Fatal("no index entries expected")
+	}
+
+	err := st.EnableIndexes(ctx, IndexMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countIndexEntries(t, st); n != 4 {
+		t.Errorf("expected 4 metadata entries, got %d", n)
+	}
+	if res := queryCids(t, st, api.PinQuery{Metadata: map[string]string{"team": "b"}}); len(res) != 2 {
+		t.Errorf("expected 2 pins for team b, got %d", len(res))
+	}
+
+	// Enabling the same indexes again does not rebuild them.
+	var rm []ds.Key
+	for k := range st.indexEntries(&indexTestPins(t)[0]) {
+		rm = append(rm, ds.RawKey(k))
+	}
+	st.deleteIndexEntries(ctx, rm)
+	err = st.EnableIndexes(ctx, IndexMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countIndexEntries(t, st); n != 3 {
+		t.Errorf("expected 3 metadata entries, got %d", n)
+	}
+
+	err = st.EnableIndexes(ctx, AllIndexes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 4 metadata, 3 names, 2 expiry, 4 allocations and 2 parents.
+	if n := countIndexEntries(t, st); n != 15 {
+		t.Errorf("expected 15 index entries, got %d", n)
+	}
+
+	// Index entries are not listed as pins.
+	out := make(chan api.Pin, 10)
+	err = st.List(ctx, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range out {
+		n++
+	}
+	if n != 4 {
+		t.Errorf("expected 4 pins, got %d", n)
+	}
+
+	err = st.EnableIndexes(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countIndexEntries(t, st); n != 0 {
+		t.Errorf("expected index entries to be removed, got %d", n)
+	}
+}
+
+func TestBatchingIndexes(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New().(ds.Batching)
+	bst, err := NewBatching(ctx, store, "", DefaultHandle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bst.EnableIndexes(ctx, AllIndexes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pins := indexTestPins(t)
+	for _, p := range pins {
+		bst.Add(ctx, p)
+	}
+	// Modifying a pin in the same batch only indexes the last version.
+	p := pins[0]
+	p.Metadata = map[string]string{"team": "c"}
+	bst.Add(ctx, p)
+	bst.Rm(ctx, pins[1].Cid)
+
+	metaQuery := func(team string) int {
+		return len(queryCids(t, bst.State, api.PinQuery{Metadata: map[string]string{"team": team}}))
+	}
+
+	if metaQuery("c") != 0 {
+		t.Error("nothing should be indexed before committing")
+	}
+
+	err = bst.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metaQuery("a") != 1 || metaQuery("b") != 1 || metaQuery("c") != 1 {
+		t.Error("unexpected indexed metadata after commit")
+	}
+
+	bst.Rm(ctx, pins[0].Cid)
+	err = bst.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metaQuery("c") != 0 {
+		t.Error("removed pin should not be indexed")
+	}
+}
+
+func TestMarshalUnmarshalIndexes(t *testing.T) {
+	ctx := context.Background()
+	st := newState(t)
+	st.EnableIndexes(ctx, AllIndexes)
+	for _, p := range indexTestPins(t) {
+		st.Add(ctx, p)
+	}
+
+	buf := new(bytes.Buffer)
+	err := st.Marshal(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st2 := newState(t)
+	st2.EnableIndexes(ctx, AllIndexes)
+	err = st2.Unmarshal(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countIndexEntries(t, st2); n != countIndexEntries(t, st) {
+		t.Errorf("indexes should be rebuilt on unmarshal, got %d entries", n)
+	}
+	if res := queryCids(t, st2, api.PinQuery{Allocation: testPeerID1}); len(res) != 3 {
+		t.Errorf("expected 3 pins allocated to peer 1, got %d", len(res))
+	}
+}
+
+func TestIndexNamespace(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+	st, err := New(ctx, store, "/pins", DefaultHandle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.EnableIndexes(ctx, AllIndexes)
+	for _, p := range indexTestPins(t) {
+		st.Add(ctx, p)
+	}
+
+	// Nothing but pins is stored in the pinset namespace.
+	results, err := store.Query(ctx, query.Query{Prefix: "/pins", KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := results.Rest()
+	if len(entries) != 4 {
+		t.Errorf("expected 4 keys in the pinset namespace, got %d", len(entries))
+	}
+	if n := countIndexEntries(t, st); n != 15 {
+		t.Errorf("expected 15 index entries, got %d", n)
+	}
+}
+
+func TestSetIndexDatastore(t *testing.T) {
+	ctx := context.Background()
+	st := newState(t)
+	idxStore := inmem.New()
+	st.SetIndexDatastore(idxStore, "/idx")
+	err := st.EnableIndexes(ctx, AllIndexes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pins := indexTestPins(t)
+	for _, p := range pins {
+		st.Add(ctx, p)
+	}
+	if n := countIndexEntries(t, st); n != 0 {
+		t.Errorf("pins should only be indexed by IndexPin, got %d entries", n)
+	}
+
+	for _, p := range pins {
+		if err := st.IndexPin(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countIndexEntries(t, st); n != 15 {
+		t.Errorf("expected 15 index entries, got %d", n)
+	}
+	if res := queryCids(t, st, api.PinQuery{Allocation: testPeerID2}); len(res) != 2 {
+		t.Errorf("expected 2 pins allocated to peer 2, got %d", len(res))
+	}
+
+	for _, p := range pins {
+		st.Rm(ctx, p.Cid)
+		// Names can be obtained until the pin is unindexed.
+		name, err := st.IndexedName(ctx, p.Cid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != p.Name {
+			t.Errorf("expected the indexed name of %s to be %q: %q", p.Cid, p.Name, name)
+		}
+		if err := st.UnindexPin(ctx, p.Cid); err != nil {
+			t.Fatal(err)
+		}
+		name, err = st.IndexedName(ctx, p.Cid)
+		if err != nil || name != "" {
+			t.Errorf("unindexed pins should have no name: %q %v", name, err)
+		}
+	}
+	results, err := idxStore.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := results.Rest()
+	if len(entries) != 1 {
+		t.Errorf("only the built indexes key should be left, got %d keys", len(entries))
+	}
+}
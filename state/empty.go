@@ -13,6 +13,11 @@ func (e *empty) List(ctx context.Context, out chan<- api.Pin) error {
 	return nil
 }
 
+func (e *empty) Query(ctx context.Context, q api.PinQuery, out chan<- api.Pin) error {
+	close(out)
+	return nil
+}
+
 func (e *empty) Has(ctx context.Context, c api.Cid) (bool, error) {
 	return false, nil
 }
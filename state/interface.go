@@ -33,6 +33,10 @@ type State interface {
 type ReadOnly interface {
 	// List lists all the pins in the state.
 	List(context.Context, chan<- api.Pin) error
+	// Query lists the pins in the state selected by the given query, in
+	// a stable order, starting after the query Cursor and honoring the
+	// query Limit.
+	Query(context.Context, api.PinQuery, chan<- api.Pin) error
 	// Has returns true if the state is holding information for a Cid.
 	Has(context.Context, api.Cid) (bool, error)
 	// Get returns the information attacthed to this pin, if any. If the
@@ -17,8 +17,20 @@ var (
 	// Cid resulting from block put using format "v0" defaults
 	Cid5, _        = api.DecodeCid("QmbgmXgsFjxAJ7cEaziL2NDSptHAkPwkEGMmKMpfyYeFXL")
 	Cid5Data       = "Cid5Data"
+	Cid6, _        = api.DecodeCid("bafkreigmkjvbda3bjdnsdq2zs3a5wrcxmvnybdfk7zpoldllyancfbwkse") // raw, served by BlockGet mock
+	Cid6Data       = "Cid6Data"
 	SlowCid1, _    = api.DecodeCid("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmd")
 	CidResolved, _ = api.DecodeCid("zb2rhiKhUepkTMw7oFfBUnChAN7ABAvg2hXUwmTBtZ6yxuabc")
+	// DAGSize is the size reported by the mocks for any dag-pb DAG.
+	DAGSize uint64 = 1024
+	// PinOwner is the API user owning Cid3 in the mocks. It has a quota
+	// of one pin.
+	PinOwner = "TestOwner"
+	// APIKeyID is the ID of the only API key known to the mocks. It
+	// belongs to PinOwner and has the read scope.
+	APIKeyID = "00112233aabbccdd"
+	// APIKeyToken is the token for APIKeyID.
+	APIKeyToken = "ck_00112233aabbccdd_0123456789abcdef"
 	// ErrorCid is meant to be used as a Cid which causes errors. i.e. the
 	// ipfs mock fails when pinning this CID.
 	ErrorCid, _ = api.DecodeCid("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmc")
@@ -103,6 +103,21 @@ type mockBlockPutResp struct {
 	Key string
 }
 
+type mockBlockRmResp struct {
+	Hash  string
+	Error string `json:",omitempty"`
+}
+
+type mockBlockStatResp struct {
+	Key  string
+	Size int
+}
+
+type mockObjectStatResp struct {
+	Hash           string
+	CumulativeSize uint64
+}
+
 type mockRepoGCResp struct {
 	Key   cid.Cid `json:",omitempty"`
 	Error string  `json:",omitempty"`
@@ -431,9 +446,42 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 		}
 		data, ok := m.BlockStore[arg[0]]
 		if !ok {
-			goto ERROR
+			w.WriteHeader(http.StatusInternalServerError)
+			resp := ipfsErr{0, fmt.Sprintf("block was not found locally (offline): ipld: could not find %s", arg[0])}
+			j, _ := json.Marshal(resp)
+			w.Write(j)
+			return
 		}
 		w.Write(data)
+	case "block/rm":
+		query := r.URL.Query()
+		arg, ok := query["arg"]
+		if !ok || len(arg) != 1 {
+			goto ERROR
+		}
+		delete(m.BlockStore, arg[0])
+		j, _ := json.Marshal(mockBlockRmResp{Hash: arg[0]})
+		w.Write(j)
+	case "block/stat":
+		query := r.URL.Query()
+		arg, ok := query["arg"]
+		if !ok || len(arg) != 1 {
+			goto ERROR
+		}
+		data, ok := m.BlockStore[arg[0]]
+		if !ok {
+			goto ERROR
+		}
+		j, _ := json.Marshal(mockBlockStatResp{Key: arg[0], Size: len(data)})
+		w.Write(j)
+	case "object/stat":
+		query := r.URL.Query()
+		arg, ok := query["arg"]
+		if !ok || len(arg) != 1 {
+			goto ERROR
+		}
+		j, _ := json.Marshal(mockObjectStatResp{Hash: arg[0], CumulativeSize: DAGSize})
+		w.Write(j)
 	case "repo/gc":
 		// It assumes `/repo/gc` with parameter `stream-errors=true`
 		enc := json.NewEncoder(w)
@@ -3,6 +3,7 @@ package test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -22,6 +23,9 @@ var (
 	ErrBadCid = errors.New("this is an expected error when using ErrorCid")
 	// ErrLinkNotFound is error returned when no link is found
 	ErrLinkNotFound = errors.New("no link by that name")
+	// ErrAPIKeyInvalid is returned when verifying a token other than
+	// APIKeyToken.
+	ErrAPIKeyInvalid = errors.New("invalid or expired api key")
 )
 
 // NewMockRPCClient creates a mock ipfs-cluster RPC server and returns
@@ -69,6 +73,10 @@ func (mock *mockCluster) Pin(ctx context.Context, in api.Pin, out *api.Pin) erro
 	if in.Cid.Equals(ErrorCid) {
 		return ErrBadCid
 	}
+	// PinOwner has used up their quota with Cid3.
+	if in.Owner == PinOwner && !in.Cid.Equals(Cid3) {
+		return fmt.Errorf("%w: %s cannot own more than 1 pins", api.ErrQuotaExceeded, PinOwner)
+	}
 
 	// a pin is never returned the replications set to 0.
 	if in.ReplicationFactorMin == 0 {
@@ -132,13 +140,127 @@ func (mock *mockCluster) Pins(ctx context.Context, in <-chan struct{}, out chan<
 		ReplicationFactorMax: -1,
 	}
 
+	owned := api.PinWithOpts(Cid3, opts)
+	owned.Owner = PinOwner
+	owned.Size = DAGSize
+
 	out <- api.PinWithOpts(Cid1, opts)
 	out <- api.PinCid(Cid2)
-	out <- api.PinWithOpts(Cid3, opts)
+	out <- owned
+	close(out)
+	return nil
+}
+
+func (mock *mockCluster) ReplicationReport(ctx context.Context, in <-chan struct{}, out chan<- api.ReplicationReport) error {
+	out <- api.ReplicationReport{
+		Cid:                  Cid1,
+		State:                api.ReplicationUnder,
+		ReplicationFactorMin: 2,
+		ReplicationFactorMax: 3,
+		Allocations:          []peer.ID{PeerID1, PeerID2},
+		Healthy:              []peer.ID{PeerID1},
+	}
+	out <- api.ReplicationReport{
+		Cid:                  Cid2,
+		State:                api.ReplicationUnavailable,
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+		Allocations:          []peer.ID{PeerID3},
+	}
 	close(out)
 	return nil
 }
 
+func (mock *mockCluster) Events(ctx context.Context, in <-chan api.EventFilter, out chan<- api.Event) error {
+	defer close(out)
+	filter := <-in
+
+	events := []api.Event{
+		{
+			Type:      api.EventPinsetAdd,
+			Cid:       Cid1,
+			Name:      "test",
+			Peer:      PeerID1,
+			Timestamp: time.Now(),
+		},
+		{
+			Type:      api.EventPinning,
+			Cid:       Cid1,
+			Name:      "test",
+			Peer:      PeerID1,
+			Status:    api.TrackerStatusPinning,
+			Timestamp: time.Now(),
+		},
+		{
+			Type:      api.EventPinned,
+			Cid:       Cid1,
+			Name:      "test",
+			Peer:      PeerID1,
+			Status:    api.TrackerStatusPinned,
+			Timestamp: time.Now(),
+		},
+		{
+			Type:      api.EventError,
+			Cid:       Cid2,
+			Peer:      PeerID1,
+			Status:    api.TrackerStatusPinError,
+			Error:     "error",
+			Timestamp: time.Now(),
+		},
+	}
+
+	for _, ev := range events {
+		if !filter.Match(ev) {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- ev:
+		}
+	}
+	return nil
+}
+
+func (mock *mockCluster) PinsQuery(ctx context.Context, in <-chan api.PinQuery, out chan<- api.Pin) error {
+	defer close(out)
+
+	query := <-in
+	match, err := query.Matcher()
+	if err != nil {
+		return err
+	}
+
+	pins := make(chan api.Pin, 10)
+	mock.Pins(ctx, nil, pins)
+	skip := query.Cursor.Defined()
+	sent := 0
+	for p := range pins {
+		if skip {
+			skip = !p.Cid.Equals(query.Cursor)
+			continue
+		}
+		if query.Limit > 0 && sent >= query.Limit {
+			break
+		}
+		if match(p) {
+			out <- p
+			sent++
+		}
+	}
+	return nil
+}
+
+func (mock *mockCluster) Usage(ctx context.Context, in string, out *api.Usage) error {
+	*out = api.Usage{User: in}
+	if in == PinOwner {
+		out.Pins = 1
+		out.Size = DAGSize
+		out.MaxPins = 1
+	}
+	return nil
+}
+
 func (mock *mockCluster) PinGet(ctx context.Context, in api.Cid, out *api.Pin) error {
 	switch in.String() {
 	case ErrorCid.String():
@@ -147,6 +269,10 @@ func (mock *mockCluster) PinGet(ctx context.Context, in api.Cid, out *api.Pin) e
 		p := api.PinCid(in)
 		p.ReplicationFactorMin = -1
 		p.ReplicationFactorMax = -1
+		if in.Equals(Cid3) {
+			p.Owner = PinOwner
+			p.Size = DAGSize
+		}
 		*out = p
 		return nil
 	case Cid2.String(): // This is a remote pin
@@ -154,12 +280,118 @@ func (mock *mockCluster) PinGet(ctx context.Context, in api.Cid, out *api.Pin) e
 		p.ReplicationFactorMin = 1
 		p.ReplicationFactorMax = 1
 		*out = p
+	case Cid6.String(): // Its block can be retrieved with BlockGet
+		p := api.PinCid(in)
+		p.ReplicationFactorMin = 2
+		p.ReplicationFactorMax = 2
+		p.Allocations = []peer.ID{PeerID1, PeerID2}
+		*out = p
 	default:
 		return state.ErrNotFound
 	}
 	return nil
 }
 
+func (mock *mockCluster) PinParents(ctx context.Context, in api.Cid, out *[]api.Pin) error {
+	var pin api.Pin
+	err := mock.PinGet(ctx, in, &pin)
+	if err != nil {
+		return err
+	}
+	meta := api.PinCid(Cid4)
+	meta.Type = api.MetaType
+	meta.Reference = &Cid5
+	*out = []api.Pin{meta}
+	return nil
+}
+
+func (mock *mockCluster) CollectionCreate(ctx context.Context, in api.Pin, out *api.Pin) error {
+	pin, err := api.CollectionPin(in.Name, in.PinOptions)
+	if err != nil {
+		return err
+	}
+	*out = pin
+	return nil
+}
+
+func (mock *mockCluster) CollectionAdd(ctx context.Context, in api.CollectionMembers, out *[]api.Pin) error {
+	coll, err := api.CollectionCid(in.Name)
+	if err != nil {
+		return err
+	}
+	pins := make([]api.Pin, 0, len(in.Cids))
+	for _, ci := range in.Cids {
+		if ci.Equals(ErrorCid) {
+			return ErrBadCid
+		}
+		pin := api.PinCid(ci)
+		pin.Parents = []api.Cid{coll}
+		pins = append(pins, pin)
+	}
+	*out = pins
+	return nil
+}
+
+func (mock *mockCluster) CollectionRemove(ctx context.Context, in api.CollectionMembers, out *struct{}) error {
+	for _, ci := range in.Cids {
+		if ci.Equals(ErrorCid) {
+			return ErrBadCid
+		}
+	}
+	return nil
+}
+
+func (mock *mockCluster) CollectionStatus(ctx context.Context, in string, out *api.GlobalPinInfo) error {
+	coll, err := api.CollectionCid(in)
+	if err != nil {
+		return err
+	}
+	err = mock.Status(ctx, coll, out)
+	out.Name = in
+	return err
+}
+
+func mockAPIKey() api.APIKey {
+	return api.APIKey{
+		ID:      APIKeyID,
+		User:    PinOwner,
+		Scopes:  []string{api.APIKeyScopeRead},
+		Expiry:  time.Now().Add(time.Hour),
+		Created: time.Now().Add(-time.Hour),
+	}
+}
+
+func (mock *mockCluster) APIKeyCreate(ctx context.Context, in api.APIKey, out *api.APIKey) error {
+	if err := in.Validate(); err != nil {
+		return err
+	}
+	in.ID = APIKeyID
+	in.Created = time.Now()
+	_, in.Secret, _ = api.ParseAPIKeyToken(APIKeyToken)
+	*out = in
+	return nil
+}
+
+func (mock *mockCluster) APIKeys(ctx context.Context, in struct{}, out *[]api.APIKey) error {
+	*out = []api.APIKey{mockAPIKey()}
+	return nil
+}
+
+func (mock *mockCluster) APIKeyRevoke(ctx context.Context, in string, out *struct{}) error {
+	if in != APIKeyID {
+		return errors.New("api key not found")
+	}
+	return nil
+}
+
+func (mock *mockCluster) APIKeyVerify(ctx context.Context, in string, out *api.APIKey) error {
+	if in != APIKeyToken {
+		return ErrAPIKeyInvalid
+	}
+	*out = mockAPIKey()
+	return nil
+}
+
 func (mock *mockCluster) ID(ctx context.Context, in struct{}, out *api.ID) error {
 	//_, pubkey, _ := crypto.GenerateKeyPair(
 	//	DefaultConfigCrypto,
@@ -222,6 +454,71 @@ func (mock *mockCluster) PeerRemove(ctx context.Context, in peer.ID, out *struct
 	return nil
 }
 
+func (mock *mockCluster) PeerDrain(ctx context.Context, in api.DrainStatus, out *api.DrainStatus) error {
+	*out = api.DrainStatus{
+		Peer:        in.Peer,
+		Coordinator: PeerID1,
+		Remove:      in.Remove,
+		Phase:       api.DrainPhaseDraining,
+		Started:     time.Now(),
+	}
+	return nil
+}
+
+func (mock *mockCluster) PeerDrainStatus(ctx context.Context, in peer.ID, out *api.DrainStatus) error {
+	*out = api.DrainStatus{
+		Peer:        in,
+		Coordinator: PeerID1,
+		Phase:       api.DrainPhaseDraining,
+		Started:     time.Now().Add(-time.Minute),
+		Pins:        3,
+		Moved:       1,
+		Moving:      Cid1,
+	}
+	return nil
+}
+
+func (mock *mockCluster) PeerDrainCancel(ctx context.Context, in peer.ID, out *api.DrainStatus) error {
+	*out = api.DrainStatus{
+		Peer:        in,
+		Coordinator: PeerID1,
+		Phase:       api.DrainPhaseCancelled,
+		Started:     time.Now().Add(-time.Minute),
+		Finished:    time.Now(),
+	}
+	return nil
+}
+
+func (mock *mockCluster) MaintenanceStart(ctx context.Context, in time.Duration, out *api.MaintenanceStatus) error {
+	if in == 0 {
+		in = time.Hour
+	}
+	*out = api.MaintenanceStatus{
+		Peer:    PeerID1,
+		Enabled: true,
+		Started: time.Now(),
+		Until:   time.Now().Add(in),
+	}
+	return nil
+}
+
+func (mock *mockCluster) MaintenanceStop(ctx context.Context, in struct{}, out *api.MaintenanceStatus) error {
+	*out = api.MaintenanceStatus{
+		Peer: PeerID1,
+	}
+	return nil
+}
+
+func (mock *mockCluster) PeerMaintenanceStatus(ctx context.Context, in peer.ID, out *api.MaintenanceStatus) error {
+	*out = api.MaintenanceStatus{
+		Peer:    in,
+		Enabled: true,
+		Started: time.Now().Add(-time.Minute),
+		Until:   time.Now().Add(time.Hour),
+	}
+	return nil
+}
+
 func (mock *mockCluster) ConnectGraph(ctx context.Context, in struct{}, out *api.ConnectGraph) error {
 	*out = api.ConnectGraph{
 		ClusterID: PeerID1,
@@ -358,6 +655,38 @@ func (mock *mockCluster) RecoverLocal(ctx context.Context, in api.Cid, out *api.
 	return (&mockPinTracker{}).Recover(ctx, in, out)
 }
 
+func (mock *mockCluster) Verify(ctx context.Context, in api.Cid, out *api.GlobalPinInfo) error {
+	return mock.Status(ctx, in, out)
+}
+
+func (mock *mockCluster) VerifyLocal(ctx context.Context, in api.Cid, out *api.PinInfo) error {
+	return (&mockPinTracker{}).Verify(ctx, in, out)
+}
+
+func (mock *mockCluster) AllocationPreview(ctx context.Context, in api.Pin, out *api.AllocationPreview) error {
+	*out = api.AllocationPreview{
+		Cid:                  in.Cid,
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+		Allocations:          []peer.ID{PeerID1},
+		Peers: []api.AllocationPeerReport{
+			{
+				Peer:   PeerID1,
+				Group:  api.AllocationGroupCandidate,
+				Rank:   1,
+				Chosen: true,
+				Reason: "chosen by the allocator with rank 1",
+			},
+			{
+				Peer:   PeerID2,
+				Group:  api.AllocationGroupExcluded,
+				Reason: "missing metrics: freespace",
+			},
+		},
+	}
+	return nil
+}
+
 func (mock *mockCluster) BlockAllocate(ctx context.Context, in api.Pin, out *[]peer.ID) error {
 	if in.ReplicationFactorMin > 1 {
 		return errors.New("replMin too high: can only mock-allocate to 1")
@@ -422,6 +751,19 @@ func (mock *mockCluster) Alerts(ctx context.Context, in struct{}, out *[]api.Ale
 	return nil
 }
 
+func (mock *mockCluster) RebalanceStatus(ctx context.Context, in struct{}, out *api.RebalanceStatus) error {
+	*out = api.RebalanceStatus{
+		Peer:      PeerID1,
+		Enabled:   true,
+		LastRun:   time.Now().Add(-time.Minute),
+		NextRun:   time.Now().Add(time.Minute),
+		Pending:   2,
+		Migrating: Cid1,
+		Migrated:  1,
+	}
+	return nil
+}
+
 func (mock *mockCluster) IPFSID(ctx context.Context, in peer.ID, out *api.IPFSID) error {
 	var id api.ID
 	_ = mock.ID(ctx, struct{}{}, &id)
@@ -485,6 +827,19 @@ func (mock *mockPinTracker) Status(ctx context.Context, in api.Cid, out *api.Pin
 	return nil
 }
 
+func (mock *mockPinTracker) StatusCids(ctx context.Context, in <-chan api.Cid, out chan<- api.PinInfo) error {
+	defer close(out)
+	for ci := range in {
+		var pinfo api.PinInfo
+		err := mock.Status(ctx, ci, &pinfo)
+		if err != nil {
+			return err
+		}
+		out <- pinfo
+	}
+	return nil
+}
+
 func (mock *mockPinTracker) RecoverAll(ctx context.Context, in <-chan struct{}, out chan<- api.PinInfo) error {
 	close(out)
 	return nil
@@ -502,6 +857,18 @@ func (mock *mockPinTracker) Recover(ctx context.Context, in api.Cid, out *api.Pi
 	return nil
 }
 
+func (mock *mockPinTracker) Verify(ctx context.Context, in api.Cid, out *api.PinInfo) error {
+	*out = api.PinInfo{
+		Cid:  in,
+		Peer: PeerID1,
+		PinInfoShort: api.PinInfoShort{
+			Status: api.TrackerStatusPinned,
+			TS:     time.Now(),
+		},
+	}
+	return nil
+}
+
 func (mock *mockPinTracker) PinQueueSize(ctx context.Context, in struct{}, out *int64) error {
 	*out = 10
 	return nil
@@ -530,6 +897,10 @@ func (mock *mockPeerMonitor) MetricNames(ctx context.Context, in struct{}, out *
 	return nil
 }
 
+func (mock *mockPeerMonitor) SendAlert(ctx context.Context, in api.Alert, out *struct{}) error {
+	return nil
+}
+
 /* IPFSConnector methods */
 
 func (mock *mockIPFSConnector) Pin(ctx context.Context, in api.Pin, out *struct{}) error {
@@ -594,6 +965,28 @@ func (mock *mockIPFSConnector) BlockStream(ctx context.Context, in <-chan api.No
 	return nil
 }
 
+func (mock *mockIPFSConnector) BlockGet(ctx context.Context, in api.Cid, out *[]byte) error {
+	switch in.String() {
+	case Cid6.String():
+		*out = []byte(Cid6Data)
+		return nil
+	default:
+		return errors.New("block not found")
+	}
+}
+
+func (mock *mockIPFSConnector) BlockRm(ctx context.Context, in api.Cid, out *struct{}) error {
+	return nil
+}
+
+func (mock *mockIPFSConnector) VerifyDAG(ctx context.Context, in api.Pin, out *api.IPFSVerification) error {
+	*out = api.IPFSVerification{
+		Cid:    in.Cid,
+		Blocks: 1,
+	}
+	return nil
+}
+
 func (mock *mockIPFSConnector) Resolve(ctx context.Context, in string, out *api.Cid) error {
 	switch in {
 	case ErrorCid.String(), "/ipfs/" + ErrorCid.String():
@@ -0,0 +1,213 @@
+package ipfscluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lubanproj/ipfs-cluster/api"
+
+	"go.opencensus.io/trace"
+)
+
+// This file contains the accounting of the pins owned by API users. Every
+// peer keeps per-owner counters, which are loaded from the shared state
+// when first needed, updated when pinning and unpinning through this peer
+// and recounted on every StateSync. Changes made by other peers are thus
+// only counted after the next StateSync.
+
+// ownedPinTypes are the pin types accounted to their owners. Shards and
+// cluster DAGs are accounted through their meta pin.
+const ownedPinTypes = api.DataType | api.MetaType
+
+// ownerUsage counts the pins owned by an API user.
+type ownerUsage struct {
+	pins int
+	size uint64
+}
+
+// isOwned returns true when the pin counts towards the usage of its owner.
+func isOwned(pin api.Pin) bool {
+	return pin.Owner != "" && pin.Type&ownedPinTypes != 0
+}
+
+// Usage returns the number and total size of the pins owned by the given
+// API user, along with their quota.
+func (c *Cluster) Usage(ctx context.Context, user string) (api.Usage, error) {
+	_, span := trace.StartSpan(ctx, "cluster/Usage")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	c.usageMux.Lock()
+	defer c.usageMux.Unlock()
+
+	if err := c.loadUsage(ctx); err != nil {
+		return api.Usage{}, err
+	}
+	u := c.usage[user]
+	quota := c.config.Quotas[user]
+	return api.Usage{
+		User:    user,
+		Pins:    u.pins,
+		Size:    u.size,
+		MaxPins: quota.MaxPins,
+		MaxSize: quota.MaxSize,
+	}, nil
+}
+
+// loadUsage counts the usage of every owner from the shared state unless
+// already done. It must be called with the usageMux held.
+func (c *Cluster) loadUsage(ctx context.Context) error {
+	if c.usage != nil {
+		return nil
+	}
+
+	out := make(chan api.Pin, 1024)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.PinsQuery(ctx, api.PinQuery{Type: ownedPinTypes}, out)
+	}()
+
+	usage := make(map[string]ownerUsage)
+	for pin := range out {
+		countUsage(usage, pin)
+	}
+	if err := <-errCh; err != nil {
+		return err
+	}
+	c.usage = usage
+	return nil
+}
+
+// countUsage adds the pin to the usage of its owner, if it has one.
+func countUsage(usage map[string]ownerUsage, pin api.Pin) {
+	if !isOwned(pin) {
+		return
+	}
+	u := usage[pin.Owner]
+	u.pins++
+	u.size += pin.Size
+	usage[pin.Owner] = u
+}
+
+// uncountUsage removes the pin from the usage of its owner, if it has one.
+func uncountUsage(usage map[string]ownerUsage, pin api.Pin) {
+	if !isOwned(pin) {
+		return
+	}
+	u, ok := usage[pin.Owner]
+	if !ok {
+		return
+	}
+	u.pins--
+	if pin.Size < u.size {
+		u.size -= pin.Size
+	} else {
+		u.size = 0
+	}
+	if u.pins <= 0 {
+		delete(usage, pin.Owner)
+		return
+	}
+	usage[pin.Owner] = u
+}
+
+// setUsage replaces the usage counters with the given ones.
+func (c *Cluster) setUsage(usage map[string]ownerUsage) {
+	c.usageMux.Lock()
+	defer c.usageMux.Unlock()
+	c.usage = usage
+}
+
+// hasSizeQuota returns true when the given user has a quota on the size of
+// the content they own. The size of pins is only obtained for them.
+func (c *Cluster) hasSizeQuota(user string) bool {
+	return user != "" && c.config.Quotas[user].MaxSize > 0
+}
+
+// reserveUsage counts a pin towards the usage of its owner in place of the
+// existing pin for the same CID, failing with ErrQuotaExceeded when the
+// owner cannot own it. Checking and counting happen atomically, so
+// concurrent requests cannot exceed the quota through this peer. Pins
+// whose size is not known are only rejected once the size quota is used
+// up.
+func (c *Cluster) reserveUsage(ctx context.Context, pin, existing api.Pin) error {
+	c.usageMux.Lock()
+	defer c.usageMux.Unlock()
+
+	if err := c.loadUsage(ctx); err != nil {
+		return err
+	}
+
+	uncountUsage(c.usage, existing)
+	if err := c.checkQuota(pin); err != nil {
+		countUsage(c.usage, existing)
+		return err
+	}
+	countUsage(c.usage, pin)
+	return nil
+}
+
+// checkQuota returns ErrQuotaExceeded when the owner of the pin cannot own
+// it on top of their current usage. It must be called with the usageMux
+// held.
+func (c *Cluster) checkQuota(pin api.Pin) error {
+	if !isOwned(pin) {
+		return nil
+	}
+	u := c.usage[pin.Owner]
+	quota := c.config.Quotas[pin.Owner]
+	if quota.MaxPins > 0 && u.pins >= quota.MaxPins {
+		return fmt.Errorf("%w: %s cannot own more than %d pins", api.ErrQuotaExceeded, pin.Owner, quota.MaxPins)
+	}
+	if quota.MaxSize > 0 && (u.size+pin.Size > quota.MaxSize || (pin.Size == 0 && u.size >= quota.MaxSize)) {
+		return fmt.Errorf("%w: %s cannot own more than %d bytes", api.ErrQuotaExceeded, pin.Owner, quota.MaxSize)
+	}
+	return nil
+}
+
+// releaseUsage counts the existing pin for a CID back in place of the given
+// one, which is no longer counted. An empty existing pin just removes the
+// given one from the usage of its owner.
+func (c *Cluster) releaseUsage(pin, existing api.Pin) {
+	if !isOwned(pin) && !isOwned(existing) {
+		return
+	}
+
+	c.usageMux.Lock()
+	defer c.usageMux.Unlock()
+
+	// Not loaded yet: the pins will be counted when loading.
+	if c.usage == nil {
+		return
+	}
+	uncountUsage(c.usage, pin)
+	countUsage(c.usage, existing)
+}
+
+// logPin commits the pin to the shared state. Owned items are counted
+// towards the usage of their owner in place of the existing pin, failing
+// if that would exceed their quota.
+func (c *Cluster) logPin(ctx context.Context, pin, existing api.Pin) error {
+	if !isOwned(pin) && !isOwned(existing) {
+		return c.consensus.LogPin(ctx, pin)
+	}
+
+	if err := c.reserveUsage(ctx, pin, existing); err != nil {
+		return err
+	}
+	err := c.consensus.LogPin(ctx, pin)
+	if err != nil {
+		c.releaseUsage(pin, existing)
+	}
+	return err
+}
+
+// logUnpin removes the pin from the shared state and from the usage of its
+// owner.
+func (c *Cluster) logUnpin(ctx context.Context, pin api.Pin) error {
+	err := c.consensus.LogUnpin(ctx, pin)
+	if err == nil {
+		c.releaseUsage(pin, api.Pin{})
+	}
+	return err
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 
 	blake2b "golang.org/x/crypto/blake2b"
 
@@ -70,6 +71,15 @@ func containsPeer(list []peer.ID, peer peer.ID) bool {
 	return false
 }
 
+func containsString(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
 func minInt(x, y int) int {
 	if x < y {
 		return x
@@ -161,6 +171,47 @@ func peersSubtract(a []peer.ID, b []peer.ID) []peer.ID {
 	return result
 }
 
+// cidLocks provides a mutex per Cid, so that read-modify-write updates of
+// the same pin are serialized. Mutexes are dropped once nobody holds them.
+// They are local to the peer: updates made by other peers are not
+// serialized.
+type cidLocks struct {
+	mux   sync.Mutex
+	locks map[api.Cid]*cidLock
+}
+
+type cidLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the mutex for the given Cid and returns the function that
+// unlocks it.
+func (cl *cidLocks) lock(ci api.Cid) func() {
+	cl.mux.Lock()
+	if cl.locks == nil {
+		cl.locks = make(map[api.Cid]*cidLock)
+	}
+	l, ok := cl.locks[ci]
+	if !ok {
+		l = &cidLock{}
+		cl.locks[ci] = l
+	}
+	l.refs++
+	cl.mux.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		cl.mux.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(cl.locks, ci)
+		}
+		cl.mux.Unlock()
+	}
+}
+
 // pingValue describes the value carried by ping metrics
 type pingValue struct {
 	Peername      string          `json:"peer_name,omitempty"`